@@ -6,14 +6,24 @@ package config
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
 	"unicode"
 
 	"github.com/alecthomas/kingpin"
 	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -22,64 +32,307 @@ var (
 	Version = "unknown"
 )
 
+// Values of OutputLayout
+const (
+	OutputLayoutPerNamespace = "per-namespace"
+	OutputLayoutSingle       = "single"
+)
+
+// Values of ContainerRuntime, auto reads both log formats
+const (
+	ContainerRuntimeAuto       = "auto"
+	ContainerRuntimeDocker     = "docker"
+	ContainerRuntimeContainerd = "containerd"
+	ContainerRuntimeCRIO       = "crio"
+)
+
+// Values of LogFormat
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Values of StatusFormat
+const (
+	StatusFormatText = "text"
+	StatusFormatJSON = "json"
+)
+
+// Values of Command
+const (
+	CommandRun      = "run"
+	CommandValidate = "validate"
+)
+
+// Values of AdminConfigPosition
+const (
+	AdminConfigPrepend = "prepend"
+	AdminConfigAppend  = "append"
+	AdminConfigBoth    = "both"
+)
+
+// MetadataFieldNames are the fields of the Kubernetes metadata of a record that MetadataFields may keep
+var MetadataFieldNames = []string{
+	"annotations",
+	"container_image",
+	"container_image_id",
+	"container_name",
+	"host",
+	"labels",
+	"namespace_annotations",
+	"namespace_labels",
+	"namespace_name",
+	"owner_kind",
+	"owner_name",
+	"pod_id",
+	"pod_ip",
+	"pod_name",
+}
+
+// LintOff is the value of LintLevel turning the lint pass off, the other values are the fluentd.Lint* severities
+const LintOff = "off"
+
 // Config is a project-wide configuration
 type Config struct {
-	Master                 string
-	KubeConfig             string
-	FluentdRPCPort         int
-	TemplatesDir           string
-	OutputDir              string
+	Master              string
+	KubeConfig          string
+	ConfigKubeConfig    string
+	ConfigKubeContext   string
+	FluentdRPCPort      int
+	TemplatesDir        string
+	OutputDir           string
+	OutputLayout        string
+	ContainerRuntime    string
+	AdminConfigPosition string
+	IsolateNamespaces   bool
+	LintLevel           string
+	LintDisabledRules   []string
+	// the subcommand, run unless given
+	Command                string
+	ValidateFile           string
+	ValidateNamespace      string
+	ValidateAdminFile      string
+	ValidateLabels         map[string]string
+	RoutingGraph           string
+	RoutingGraphFormat     string
 	LogLevel               string
+	LogFormat              string
 	FluentdLogLevel        string
 	BufferMountFolder      string
 	AnnotConfigmapName     string
+	AnnotConfigKey         string
 	AnnotStatus            string
+	StatusFormat           string
+	EmitEvents             bool
+	AnnotFlushThreads      string
+	AnnotFanOut            string
+	AnnotDisabled          string
+	AnnotIgnore            string
+	AnnotParser            string
+	AnnotExclude           string
+	AnnotKeepTimeFormat    string
+	AnnotProject           string
+	AnnotSources           string
+	AnnotBufferProfile     string
+	PodConfigAnnotation    string
 	DefaultConfigmapName   string
 	IntervalSeconds        int
 	Datasource             string
 	CRDMigrationMode       bool
+	CRDFetchTimeoutSeconds int
+	CRDFetchRetries        int
+	CentralNamespace       string
 	FsDatasourceDir        string
+	FileDatasourceDir      string
+	GitURL                 string
+	GitBranch              string
+	GitPath                string
+	GitDir                 string
+	GitPollInterval        time.Duration
+	GitSSHKeyFile          string
+	GitKnownHostsFile      string
+	GitTokenFile           string
 	AllowFile              bool
 	ID                     string
 	FluentdValidateCommand string
+	ValidationConcurrency  int
+	ValidationCacheSize    int
+	FetchConcurrency       int
+	PerNamespaceTimeout    time.Duration
 	MetaKey                string
 	MetaValues             string
 	LabelSelector          string
 	KubeletRoot            string
+	DisablePods            bool
+	PodLabelSelector       string
+	PodFieldSelector       string
 	Namespaces             []string
+	NamespaceSelector      string
+	ExcludeNamespaces      []string
+	NamespacePriority      []string
+	SingleNamespace        string
 	PrometheusEnabled      bool
+	EnablePrometheusFilter bool
 	MetricsPort            int
+	FluentdMonitorAddr     string
+	FluentdMonitorInterval int
+	PerNamespaceMetrics    bool
 	AllowTagExpansion      bool
+	WarnUnroutedTags       bool
+	WarnDuplicateRouting   bool
+	StrictTagIsolation     bool
+	LogConfigDiffs         bool
 	AdminNamespace         string
+	AllowedTailPaths       []string
+	AllowedPlugins         []string
+	DeniedPlugins          []string
+	MetadataFields         []string
+	ValidateSecretRefs     bool
+	SecretMountRoot        string
+	AllowedProjects        []string
+	ReservedTagPrefixes    []string
+	OutputHostOverride     string
+	StatusSummaryConfigMap string
+	RuntimeConfigMap       string
+	RuntimeConfigDir       string
+	SnippetsNamespace      string
+	GlobalConfig           string
+	FluentGemCommand       string
+	ExpectedPlugins        map[string]string
+	NamespaceSources       map[string]string
+	DefaultOutput          string
+	LabelRoutes            []string
+	AggregatorLabel        string
+	Aggregators            map[string]string
+	DefaultAggregator      string
+	ConfigChecksum         bool
+	RequiredAnnotations    []string
+	TemplateEnv            []string
+	StrictTemplating       bool
+	StrictMode             bool
+	DryRun                 bool
+	RunOnce                bool
+	MaxNamespaces          int
+	NewNamespaceGrace      time.Duration
+	ResyncPeriod           time.Duration
+	BufferDrainTimeout     time.Duration
+	ReloadDebounce         time.Duration
+	ReloadDebounceMaxWait  time.Duration
+	MaxReloadsPerMinute    int
+	MaxFlushThreads        int
+	MaxOutputsPerNamespace int
+	MaxConfigBytes         int
+	MaxRulesPerNamespace   int
+	FluentdWorkers         int
+	DefaultRetryMaxTimes   int
+	MaxRetryMaxTimes       int
+	DefaultRetryWait       string
+	MinRetryWait           string
+	DefaultRetryTimeout    string
+	MaxRetryTimeout        string
+	DefaultTimeFormat      string
+	DefaultTimezone        string
+	DeadLetterPlugin       string
+	QuarantinePlugin       string
+	WebhookAddr            string
+	RollbackAddr           string
+	DryValidateAddr        string
+	DebugConfigAddr        string
+	HealthAddr             string
+	HealthStaleAfter       time.Duration
+	GRPCAddr               string
+	LeaderElection         bool
+	LeaderElectionLease    string
+	// empty for the admin namespace
+	LeaderElectionNamespace string
+	LastGoodDir             string
+	OTLPEndpoint            string
+	WebhookCertFile         string
+	WebhookKeyFile          string
+	HTTPCertFile            string
+	HTTPKeyFile             string
+	HTTPTokenFile           string
+	HTTPTokenReview         bool
+	HTTPAllowedUsers        []string
+	HTTPTokenAudiences      []string
+	HTTPAuthProbes          bool
 	// parsed or processed/cached fields
-	level               logrus.Level
-	ParsedMetaValues    map[string]string
-	ParsedLabelSelector labels.Set
-	ExecTimeoutSeconds  int
+	level                  logrus.Level
+	ParsedMetaValues       map[string]string
+	ParsedTemplateEnv      map[string]string
+	ParsedNamespaceSources map[string]string
+	ParsedDefaultOutput    string
+	LabelRoutingRules      []LabelRoutingRule // in --label-route order, the first matching rule wins
+	ParsedLabelSelector    labels.Set
+	// nil without --namespace-selector
+	ParsedNamespaceSelector labels.Selector
+	ExecTimeoutSeconds      int
+	// the *Config in effect once a runtime config is applied, shared by the copies of the config
+	current *atomic.Value
 }
 
 var defaultConfig = &Config{
-	Master:               "",
-	KubeConfig:           "",
-	FluentdRPCPort:       24444,
-	TemplatesDir:         "/templates",
-	OutputDir:            "/fluentd/etc",
-	Datasource:           "default",
-	LogLevel:             logrus.InfoLevel.String(),
-	FluentdLogLevel:      "info",
-	BufferMountFolder:    "",
-	AnnotConfigmapName:   "logging.csp.vmware.com/fluentd-configmap",
-	AnnotStatus:          "logging.csp.vmware.com/fluentd-status",
-	DefaultConfigmapName: "fluentd-config",
-	KubeletRoot:          "/var/lib/kubelet/",
-	IntervalSeconds:      60,
-	ID:                   "default",
-	PrometheusEnabled:    false,
-	MetricsPort:          9000,
-	AdminNamespace:       "kube-system",
-	ExecTimeoutSeconds:   30,
+	Master:                 "",
+	KubeConfig:             "",
+	FluentdRPCPort:         24444,
+	TemplatesDir:           "/templates",
+	OutputDir:              "/fluentd/etc",
+	Datasource:             "default",
+	GitPollInterval:        time.Minute,
+	LogLevel:               logrus.InfoLevel.String(),
+	LogFormat:              LogFormatText,
+	FluentdLogLevel:        "info",
+	BufferMountFolder:      "",
+	AnnotConfigmapName:     "logging.csp.vmware.com/fluentd-configmap",
+	AnnotConfigKey:         "logging.csp.vmware.com/fluentd-config-key",
+	AnnotStatus:            "logging.csp.vmware.com/fluentd-status",
+	AnnotFlushThreads:      "logging.csp.vmware.com/fluentd-max-flush-threads",
+	AnnotFanOut:            "logging.csp.vmware.com/also-send-to",
+	AnnotDisabled:          "logging.csp.vmware.com/logging-disabled",
+	AnnotIgnore:            "logging.csp.vmware.com/ignore",
+	AnnotParser:            "logging.csp.vmware.com/parser",
+	AnnotExclude:           "logging.csp.vmware.com/exclude",
+	AnnotKeepTimeFormat:    "logging.csp.vmware.com/keep-time-format",
+	AnnotProject:           "logging.csp.vmware.com/project",
+	AnnotSources:           "logging.csp.vmware.com/sources",
+	AnnotBufferProfile:     "logging.csp.vmware.com/buffer-profile",
+	DefaultConfigmapName:   "fluentd-config",
+	KubeletRoot:            "/var/lib/kubelet/",
+	IntervalSeconds:        60,
+	ID:                     "default",
+	PrometheusEnabled:      false,
+	MetricsPort:            9000,
+	HealthStaleAfter:       10 * time.Minute,
+	FluentdMonitorInterval: 30,
+	AdminNamespace:         "kube-system",
+	ExecTimeoutSeconds:     30,
+	CRDFetchTimeoutSeconds: 10,
+	CRDFetchRetries:        3,
+	LeaderElectionLease:    "kube-fluentd-operator",
+	ReloadDebounce:         5 * time.Second,
+	ReloadDebounceMaxWait:  30 * time.Second,
+	ValidationConcurrency:  1,
+	ValidationCacheSize:    1000,
+	FetchConcurrency:       8,
+	SecretMountRoot:        "/etc/fluentd/secrets",
+	ReservedTagPrefixes:    []string{"fluent", "kubernetes", "kube", "systemd"},
 }
 
+// isLoopback tells if host, from a listen address, accepts only local connections
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// defaultHTTPTokenAudience is the audience of the tokens accepted by --http-token-review
+const defaultHTTPTokenAudience = "kube-fluentd-operator"
+
+// workloadKindEnv is set by the Helm chart to the kind of the workload running the reloader
+const workloadKindEnv = "KFO_WORKLOAD_KIND"
+
 var reValidID = regexp.MustCompile("([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]")
 var reValidAnnotationName = regexp.MustCompile("^([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]+.*$")
 
@@ -87,6 +340,14 @@ func (cfg *Config) GetLogLevel() logrus.Level {
 	return cfg.level
 }
 
+// GetLogFormatter returns the logrus formatter for --log-format
+func (cfg *Config) GetLogFormatter() logrus.Formatter {
+	if cfg.LogFormat == LogFormatJSON {
+		return &logrus.JSONFormatter{}
+	}
+	return &logrus.TextFormatter{}
+}
+
 // Validate performs validation on the Config object
 // nolint:gocognit
 func (cfg *Config) Validate() error {
@@ -99,6 +360,58 @@ func (cfg *Config) Validate() error {
 		cfg.IntervalSeconds = 30
 	}
 
+	if cfg.CRDFetchTimeoutSeconds <= 0 {
+		cfg.CRDFetchTimeoutSeconds = defaultConfig.CRDFetchTimeoutSeconds
+	}
+
+	if cfg.MaxNamespaces < 0 {
+		cfg.MaxNamespaces = 0
+	}
+
+	if cfg.ValidationConcurrency < 1 {
+		cfg.ValidationConcurrency = defaultConfig.ValidationConcurrency
+	}
+
+	if cfg.ValidationCacheSize < 0 {
+		cfg.ValidationCacheSize = 0
+	}
+
+	if cfg.FetchConcurrency < 1 {
+		cfg.FetchConcurrency = defaultConfig.FetchConcurrency
+	}
+
+	if cfg.MaxFlushThreads < 0 {
+		cfg.MaxFlushThreads = 0
+	}
+
+	if cfg.MaxOutputsPerNamespace < 0 {
+		cfg.MaxOutputsPerNamespace = 0
+	}
+
+	if cfg.MaxConfigBytes < 0 {
+		cfg.MaxConfigBytes = 0
+	}
+
+	if cfg.MaxRulesPerNamespace < 0 {
+		cfg.MaxRulesPerNamespace = 0
+	}
+
+	if cfg.FluentdWorkers < 0 {
+		cfg.FluentdWorkers = 0
+	}
+
+	if cfg.DefaultRetryMaxTimes < 0 {
+		cfg.DefaultRetryMaxTimes = 0
+	}
+
+	if cfg.MaxRetryMaxTimes < 0 {
+		cfg.MaxRetryMaxTimes = 0
+	}
+
+	if cfg.CRDFetchRetries < 0 {
+		cfg.CRDFetchRetries = 0
+	}
+
 	ll, err := logrus.ParseLevel(cfg.LogLevel)
 	if err != nil {
 		return fmt.Errorf("failed to parse log level: %+v", err)
@@ -123,11 +436,258 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("invalid fluentd buffer mount folder: %v%v", "/var/log/", cfg.BufferMountFolder)
 	}
 
+	// this can be empty
+	if cfg.AnnotConfigKey != "" && !reValidAnnotationName.MatchString(cfg.AnnotConfigKey) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotConfigKey)
+	}
+
 	// this can be empty
 	if cfg.AnnotStatus != "" && !reValidAnnotationName.MatchString(cfg.AnnotStatus) {
 		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotStatus)
 	}
 
+	// this can be empty
+	if cfg.AnnotFlushThreads != "" && !reValidAnnotationName.MatchString(cfg.AnnotFlushThreads) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotFlushThreads)
+	}
+
+	// this can be empty
+	if cfg.AnnotFanOut != "" && !reValidAnnotationName.MatchString(cfg.AnnotFanOut) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotFanOut)
+	}
+
+	// this can be empty
+	if cfg.AnnotDisabled != "" && !reValidAnnotationName.MatchString(cfg.AnnotDisabled) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotDisabled)
+	}
+
+	// this can be empty
+	if cfg.AnnotIgnore != "" && !reValidAnnotationName.MatchString(cfg.AnnotIgnore) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotIgnore)
+	}
+
+	// this can be empty
+	if cfg.AnnotParser != "" && !reValidAnnotationName.MatchString(cfg.AnnotParser) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotParser)
+	}
+
+	// this can be empty
+	if cfg.AnnotExclude != "" && !reValidAnnotationName.MatchString(cfg.AnnotExclude) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotExclude)
+	}
+
+	// this can be empty
+	if cfg.AnnotKeepTimeFormat != "" && !reValidAnnotationName.MatchString(cfg.AnnotKeepTimeFormat) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotKeepTimeFormat)
+	}
+
+	if len(cfg.AllowedProjects) > 0 && (cfg.AnnotProject == "" || !reValidAnnotationName.MatchString(cfg.AnnotProject)) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotProject)
+	}
+
+	prefixes := []string{}
+	for _, p := range cfg.ReservedTagPrefixes {
+		p = strings.Trim(strings.TrimSpace(p), ".")
+		if p == "" {
+			continue
+		}
+		if strings.ContainsAny(p, "*{} ") {
+			return fmt.Errorf("invalid reserved tag prefix: '%s'", p)
+		}
+		prefixes = append(prefixes, p)
+	}
+	cfg.ReservedTagPrefixes = prefixes
+
+	if err := cfg.validateRetryPolicy(); err != nil {
+		return err
+	}
+
+	if err := cfg.validateTimeFormat(); err != nil {
+		return err
+	}
+
+	if cfg.PodConfigAnnotation != "" {
+		if !reValidAnnotationName.MatchString(cfg.PodConfigAnnotation) {
+			return fmt.Errorf("invalid annotation name: '%s'", cfg.PodConfigAnnotation)
+		}
+		if cfg.DisablePods {
+			return errors.New("using --pod-config-annotation requires watching pods, it cannot be used with --disable-pods")
+		}
+	}
+
+	if cfg.SingleNamespace != "" && len(cfg.Namespaces) > 0 {
+		return errors.New("--single-namespace cannot be used with --namespaces")
+	}
+
+	if cfg.GRPCAddr != "" {
+		host, _, err := net.SplitHostPort(cfg.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("invalid --grpc-addr '%s', expected host:port", cfg.GRPCAddr)
+		}
+		// the states of all namespaces would be open to every pod of the cluster
+		if !isLoopback(host) && cfg.HTTPTokenFile == "" && !cfg.HTTPTokenReview {
+			return fmt.Errorf("--grpc-addr '%s' is not a loopback address, it needs --http-token-file or --http-token-review", cfg.GRPCAddr)
+		}
+	}
+
+	if cfg.ReloadDebounce < 0 {
+		return errors.New("--reload-debounce cannot be negative")
+	}
+	if cfg.ReloadDebounce > 0 && cfg.ReloadDebounceMaxWait < cfg.ReloadDebounce {
+		return fmt.Errorf("--reload-debounce-max-wait must be at least --reload-debounce (%v)", cfg.ReloadDebounce)
+	}
+
+	if cfg.MaxReloadsPerMinute < 0 {
+		return errors.New("--max-reloads-per-minute cannot be negative")
+	}
+
+	if cfg.SnippetsNamespace != "" && (cfg.Datasource == "fs" || cfg.Datasource == "fake") {
+		return fmt.Errorf("--snippets-namespace needs a Kubernetes datasource, not --datasource=%s", cfg.Datasource)
+	}
+
+	if cfg.GlobalConfig != "" {
+		if cfg.Datasource == "fs" || cfg.Datasource == "fake" {
+			return fmt.Errorf("--global-config needs a Kubernetes datasource, not --datasource=%s", cfg.Datasource)
+		}
+		parts := strings.Split(cfg.GlobalConfig, "/")
+		if len(parts) > 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return fmt.Errorf("invalid --global-config '%s', expected namespace/name or name", cfg.GlobalConfig)
+		}
+	}
+
+	if (cfg.ConfigKubeConfig != "" || cfg.ConfigKubeContext != "") && (cfg.Datasource == "fs" || cfg.Datasource == "fake") {
+		return fmt.Errorf("--config-kubeconfig and --config-context need a Kubernetes datasource, not --datasource=%s", cfg.Datasource)
+	}
+
+	if cfg.DebugConfigAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.DebugConfigAddr); err != nil {
+			return fmt.Errorf("invalid --debug-config-addr '%s', expected host:port", cfg.DebugConfigAddr)
+		}
+	}
+
+	if cfg.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.HealthAddr); err != nil {
+			return fmt.Errorf("invalid --health-addr '%s', expected host:port", cfg.HealthAddr)
+		}
+	}
+
+	if cfg.HealthStaleAfter < 0 {
+		return fmt.Errorf("invalid --health-stale-after %v, it cannot be negative", cfg.HealthStaleAfter)
+	}
+
+	if cfg.RunOnce && cfg.LeaderElection {
+		return errors.New("--once cannot be used with --leader-election")
+	}
+
+	if cfg.LeaderElection {
+		if cfg.Datasource == "fs" || cfg.Datasource == "fake" {
+			return fmt.Errorf("--leader-election needs a Kubernetes datasource, not --datasource=%s", cfg.Datasource)
+		}
+		if cfg.LeaderElectionLease == "" {
+			return errors.New("--leader-election-lease cannot be empty")
+		}
+		if cfg.LeaderElectionNamespace == "" {
+			cfg.LeaderElectionNamespace = cfg.AdminNamespace
+		}
+		if os.Getenv(workloadKindEnv) == "DaemonSet" {
+			logrus.Warnf("--leader-election is set but the reloader runs in a DaemonSet: only the node of the leader gets its fluentd config updated")
+		}
+	}
+
+	for _, denied := range cfg.DeniedPlugins {
+		for _, allowed := range cfg.AllowedPlugins {
+			if denied == allowed {
+				return fmt.Errorf("plugin '%s' is both in --allowed-plugins and --denied-plugins", denied)
+			}
+		}
+	}
+
+	for _, field := range cfg.MetadataFields {
+		known := false
+		for _, name := range MetadataFieldNames {
+			known = known || name == field
+		}
+		if !known {
+			return fmt.Errorf("unknown --metadata-field '%s', the known fields are: %s", field, strings.Join(MetadataFieldNames, ", "))
+		}
+	}
+
+	if cfg.WebhookAddr != "" && (cfg.WebhookCertFile == "" || cfg.WebhookKeyFile == "") {
+		return errors.New("using --webhook-addr requires --webhook-cert-file and --webhook-key-file too")
+	}
+
+	if (cfg.HTTPCertFile == "") != (cfg.HTTPKeyFile == "") {
+		return errors.New("--http-cert-file and --http-key-file must be used together")
+	}
+
+	if cfg.HTTPTokenReview && (cfg.Datasource == "fs" || cfg.Datasource == "fake") {
+		return fmt.Errorf("--http-token-review needs a Kubernetes datasource, not --datasource=%s", cfg.Datasource)
+	}
+
+	if len(cfg.HTTPAllowedUsers) > 0 && !cfg.HTTPTokenReview {
+		return errors.New("--http-allowed-user needs --http-token-review")
+	}
+
+	// any service account token of the cluster would be accepted otherwise
+	if cfg.HTTPTokenReview && len(cfg.HTTPAllowedUsers) == 0 {
+		return errors.New("--http-token-review needs --http-allowed-user")
+	}
+
+	// the dry validation runs the fluentd validator on any config it is sent
+	if cfg.DryValidateAddr != "" && cfg.HTTPTokenFile == "" && !cfg.HTTPTokenReview {
+		return errors.New("--dry-validate-addr needs --http-token-file or --http-token-review")
+	}
+
+	if cfg.RuntimeConfigDir != "" {
+		if cfg.RuntimeConfigMap != "" {
+			return errors.New("use either --runtime-config-configmap or --runtime-config-dir, not both")
+		}
+		if cfg.Datasource == "fs" || cfg.Datasource == "fake" {
+			return fmt.Errorf("--runtime-config-dir needs a Kubernetes datasource, not --datasource=%s", cfg.Datasource)
+		}
+	}
+
+	for _, name := range cfg.LintDisabledRules {
+		known := false
+		for _, rule := range fluentd.LintRules {
+			known = known || rule.Name == name
+		}
+		if !known {
+			return fmt.Errorf("unknown lint rule: '%s'", name)
+		}
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		u, err := url.Parse(cfg.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid OTLP endpoint '%s', expected http(s)://host:port", cfg.OTLPEndpoint)
+		}
+	}
+
+	if len(cfg.ExpectedPlugins) > 0 && cfg.FluentGemCommand == "" {
+		return errors.New("using --expected-plugins requires --fluent-gem-binary too")
+	}
+
+	if cfg.EnablePrometheusFilter && !cfg.PrometheusEnabled {
+		return errors.New("using --prometheus-filter requires --prometheus-enabled too")
+	}
+
+	if cfg.FluentdMonitorAddr != "" {
+		if !cfg.PrometheusEnabled {
+			return errors.New("using --fluentd-monitor-addr requires --prometheus-enabled too")
+		}
+		host, port, err := net.SplitHostPort(cfg.FluentdMonitorAddr)
+		if err != nil || host == "" {
+			return fmt.Errorf("invalid --fluentd-monitor-addr '%s', use host:port", cfg.FluentdMonitorAddr)
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("invalid --fluentd-monitor-addr '%s', use host:port", cfg.FluentdMonitorAddr)
+		}
+		if cfg.FluentdMonitorInterval <= 0 {
+			return errors.New("--fluentd-monitor-interval must be positive")
+		}
+	}
+
 	if cfg.Datasource == "fs" && cfg.FsDatasourceDir == "" {
 		return errors.New("using --datasource=fs requires --fs-dir too")
 	}
@@ -171,6 +731,147 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.BufferDrainTimeout < 0 {
+		return errors.New("--buffer-drain-timeout cannot be negative")
+	}
+	if cfg.BufferDrainTimeout > 0 && cfg.FluentdMonitorAddr == "" {
+		return errors.New("using --buffer-drain-timeout requires --fluentd-monitor-addr too")
+	}
+
+	if cfg.ValidateSecretRefs && !path.IsAbs(cfg.SecretMountRoot) {
+		return fmt.Errorf("--secret-mount-root must be an absolute path, got '%s'", cfg.SecretMountRoot)
+	}
+
+	if cfg.NewNamespaceGrace < 0 {
+		return errors.New("--new-namespace-grace cannot be negative")
+	}
+
+	if cfg.PerNamespaceTimeout < 0 {
+		return errors.New("--per-namespace-timeout cannot be negative")
+	}
+
+	if cfg.ResyncPeriod < 0 {
+		return errors.New("--resync-period cannot be negative")
+	}
+
+	if cfg.AnnotSources != "" && !reValidAnnotationName.MatchString(cfg.AnnotSources) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotSources)
+	}
+
+	if cfg.AnnotBufferProfile != "" && !reValidAnnotationName.MatchString(cfg.AnnotBufferProfile) {
+		return fmt.Errorf("invalid annotation name: '%s'", cfg.AnnotBufferProfile)
+	}
+
+	if err := cfg.loadNamespaceSources(); err != nil {
+		return err
+	}
+
+	if err := cfg.loadDefaultOutput(); err != nil {
+		return err
+	}
+
+	if err := cfg.loadLabelRoutes(); err != nil {
+		return err
+	}
+
+	if err := cfg.validateAggregators(); err != nil {
+		return err
+	}
+
+	cfg.ParsedTemplateEnv = map[string]string{}
+	for _, name := range cfg.TemplateEnv {
+		if !reValidEnvName.MatchString(name) {
+			return fmt.Errorf("invalid --template-env '%s', use the name of an environment variable", name)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			logrus.Warnf("Environment variable %s is not set, namespace configs will see an empty value", name)
+		}
+		cfg.ParsedTemplateEnv[name] = value
+	}
+
+	for _, pattern := range cfg.ExcludeNamespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude-namespaces pattern '%s': %v", pattern, err)
+		}
+	}
+
+	cfg.ParsedNamespaceSelector = nil
+	if cfg.NamespaceSelector != "" {
+		selector, err := labels.Parse(cfg.NamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("invalid --namespace-selector '%s': %v", cfg.NamespaceSelector, err)
+		}
+		cfg.ParsedNamespaceSelector = selector
+		if len(cfg.Namespaces) > 0 || cfg.SingleNamespace != "" {
+			logrus.Warnf("Ignoring --namespace-selector as the namespaces to process are listed explicitly")
+		}
+	}
+
+	if cfg.PodLabelSelector != "" {
+		if _, err := labels.Parse(cfg.PodLabelSelector); err != nil {
+			return fmt.Errorf("invalid --pod-label-selector '%s': %v", cfg.PodLabelSelector, err)
+		}
+	}
+	if cfg.PodFieldSelector != "" {
+		if _, err := fields.ParseSelector(cfg.PodFieldSelector); err != nil {
+			return fmt.Errorf("invalid --pod-field-selector '%s': %v", cfg.PodFieldSelector, err)
+		}
+	}
+
+	if cfg.Datasource == "secret" && cfg.CRDMigrationMode {
+		return errors.New("--crd-migration-mode cannot be used with --datasource=secret")
+	}
+
+	if cfg.Datasource == "git" {
+		if cfg.GitURL == "" {
+			return errors.New("using --datasource=git requires --git-url too")
+		}
+		if cfg.CRDMigrationMode {
+			return errors.New("--crd-migration-mode cannot be used with --datasource=git")
+		}
+		if cfg.ConfigKubeConfig != "" || cfg.ConfigKubeContext != "" {
+			return errors.New("--config-kubeconfig and --config-context cannot be used with --datasource=git")
+		}
+		if cfg.GitPollInterval <= 0 {
+			return errors.New("--git-poll-interval must be positive")
+		}
+		if cfg.GitSSHKeyFile != "" && cfg.GitTokenFile != "" {
+			return errors.New("--git-ssh-key-file and --git-token-file cannot be used together")
+		}
+		if strings.HasPrefix(cfg.GitBranch, "-") {
+			return fmt.Errorf("invalid --git-branch '%s'", cfg.GitBranch)
+		}
+		if strings.HasPrefix(cfg.GitPath, "/") || strings.Contains("/"+cfg.GitPath+"/", "/../") {
+			return fmt.Errorf("invalid --git-path '%s', expected a relative path inside the repository", cfg.GitPath)
+		}
+	} else if cfg.GitURL != "" {
+		return errors.New("--git-url needs --datasource=git")
+	}
+
+	if cfg.Datasource == "file" {
+		if cfg.FileDatasourceDir == "" {
+			return errors.New("using --datasource=file requires --file-dir too")
+		}
+		if cfg.CRDMigrationMode {
+			return errors.New("--crd-migration-mode cannot be used with --datasource=file")
+		}
+		if cfg.ConfigKubeConfig != "" || cfg.ConfigKubeContext != "" {
+			return errors.New("--config-kubeconfig and --config-context cannot be used with --datasource=file")
+		}
+	} else if cfg.FileDatasourceDir != "" {
+		return errors.New("--file-dir needs --datasource=file")
+	}
+
+	if cfg.CentralNamespace != "" {
+		if cfg.Datasource != "crd" && !cfg.CRDMigrationMode {
+			return errors.New("--central-namespace needs --datasource=crd or --crd-migration-mode")
+		}
+		if cfg.SingleNamespace != "" && cfg.SingleNamespace != cfg.CentralNamespace {
+			return errors.New("--central-namespace cannot be used with --single-namespace")
+		}
+	}
+
 	if cfg.Datasource == "multimap" {
 		if cfg.LabelSelector == "" {
 			return errors.New("using --datasource=multimap requires --label-selector too")
@@ -202,6 +903,8 @@ func (cfg *Config) Validate() error {
 }
 
 func (cfg *Config) ParseFlags(args []string) error {
+	cfg.current = &atomic.Value{}
+
 	app := kingpin.New("config-reloader", "Regenerates Fluentd configs based Kubernetes namespace annotations against templates, reloading Fluentd if necessary")
 	app.Version(Version)
 	app.DefaultEnvars()
@@ -209,12 +912,29 @@ func (cfg *Config) ParseFlags(args []string) error {
 	// Flags related to Kubernetes
 	app.Flag("master", "The Kubernetes API server to connect to (default: auto-detect)").Default(defaultConfig.Master).StringVar(&cfg.Master)
 	app.Flag("kubeconfig", "Retrieve target cluster configuration from a Kubernetes configuration file (default: auto-detect)").Default(defaultConfig.KubeConfig).StringVar(&cfg.KubeConfig)
+	app.Flag("config-kubeconfig", "Read the namespace configs from the cluster of this Kubernetes configuration file instead, the pods and the statuses stay in the cluster of --kubeconfig").StringVar(&cfg.ConfigKubeConfig)
+	app.Flag("config-context", "Read the namespace configs from the cluster of this context of --config-kubeconfig (default: its current context)").StringVar(&cfg.ConfigKubeContext)
 
-	app.Flag("datasource", "Datasource to use default|fake|fs|multimap|crd (default: default) ").Default("default").EnumVar(&cfg.Datasource, "default", "fake", "fs", "multimap", "crd")
+	app.Flag("datasource", "Datasource to use default|fake|fs|multimap|crd|secret|git|file (default: default) ").Default("default").EnumVar(&cfg.Datasource, "default", "fake", "fs", "multimap", "crd", "secret", "git", "file")
 	app.Flag("crd-migration-mode", "Enable the crd datasource together with the current datasource to facilitate the migration (used only with --datasource=default|multimap)").BoolVar(&cfg.CRDMigrationMode)
+	app.Flag("crd-fetch-timeout", "Timeout (in seconds) for reading the FluentdConfigs of a namespace (used only with --datasource=crd or --crd-migration-mode)").Default(strconv.Itoa(defaultConfig.CRDFetchTimeoutSeconds)).IntVar(&cfg.CRDFetchTimeoutSeconds)
+	app.Flag("crd-fetch-retries", "How many times to retry reading the FluentdConfigs of a namespace before giving up (used only with --datasource=crd or --crd-migration-mode)").Default(strconv.Itoa(defaultConfig.CRDFetchRetries)).IntVar(&cfg.CRDFetchRetries)
+	app.Flag("central-namespace", "Read the FluentdConfigs of all namespaces from this namespace, each one applies to the namespace in its spec.namespace or its logging.csp.vmware.com/target-namespace label (used only with --datasource=crd or --crd-migration-mode)").StringVar(&cfg.CentralNamespace)
 	app.Flag("fs-dir", "If --datasource=fs is used, configure the dir hosting the files").StringVar(&cfg.FsDatasourceDir)
+	app.Flag("file-dir", "If --datasource=file is used, the mounted dir holding the config of every namespace in {namespace}.conf").StringVar(&cfg.FileDatasourceDir)
+	app.Flag("git-url", "The Git repository holding the namespace configs, e.g. git@github.com:org/logging.git (used only with --datasource=git)").StringVar(&cfg.GitURL)
+	app.Flag("git-branch", "The branch of --git-url to read the configs from (default: the default branch of the repository)").StringVar(&cfg.GitBranch)
+	app.Flag("git-path", "The directory of the repository holding the namespace configs (default: its root)").StringVar(&cfg.GitPath)
+	app.Flag("git-dir", "The local directory the repository is cloned into (default: a new temporary directory)").StringVar(&cfg.GitDir)
+	app.Flag("git-poll-interval", "Pull the repository this often and run when it changed").Default(defaultConfig.GitPollInterval.String()).DurationVar(&cfg.GitPollInterval)
+	app.Flag("git-ssh-key-file", "The private SSH key for an ssh:// or scp-like --git-url, e.g. mounted from a Secret").StringVar(&cfg.GitSSHKeyFile)
+	app.Flag("git-known-hosts-file", "The known_hosts file checking the SSH host key of --git-url (default: the host key is accepted on the first connection)").StringVar(&cfg.GitKnownHostsFile)
+	app.Flag("git-token-file", "A file holding the access token for an https:// --git-url, e.g. mounted from a Secret. It is read on every pull and needs git 2.31 or later").StringVar(&cfg.GitTokenFile)
 
 	app.Flag("interval", "Run every x seconds").Default(strconv.Itoa(defaultConfig.IntervalSeconds)).IntVar(&cfg.IntervalSeconds)
+	app.Flag("reload-debounce", "Wait for the changes of the Kubernetes objects to be quiet for this long before running, so that a burst of changes makes a single run. 0 runs on every change").Default(defaultConfig.ReloadDebounce.String()).DurationVar(&cfg.ReloadDebounce)
+	app.Flag("reload-debounce-max-wait", "Run at the latest this long after the first of a continuous stream of changes (used only with --reload-debounce)").Default(defaultConfig.ReloadDebounceMaxWait.String()).DurationVar(&cfg.ReloadDebounceMaxWait)
+	app.Flag("max-reloads-per-minute", "Reload fluentd at most this many times per minute, the changes made in between are applied together by the next allowed reload. 0 means no limit").IntVar(&cfg.MaxReloadsPerMinute)
 
 	app.Flag("allow-file", "Allow @type file for namespace configuration").BoolVar(&cfg.AllowFile)
 
@@ -222,40 +942,171 @@ func (cfg *Config) ParseFlags(args []string) error {
 
 	app.Flag("fluentd-rpc-port", "RPC port of Fluentd").Default(strconv.Itoa(defaultConfig.FluentdRPCPort)).IntVar(&cfg.FluentdRPCPort)
 	app.Flag("log-level", "Control verbosity of log level for reloader").Default(defaultConfig.LogLevel).StringVar(&cfg.LogLevel)
+	app.Flag("log-format", "Format of the reloader logs, json keeps the namespace, config hash and event of a line as separate fields: text|json").Default(defaultConfig.LogFormat).EnumVar(&cfg.LogFormat, LogFormatText, LogFormatJSON)
 	app.Flag("fluentd-loglevel", "Control verbosity of log level for fluentd").Default(defaultConfig.FluentdLogLevel).StringVar(&cfg.FluentdLogLevel)
 
 	app.Flag("buffer-mount-folder", "Folder in /var/log/{} where to create all fluentd buffers").Default(defaultConfig.BufferMountFolder).StringVar(&cfg.BufferMountFolder)
 
 	app.Flag("annotation", "Which annotation on the namespace stores the configmap name?").Default(defaultConfig.AnnotConfigmapName).StringVar(&cfg.AnnotConfigmapName)
+	app.Flag("config-key-annotation", "Which annotation on the namespace names the ConfigMap or Secret key holding the config, instead of fluent.conf? Use empty string to disable").Default(defaultConfig.AnnotConfigKey).StringVar(&cfg.AnnotConfigKey)
 	app.Flag("default-configmap", "Read the configmap by this name if namespace is not annotated. Use empty string to suppress the default.").Default(defaultConfig.DefaultConfigmapName).StringVar(&cfg.DefaultConfigmapName)
 	app.Flag("status-annotation", "Store configuration errors in this annotation, leave empty to turn off").Default(defaultConfig.AnnotStatus).StringVar(&cfg.AnnotStatus)
+	app.Flag("status-format", "Store the plain status message in the status annotation, or a JSON object with the status, its severity, when it was written and the config hash: text|json").Default(StatusFormatText).EnumVar(&cfg.StatusFormat, StatusFormatText, StatusFormatJSON)
+	app.Flag("emit-events", "Also record a Kubernetes Event against the namespace when its config is applied or rejected").BoolVar(&cfg.EmitEvents)
+
+	app.Flag("fluentd-workers", "Number of fluentd workers. With more than one, the sources of every namespace are pinned to a single worker. 0 keeps fluentd's default of one worker").IntVar(&cfg.FluentdWorkers)
+	app.Flag("max-flush-threads", "Cap the flush_thread_count of every namespace output to this many threads. 0 means no limit").IntVar(&cfg.MaxFlushThreads)
+	app.Flag("max-outputs-per-namespace", "Fail namespaces whose config has more outputs than this, counting every store of a copy output. 0 means no limit").IntVar(&cfg.MaxOutputsPerNamespace)
+	app.Flag("max-config-bytes", "Fail namespaces whose config is larger than this many bytes. 0 means no limit").IntVar(&cfg.MaxConfigBytes)
+	app.Flag("max-rules-per-namespace", "Fail namespaces whose config has more match and filter directives than this. 0 means no limit").IntVar(&cfg.MaxRulesPerNamespace)
+	app.Flag("flush-threads-annotation", "Which annotation on the namespace overrides --max-flush-threads for that namespace? Use empty string to disable per-namespace limits").Default(defaultConfig.AnnotFlushThreads).StringVar(&cfg.AnnotFlushThreads)
+	app.Flag("fan-out-annotation", "Which annotation on the namespace lists the admin plugins to also send its logs to? Use empty string to disable fan-out").Default(defaultConfig.AnnotFanOut).StringVar(&cfg.AnnotFanOut)
+	app.Flag("logging-disabled-annotation", "Which annotation on the namespace disables its logging, replacing its config entirely? Its value is drop or quarantine. Use empty string to disable the kill switch").Default(defaultConfig.AnnotDisabled).StringVar(&cfg.AnnotDisabled)
+	app.Flag("ignore-annotation", "Which annotation on the namespace set to true makes the config-reloader leave the namespace alone, as if it had no config? Use empty string to disable").Default(defaultConfig.AnnotIgnore).StringVar(&cfg.AnnotIgnore)
+	app.Flag("parser-annotation", "Which annotation on pods (and on the namespace, as a default) hints the log format of containers: json, logfmt or multiline? Use empty string to disable").Default(defaultConfig.AnnotParser).StringVar(&cfg.AnnotParser)
+	app.Flag("exclude-annotation", "Which annotation on pods set to true drops the logs of all their containers? Use empty string to disable").Default(defaultConfig.AnnotExclude).StringVar(&cfg.AnnotExclude)
+
+	app.Flag("default-retry-max-times", "Set retry_max_times on every namespace buffer that does not set it. 0 keeps fluentd's default").IntVar(&cfg.DefaultRetryMaxTimes)
+	app.Flag("max-retry-max-times", "Lower the retry_max_times of namespace buffers to at most this. 0 means no limit").IntVar(&cfg.MaxRetryMaxTimes)
+	app.Flag("default-retry-wait", "Set retry_wait on every namespace buffer that does not set it, e.g. 1s").StringVar(&cfg.DefaultRetryWait)
+	app.Flag("min-retry-wait", "Raise the retry_wait of namespace buffers to at least this").StringVar(&cfg.MinRetryWait)
+	app.Flag("default-retry-timeout", "Set retry_timeout on every namespace buffer that does not set it, e.g. 1h").StringVar(&cfg.DefaultRetryTimeout)
+	app.Flag("max-retry-timeout", "Lower the retry_timeout of namespace buffers to at most this").StringVar(&cfg.MaxRetryTimeout)
+	app.Flag("default-time-format", "Rewrite the time field of all container logs with this strftime format, e.g. %Y-%m-%dT%H:%M:%S.%L%z. Empty leaves the time alone").StringVar(&cfg.DefaultTimeFormat)
+	app.Flag("default-timezone", "Timezone used with --default-time-format: UTC or an offset like +02:00. Empty uses the timezone of fluentd").StringVar(&cfg.DefaultTimezone)
+	app.Flag("keep-time-format-annotation", "A namespace with this annotation set to true is left out of --default-time-format").Default(defaultConfig.AnnotKeepTimeFormat).StringVar(&cfg.AnnotKeepTimeFormat)
 
 	app.Flag("prometheus-enabled", "Prometheus metrics enabled (default: false)").BoolVar(&cfg.PrometheusEnabled)
+	app.Flag("prometheus-filter", "Count the records of every namespace, pod and container in fluentd's prometheus metrics (also needs --prometheus-enabled)").BoolVar(&cfg.EnablePrometheusFilter)
 	app.Flag("metrics-port", "Expose prometheus metrics on this port (also needs --prometheus-enabled)").Default(strconv.Itoa(defaultConfig.MetricsPort)).IntVar(&cfg.MetricsPort)
+	app.Flag("fluentd-monitor-addr", "Start fluentd's monitor_agent on this host:port, e.g. 127.0.0.1:24220, and export the buffer queue length and retry count of every namespace (also needs --prometheus-enabled). Empty disables it").StringVar(&cfg.FluentdMonitorAddr)
+	app.Flag("buffer-drain-timeout", "Before a reload moving or removing file buffers, flush fluentd and wait up to this long, e.g. 2m, for these buffers to drain (needs --fluentd-monitor-addr). 0 reloads right away").DurationVar(&cfg.BufferDrainTimeout)
+	app.Flag("fluentd-monitor-interval", "Scrape the fluentd monitor_agent every this many seconds").Default(strconv.Itoa(defaultConfig.FluentdMonitorInterval)).IntVar(&cfg.FluentdMonitorInterval)
+
+	app.Flag("per-namespace-metrics", "Label timing metrics with the namespace name instead of just its size class. Increases metrics cardinality (default: false)").BoolVar(&cfg.PerNamespaceMetrics)
 
 	app.Flag("kubelet-root", "Kubelet root dir, configured using --root-dir on the kubelet service").Default(defaultConfig.KubeletRoot).StringVar(&cfg.KubeletRoot)
+	app.Flag("disable-pods", "Do not watch pods. Allows running without RBAC permissions on pods, but container-based macros will not match anything (default: false)").BoolVar(&cfg.DisablePods)
+	app.Flag("pod-label-selector", "Only watch the pods matching this label selector to reduce memory, the other pods are unknown to the container-based macros").StringVar(&cfg.PodLabelSelector)
+	app.Flag("pod-field-selector", "Only watch the pods matching this field selector, e.g. spec.nodeName=node-1 to watch the pods of a single node").StringVar(&cfg.PodFieldSelector)
+	app.Flag("pod-config-annotation", "Also read fluentd config snippets from this annotation on the pods of a namespace, appended to the namespace config. Empty disables it").StringVar(&cfg.PodConfigAnnotation)
+	app.Flag("required-annotations", "Annotations that must be set on a namespace for its config to be processed, e.g. an owner annotation").StringsVar(&cfg.RequiredAnnotations)
+	app.Flag("new-namespace-grace", "Wait this long after a namespace is created before processing it, e.g. 30s, so that its config objects can land. 0 processes new namespaces right away").DurationVar(&cfg.NewNamespaceGrace)
+	app.Flag("resync-period", "Resync the informers of the Kubernetes objects and run the control loop this often even without a change, e.g. 10m. 0 disables the periodic resync").DurationVar(&cfg.ResyncPeriod)
+	app.Flag("project-annotation", "Which annotation on the namespace references its project ID? Used with --allowed-projects").Default(defaultConfig.AnnotProject).StringVar(&cfg.AnnotProject)
+	app.Flag("allowed-projects", "Only process namespaces belonging to one of these projects. Empty processes all namespaces").StringsVar(&cfg.AllowedProjects)
+	app.Flag("template-env", "Environment variable namespace configs may refer to as {{ .Env.NAME }}, e.g. REGION. Other variables are not visible to them").StringsVar(&cfg.TemplateEnv)
+	app.Flag("strict-templating", "Fail the namespace configs referring to a namespace label that is not set, instead of using an empty string (default: false)").BoolVar(&cfg.StrictTemplating)
+	app.Flag("max-namespaces", "Process at most this many namespaces, a safety valve against runaway clusters. 0 means no limit").IntVar(&cfg.MaxNamespaces)
 	app.Flag("namespaces", "List of namespaces to process. If empty, processes all namespaces").StringsVar(&cfg.Namespaces)
+	app.Flag("namespace-selector", "Only process the namespaces matching this label selector, e.g. logging.vmware.com/enabled=true. Ignored if --namespaces is set").StringVar(&cfg.NamespaceSelector)
+	app.Flag("namespace-priority", "Namespaces processed first and in this order, the others follow sorted by name. The config of a namespace comes before the ones after it, its <match> wins for the logs both route").StringsVar(&cfg.NamespacePriority)
+	app.Flag("exclude-namespaces", "Namespaces or glob patterns, e.g. kube-*, never processed even if listed in --namespaces. The admin namespace is always processed").StringsVar(&cfg.ExcludeNamespaces)
+	app.Flag("single-namespace", "Process only this namespace, watching nothing outside of it. Allows running with permissions on this namespace only").StringVar(&cfg.SingleNamespace)
 
 	app.Flag("templates-dir", "Where to find templates").Default(defaultConfig.TemplatesDir).StringVar(&cfg.TemplatesDir)
 	app.Flag("output-dir", "Where to output config files").Default(defaultConfig.OutputDir).StringVar(&cfg.OutputDir)
+	app.Flag("output-layout", "Write the config of every namespace to its own file included by fluent.conf, or everything to fluent.conf: per-namespace|single").Default(OutputLayoutPerNamespace).EnumVar(&cfg.OutputLayout, OutputLayoutPerNamespace, OutputLayoutSingle)
+	app.Flag("container-runtime", "Which log format the container logs are written in: docker reads JSON lines, containerd and crio the CRI format, auto guesses from every line: auto|docker|containerd|crio").Default(ContainerRuntimeAuto).EnumVar(&cfg.ContainerRuntime, ContainerRuntimeAuto, ContainerRuntimeDocker, ContainerRuntimeContainerd, ContainerRuntimeCRIO)
+	app.Flag("routing-graph", "Print a best-effort graph of how the logs of this namespace are routed through the config in --output-dir and exit").StringVar(&cfg.RoutingGraph)
+	app.Flag("lint-level", "Lint the namespace configs and report the findings at least this severe: off|error|warn|info. Error findings fail the namespace, the others are only reported").Default(LintOff).EnumVar(&cfg.LintLevel, LintOff, fluentd.LintError, fluentd.LintWarn, fluentd.LintInfo)
+	app.Flag("lint-disable-rule", "Name of a lint rule not to run, e.g. tail-pos-file").StringsVar(&cfg.LintDisabledRules)
+	app.Flag("isolate-namespaces", "Move the config of every namespace into a <label> only its own records are routed to, so that no namespace can match the records of another one (default: false)").BoolVar(&cfg.IsolateNamespaces)
+	app.Flag("admin-config-position", "Put the admin namespace config before the namespace configs, after them, or split it with its \"# @section append\" sections going after: prepend|append|both").Default(AdminConfigPrepend).EnumVar(&cfg.AdminConfigPosition, AdminConfigPrepend, AdminConfigAppend, AdminConfigBoth)
+	app.Flag("routing-graph-format", "Format of the routing graph: json|dot").Default("json").EnumVar(&cfg.RoutingGraphFormat, "json", "dot")
 
 	app.Flag("meta-key", "Attach metadata under this key").StringVar(&cfg.MetaKey)
 	app.Flag("meta-values", "Metadata in the k=v,k2=v2 format").StringVar(&cfg.MetaValues)
 
+	app.Flag("fluent-gem-binary", "Path to the fluent-gem binary used to record the installed plugin versions at startup").StringVar(&cfg.FluentGemCommand)
+	cfg.ExpectedPlugins = map[string]string{}
+	cfg.NamespaceSources = map[string]string{}
+	app.Flag("namespace-source", "A log source namespaces can select with the sources annotation, in the name=template-file format. The template renders <source> directives for {{ .Namespace }}").StringMapVar(&cfg.NamespaceSources)
+	app.Flag("default-output", "Template file of a <match> every namespace also sends its records to, whatever its own outputs. The template renders for {{ .Namespace }}").StringVar(&cfg.DefaultOutput)
+	app.Flag("label-route", "Send the records of the namespaces labeled key=value to the <match> of a template file instead of the --default-output, in the key=value=template-file format. Repeatable, the first matching route wins").StringsVar(&cfg.LabelRoutes)
+	cfg.Aggregators = map[string]string{}
+	app.Flag("aggregator-label", "Namespace label selecting the aggregator the outputs of the namespace are routed to, e.g. aggregator. Empty disables aggregator routing").StringVar(&cfg.AggregatorLabel)
+	app.Flag("aggregator", "An aggregator namespaces can select with --aggregator-label, in the name=plugin format. The plugin is a <plugin> of the admin namespace, usually a forward output").StringMapVar(&cfg.Aggregators)
+	app.Flag("default-aggregator", "Aggregator of the namespaces without the aggregator label (used only with --aggregator-label)").StringVar(&cfg.DefaultAggregator)
+	app.Flag("sources-annotation", "Which annotation on the namespace selects its log sources, e.g. container,systemd? Use empty string to collect the container logs only").Default(defaultConfig.AnnotSources).StringVar(&cfg.AnnotSources)
+	app.Flag("buffer-profile-annotation", "Which annotation on the namespace selects the buffer profile of its outputs: low-latency or high-durability? Use empty string to disable the profiles").Default(defaultConfig.AnnotBufferProfile).StringVar(&cfg.AnnotBufferProfile)
+	app.Flag("expected-plugins", "Expected plugin versions in the name=version format, a warning is logged on drift. Requires --fluent-gem-binary").StringMapVar(&cfg.ExpectedPlugins)
 	app.Flag("fluentd-binary", "Path to fluentd binary used to validate configuration").StringVar(&cfg.FluentdValidateCommand)
+	app.Flag("validation-concurrency", "How many namespaces to validate at the same time, i.e. the maximum number of fluentd validation processes (used only with --fluentd-binary)").Default(strconv.Itoa(defaultConfig.ValidationConcurrency)).IntVar(&cfg.ValidationConcurrency)
+	app.Flag("validation-cache-size", "How many valid configs to remember so that they are not validated again, 0 validates every config every time (used only with --fluentd-binary)").Default(strconv.Itoa(defaultConfig.ValidationCacheSize)).IntVar(&cfg.ValidationCacheSize)
+	app.Flag("fetch-concurrency", "How many namespaces to read from the API at the same time at the start of a cycle").Default(strconv.Itoa(defaultConfig.FetchConcurrency)).IntVar(&cfg.FetchConcurrency)
+	app.Flag("per-namespace-timeout", "Fail a namespace whose config, pods and snippets take longer than this to read, e.g. 30s, the other namespaces are read as usual. 0 waits as long as it takes").DurationVar(&cfg.PerNamespaceTimeout)
 
 	app.Flag("label-selector", "Label selector in the k=v,k2=v2 format (used only with --datasource=multimap)").StringVar(&cfg.LabelSelector)
 
 	app.Flag("allow-tag-expansion", "Allow specifying tags in the format 'k.{a,b}.** k.c.**' (default: false)").BoolVar(&cfg.AllowTagExpansion)
 
+	app.Flag("allowed-tail-paths", "Host paths (directories or glob patterns) that namespaces may tail using @type host-file").StringsVar(&cfg.AllowedTailPaths)
+	app.Flag("allowed-plugins", "Plugin types (inputs, filters, outputs, parsers, formatters, buffers...) that namespaces may use. Empty allows all plugins").StringsVar(&cfg.AllowedPlugins)
+	app.Flag("denied-plugins", "Plugin types that namespaces may not use, e.g. exec, even if allowed by --allowed-plugins").StringsVar(&cfg.DeniedPlugins)
+	app.Flag("metadata-field", "A field of the Kubernetes metadata kept on the container log records, e.g. pod_name. The other fields are removed. Empty keeps the default fields").StringsVar(&cfg.MetadataFields)
+	app.Flag("validate-secret-refs", "Fail the namespaces whose outputs refer to a file under --secret-mount-root for which no Secret key exists in the namespace (default: false)").BoolVar(&cfg.ValidateSecretRefs)
+	app.Flag("secret-mount-root", "Where the Secrets of the namespaces are mounted for fluentd, as <root>/<secret>/<key> (used only with --validate-secret-refs)").Default(defaultConfig.SecretMountRoot).StringVar(&cfg.SecretMountRoot)
+	app.Flag("reserved-tag-prefix", "Tag prefixes namespaces may not emit records to, e.g. fluent. Other tags emitted by a namespace are moved under kube.<namespace>. Pass an empty string to reserve nothing").Default(defaultConfig.ReservedTagPrefixes...).StringsVar(&cfg.ReservedTagPrefixes)
+	app.Flag("output-host-override", "Redirect the elasticsearch, forward, kafka and s3 outputs of all namespaces to this host, e.g. a test sink. Other params are kept").StringVar(&cfg.OutputHostOverride)
+	app.Flag("strict-mode", "Apply nothing if the config of any namespace is invalid, keeping the last applied config of all namespaces (default: false)").BoolVar(&cfg.StrictMode)
+	app.Flag("dry-run", "Generate and validate the configs and write the statuses, but write no file and never reload fluentd (default: false)").BoolVar(&cfg.DryRun)
+	app.Flag("once", "Run a single cycle and exit, with exit code 1 if the config of any namespace failed, 2 if the cycle itself failed (default: false)").BoolVar(&cfg.RunOnce)
+	app.Flag("config-checksum", "Write the checksums of the generated config to checksums.sha256 in the output dir and expose them as a metric (default: false)").BoolVar(&cfg.ConfigChecksum)
+	app.Flag("status-summary-configmap", "Name of a ConfigMap in the reloader's namespace summarizing the status of all namespaces. Empty disables the summary").StringVar(&cfg.StatusSummaryConfigMap)
+
+	app.Flag("global-config", "ConfigMap, as namespace/name or just name in the admin namespace, whose fluent.conf is prepended to the config of every namespace. Empty disables it").StringVar(&cfg.GlobalConfig)
+	app.Flag("snippets-namespace", "Namespace of the ConfigMaps labelled logging.csp.vmware.com/fluentd-snippets=true whose keys the namespace configs may include with @include <configmap>/<key>. Empty disables the snippets").StringVar(&cfg.SnippetsNamespace)
+	app.Flag("runtime-config-configmap", "Name of a ConfigMap in the reloader's namespace overriding the reloadable flags at runtime, keyed by flag name. Empty disables it").StringVar(&cfg.RuntimeConfigMap)
+	app.Flag("runtime-config-dir", "Directory overriding the reloadable flags at runtime, one file per flag named after it, e.g. a mounted ConfigMap. Empty disables it").StringVar(&cfg.RuntimeConfigDir)
+
+	app.Flag("warn-unrouted-tags", "Report in the status annotation the container tags that no <match> of the namespace routes. Best effort (default: false)").BoolVar(&cfg.WarnUnroutedTags)
+
+	app.Flag("warn-duplicate-routing", "Log a warning for the containers whose logs are routed by the config of more than one namespace and export their count as a metric. Best effort (default: false)").BoolVar(&cfg.WarnDuplicateRouting)
+	app.Flag("strict-tag-isolation", "Fail the namespaces whose config routes the container logs of another namespace, found like with --warn-duplicate-routing. Collisions with the admin namespace are only reported (default: false)").BoolVar(&cfg.StrictTagIsolation)
+	app.Flag("log-config-diffs", "Log at info level a diff of the generated config of every namespace that changed, with the credentials redacted (default: false)").BoolVar(&cfg.LogConfigDiffs)
+
+	app.Flag("dead-letter-plugin", "Name of a <plugin> defined in the admin namespace receiving all error events (the @ERROR label). Namespaces cannot redefine it").StringVar(&cfg.DeadLetterPlugin)
+	app.Flag("quarantine-plugin", "Name of a <plugin> defined in the admin namespace receiving the logs of namespaces whose config is invalid, instead of dropping them").StringVar(&cfg.QuarantinePlugin)
 	app.Flag("admin-namespace", "Configurations defined in this namespace are copied as is, without further processing. Virtual plugins can also be defined in this namespace").Default(defaultConfig.AdminNamespace).StringVar(&cfg.AdminNamespace)
 
 	app.Flag("exec-timeout", "Timeout duration (in seconds) for exec command during validation").Default(strconv.Itoa(defaultConfig.ExecTimeoutSeconds)).IntVar(&cfg.ExecTimeoutSeconds)
-	_, err := app.Parse(args)
+
+	app.Flag("rollback-addr", "Serve the last good config of every namespace and an endpoint rolling a namespace back to it on this address, e.g. 127.0.0.1:9001. Empty disables it").StringVar(&cfg.RollbackAddr)
+	app.Flag("dry-validate-addr", "Serve an endpoint validating a proposed config of a namespace like a run would, without applying it, on this address, e.g. 127.0.0.1:9005. Needs --http-token-file or --http-token-review. Empty disables it").StringVar(&cfg.DryValidateAddr)
+	app.Flag("debug-config-addr", "Serve the last generated config, combined on /config and by namespace on /config/{namespace}, with credentials redacted on this address, e.g. 127.0.0.1:9003. Empty disables it").StringVar(&cfg.DebugConfigAddr)
+	app.Flag("health-addr", "Serve the liveness probe on /healthz and the readiness probe on /readyz on this address, e.g. :9004. Empty disables them").StringVar(&cfg.HealthAddr)
+	app.Flag("health-stale-after", "Fail the liveness probe when the control loop has not succeeded for this long, the loop then runs at least every half of it. 0 never fails it").Default(defaultConfig.HealthStaleAfter.String()).DurationVar(&cfg.HealthStaleAfter)
+	app.Flag("grpc-addr", "Serve a read-only gRPC API with the status, config hash and last applied time of every namespace on this address, e.g. 127.0.0.1:9002. Empty disables it. Secured like the HTTP endpoints, a non-loopback address needs --http-token-file or --http-token-review").StringVar(&cfg.GRPCAddr)
+	app.Flag("leader-election", "Run the control loop only in the replica holding a Lease, the other replicas keep their informers synced and stand by (default: false)").BoolVar(&cfg.LeaderElection)
+	app.Flag("leader-election-lease", "Name of the Lease used for the leader election").Default(defaultConfig.LeaderElectionLease).StringVar(&cfg.LeaderElectionLease)
+	app.Flag("leader-election-namespace", "Namespace of the Lease used for the leader election. Empty uses the admin namespace").StringVar(&cfg.LeaderElectionNamespace)
+	app.Flag("last-good-dir", "Also store the last good config of every namespace in this directory so that it survives restarts. Empty keeps it in memory only").StringVar(&cfg.LastGoodDir)
+	app.Flag("otlp-endpoint", "Export OpenTelemetry traces of every run to this OTLP/HTTP collector, e.g. http://otel-collector:4318. Empty disables tracing").StringVar(&cfg.OTLPEndpoint)
+	app.Flag("webhook-addr", "Serve a validating admission webhook for FluentdConfig/ConfigMap objects on this address, e.g. :8443. Empty disables the webhook").StringVar(&cfg.WebhookAddr)
+	app.Flag("webhook-cert-file", "TLS certificate used by the admission webhook (used only with --webhook-addr)").StringVar(&cfg.WebhookCertFile)
+	app.Flag("webhook-key-file", "TLS private key used by the admission webhook (used only with --webhook-addr)").StringVar(&cfg.WebhookKeyFile)
+	app.Flag("http-cert-file", "Serve the metrics, health, rollback, debug config and dry validation endpoints over TLS with this certificate").StringVar(&cfg.HTTPCertFile)
+	app.Flag("http-key-file", "TLS private key of --http-cert-file").StringVar(&cfg.HTTPKeyFile)
+	app.Flag("http-token-file", "Require the bearer token read from this file on the metrics, health, rollback, debug config and dry validation endpoints").StringVar(&cfg.HTTPTokenFile)
+	app.Flag("http-token-review", "Require a bearer token authenticated by a Kubernetes TokenReview on the metrics, health, rollback, debug config and dry validation endpoints, needs --http-allowed-user (default: false)").BoolVar(&cfg.HTTPTokenReview)
+	app.Flag("http-allowed-user", "Accept only the tokens of these users, e.g. system:serviceaccount:monitoring:prometheus (used only with --http-token-review)").StringsVar(&cfg.HTTPAllowedUsers)
+	app.Flag("http-token-audience", "Accept only the tokens issued for one of these audiences, none accepts the tokens of the API server (used only with --http-token-review)").Default(defaultHTTPTokenAudience).StringsVar(&cfg.HTTPTokenAudiences)
+	app.Flag("http-auth-probes", "Require the bearer token on /healthz and /readyz too, the kubelet probes cannot send one (default: false)").BoolVar(&cfg.HTTPAuthProbes)
+	app.Command(CommandRun, "Run the control loop (default)").Default()
+	validate := app.Command(CommandValidate, "Process and validate a namespace config from a file like the control loop does, without a cluster, and exit non-zero if it fails")
+	validate.Flag("file", "The namespace config to validate").Required().ExistingFileVar(&cfg.ValidateFile)
+	validate.Flag("namespace", "The namespace the config belongs to").Default("default").StringVar(&cfg.ValidateNamespace)
+	validate.Flag("admin-file", "The config of the admin namespace, for the virtual plugins and the default namespace config it defines").ExistingFileVar(&cfg.ValidateAdminFile)
+	cfg.ValidateLabels = map[string]string{}
+	validate.Flag("label", "A label of the namespace, in the key=value format, seen by the templated configs").StringMapVar(&cfg.ValidateLabels)
+
+	command, err := app.Parse(args)
 
 	if err != nil {
 		return err
 	}
+	cfg.Command = command
 
 	return nil
 }
@@ -290,3 +1141,177 @@ func (cfg *Config) hasValidBufferMountFolder() bool {
 	}
 	return true
 }
+
+// validateRetryPolicy checks the retry times parse and that every default is within its bound
+func (cfg *Config) validateRetryPolicy() error {
+	if cfg.MaxRetryMaxTimes > 0 && cfg.DefaultRetryMaxTimes > cfg.MaxRetryMaxTimes {
+		return fmt.Errorf("--default-retry-max-times %d is above --max-retry-max-times %d", cfg.DefaultRetryMaxTimes, cfg.MaxRetryMaxTimes)
+	}
+
+	times := map[string]time.Duration{}
+	for flag, value := range map[string]string{
+		"default-retry-wait":    cfg.DefaultRetryWait,
+		"min-retry-wait":        cfg.MinRetryWait,
+		"default-retry-timeout": cfg.DefaultRetryTimeout,
+		"max-retry-timeout":     cfg.MaxRetryTimeout,
+	} {
+		if value == "" {
+			continue
+		}
+		d, err := fluentd.ParseTime(value)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %v", flag, err)
+		}
+		times[flag] = d
+	}
+
+	checks := [][2]string{
+		{"min-retry-wait", "default-retry-wait"},
+		{"default-retry-timeout", "max-retry-timeout"},
+		{"default-retry-wait", "default-retry-timeout"},
+		{"min-retry-wait", "max-retry-timeout"},
+	}
+	for _, c := range checks {
+		lower, okLower := times[c[0]]
+		upper, okUpper := times[c[1]]
+		if okLower && okUpper && lower > upper {
+			return fmt.Errorf("--%s cannot be longer than --%s", c[0], c[1])
+		}
+	}
+
+	return nil
+}
+
+var reValidSourceName = regexp.MustCompile(`^[a-z0-9][-a-z0-9_]*$`)
+
+// loadNamespaceSources reads the templates of the log sources namespaces can select
+func (cfg *Config) loadNamespaceSources() error {
+	cfg.ParsedNamespaceSources = map[string]string{}
+	for name, file := range cfg.NamespaceSources {
+		if !reValidSourceName.MatchString(name) || name == "container" {
+			return fmt.Errorf("invalid --namespace-source name '%s'", name)
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("cannot read the template of log source %s: %v", name, err)
+		}
+
+		if _, err := template.New(name).Parse(string(data)); err != nil {
+			return fmt.Errorf("bad template of log source %s: %v", name, err)
+		}
+		cfg.ParsedNamespaceSources[name] = string(data)
+	}
+
+	return nil
+}
+
+// loadDefaultOutput reads the template of the output every namespace also sends its records to
+func (cfg *Config) loadDefaultOutput() error {
+	cfg.ParsedDefaultOutput = ""
+	if cfg.DefaultOutput == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(cfg.DefaultOutput)
+	if err != nil {
+		return fmt.Errorf("cannot read the template of the default output: %v", err)
+	}
+
+	if _, err := template.New("default-output").Parse(string(data)); err != nil {
+		return fmt.Errorf("bad template of the default output: %v", err)
+	}
+	cfg.ParsedDefaultOutput = string(data)
+
+	return nil
+}
+
+// LabelRoutingRule routes the namespaces labeled Label=Value to the output rendered by a template
+type LabelRoutingRule struct {
+	Label  string
+	Value  string
+	Output string
+}
+
+// loadLabelRoutes reads the templates of the --label-route outputs
+func (cfg *Config) loadLabelRoutes() error {
+	cfg.LabelRoutingRules = nil
+	for _, route := range cfg.LabelRoutes {
+		parts := strings.SplitN(route, "=", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return fmt.Errorf("invalid --label-route '%s', use the key=value=template-file format", route)
+		}
+		if _, err := labels.Parse(parts[0] + "=" + parts[1]); err != nil {
+			return fmt.Errorf("invalid --label-route '%s': %v", route, err)
+		}
+
+		data, err := ioutil.ReadFile(parts[2])
+		if err != nil {
+			return fmt.Errorf("cannot read the template of label route %s=%s: %v", parts[0], parts[1], err)
+		}
+		if _, err := template.New("label-route").Parse(string(data)); err != nil {
+			return fmt.Errorf("bad template of label route %s=%s: %v", parts[0], parts[1], err)
+		}
+
+		cfg.LabelRoutingRules = append(cfg.LabelRoutingRules, LabelRoutingRule{
+			Label:  parts[0],
+			Value:  parts[1],
+			Output: string(data),
+		})
+	}
+
+	return nil
+}
+
+var reValidAggregatorName = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9_.]*$`)
+
+// validateAggregators checks the aggregators namespaces are routed to with --aggregator-label
+func (cfg *Config) validateAggregators() error {
+	if cfg.AggregatorLabel == "" {
+		return nil
+	}
+
+	if len(cfg.Aggregators) == 0 {
+		return errors.New("using --aggregator-label requires at least one --aggregator")
+	}
+	for name, plugin := range cfg.Aggregators {
+		if !reValidAggregatorName.MatchString(name) {
+			return fmt.Errorf("invalid --aggregator name '%s'", name)
+		}
+		if plugin == "" {
+			return fmt.Errorf("no plugin given for aggregator %s, use the name=plugin format", name)
+		}
+	}
+
+	if _, ok := cfg.Aggregators[cfg.DefaultAggregator]; !ok {
+		return fmt.Errorf("--default-aggregator must be one of the --aggregator names, got '%s'", cfg.DefaultAggregator)
+	}
+
+	return nil
+}
+
+var reValidEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var reValidTimezone = regexp.MustCompile(`^(UTC|[+-]\d\d:\d\d)$`)
+
+// validateTimeFormat checks the time format can be safely embedded in a ruby string and that the
+// timezone is one Time#getlocal understands
+func (cfg *Config) validateTimeFormat() error {
+	if strings.ContainsAny(cfg.DefaultTimeFormat, `'\}`) {
+		return fmt.Errorf("--default-time-format cannot contain quotes, backslashes or '}'")
+	}
+
+	if cfg.DefaultTimezone == "" {
+		return nil
+	}
+
+	if cfg.DefaultTimeFormat == "" {
+		return fmt.Errorf("--default-timezone requires --default-time-format")
+	}
+
+	if !reValidTimezone.MatchString(cfg.DefaultTimezone) {
+		return fmt.Errorf("invalid --default-timezone '%s', use UTC or an offset like +02:00", cfg.DefaultTimezone)
+	}
+
+	return nil
+}
@@ -5,7 +5,12 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -30,6 +35,78 @@ func TestBadConfigs(t *testing.T) {
 		{"--meta-key=test", "--meta-values=a"},
 		{"--meta-key=test", "--meta-values=a="},
 		{"--meta-key=test", "--meta-values=a=="},
+		{"--prometheus-filter"},
+		{"--expected-plugins=fluent-plugin-s3=1.6.1"},
+		{"--pod-config-annotation=/x"},
+		{"--datasource=secret", "--crd-migration-mode"},
+		{"--metadata-field=pod_name", "--metadata-field=master_url"},
+		{"--datasource=git"},
+		{"--datasource=file"},
+		{"--dry-validate-addr=127.0.0.1:9005"},
+		{"--http-token-review"},
+		{"--datasource=file", "--file-dir=/etc/kfo/configs", "--crd-migration-mode"},
+		{"--file-dir=/etc/kfo/configs"},
+		{"--git-url=git@github.com:org/logging.git"},
+		{"--datasource=git", "--git-url=git@github.com:org/logging.git", "--crd-migration-mode"},
+		{"--datasource=git", "--git-url=git@github.com:org/logging.git", "--git-poll-interval=0s"},
+		{"--datasource=git", "--git-url=git@github.com:org/logging.git", "--git-path=../etc"},
+		{"--datasource=git", "--git-url=git@github.com:org/logging.git", "--git-branch=--upload-pack=touch /tmp/x"},
+		{"--datasource=git", "--git-url=https://github.com/org/logging.git", "--git-ssh-key-file=id_rsa", "--git-token-file=token"},
+		{"--pod-label-selector=app in (web"},
+		{"--pod-field-selector=spec.nodeName"},
+		{"--datasource=fs", "--fs-dir=/tmp", "--leader-election"},
+		{"--leader-election", "--leader-election-lease="},
+		{"--debug-config-addr=9003"},
+		{"--allowed-plugins=exec", "--denied-plugins=exec"},
+		{"--global-config=a/b/c"},
+		{"--global-config=logging/"},
+		{"--datasource=fs", "--fs-dir=/tmp", "--snippets-namespace=logging"},
+		{"--reload-debounce=-1s"},
+		{"--reload-debounce=10s", "--reload-debounce-max-wait=5s"},
+		{"--pod-config-annotation=example.com/fluentd", "--disable-pods"},
+		{"--webhook-addr=:8443"},
+		{"--webhook-addr=:8443", "--webhook-cert-file=tls.crt"},
+		{"--reserved-tag-prefix=kube.*"},
+		{"--single-namespace=team", "--namespaces=other"},
+		{"--default-retry-wait=soon"},
+		{"--default-retry-timeout=2h", "--max-retry-timeout=1h"},
+		{"--default-retry-max-times=30", "--max-retry-max-times=20"},
+		{"--default-retry-wait=1m", "--default-retry-timeout=30s"},
+		{"--default-time-format=%Y' + system('id') + '"},
+		{"--default-timezone=+02:00"},
+		{"--allowed-projects=p-1", "--project-annotation="},
+		{"--fluentd-monitor-addr=127.0.0.1:24220"},
+		{"--template-env=REGION", "--template-env=NOT-A-NAME"},
+		{"--namespace-source=systemd=/does/not/exist.conf"},
+		{"--namespace-source=container=/dev/null"},
+		{"--default-output=/does/not/exist.conf"},
+		{"--label-route=tier=prod"},
+		{"--label-route=tier=prod=/does/not/exist.conf"},
+		{"--label-route=tier/x/y=prod=/dev/null"},
+		{"--new-namespace-grace=-5s"},
+		{"--resync-period=-1m"},
+		{"--per-namespace-timeout=-30s"},
+		{"--max-reloads-per-minute=-1"},
+		{"--runtime-config-dir=/etc/runtime", "--runtime-config-configmap=fluentd-runtime-config"},
+		{"--datasource=fs", "--fs-dir=/tmp", "--runtime-config-dir=/etc/runtime"},
+		{"--prometheus-enabled", "--fluentd-monitor-addr=24220"},
+		{"--prometheus-enabled", "--fluentd-monitor-addr=127.0.0.1:24220", "--fluentd-monitor-interval=0"},
+		{"--default-time-format=%FT%T%z", "--default-timezone=Europe/Paris"},
+		{"--otlp-endpoint=otel-collector:4318"},
+		{"--lint-level=warn", "--lint-disable-rule=no-such-rule"},
+		{"--buffer-drain-timeout=2m"},
+		{"--buffer-drain-timeout=-2m", "--prometheus-enabled", "--fluentd-monitor-addr=127.0.0.1:24220"},
+		{"--otlp-endpoint=grpc://otel-collector:4317"},
+		{"--grpc-addr=9002"},
+		{"--grpc-addr=:9002"},
+		{"--grpc-addr=10.0.0.1:9002"},
+		{"--datasource=fs", "--fs-dir=/tmp", "--config-context=management"},
+		{"--namespace-selector=logging in (true"},
+		{"--exclude-namespaces=kube-[system"},
+		{"--aggregator-label=aggregator"},
+		{"--aggregator-label=aggregator", "--aggregator=us-east=agg-us-east"},
+		{"--aggregator-label=aggregator", "--aggregator=us-east=agg-us-east", "--default-aggregator=eu-west"},
+		{"--aggregator-label=aggregator", "--aggregator=us east=agg-us-east", "--default-aggregator=us east"},
 	}
 
 	for _, args := range inputs {
@@ -53,3 +130,126 @@ func TestNormalization(t *testing.T) {
 	assert.Equal(t, 60, cfg.IntervalSeconds)
 	assert.Equal(t, "info", cfg.LogLevel)
 }
+
+func TestGRPCAddr(t *testing.T) {
+	inputs := [][]string{
+		{"--grpc-addr=127.0.0.1:9002"},
+		{"--grpc-addr=[::1]:9002"},
+		{"--grpc-addr=localhost:9002"},
+		{"--grpc-addr=:9002", "--http-token-file=/etc/kfo/token"},
+		{"--grpc-addr=:9002", "--http-token-review", "--http-allowed-user=system:serviceaccount:monitoring:prometheus"},
+	}
+
+	for _, args := range inputs {
+		cfg := &Config{}
+		assert.Nil(t, cfg.ParseFlags(args))
+		assert.Nil(t, cfg.Validate(), "'%v' must pass validation", args)
+	}
+}
+
+func TestApplyRuntimeConfig(t *testing.T) {
+	base := &Config{}
+	err := base.ParseFlags([]string{"--namespaces=a", "--status-annotation=example.com/status"})
+	assert.Nil(t, err)
+	assert.Nil(t, base.Validate())
+
+	cfg := *base
+	applied, err := cfg.ApplyRuntimeConfig(base, map[string]string{
+		"namespaces":     "b, c\nd",
+		"strict-mode":    "true",
+		"log-level":      "debug",
+		"max-namespaces": "-1",
+		"kubeconfig":     "/tmp/other",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"log-level", "max-namespaces", "namespaces", "strict-mode"}, applied)
+	assert.Equal(t, []string{"b", "c", "d"}, cfg.Current().Namespaces)
+	assert.True(t, cfg.Current().StrictMode)
+	assert.Equal(t, logrus.DebugLevel, cfg.Current().GetLogLevel())
+	assert.Equal(t, 0, cfg.Current().MaxNamespaces)
+	assert.Equal(t, "", cfg.Current().KubeConfig)
+	assert.Equal(t, "example.com/status", cfg.Current().AnnotStatus)
+
+	// a bad runtime config changes nothing
+	_, err = cfg.ApplyRuntimeConfig(base, map[string]string{"status-annotation": "/hello"})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, cfg.Current().Namespaces)
+
+	// removed flags revert to their startup value
+	_, err = cfg.ApplyRuntimeConfig(base, map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, cfg.Current().Namespaces)
+	assert.False(t, cfg.Current().StrictMode)
+	assert.Equal(t, logrus.InfoLevel, cfg.Current().GetLogLevel())
+
+	// the reload rate can be tuned live
+	applied, err = cfg.ApplyRuntimeConfig(base, map[string]string{
+		"reload-debounce":        "0s",
+		"max-reloads-per-minute": "4",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"max-reloads-per-minute", "reload-debounce"}, applied)
+	assert.Equal(t, time.Duration(0), cfg.Current().ReloadDebounce)
+	assert.Equal(t, 4, cfg.Current().MaxReloadsPerMinute)
+
+	_, err = cfg.ApplyRuntimeConfig(base, map[string]string{"reload-debounce": "1h"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 4, cfg.Current().MaxReloadsPerMinute)
+
+	// the config the reloader started with is never changed
+	assert.Equal(t, []string{"a"}, cfg.Namespaces)
+	assert.Equal(t, 0, cfg.MaxReloadsPerMinute)
+	assert.Equal(t, cfg.Current(), base.Current())
+}
+
+func TestLeaderElectionInDaemonSet(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	assert.Nil(t, os.Setenv(workloadKindEnv, "DaemonSet"))
+	defer os.Unsetenv(workloadKindEnv)
+
+	cfg := &Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{"--leader-election"}))
+	assert.Nil(t, cfg.Validate())
+	assert.NotNil(t, hook.LastEntry())
+	assert.Contains(t, hook.LastEntry().Message, "runs in a DaemonSet")
+}
+
+func TestIsFlag(t *testing.T) {
+	assert.True(t, isFlag("kubeconfig"))
+	assert.True(t, isFlag("datasource"))
+	assert.True(t, isFlag("dry-run"))
+	assert.False(t, isFlag("no-such-flag"))
+}
+
+func TestLogFormat(t *testing.T) {
+	cfg := &Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{}))
+	assert.Equal(t, LogFormatText, cfg.LogFormat)
+	assert.IsType(t, &logrus.TextFormatter{}, cfg.GetLogFormatter())
+
+	assert.Nil(t, cfg.ParseFlags([]string{"--log-format=json"}))
+	assert.IsType(t, &logrus.JSONFormatter{}, cfg.GetLogFormatter())
+
+	assert.NotNil(t, cfg.ParseFlags([]string{"--log-format=xml"}))
+}
+
+func TestValidateCommand(t *testing.T) {
+	cfg := &Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{"--interval=30"}))
+	assert.Equal(t, CommandRun, cfg.Command)
+
+	cfg = &Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{"validate", "--file=config_test.go", "--label=team=a", "--allowed-plugins=null"}))
+	assert.Nil(t, cfg.Validate())
+	assert.Equal(t, CommandValidate, cfg.Command)
+	assert.Equal(t, "config_test.go", cfg.ValidateFile)
+	assert.Equal(t, "default", cfg.ValidateNamespace)
+	assert.Equal(t, map[string]string{"team": "a"}, cfg.ValidateLabels)
+	assert.Equal(t, []string{"null"}, cfg.AllowedPlugins)
+
+	cfg = &Config{}
+	assert.NotNil(t, cfg.ParseFlags([]string{"validate"}))
+	assert.NotNil(t, cfg.ParseFlags([]string{"validate", "--file=/does/not/exist.conf"}))
+}
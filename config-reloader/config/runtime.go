@@ -0,0 +1,187 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reloadableFlags are the flags that can be changed at runtime, keyed by flag name.
+// Every setter copies the field(s) backing the flag, including the parsed ones. The fields are
+// never changed in place: read them from Current()
+var reloadableFlags = map[string]func(dst, src *Config){
+	"log-level": func(dst, src *Config) {
+		dst.LogLevel = src.LogLevel
+		dst.level = src.level
+	},
+	"fluentd-loglevel":   func(dst, src *Config) { dst.FluentdLogLevel = src.FluentdLogLevel },
+	"status-annotation":  func(dst, src *Config) { dst.AnnotStatus = src.AnnotStatus },
+	"namespaces":         func(dst, src *Config) { dst.Namespaces = src.Namespaces },
+	"exclude-namespaces": func(dst, src *Config) { dst.ExcludeNamespaces = src.ExcludeNamespaces },
+	"namespace-priority": func(dst, src *Config) { dst.NamespacePriority = src.NamespacePriority },
+	"namespace-selector": func(dst, src *Config) {
+		dst.NamespaceSelector = src.NamespaceSelector
+		dst.ParsedNamespaceSelector = src.ParsedNamespaceSelector
+	},
+	"required-annotations":      func(dst, src *Config) { dst.RequiredAnnotations = src.RequiredAnnotations },
+	"max-namespaces":            func(dst, src *Config) { dst.MaxNamespaces = src.MaxNamespaces },
+	"max-flush-threads":         func(dst, src *Config) { dst.MaxFlushThreads = src.MaxFlushThreads },
+	"max-outputs-per-namespace": func(dst, src *Config) { dst.MaxOutputsPerNamespace = src.MaxOutputsPerNamespace },
+	"max-config-bytes":          func(dst, src *Config) { dst.MaxConfigBytes = src.MaxConfigBytes },
+	"max-rules-per-namespace":   func(dst, src *Config) { dst.MaxRulesPerNamespace = src.MaxRulesPerNamespace },
+	"lint-level":                func(dst, src *Config) { dst.LintLevel = src.LintLevel },
+	"lint-disable-rule":         func(dst, src *Config) { dst.LintDisabledRules = src.LintDisabledRules },
+	"allowed-plugins":           func(dst, src *Config) { dst.AllowedPlugins = src.AllowedPlugins },
+	"denied-plugins":            func(dst, src *Config) { dst.DeniedPlugins = src.DeniedPlugins },
+	"allowed-tail-paths":        func(dst, src *Config) { dst.AllowedTailPaths = src.AllowedTailPaths },
+	"allow-tag-expansion":       func(dst, src *Config) { dst.AllowTagExpansion = src.AllowTagExpansion },
+	"output-host-override":      func(dst, src *Config) { dst.OutputHostOverride = src.OutputHostOverride },
+	"warn-unrouted-tags":        func(dst, src *Config) { dst.WarnUnroutedTags = src.WarnUnroutedTags },
+	"warn-duplicate-routing":    func(dst, src *Config) { dst.WarnDuplicateRouting = src.WarnDuplicateRouting },
+	"strict-tag-isolation":      func(dst, src *Config) { dst.StrictTagIsolation = src.StrictTagIsolation },
+	"log-config-diffs":          func(dst, src *Config) { dst.LogConfigDiffs = src.LogConfigDiffs },
+	"strict-mode":               func(dst, src *Config) { dst.StrictMode = src.StrictMode },
+	"validate-secret-refs":      func(dst, src *Config) { dst.ValidateSecretRefs = src.ValidateSecretRefs },
+	"per-namespace-metrics":     func(dst, src *Config) { dst.PerNamespaceMetrics = src.PerNamespaceMetrics },
+	"reload-debounce":           func(dst, src *Config) { dst.ReloadDebounce = src.ReloadDebounce },
+	"reload-debounce-max-wait":  func(dst, src *Config) { dst.ReloadDebounceMaxWait = src.ReloadDebounceMaxWait },
+	"max-reloads-per-minute":    func(dst, src *Config) { dst.MaxReloadsPerMinute = src.MaxReloadsPerMinute },
+	"label-selector": func(dst, src *Config) {
+		dst.LabelSelector = src.LabelSelector
+		dst.ParsedLabelSelector = src.ParsedLabelSelector
+	},
+}
+
+// listFlags take several values, given comma or newline separated in the runtime config
+var listFlags = map[string]bool{
+	"namespaces":           true,
+	"exclude-namespaces":   true,
+	"namespace-priority":   true,
+	"required-annotations": true,
+	"allowed-plugins":      true,
+	"denied-plugins":       true,
+	"allowed-tail-paths":   true,
+}
+
+// boolFlags are given as true or false in the runtime config
+var boolFlags = map[string]bool{
+	"allow-tag-expansion":    true,
+	"warn-unrouted-tags":     true,
+	"warn-duplicate-routing": true,
+	"strict-tag-isolation":   true,
+	"log-config-diffs":       true,
+	"strict-mode":            true,
+	"validate-secret-refs":   true,
+	"per-namespace-metrics":  true,
+}
+
+// ReloadableFlags returns the names of the flags that can be changed at runtime, sorted
+func ReloadableFlags() []string {
+	res := make([]string, 0, len(reloadableFlags))
+	for name := range reloadableFlags {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// isFlag tells if name is a flag of the reloader, whether it is reloadable or not
+func isFlag(name string) bool {
+	err := (&Config{}).ParseFlags([]string{"--" + name})
+	return err == nil || !strings.Contains(err.Error(), "unknown long flag")
+}
+
+// Current returns the config in effect: the latest runtime config applied to cfg, or cfg itself.
+// The returned config is never changed, load it once per run or request and read it without lock
+func (cfg *Config) Current() *Config {
+	if cfg.current != nil {
+		if current, ok := cfg.current.Load().(*Config); ok {
+			return current
+		}
+	}
+	return cfg
+}
+
+// ApplyRuntimeConfig sets the reloadable flags from values (flag name -> value) on top of base,
+// the config the reloader started with, and publishes the result as cfg.Current(). cfg itself is
+// not changed. Flags missing from values revert to their base value. Flags that cannot be changed
+// at runtime are ignored with a warning. Nothing is changed if the resulting config is invalid.
+// Returns the names of the flags taken from values
+func (cfg *Config) ApplyRuntimeConfig(base *Config, values map[string]string) ([]string, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := []string{}
+	applied := []string{}
+	for _, name := range names {
+		if _, ok := reloadableFlags[name]; !ok {
+			if isFlag(name) {
+				logrus.Warnf("Ignoring runtime config %s, the flag is only read at startup: restart the reloader to change it", name)
+			} else {
+				logrus.Warnf("Ignoring runtime config %s, there is no such flag", name)
+			}
+			continue
+		}
+
+		applied = append(applied, name)
+		value := strings.TrimSpace(values[name])
+		switch {
+		case boolFlags[name]:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("bad runtime config: %s must be true or false", name)
+			}
+			if b {
+				args = append(args, "--"+name)
+			} else {
+				args = append(args, "--no-"+name)
+			}
+		case listFlags[name]:
+			for _, v := range strings.FieldsFunc(values[name], func(r rune) bool { return r == ',' || r == '\n' }) {
+				if v = strings.TrimSpace(v); v != "" {
+					args = append(args, fmt.Sprintf("--%s=%s", name, v))
+				}
+			}
+		default:
+			args = append(args, fmt.Sprintf("--%s=%s", name, value))
+		}
+	}
+
+	parsed := &Config{}
+	if err := parsed.ParseFlags(args); err != nil {
+		return nil, fmt.Errorf("bad runtime config: %+v", err)
+	}
+
+	next := *base
+	for _, name := range applied {
+		reloadableFlags[name](&next, parsed)
+	}
+
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("bad runtime config: %+v", err)
+	}
+
+	current := *cfg
+	for _, set := range reloadableFlags {
+		set(&current, &next)
+	}
+
+	if cfg.current == nil {
+		// a config that was not built by ParseFlags, it must not be shared yet
+		cfg.current = &atomic.Value{}
+		current.current = cfg.current
+	}
+	cfg.current.Store(&current)
+
+	return applied, nil
+}
@@ -5,36 +5,88 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 )
 
 type Controller struct {
-	Updater    Updater
-	OutputDir  string
-	Reloader   *fluentd.Reloader
-	Datasource datasource.Datasource
-	Generator  *generator.Generator
+	Updater        Updater
+	OutputDir      string
+	Reloader       *fluentd.Reloader
+	Datasource     datasource.Datasource
+	Generator      *generator.Generator
+	WriteChecksums bool
+	Source         string
+	// with a dry run fluentd is never reloaded
+	DryRun bool
+	// with a timeout the buffers moved by a new config are drained before the reload
+	BufferDrainTimeout time.Duration
+	MonitorURL         string
+	// requests for an immediate run, e.g. after a rollback
+	runNow chan struct{}
+	// statuses of the last run, read by the gRPC API
+	states      map[string]*datasource.NamespaceStatus
+	statesMutex sync.RWMutex
+	// with leader election the loop only runs while holding this lock
+	leaseLock resourcelock.Interface
+	// config hashes rendered by the last run, nil before the first one
+	configHashes map[string]string
+	// nil without --health-addr
+	health *Health
+	// nil until --max-reloads-per-minute is set
+	reloadLimit *reloadLimiter
+	// shared with the datasource, which applies the runtime config to it between runs
+	cfg *config.Config
 }
 
+// Run runs the control loop until stopped. With leader election it only runs while this replica
+// is the leader
 func (c *Controller) Run(ctx context.Context, stop <-chan struct{}) {
+	if c.leaseLock != nil {
+		c.runElected(ctx, stop)
+		return
+	}
+	c.loop(ctx, stop)
+}
+
+func (c *Controller) loop(ctx context.Context, stop <-chan struct{}) {
 	for {
 		err := c.RunOnce(ctx)
 		if err != nil {
 			logrus.Error(err)
+		} else if c.health != nil {
+			c.health.runSucceeded()
+		}
+
+		// with a staleness threshold an idle loop runs anyway, else it would look stuck
+		var resync <-chan time.Time
+		if c.health != nil && c.health.resyncInterval() > 0 {
+			resync = time.After(c.health.resyncInterval())
 		}
 
 		select {
 		case <-c.Updater.GetUpdateChannel():
+		case <-resync:
+		case <-c.runNow:
 		case <-stop:
 			logrus.Info("Terminating main controller loop")
 			return
+		case <-ctx.Done():
+			logrus.Info("Terminating main controller loop")
+			return
 		}
 	}
 }
@@ -60,36 +112,123 @@ func New(ctx context.Context, cfg *config.Config) (*Controller, error) {
 			return nil, err
 		}
 		reloader = fluentd.NewReloader(ctx, cfg.FluentdRPCPort)
-		up = NewOnDemandUpdater(ctx, updateChan)
+		// debounced even without --reload-debounce as the runtime config can set it later
+		up = NewDebouncedUpdater(ctx, updateChan, cfg.ReloadDebounce, cfg.ReloadDebounceMaxWait)
+		if !cfg.RunOnce {
+			reprocessOnSignal(updateChan)
+		}
 	}
 
 	gen := generator.New(ctx, cfg)
 	gen.SetStatusUpdater(ctx, ds)
+	if sc, ok := ds.(datasource.SecretChecker); ok {
+		gen.SetSecretChecker(sc)
+	}
+	if sr, ok := ds.(datasource.SnippetReader); ok && cfg.SnippetsNamespace != "" {
+		gen.SetSnippetReader(sr)
+	}
+	if er, ok := ds.(datasource.EventRecorder); ok {
+		gen.SetEventRecorder(er)
+	}
+
+	var monitorURL string
+	if cfg.FluentdMonitorAddr != "" {
+		monitorURL = fmt.Sprintf("http://%s/api/plugins.json", cfg.FluentdMonitorAddr)
+	}
+
+	var leaseLock resourcelock.Interface
+	if cfg.LeaderElection {
+		locker, ok := ds.(datasource.LeaseLocker)
+		if !ok {
+			return nil, fmt.Errorf("leader election is not supported with --datasource=%s", cfg.Datasource)
+		}
+		identity, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find the identity for the leader election: %+v", err)
+		}
+		leaseLock = locker.LeaseLock(cfg.LeaderElectionNamespace, cfg.LeaderElectionLease, identity)
+	}
+
+	var reloadLimit *reloadLimiter
+	if cfg.MaxReloadsPerMinute > 0 {
+		reloadLimit = newReloadLimiter(cfg.MaxReloadsPerMinute)
+	}
 
 	return &Controller{
-		Updater:    up,
-		OutputDir:  cfg.OutputDir,
-		Reloader:   reloader,
-		Datasource: ds,
-		Generator:  gen,
+		Updater:            up,
+		OutputDir:          cfg.OutputDir,
+		Reloader:           reloader,
+		Datasource:         ds,
+		Generator:          gen,
+		WriteChecksums:     cfg.ConfigChecksum,
+		DryRun:             cfg.DryRun,
+		Source:             sourceName(cfg),
+		BufferDrainTimeout: cfg.BufferDrainTimeout,
+		MonitorURL:         monitorURL,
+		runNow:             make(chan struct{}, 1),
+		leaseLock:          leaseLock,
+		reloadLimit:        reloadLimit,
+		cfg:                cfg,
 	}, nil
 }
 
-func (c *Controller) RunOnce(ctx context.Context) error {
+// sourceName describes where the namespace configs are read from
+func sourceName(cfg *config.Config) string {
+	source := cfg.Datasource
+	if source == "default" {
+		source = "configmap"
+	}
+
+	if cfg.CRDMigrationMode && source != "crd" {
+		source += "+crd"
+	}
+
+	return source
+}
+
+// followRuntimeConfig applies the reloadable flags the loop itself reads, in case the runtime
+// config changed them
+func (c *Controller) followRuntimeConfig() {
+	if c.cfg == nil {
+		return
+	}
+
+	cfg := c.cfg.Current()
+
+	if d, ok := c.Updater.(*DebouncedUpdater); ok {
+		d.setWindow(cfg.ReloadDebounce, cfg.ReloadDebounceMaxWait)
+	}
+
+	if c.reloadLimit != nil {
+		c.reloadLimit.setPerMinute(cfg.MaxReloadsPerMinute)
+	} else if cfg.MaxReloadsPerMinute > 0 {
+		c.reloadLimit = newReloadLimiter(cfg.MaxReloadsPerMinute)
+	}
+}
+
+func (c *Controller) RunOnce(ctx context.Context) (err error) {
 	logrus.Infof("Running main control loop")
 
+	ctx, span := metrics.StartSpan(ctx, metrics.SpanCycle)
+	defer func() { metrics.EndSpan(span, err) }()
+
+	start := time.Now()
 	allNamespaces, err := c.Datasource.GetNamespaces(ctx)
+	metrics.ObserveGetNamespacesDurationMetric(time.Since(start))
 	if err != nil {
+		// no namespace is generated in this run, the previous config stays in place
+		metrics.IncNamespaceErrorsMetric(datasource.ErrorPhaseFetch)
 		return err
 	}
+	c.followRuntimeConfig()
 
 	c.Generator.SetModel(allNamespaces)
 	configHashes, err := c.Generator.RenderToDisk(ctx, c.OutputDir)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	needsReload := false
+	changedNamespaces := []string{}
 
 	for _, nsConfig := range allNamespaces {
 		newHash, found := configHashes[nsConfig.Name]
@@ -100,16 +239,134 @@ func (c *Controller) RunOnce(ctx context.Context) error {
 		}
 
 		if newHash != nsConfig.PreviousConfigHash {
-			needsReload = true
+			changedNamespaces = append(changedNamespaces, nsConfig.Name)
 			c.Datasource.WriteCurrentConfigHash(nsConfig.Name, newHash)
 		}
 	}
 
-	if needsReload {
-		c.Reloader.ReloadConfiguration()
+	// the config of a namespace deleted or ignored since the last run is dropped from the output
+	removedNamespaces := []string{}
+	for ns := range c.configHashes {
+		if _, found := configHashes[ns]; !found {
+			removedNamespaces = append(removedNamespaces, ns)
+		}
+	}
+	sort.Strings(removedNamespaces)
+	c.configHashes = configHashes
+
+	metrics.SetChangedNamespacesMetric(len(changedNamespaces))
+	reload := len(changedNamespaces) > 0 || len(removedNamespaces) > 0
+	if reload {
+		action := "Reloading fluentd"
+		if c.DryRun {
+			action = "Dry run, not reloading fluentd"
+		}
+		if len(removedNamespaces) > 0 {
+			logrus.Infof("%s, %d of %d namespaces changed: %s, removed: %s", action,
+				len(changedNamespaces), len(allNamespaces), strings.Join(changedNamespaces, ", "), strings.Join(removedNamespaces, ", "))
+		} else {
+			logrus.Infof("%s, %d of %d namespaces changed: %s", action,
+				len(changedNamespaces), len(allNamespaces), strings.Join(changedNamespaces, ", "))
+		}
+	} else if c.reloadLimit != nil && c.reloadLimit.pending {
+		logrus.Infof("Reloading fluentd with the changes of a deferred reload")
+		reload = true
+	}
+
+	if reload && !c.DryRun {
+		outputs := c.Generator.DisruptedOutputs()
+		if c.reloadLimit != nil {
+			if !c.reloadLimit.allow(outputs, c.triggerRun) {
+				metrics.IncReloadsDeferredMetric()
+				logrus.Infof("Deferring the reload, fluentd is reloaded at most %d times per minute", c.reloadLimit.limiter.Burst())
+				reload = false
+			} else {
+				outputs = c.reloadLimit.takeDisruptedOutputs()
+			}
+		}
+
+		if reload {
+			if len(outputs) > 0 && c.BufferDrainTimeout > 0 {
+				c.drainBuffers(ctx, outputs)
+			}
+
+			_, reloadSpan := metrics.StartSpan(ctx, metrics.SpanReload)
+			c.Reloader.ReloadConfiguration()
+			reloadSpan.End()
+		}
 	}
 
 	c.Generator.CleanupUnusedFiles(c.OutputDir, configHashes)
 
+	if c.WriteChecksums && !c.DryRun {
+		if _, err := c.Generator.WriteChecksums(c.OutputDir); err != nil {
+			logrus.Warnf("Cannot write config checksums: %+v", err)
+		}
+	}
+
+	summary := c.Generator.StatusSummary(allNamespaces)
+	c.statesMutex.Lock()
+	c.states = summary
+	c.statesMutex.Unlock()
+
+	infos := make([]metrics.NamespaceInfo, 0, len(summary))
+	for ns, st := range summary {
+		infos = append(infos, metrics.NamespaceInfo{Namespace: ns, Status: st.Status, ConfigHash: st.Hash})
+	}
+	metrics.SetNamespaceInfoMetric(infos, c.Source)
+
+	if w, ok := c.Datasource.(datasource.StatusSummaryWriter); ok {
+		if err := w.WriteStatusSummary(ctx, summary); err != nil {
+			logrus.Warnf("Cannot write status summary: %+v", err)
+		}
+	}
+
 	return nil
 }
+
+// NamespaceStates returns the statuses of the namespaces processed by the last run
+func (c *Controller) NamespaceStates() map[string]*datasource.NamespaceStatus {
+	c.statesMutex.RLock()
+	defer c.statesMutex.RUnlock()
+
+	res := make(map[string]*datasource.NamespaceStatus, len(c.states))
+	for ns, st := range c.states {
+		stCopy := *st
+		res[ns] = &stCopy
+	}
+	return res
+}
+
+// FailedNamespaces returns the sorted names of the namespaces whose config failed in the last run
+func (c *Controller) FailedNamespaces() []string {
+	c.statesMutex.RLock()
+	defer c.statesMutex.RUnlock()
+
+	failed := []string{}
+	for ns, st := range c.states {
+		if st.Status == datasource.StatusError {
+			failed = append(failed, ns)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// drainBuffers flushes fluentd and waits for the buffers of the given outputs to drain. The reload
+// goes ahead after the timeout anyway, the chunks left in these buffers are not read by the new config
+func (c *Controller) drainBuffers(ctx context.Context, outputs []string) {
+	logrus.Infof("The new config moves or removes the file buffers of %s, draining them first", strings.Join(outputs, ", "))
+	start := time.Now()
+
+	ctx, span := metrics.StartSpan(ctx, metrics.SpanDrain)
+	err := c.Reloader.DrainBuffers(ctx, c.MonitorURL, outputs, c.BufferDrainTimeout)
+	metrics.EndSpan(span, err)
+	if err != nil {
+		metrics.IncBufferDrainsMetric(metrics.DrainResultTimeout)
+		logrus.Warnf("Reloading anyway, buffered data may be lost: %+v", err)
+		return
+	}
+
+	metrics.IncBufferDrainsMetric(metrics.DrainResultDrained)
+	logrus.Infof("Buffers drained in %v", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,55 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailedNamespaces(t *testing.T) {
+	c := &Controller{}
+	assert.Equal(t, []string{}, c.FailedNamespaces())
+
+	c.states = map[string]*datasource.NamespaceStatus{
+		"ok":       {Status: datasource.StatusOK},
+		"zzz":      {Status: datasource.StatusError, Phase: datasource.ErrorPhaseValidation},
+		"disabled": {Status: datasource.StatusDisabled},
+		"bad":      {Status: datasource.StatusError, Phase: datasource.ErrorPhaseValidation},
+	}
+	assert.Equal(t, []string{"bad", "zzz"}, c.FailedNamespaces())
+}
+
+func TestFollowRuntimeConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &config.Config{ReloadDebounce: 5 * time.Second, ReloadDebounceMaxWait: 30 * time.Second}
+	up := NewDebouncedUpdater(ctx, make(chan time.Time), cfg.ReloadDebounce, cfg.ReloadDebounceMaxWait)
+	c := &Controller{Updater: up, cfg: cfg}
+
+	c.followRuntimeConfig()
+	assert.Nil(t, c.reloadLimit)
+
+	// as changed by the runtime config
+	cfg.ReloadDebounce = time.Second
+	cfg.MaxReloadsPerMinute = 2
+	c.followRuntimeConfig()
+	quiet, maxWait := up.window()
+	assert.Equal(t, time.Second, quiet)
+	assert.Equal(t, 30*time.Second, maxWait)
+	assert.Equal(t, 2, c.reloadLimit.limiter.Burst())
+
+	cfg.MaxReloadsPerMinute = 0
+	c.followRuntimeConfig()
+	assert.True(t, c.reloadLimit.allow(nil, func() {}))
+	assert.True(t, c.reloadLimit.allow(nil, func() {}))
+	assert.True(t, c.reloadLimit.allow(nil, func() {}))
+}
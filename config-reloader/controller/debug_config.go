@@ -0,0 +1,87 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	debugConfigPath  = "/config"
+	debugPluginsPath = "/plugins"
+)
+
+// debugConfigHandler serves GET /config with the combined config of the last render,
+// GET /config/{namespace} with the config and the status of a namespace, both with the credentials redacted,
+// and GET /plugins with the plugins installed in the fluentd image
+func (c *Controller) debugConfigHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(debugPluginsPath, func(w http.ResponseWriter, r *http.Request) {
+		installed := c.Generator.InstalledPlugins()
+		if installed == nil {
+			http.Error(w, "the installed plugins are not known, use --fluent-gem-binary", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(installed)
+	})
+
+	mux.HandleFunc(debugConfigPath, func(w http.ResponseWriter, r *http.Request) {
+		config := c.Generator.CombinedDebugConfig()
+		if config == "" {
+			http.Error(w, "no config generated yet", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(config))
+	})
+
+	mux.HandleFunc(debugConfigPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		ns := strings.TrimPrefix(r.URL.Path, debugConfigPath+"/")
+		config := c.Generator.DebugConfig(ns)
+		if config == nil {
+			http.Error(w, "no config generated for namespace "+ns, http.StatusNotFound)
+			return
+		}
+
+		res := struct {
+			*generator.DebugConfig
+			Status *datasource.NamespaceStatus `json:"status,omitempty"`
+		}{
+			DebugConfig: config,
+			Status:      c.NamespaceStates()[ns],
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+
+	return mux
+}
+
+// ServeDebugConfig serves the generated configs in the background, through the gate
+func (c *Controller) ServeDebugConfig(addr string, gate *httpauth.Gate) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: gate.Handler(c.debugConfigHandler()),
+	}
+
+	go func() {
+		logrus.Infof("Serving the generated configs on %s%s and the installed plugins on %s%s", addr, debugConfigPath, addr, debugPluginsPath)
+		if err := gate.ListenAndServe(srv); err != nil {
+			logrus.Errorf("Debug config server stopped: %+v", err)
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugConfigHandler(t *testing.T) {
+	c := &Controller{
+		Generator: generator.New(context.Background(), &config.Config{TemplatesDir: "../templates"}),
+	}
+	srv := httptest.NewServer(c.debugConfigHandler())
+	defer srv.Close()
+
+	// nothing generated yet
+	resp, err := http.Get(srv.URL + "/config")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/config/demo")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the plugin inventory is not known yet
+	resp, err = http.Get(srv.URL + "/plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	c.Generator.SetInstalledPlugins(map[string]string{"fluent-plugin-concat": "2.5.0"})
+	resp, err = http.Get(srv.URL + "/plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	installed := map[string]string{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&installed))
+	assert.Equal(t, "2.5.0", installed["fluent-plugin-concat"])
+}
@@ -0,0 +1,85 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/sirupsen/logrus"
+)
+
+const dryValidatePath = "/dry-validate/"
+
+// maxDryValidateBytes is the size limit of a ConfigMap, no namespace config can be larger
+const maxDryValidateBytes = 1 << 20
+
+// dryValidateHandler serves POST /dry-validate/{namespace} with a proposed config of the namespace
+// as body. It answers with the outcome of the checks of a run, without applying anything
+func (c *Controller) dryValidateHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(dryValidatePath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST with the proposed config as body", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ns := strings.TrimPrefix(r.URL.Path, dryValidatePath)
+		if ns == "" || strings.Contains(ns, "/") {
+			http.Error(w, "use /dry-validate/{namespace}", http.StatusBadRequest)
+			return
+		}
+		if c.cfg != nil && ns == c.cfg.AdminNamespace {
+			http.Error(w, "the admin namespace is not validated", http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxDryValidateBytes))
+		if err != nil {
+			http.Error(w, "cannot read the proposed config: "+err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		nsConf := &datasource.NamespaceConfig{
+			Name:          ns,
+			FluentdConfig: string(body),
+		}
+		if reader, ok := c.Datasource.(datasource.NamespaceMetadataReader); ok {
+			// a namespace that does not exist yet is validated without them
+			if labels, annotations, err := reader.NamespaceMetadata(ns); err == nil {
+				nsConf.Labels, nsConf.Annotations = labels, annotations
+			}
+		}
+
+		res := c.Generator.DryValidateNamespace(r.Context(), nsConf)
+		logrus.Debugf("Dry validation of a config of namespace %s, valid: %t", ns, res.Valid)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+
+	return mux
+}
+
+// ServeDryValidate serves the dry validation of proposed namespace configs in the background,
+// through the gate
+func (c *Controller) ServeDryValidate(addr string, gate *httpauth.Gate) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: gate.Handler(c.dryValidateHandler()),
+	}
+
+	go func() {
+		logrus.Infof("Serving dry validations of namespace configs on %s%s", addr, dryValidatePath)
+		if err := gate.ListenAndServe(srv); err != nil {
+			logrus.Errorf("Dry validation server stopped: %+v", err)
+		}
+	}()
+}
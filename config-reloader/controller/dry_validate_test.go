@@ -0,0 +1,94 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryValidateHandler(t *testing.T) {
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		DeniedPlugins:  []string{"exec"},
+	}
+	c := &Controller{
+		Generator: generator.New(context.Background(), cfg),
+		cfg:       cfg,
+	}
+	srv := httptest.NewServer(c.dryValidateHandler())
+	defer srv.Close()
+
+	validate := func(path string, body string) (*http.Response, *generator.DryValidation) {
+		resp, err := http.Post(srv.URL+path, "text/plain", strings.NewReader(body))
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+
+		res := &generator.DryValidation{}
+		if resp.StatusCode == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(resp.Body).Decode(res))
+		}
+		return resp, res
+	}
+
+	resp, res := validate("/dry-validate/demo", "<match **>\n  @type null\n</match>\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, res.Valid)
+	assert.Equal(t, "demo", res.Namespace)
+
+	resp, res = validate("/dry-validate/demo", "<match **>\n  @type exec\n</match>\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, res.Valid)
+	assert.Equal(t, "PolicyError", res.Phase)
+
+	resp, _ = validate("/dry-validate/kube-system", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = validate("/dry-validate/", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err := http.Get(srv.URL + "/dry-validate/demo")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestDryValidateNeedsToken(t *testing.T) {
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	}
+	c := &Controller{
+		Generator: generator.New(context.Background(), cfg),
+		cfg:       cfg,
+	}
+	gate := &httpauth.Gate{Token: "s3cret"}
+	srv := httptest.NewServer(gate.Handler(c.dryValidateHandler()))
+	defer srv.Close()
+
+	post := func(token string) int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/dry-validate/demo", strings.NewReader("<match **>\n  @type null\n</match>\n"))
+		assert.Nil(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post(""))
+	assert.Equal(t, http.StatusUnauthorized, post("wrong"))
+	assert.Equal(t, http.StatusOK, post("s3cret"))
+}
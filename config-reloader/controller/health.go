@@ -0,0 +1,160 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// Health backs the probes of the reloader. It is served before the controller exists so that
+// the probes answer while the informers are syncing
+type Health struct {
+	// with a zero staleAfter the control loop is never reported as stuck
+	staleAfter time.Duration
+	mutex      sync.RWMutex
+	// nil until the datasource is created and its caches are synced
+	ready func() bool
+	// a standby replica of a leader election does not run the control loop
+	active bool
+	// the last successful run, or when the loop became active
+	lastRun time.Time
+}
+
+// NewHealth creates the health of a reloader whose control loop must succeed at least every staleAfter
+func NewHealth(staleAfter time.Duration) *Health {
+	return &Health{
+		staleAfter: staleAfter,
+		active:     true,
+		lastRun:    time.Now(),
+	}
+}
+
+// setDatasource marks the caches as synced, the datasource is then ready if its own check agrees
+func (h *Health) setDatasource(ds datasource.Datasource) {
+	ready := func() bool { return true }
+	if rc, ok := ds.(datasource.ReadinessChecker); ok {
+		ready = rc.IsReady
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.ready = ready
+}
+
+// setActive tells if the control loop is running, becoming active starts a staleness window anew
+func (h *Health) setActive(active bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.active = active
+	h.lastRun = time.Now()
+}
+
+// runSucceeded records a successful run of the control loop
+func (h *Health) runSucceeded() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.lastRun = time.Now()
+}
+
+// resyncInterval is how often the control loop runs without any change so that an idle reloader
+// does not look stuck, zero if it never needs to
+func (h *Health) resyncInterval() time.Duration {
+	return h.staleAfter / 2
+}
+
+// stale returns why the control loop looks stuck, empty if it does not
+func (h *Health) stale() string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.staleAfter <= 0 || !h.active {
+		return ""
+	}
+	if since := time.Since(h.lastRun); since > h.staleAfter {
+		return fmt.Sprintf("no successful run for %v, more than %v", since.Round(time.Second), h.staleAfter)
+	}
+	return ""
+}
+
+// notReady returns why the reloader is not ready, empty if it is
+func (h *Health) notReady() string {
+	h.mutex.RLock()
+	ready := h.ready
+	h.mutex.RUnlock()
+
+	if ready == nil {
+		return "the informer caches are not synced yet"
+	}
+	if !ready() {
+		return "the datasource is not ready"
+	}
+	return ""
+}
+
+// handler serves GET /healthz failing once the control loop is stuck and GET /readyz failing
+// until the caches are synced and the datasource is ready
+func (h *Health) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(healthzPath, func(w http.ResponseWriter, r *http.Request) {
+		if reason := h.stale(); reason != "" {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc(readyzPath, func(w http.ResponseWriter, r *http.Request) {
+		if reason := h.notReady(); reason != "" {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	return mux
+}
+
+// Serve serves the probes in the background. Unless authProbes is set they are exempt from the
+// bearer tokens of the gate, the kubelet cannot send one
+func (h *Health) Serve(addr string, gate *httpauth.Gate, authProbes bool) {
+	exempt := []string{healthzPath, readyzPath}
+	if authProbes {
+		exempt = nil
+	}
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: gate.Handler(h.handler(), exempt...),
+	}
+
+	go func() {
+		logrus.Infof("Serving the health probes on %s%s and %s%s", addr, healthzPath, addr, readyzPath)
+		if err := gate.ListenAndServe(srv); err != nil {
+			logrus.Errorf("Health probe server stopped: %+v", err)
+		}
+	}()
+}
+
+// SetHealth reports the state of the controller to the health probes
+func (c *Controller) SetHealth(h *Health) {
+	c.health = h
+	h.setDatasource(c.Datasource)
+	if c.leaseLock != nil {
+		// standing by until elected
+		h.setActive(false)
+	}
+}
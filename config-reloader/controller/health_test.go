@@ -0,0 +1,68 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type readinessDatasource struct {
+	datasource.Datasource
+	ready bool
+}
+
+func (d *readinessDatasource) IsReady() bool {
+	return d.ready
+}
+
+func TestHealthHandler(t *testing.T) {
+	h := NewHealth(time.Minute)
+	srv := httptest.NewServer(h.handler())
+	defer srv.Close()
+
+	status := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// syncing
+	assert.Equal(t, http.StatusServiceUnavailable, status(readyzPath))
+	assert.Equal(t, http.StatusOK, status(healthzPath))
+
+	ds := &readinessDatasource{}
+	c := &Controller{Datasource: ds}
+	c.SetHealth(h)
+	assert.Equal(t, http.StatusServiceUnavailable, status(readyzPath))
+	ds.ready = true
+	assert.Equal(t, http.StatusOK, status(readyzPath))
+
+	// no successful run for too long
+	h.lastRun = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, http.StatusServiceUnavailable, status(healthzPath))
+	h.runSucceeded()
+	assert.Equal(t, http.StatusOK, status(healthzPath))
+
+	// a standby replica is not stuck
+	h.lastRun = time.Now().Add(-2 * time.Minute)
+	h.setActive(false)
+	assert.Equal(t, http.StatusOK, status(healthzPath))
+	h.setActive(true)
+	assert.Equal(t, http.StatusOK, status(healthzPath))
+}
+
+func TestHealthNeverStale(t *testing.T) {
+	h := NewHealth(0)
+	h.lastRun = time.Now().Add(-time.Hour)
+	assert.Equal(t, "", h.stale())
+	assert.Equal(t, time.Duration(0), h.resyncInterval())
+}
@@ -0,0 +1,85 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+// timings of the leader election, the usual ones of the Kubernetes controllers
+var (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// runElected runs the control loop only while this replica holds the lease. Losing the lease
+// stops the loop once its current run is done, the replica then stands by until it is elected again
+func (c *Controller) runElected(ctx context.Context, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	identity := c.leaseLock.Identity()
+	for ctx.Err() == nil {
+		leading := make(chan context.Context, 1)
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            c.leaseLock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            c.leaseLock.Describe(),
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					leading <- leaderCtx
+				},
+				OnStoppedLeading: func() {},
+				OnNewLeader: func(leader string) {
+					if leader != identity {
+						logrus.Infof("%s is the leader, standing by", leader)
+					}
+				},
+			},
+		})
+		if err != nil {
+			logrus.Errorf("Cannot run the leader election: %+v", err)
+			return
+		}
+
+		done := make(chan struct{})
+		go func() {
+			elector.Run(ctx)
+			close(done)
+		}()
+
+		select {
+		case leaderCtx := <-leading:
+			logrus.Infof("Elected leader with lease %s, starting the control loop", c.leaseLock.Describe())
+			if c.health != nil {
+				c.health.setActive(true)
+			}
+			c.loop(leaderCtx, stop)
+			if c.health != nil {
+				c.health.setActive(false)
+			}
+			<-done
+			if ctx.Err() == nil {
+				logrus.Warnf("Lost the lease %s, the control loop is stopped", c.leaseLock.Describe())
+			}
+		case <-done:
+		}
+	}
+	logrus.Info("Terminating main controller loop")
+}
@@ -0,0 +1,84 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// countingDatasource counts the runs of the control loop, each of them failing to fetch
+type countingDatasource struct {
+	runs int32
+}
+
+func (d *countingDatasource) UpdateStatus(ctx context.Context, namespace string, status string) {}
+
+func (d *countingDatasource) GetNamespaces(ctx context.Context) ([]*datasource.NamespaceConfig, error) {
+	atomic.AddInt32(&d.runs, 1)
+	return nil, errors.New("no namespaces here")
+}
+
+func (d *countingDatasource) WriteCurrentConfigHash(namespace string, hash string) {}
+
+func testLeaseLock(client kubernetes.Interface, identity string) resourcelock.Interface {
+	return &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-fluentd-operator"},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+}
+
+func TestOnlyTheLeaderRuns(t *testing.T) {
+	defer func(d, r, p time.Duration) { leaseDuration, renewDeadline, retryPeriod = d, r, p }(leaseDuration, renewDeadline, retryPeriod)
+	leaseDuration, renewDeadline, retryPeriod = time.Second, 500*time.Millisecond, 50*time.Millisecond
+
+	client := fake.NewSimpleClientset()
+	start := func(identity string) (*countingDatasource, chan struct{}, chan struct{}) {
+		ds := &countingDatasource{}
+		c := &Controller{
+			Updater:    NewOnDemandUpdater(context.Background(), make(chan time.Time)),
+			Datasource: ds,
+			runNow:     make(chan struct{}, 1),
+			leaseLock:  testLeaseLock(client, identity),
+		}
+
+		stop, done := make(chan struct{}), make(chan struct{})
+		go func() {
+			c.Run(context.Background(), stop)
+			close(done)
+		}()
+		return ds, stop, done
+	}
+	runs := func(ds *countingDatasource) func() bool {
+		return func() bool { return atomic.LoadInt32(&ds.runs) > 0 }
+	}
+
+	first, stopFirst, firstDone := start("first")
+	assert.Eventually(t, runs(first), 5*time.Second, 10*time.Millisecond)
+
+	second, stopSecond, secondDone := start("second")
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&second.runs))
+
+	// the lease is released on the way out, the standby takes over
+	close(stopFirst)
+	<-firstDone
+	assert.Eventually(t, runs(second), 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&first.runs))
+
+	close(stopSecond)
+	<-secondDone
+}
@@ -0,0 +1,83 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// reloadLimiter caps the fluentd reloads with a token bucket of --max-reloads-per-minute tokens.
+// A reload over the limit is deferred: the new config is already written, the next run allowed
+// to reload applies it together with the changes made in between. It is only used by the loop
+type reloadLimiter struct {
+	limiter   *rate.Limiter
+	perMinute int
+	// a reload was deferred and is still due
+	pending bool
+	// the outputs whose buffers the deferred config disrupts, they are drained by the next reload
+	disruptedOutputs map[string]bool
+	// when the run scheduled for the next token starts
+	retryAt time.Time
+}
+
+func newReloadLimiter(perMinute int) *reloadLimiter {
+	return &reloadLimiter{
+		limiter:          rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), perMinute),
+		perMinute:        perMinute,
+		disruptedOutputs: map[string]bool{},
+	}
+}
+
+// setPerMinute changes the limit, e.g. from the runtime config. Without a limit the next reload is
+// allowed, so a deferred one still happens and drains the outputs its config disrupts
+func (l *reloadLimiter) setPerMinute(perMinute int) {
+	if perMinute == l.perMinute {
+		return
+	}
+	l.perMinute = perMinute
+	if perMinute <= 0 {
+		l.limiter.SetLimit(rate.Inf)
+		return
+	}
+	l.limiter.SetLimit(rate.Every(time.Minute / time.Duration(perMinute)))
+	l.limiter.SetBurst(perMinute)
+}
+
+// allow tells if fluentd can be reloaded now. Otherwise the reload is deferred and trigger is
+// called once the next reload is allowed
+func (l *reloadLimiter) allow(outputs []string, trigger func()) bool {
+	for _, o := range outputs {
+		l.disruptedOutputs[o] = true
+	}
+
+	now := time.Now()
+	r := l.limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		l.pending = false
+		return true
+	}
+
+	r.CancelAt(now)
+	l.pending = true
+	if now.After(l.retryAt) {
+		l.retryAt = now.Add(delay)
+		time.AfterFunc(delay, trigger)
+	}
+	return false
+}
+
+// takeDisruptedOutputs returns the outputs to drain before the allowed reload
+func (l *reloadLimiter) takeDisruptedOutputs() []string {
+	res := make([]string, 0, len(l.disruptedOutputs))
+	for o := range l.disruptedOutputs {
+		res = append(res, o)
+	}
+	sort.Strings(res)
+	l.disruptedOutputs = map[string]bool{}
+	return res
+}
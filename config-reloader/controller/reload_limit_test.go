@@ -0,0 +1,74 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestReloadLimiter(t *testing.T) {
+	l := newReloadLimiter(2)
+	triggered := make(chan struct{}, 10)
+	trigger := func() { triggered <- struct{}{} }
+
+	// the bucket starts full
+	assert.True(t, l.allow(nil, trigger))
+	assert.True(t, l.allow(nil, trigger))
+	assert.False(t, l.pending)
+
+	// the next reloads wait for a token, a single run is scheduled for it
+	assert.False(t, l.allow([]string{"out_b"}, trigger))
+	assert.False(t, l.allow([]string{"out_a", "out_b"}, trigger))
+	assert.True(t, l.pending)
+	assert.True(t, time.Until(l.retryAt) > 20*time.Second)
+
+	// the disrupted outputs of the deferred configs are drained by the allowed reload
+	l.limiter.SetLimit(rate.Inf)
+	assert.True(t, l.allow(nil, trigger))
+	assert.False(t, l.pending)
+	assert.Equal(t, []string{"out_a", "out_b"}, l.takeDisruptedOutputs())
+	assert.Empty(t, l.takeDisruptedOutputs())
+	assert.Equal(t, 0, len(triggered))
+}
+
+func TestReloadLimiterTriggersRun(t *testing.T) {
+	l := newReloadLimiter(600)
+	triggered := make(chan struct{}, 10)
+	trigger := func() { triggered <- struct{}{} }
+
+	for i := 0; i < 600; i++ {
+		assert.True(t, l.allow(nil, trigger))
+	}
+	assert.False(t, l.allow(nil, trigger))
+
+	select {
+	case <-triggered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run was triggered for the deferred reload")
+	}
+	assert.True(t, l.allow(nil, trigger))
+}
+
+func TestReloadLimiterSetPerMinute(t *testing.T) {
+	l := newReloadLimiter(1)
+	trigger := func() {}
+
+	assert.True(t, l.allow(nil, trigger))
+	assert.False(t, l.allow([]string{"out_a"}, trigger))
+	assert.True(t, l.pending)
+
+	// lifting the limit lets the deferred reload through with its disrupted outputs
+	l.setPerMinute(0)
+	assert.True(t, l.allow(nil, trigger))
+	assert.False(t, l.pending)
+	assert.Equal(t, []string{"out_a"}, l.takeDisruptedOutputs())
+
+	l.setPerMinute(3)
+	assert.Equal(t, 3, l.limiter.Burst())
+	assert.Equal(t, rate.Every(20*time.Second), l.limiter.Limit())
+}
@@ -0,0 +1,80 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	lastGoodPath = "/last-good/"
+	rollbackPath = "/rollback/"
+)
+
+// rollbackHandler serves GET /last-good/{namespace} with the last good config of a namespace and
+// POST /rollback/{namespace} applying it again in an immediate run
+func (c *Controller) rollbackHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(lastGoodPath, func(w http.ResponseWriter, r *http.Request) {
+		ns := strings.TrimPrefix(r.URL.Path, lastGoodPath)
+		snapshot := c.Generator.LastGoodConfig(ns)
+		if snapshot == nil {
+			http.Error(w, "no last good config known for namespace "+ns, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	})
+
+	mux.HandleFunc(rollbackPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST to roll back a namespace", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ns := strings.TrimPrefix(r.URL.Path, rollbackPath)
+		if err := c.Generator.Rollback(ns); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		c.triggerRun()
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
+
+// ServeRollback serves the last good configs and the rollback endpoint in the background, through
+// the gate
+func (c *Controller) ServeRollback(addr string, gate *httpauth.Gate) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: gate.Handler(c.rollbackHandler()),
+	}
+
+	go func() {
+		logrus.Infof("Serving last good configs on %s%s and rollbacks on %s%s", addr, lastGoodPath, addr, rollbackPath)
+		if err := gate.ListenAndServe(srv); err != nil {
+			logrus.Errorf("Rollback server stopped: %+v", err)
+		}
+	}()
+}
+
+// triggerRun makes the control loop run right away
+func (c *Controller) triggerRun() {
+	select {
+	case c.runNow <- struct{}{}:
+	default:
+		// a run is already pending
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollbackHandler(t *testing.T) {
+	c := &Controller{
+		Generator: generator.New(context.Background(), &config.Config{TemplatesDir: "../templates"}),
+		runNow:    make(chan struct{}, 1),
+	}
+	srv := httptest.NewServer(c.rollbackHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/last-good/demo")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/rollback/demo")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// nothing to roll back to, no run is triggered
+	resp, err = http.Post(srv.URL+"/rollback/demo", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, 0, len(c.runNow))
+}
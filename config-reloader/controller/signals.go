@@ -0,0 +1,33 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reprocessSignal forces a control loop run over all namespaces. SIGUSR2 is kept free
+// for other maintenance actions, don't reuse it here
+var reprocessSignal = syscall.SIGUSR1
+
+// reprocessOnSignal triggers a control loop run every time the reloader receives reprocessSignal
+func reprocessOnSignal(updateChan chan time.Time) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, reprocessSignal)
+
+	go func() {
+		for sig := range signals {
+			logrus.Infof("Received %v, reprocessing all namespaces", sig)
+			// a pending run reprocesses everything anyway
+			util.NotifyUpdate(updateChan)
+		}
+	}()
+}
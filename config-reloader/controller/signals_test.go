@@ -0,0 +1,27 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReprocessOnSignal(t *testing.T) {
+	updateChan := make(chan time.Time, 1)
+	reprocessOnSignal(updateChan)
+
+	p, err := os.FindProcess(os.Getpid())
+	assert.Nil(t, err)
+	assert.Nil(t, p.Signal(reprocessSignal))
+
+	select {
+	case <-updateChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update after the signal")
+	}
+}
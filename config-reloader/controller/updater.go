@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"sync"
 	"time"
 )
 
@@ -35,3 +36,72 @@ func NewOnDemandUpdater(ctx context.Context, channel chan time.Time) *OnDemandUp
 func (o *OnDemandUpdater) GetUpdateChannel() <-chan time.Time {
 	return o.channel
 }
+
+// DebouncedUpdater coalesces the notifications of another channel: it delivers one once no other
+// notification came for the quiet window, or at the latest maxWait after the first one so that a
+// continuous stream of notifications cannot delay the update forever. Without a quiet window every
+// notification is delivered right away
+type DebouncedUpdater struct {
+	channel chan time.Time
+
+	mutex   sync.Mutex
+	quiet   time.Duration
+	maxWait time.Duration
+}
+
+func NewDebouncedUpdater(ctx context.Context, input <-chan time.Time, quiet time.Duration, maxWait time.Duration) *DebouncedUpdater {
+	d := &DebouncedUpdater{channel: make(chan time.Time, 1), quiet: quiet, maxWait: maxWait}
+	go d.run(ctx, input)
+	return d
+}
+
+// setWindow changes the windows for the next notifications, e.g. from the runtime config
+func (d *DebouncedUpdater) setWindow(quiet time.Duration, maxWait time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.quiet, d.maxWait = quiet, maxWait
+}
+
+func (d *DebouncedUpdater) window() (time.Duration, time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.quiet, d.maxWait
+}
+
+func (d *DebouncedUpdater) run(ctx context.Context, input <-chan time.Time) {
+	var quietDone, maxWaitDone <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-input:
+			quiet, maxWait := d.window()
+			if quiet <= 0 {
+				d.notify(t)
+				break
+			}
+			quietDone = time.After(quiet)
+			if maxWaitDone == nil {
+				maxWaitDone = time.After(maxWait)
+			}
+			continue
+		case t := <-quietDone:
+			d.notify(t)
+		case t := <-maxWaitDone:
+			d.notify(t)
+		}
+		quietDone, maxWaitDone = nil, nil
+	}
+}
+
+func (d *DebouncedUpdater) notify(t time.Time) {
+	select {
+	case d.channel <- t:
+	default:
+		// an update is already pending
+	}
+}
+
+func (d *DebouncedUpdater) GetUpdateChannel() <-chan time.Time {
+	return d.channel
+}
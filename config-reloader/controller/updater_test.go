@@ -0,0 +1,87 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncedUpdaterCoalesces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	input := make(chan time.Time)
+	up := NewDebouncedUpdater(ctx, input, 50*time.Millisecond, time.Hour)
+
+	for i := 0; i < 5; i++ {
+		input <- time.Now()
+	}
+
+	select {
+	case <-up.GetUpdateChannel():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update delivered")
+	}
+
+	// a single update for the burst
+	select {
+	case <-up.GetUpdateChannel():
+		t.Fatal("more than one update delivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDebouncedUpdaterMaxWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	input := make(chan time.Time)
+	up := NewDebouncedUpdater(ctx, input, 100*time.Millisecond, 300*time.Millisecond)
+
+	// never quiet for long enough
+	start := time.Now()
+	stop := time.After(2 * time.Second)
+	for {
+		select {
+		case <-up.GetUpdateChannel():
+			assert.True(t, time.Since(start) < time.Second, "delivered after %v", time.Since(start))
+			return
+		case <-stop:
+			t.Fatal("a continuous stream starved the updates")
+		case <-time.After(20 * time.Millisecond):
+			input <- time.Now()
+		}
+	}
+}
+
+func TestDebouncedUpdaterSetWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	input := make(chan time.Time)
+	up := NewDebouncedUpdater(ctx, input, time.Hour, time.Hour)
+
+	// without a quiet window the notifications go through right away
+	up.setWindow(0, 0)
+	input <- time.Now()
+	select {
+	case <-up.GetUpdateChannel():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update delivered")
+	}
+
+	up.setWindow(50*time.Millisecond, time.Hour)
+	start := time.Now()
+	input <- time.Now()
+	select {
+	case <-up.GetUpdateChannel():
+		assert.True(t, time.Since(start) >= 50*time.Millisecond, "delivered after %v", time.Since(start))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update delivered")
+	}
+}
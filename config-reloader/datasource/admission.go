@@ -0,0 +1,87 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	core "k8s.io/api/core/v1"
+)
+
+// NamespaceAdmission decides if a namespace is processed at all. A rejected namespace is skipped
+// and gets the reason as its status
+type NamespaceAdmission interface {
+	Admit(nsobj *core.Namespace) (admitted bool, reason string)
+}
+
+// NamespaceAdmissionFunc adapts a plain function to a NamespaceAdmission
+type NamespaceAdmissionFunc func(nsobj *core.Namespace) (bool, string)
+
+// Admit calls f
+func (f NamespaceAdmissionFunc) Admit(nsobj *core.Namespace) (bool, string) {
+	return f(nsobj)
+}
+
+var (
+	registeredAdmissionsLock sync.Mutex
+	registeredAdmissions     []NamespaceAdmission
+)
+
+// RegisterNamespaceAdmission adds a custom admission consulted for every namespace after the
+// built-in ones. Call it from an init function, before the datasource is created
+func RegisterNamespaceAdmission(admission NamespaceAdmission) {
+	registeredAdmissionsLock.Lock()
+	defer registeredAdmissionsLock.Unlock()
+
+	registeredAdmissions = append(registeredAdmissions, admission)
+}
+
+// namespaceAdmissions returns the built-in admissions followed by the registered ones
+func namespaceAdmissions(cfg *config.Config) []NamespaceAdmission {
+	registeredAdmissionsLock.Lock()
+	defer registeredAdmissionsLock.Unlock()
+
+	res := []NamespaceAdmission{&projectAdmission{cfg: cfg}}
+	return append(res, registeredAdmissions...)
+}
+
+// projectAdmission only admits the namespaces whose project annotation is one of --allowed-projects.
+// Without allowed projects every namespace is admitted. The admin namespace is exempt
+type projectAdmission struct {
+	cfg *config.Config
+}
+
+func (a *projectAdmission) Admit(nsobj *core.Namespace) (bool, string) {
+	if len(a.cfg.AllowedProjects) == 0 || nsobj.Name == a.cfg.AdminNamespace {
+		return true, ""
+	}
+
+	project := nsobj.Annotations[a.cfg.AnnotProject]
+	if project == "" {
+		return false, fmt.Sprintf("namespace is not processed, it does not belong to a project (annotation %s is missing)", a.cfg.AnnotProject)
+	}
+
+	for _, p := range a.cfg.AllowedProjects {
+		if p == project {
+			return true, ""
+		}
+	}
+
+	return false, fmt.Sprintf("namespace is not processed, project %s is not registered", project)
+}
+
+// admitNamespace returns the reason of the first admission rejecting the namespace or else an empty string
+func (d *kubeInformerConnection) admitNamespace(nsobj *core.Namespace) string {
+	for _, admission := range d.admissions {
+		if ok, reason := admission.Admit(nsobj); !ok {
+			if reason == "" {
+				reason = "namespace is not processed, it was rejected by an admission check"
+			}
+			return reason
+		}
+	}
+	return ""
+}
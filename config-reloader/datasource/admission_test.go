@@ -0,0 +1,89 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestProjectAdmission(t *testing.T) {
+	cfg := &config.Config{
+		AdminNamespace: "kube-system",
+		AnnotProject:   "example.com/project",
+	}
+	admission := &projectAdmission{cfg: cfg}
+
+	makeNs := func(name string, project string) *core.Namespace {
+		ns := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if project != "" {
+			ns.Annotations = map[string]string{"example.com/project": project}
+		}
+		return ns
+	}
+
+	// permissive without allowed projects
+	ok, _ := admission.Admit(makeNs("anything", ""))
+	assert.True(t, ok)
+
+	cfg.AllowedProjects = []string{"p-1", "p-2"}
+	ok, _ = admission.Admit(makeNs("registered", "p-2"))
+	assert.True(t, ok)
+	ok, _ = admission.Admit(makeNs("kube-system", ""))
+	assert.True(t, ok)
+
+	ok, reason := admission.Admit(makeNs("unknown", "p-3"))
+	assert.False(t, ok)
+	assert.Contains(t, reason, "project p-3 is not registered")
+
+	ok, reason = admission.Admit(makeNs("orphan", ""))
+	assert.False(t, ok)
+	assert.Contains(t, reason, "example.com/project")
+}
+
+func TestGetNamespacesConsultsAdmissions(t *testing.T) {
+	allowed := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "allowed"}}
+	denied := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "denied"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(allowed))
+	assert.Nil(t, indexer.Add(denied))
+
+	custom := NamespaceAdmissionFunc(func(nsobj *core.Namespace) (bool, string) {
+		if nsobj.Name == "denied" {
+			return false, "denied by policy"
+		}
+		return true, ""
+	})
+
+	client := fake.NewSimpleClientset(allowed, denied)
+	d := &kubeInformerConnection{
+		client:      client,
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{AnnotStatus: "example.com/status"},
+		kubeds: staticKubeDS{
+			"allowed": "<match **>\n  @type null\n</match>",
+			"denied":  "<match **>\n  @type null\n</match>",
+		},
+		nslist:     listerv1.NewNamespaceLister(indexer),
+		admissions: []NamespaceAdmission{custom},
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, "allowed", nses[0].Name)
+
+	updated, err := client.CoreV1().Namespaces().Get(context.Background(), "denied", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "denied by policy", updated.Annotations["example.com/status"])
+}
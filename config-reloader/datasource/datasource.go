@@ -6,8 +6,13 @@ package datasource
 import (
 	"context"
 	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
 
 	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 )
 
 type Mount struct {
@@ -21,12 +26,16 @@ type MiniContainer struct {
 	// the pod id
 	PodID   string
 	PodName string
+	PodIP   string
 
 	Image       string
+	ImageID     string
 	ContainerID string
 
 	// pod labels
 	Labels map[string]string
+	// pod annotations
+	Annotations map[string]string
 
 	// container name
 	Name string
@@ -34,6 +43,16 @@ type MiniContainer struct {
 	HostMounts []*Mount
 
 	NodeName string
+
+	// kind and name of the controller owning the pod, e.g. ReplicaSet or DaemonSet, empty for bare pods
+	OwnerKind string
+	OwnerName string
+
+	// log format hint (json, logfmt, multiline) from the pod or namespace annotation, may be empty
+	ParserHint string
+
+	// the pod is annotated to drop its logs, the container has neither mounts nor a parser hint then
+	Excluded bool
 }
 
 // NamespaceConfig holds all relevant data for a namespace
@@ -43,6 +62,16 @@ type NamespaceConfig struct {
 	PreviousConfigHash string
 	MiniContainers     []*MiniContainer
 	Labels             map[string]string
+	Annotations        map[string]string
+	// every container of the namespace whose logs are collected, listed only for the routing checks
+	// of --warn-unrouted-tags, --warn-duplicate-routing and --strict-tag-isolation
+	Containers []ContainerRef
+	// hash of everything read for the namespace, empty if the datasource does not compute it
+	InputHash string
+	// the input is the same as in the previous run, so the previous render can be reused
+	Unchanged bool
+	// the config could not be read, the namespace fails with this error without being processed
+	FetchError error
 }
 
 // StatusUpdater sets an error description on the namespace
@@ -51,6 +80,73 @@ type StatusUpdater interface {
 	UpdateStatus(ctx context.Context, namespace string, status string)
 }
 
+// Possible NamespaceStatus.Status values
+const (
+	StatusOK      = "ok"
+	StatusWarning = "warning"
+	// the logging of the namespace is disabled by the cluster admin
+	StatusDisabled = "disabled"
+	StatusError    = "error"
+)
+
+// NamespaceStatus is the outcome of the last config generation for a namespace
+type NamespaceStatus struct {
+	Status      string `json:"status"`
+	Phase       string `json:"phase,omitempty"`
+	Message     string `json:"message,omitempty"`
+	LastApplied string `json:"lastApplied,omitempty"`
+	Hash        string `json:"hash"`
+	// findings of the lint pass, the error ones also fail the namespace
+	Findings []*fluentd.LintFinding `json:"findings,omitempty"`
+}
+
+// StatusSummaryWriter stores the statuses of all namespaces in a single place.
+// Datasources may optionally implement it
+type StatusSummaryWriter interface {
+	WriteStatusSummary(ctx context.Context, statuses map[string]*NamespaceStatus) error
+}
+
+// SecretChecker tells if a Secret of a namespace has a key. It returns ErrSecretsForbidden when
+// not allowed to read Secrets. Datasources may optionally implement it
+type SecretChecker interface {
+	SecretKeyExists(ctx context.Context, namespace string, name string, key string) (bool, error)
+}
+
+// Types and reasons of the events recorded against a namespace
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+
+	EventReasonApplied  = "FluentdConfigApplied"
+	EventReasonWarning  = "FluentdConfigWarning"
+	EventReasonInvalid  = "FluentdConfigInvalid"
+	EventReasonDisabled = "FluentdConfigDisabled"
+)
+
+// EventRecorder records a Kubernetes Event against a namespace, eventType is Normal or Warning.
+// Datasources may optionally implement it
+type EventRecorder interface {
+	RecordEvent(namespace string, eventType string, reason string, message string)
+}
+
+// LeaseLocker gives the lock the replicas are elected with when running more than one of them.
+// Datasources may optionally implement it
+type LeaseLocker interface {
+	LeaseLock(namespace string, name string, identity string) resourcelock.Interface
+}
+
+// ReadinessChecker tells if a datasource can read the configs, e.g. its informers still run.
+// Datasources may optionally implement it
+type ReadinessChecker interface {
+	IsReady() bool
+}
+
+// NamespaceMetadataReader reads the labels and annotations of a namespace, e.g. for validating
+// a config outside of a run. Datasources may optionally implement it
+type NamespaceMetadataReader interface {
+	NamespaceMetadata(namespace string) (labels map[string]string, annotations map[string]string, err error)
+}
+
 // Datasource reads data from k8s
 type Datasource interface {
 	StatusUpdater
@@ -81,35 +177,135 @@ func findContainerStatus(statuses []core.ContainerStatus, name string) *core.Con
 	return nil
 }
 
-func convertPodToMinis(resp *core.PodList) []*MiniContainer {
+// podContainer is a container of a pod, whatever its kind
+type podContainer struct {
+	name         string
+	image        string
+	volumeMounts []core.VolumeMount
+	status       *core.ContainerStatus
+}
+
+// podContainers lists the init, regular and ephemeral containers of a pod. Each one has its own
+// log file, tagged with its name, the names being unique within the pod
+func podContainers(pod *core.Pod) []podContainer {
+	res := make([]podContainer, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers)+len(pod.Spec.EphemeralContainers))
+	for _, cont := range pod.Spec.InitContainers {
+		res = append(res, podContainer{cont.Name, cont.Image, cont.VolumeMounts, findContainerStatus(pod.Status.InitContainerStatuses, cont.Name)})
+	}
+	for _, cont := range pod.Spec.Containers {
+		res = append(res, podContainer{cont.Name, cont.Image, cont.VolumeMounts, findContainerStatus(pod.Status.ContainerStatuses, cont.Name)})
+	}
+	for _, cont := range pod.Spec.EphemeralContainers {
+		res = append(res, podContainer{cont.Name, cont.Image, cont.VolumeMounts, findContainerStatus(pod.Status.EphemeralContainerStatuses, cont.Name)})
+	}
+	return res
+}
+
+// parserHint reads the log format of a container from the pod annotation. The value is either a format
+// for all containers of the pod or a comma-separated list of container=format pairs
+func parserHint(pod *core.Pod, annotation string, container string, fallback string) string {
+	if annotation == "" {
+		return ""
+	}
+
+	value := strings.TrimSpace(pod.Annotations[annotation])
+	if value == "" {
+		return fallback
+	}
+
+	if !strings.Contains(value, "=") {
+		return strings.ToLower(value)
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == container {
+			return strings.ToLower(strings.TrimSpace(kv[1]))
+		}
+	}
+
+	return fallback
+}
+
+// podExcluded tells if a pod is annotated to drop its logs
+func podExcluded(pod *core.Pod, annotation string) bool {
+	if annotation == "" {
+		return false
+	}
+	return strings.TrimSpace(pod.Annotations[annotation]) == "true"
+}
+
+// ContainerRef names a container of a namespace by the pod and container names of its tag
+type ContainerRef struct {
+	PodName string
+	Name    string
+}
+
+// convertPodToContainers lists every container of the pods, init and ephemeral containers included,
+// leaving out the containers of excluded pods as their logs are dropped
+func convertPodToContainers(pods []*core.Pod, excludeAnnotation string) []ContainerRef {
+	var res []ContainerRef
+	for _, pod := range pods {
+		if podExcluded(pod, excludeAnnotation) {
+			continue
+		}
+		for _, cont := range podContainers(pod) {
+			res = append(res, ContainerRef{PodName: pod.Name, Name: cont.name})
+		}
+	}
+	return res
+}
+
+// convertPodToMinis keeps the containers having emptyDir mounts or a parser hint, init and ephemeral
+// containers included. Containers without a hint of their own get defaultParser, read from the
+// namespace by the caller. The containers of an excluded pod are all kept, marked as excluded and
+// without mounts or hint, so that no source is generated for them
+func convertPodToMinis(resp *core.PodList, parserAnnotation string, excludeAnnotation string, defaultParser string) []*MiniContainer {
 	var res []*MiniContainer
 
-	for _, pod := range resp.Items {
-		for _, cont := range pod.Spec.Containers {
-			contStatus := findContainerStatus(pod.Status.ContainerStatuses, cont.Name)
-			cid := ""
-			if contStatus != nil {
-				cid = contStatus.ContainerID
+	for i := range resp.Items {
+		pod := &resp.Items[i]
+		excluded := podExcluded(pod, excludeAnnotation)
+		for _, cont := range podContainers(pod) {
+			cid, imageID := "", ""
+			if cont.status != nil {
+				cid = cont.status.ContainerID
+				imageID = cont.status.ImageID
 			}
 
 			mini := &MiniContainer{
 				PodID:       string(pod.UID),
 				PodName:     pod.Name,
+				PodIP:       pod.Status.PodIP,
 				Labels:      pod.Labels,
-				Name:        cont.Name,
+				Annotations: pod.Annotations,
+				Name:        cont.name,
 				NodeName:    pod.Spec.NodeName,
-				Image:       cont.Image,
+				Image:       cont.image,
+				ImageID:     imageID,
 				ContainerID: cid,
+				ParserHint:  parserHint(pod, parserAnnotation, cont.name, defaultParser),
+			}
+			if owner := metav1.GetControllerOf(pod); owner != nil {
+				mini.OwnerKind = owner.Kind
+				mini.OwnerName = owner.Name
+			}
+
+			if excluded {
+				mini.ParserHint = ""
+				mini.Excluded = true
+				res = append(res, mini)
+				continue
 			}
 
-			for i := range cont.VolumeMounts {
-				m := makeVolume(pod.Spec.Volumes, &cont.VolumeMounts[i])
+			for i := range cont.volumeMounts {
+				m := makeVolume(pod.Spec.Volumes, &cont.volumeMounts[i])
 				if m != nil {
 					mini.HostMounts = append(mini.HostMounts, m)
 				}
 			}
 
-			if len(mini.HostMounts) > 0 {
+			if len(mini.HostMounts) > 0 || mini.ParserHint != "" {
 				sort.Sort(byLength(mini.HostMounts))
 				res = append(res, mini)
 			}
@@ -0,0 +1,140 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func makePod(name string, annotations map[string]string, containers ...string) core.Pod {
+	pod := core.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	for _, c := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, core.Container{Name: c})
+	}
+	return pod
+}
+
+func TestConvertPodToMinisParserHints(t *testing.T) {
+	annot := "example.com/parser"
+	pods := &core.PodList{
+		Items: []core.Pod{
+			makePod("all", map[string]string{annot: "JSON"}, "app", "proxy"),
+			makePod("pairs", map[string]string{annot: "app=logfmt, proxy = multiline"}, "app", "proxy", "other"),
+			makePod("none", nil, "app"),
+		},
+	}
+
+	hints := map[string]string{}
+	for _, mc := range convertPodToMinis(pods, annot, "", "") {
+		hints[mc.PodName+"/"+mc.Name] = mc.ParserHint
+	}
+	assert.Equal(t, map[string]string{
+		"all/app":     "json",
+		"all/proxy":   "json",
+		"pairs/app":   "logfmt",
+		"pairs/proxy": "multiline",
+	}, hints)
+
+	// the namespace default applies to the containers without a hint of their own
+	hints = map[string]string{}
+	for _, mc := range convertPodToMinis(pods, annot, "", "json") {
+		hints[mc.PodName+"/"+mc.Name] = mc.ParserHint
+	}
+	assert.Equal(t, "json", hints["pairs/other"])
+	assert.Equal(t, "json", hints["none/app"])
+	assert.Equal(t, "logfmt", hints["pairs/app"])
+
+	// no annotation configured, no containers without mounts
+	assert.Empty(t, convertPodToMinis(pods, "", "", "json"))
+}
+
+func TestConvertPodToMinisMetadata(t *testing.T) {
+	controller := true
+	owned := makePod("owned", map[string]string{"parser": "json"}, "app")
+	owned.Labels = map[string]string{"app": "web"}
+	owned.Spec.NodeName = "node-1"
+	owned.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ConfigMap", Name: "not-a-controller"},
+		{Kind: "ReplicaSet", Name: "web-5d8f7b9c4", Controller: &controller},
+	}
+	pods := &core.PodList{
+		Items: []core.Pod{owned, makePod("bare", map[string]string{"parser": "json"}, "app")},
+	}
+
+	minis := convertPodToMinis(pods, "parser", "", "")
+	assert.Len(t, minis, 2)
+
+	assert.Equal(t, "node-1", minis[0].NodeName)
+	assert.Equal(t, map[string]string{"app": "web"}, minis[0].Labels)
+	assert.Equal(t, "ReplicaSet", minis[0].OwnerKind)
+	assert.Equal(t, "web-5d8f7b9c4", minis[0].OwnerName)
+
+	assert.Empty(t, minis[1].OwnerKind)
+	assert.Empty(t, minis[1].OwnerName)
+}
+
+func TestConvertPodToMinisExcluded(t *testing.T) {
+	noisy := makePod("loadgen", map[string]string{"parser": "json", "exclude": "true"}, "app", "sidecar")
+	noisy.Spec.Volumes = []core.Volume{{Name: "logs", VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}}}
+	noisy.Spec.Containers[0].VolumeMounts = []core.VolumeMount{{Name: "logs", MountPath: "/var/log/app"}}
+	pods := &core.PodList{
+		Items: []core.Pod{noisy, makePod("web", map[string]string{"parser": "json"}, "app")},
+	}
+
+	minis := convertPodToMinis(pods, "parser", "exclude", "")
+	assert.Len(t, minis, 3)
+	for _, mc := range minis[:2] {
+		assert.Equal(t, "loadgen", mc.PodName)
+		assert.True(t, mc.Excluded)
+		assert.Empty(t, mc.HostMounts)
+		assert.Empty(t, mc.ParserHint)
+	}
+	assert.False(t, minis[2].Excluded)
+	assert.Equal(t, "json", minis[2].ParserHint)
+
+	// only true excludes a pod
+	noisy.Annotations["exclude"] = "false"
+	minis = convertPodToMinis(&core.PodList{Items: []core.Pod{noisy}}, "parser", "exclude", "")
+	assert.False(t, minis[0].Excluded)
+	assert.Len(t, minis[0].HostMounts, 1)
+
+	// adding or removing the annotation changes the input of the namespace
+	nsobj := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}}
+	noisy.Annotations["exclude"] = "true"
+	excluded := namespaceInputHash("", nsobj, "", convertPodToMinis(&core.PodList{Items: []core.Pod{noisy}}, "parser", "exclude", ""), nil)
+	assert.NotEqual(t, namespaceInputHash("", nsobj, "", minis, nil), excluded)
+}
+
+func TestConvertPodToMinisAllContainerKinds(t *testing.T) {
+	pod := makePod("mesh", map[string]string{"parser": "json"}, "app", "istio-proxy")
+	pod.Spec.InitContainers = []core.Container{{Name: "istio-init", Image: "proxyv2"}}
+	pod.Spec.EphemeralContainers = []core.EphemeralContainer{
+		{EphemeralContainerCommon: core.EphemeralContainerCommon{Name: "debugger", Image: "busybox"}},
+	}
+	pod.Status.InitContainerStatuses = []core.ContainerStatus{{Name: "istio-init", ContainerID: "containerd://init"}}
+	pod.Status.ContainerStatuses = []core.ContainerStatus{{Name: "app", ContainerID: "containerd://app"}}
+	pod.Status.EphemeralContainerStatuses = []core.ContainerStatus{{Name: "debugger", ContainerID: "containerd://debug"}}
+
+	minis := convertPodToMinis(&core.PodList{Items: []core.Pod{pod}}, "parser", "", "")
+	names := []string{}
+	ids := map[string]string{}
+	for _, mc := range minis {
+		names = append(names, mc.Name)
+		ids[mc.Name] = mc.ContainerID
+	}
+
+	// every container has its own entry, the init containers first
+	assert.Equal(t, []string{"istio-init", "app", "istio-proxy", "debugger"}, names)
+	assert.Equal(t, map[string]string{
+		"istio-init":  "containerd://init",
+		"app":         "containerd://app",
+		"istio-proxy": "",
+		"debugger":    "containerd://debug",
+	}, ids)
+	assert.Equal(t, "busybox", minis[3].Image)
+}
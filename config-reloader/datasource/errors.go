@@ -0,0 +1,76 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Possible NamespaceStatus.Phase values, telling where an error comes from
+const (
+	// ErrorPhaseFetch is a failure reading the namespace, its config or its pods from the API
+	ErrorPhaseFetch = "FetchError"
+	// ErrorPhaseRender is a config that cannot be parsed or processed
+	ErrorPhaseRender = "RenderError"
+	// ErrorPhaseValidation is a config rejected by the fluentd validator or referring to missing Secrets
+	ErrorPhaseValidation = "ValidationError"
+	// ErrorPhasePolicy is a config using something the cluster admin does not allow
+	ErrorPhasePolicy = "PolicyError"
+	// ErrorPhaseLint is a config with error severity lint findings
+	ErrorPhaseLint = "LintError"
+)
+
+// PhaseError is an error tagged with the phase of the generation it comes from
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// NewPhaseError tags err with a phase
+func NewPhaseError(phase string, err error) error {
+	return &PhaseError{Phase: phase, Err: err}
+}
+
+// PolicyErrorf formats an ErrorPhasePolicy error
+func PolicyErrorf(format string, args ...interface{}) error {
+	return NewPhaseError(ErrorPhasePolicy, fmt.Errorf(format, args...))
+}
+
+// ErrorPhase returns the phase err is tagged with. Untagged errors are ErrorPhaseRender
+func ErrorPhase(err error) string {
+	var pe *PhaseError
+	if errors.As(err, &pe) {
+		return pe.Phase
+	}
+	return ErrorPhaseRender
+}
+
+// IsInfrastructureError tells if err means that the API cannot be used at all, as opposed to
+// an error reading the config of a single namespace. The first fails the whole run
+func IsInfrastructureError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err) || apierrors.IsUnauthorized(err)
+}
@@ -0,0 +1,24 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorPhase(t *testing.T) {
+	assert.Equal(t, ErrorPhaseRender, ErrorPhase(errors.New("bad")))
+
+	err := PolicyErrorf("plugin %s not allowed", "exec")
+	assert.Equal(t, "plugin exec not allowed", err.Error())
+	assert.Equal(t, ErrorPhasePolicy, ErrorPhase(err))
+
+	// the phase survives wrapping
+	wrapped := fmt.Errorf("namespace a: %w", NewPhaseError(ErrorPhaseFetch, errors.New("timeout")))
+	assert.Equal(t, ErrorPhaseFetch, ErrorPhase(wrapped))
+}
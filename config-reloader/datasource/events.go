@@ -0,0 +1,48 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// the API server rejects longer event messages
+const maxEventMessageLength = 1024
+
+// newEventRecorder returns a recorder posting the events through client. The events are sent in
+// the background and dropped if the API server cannot take them
+func newEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	broadcaster.StartLogging(logrus.Debugf)
+	return broadcaster.NewRecorder(scheme.Scheme, core.EventSource{Component: "kube-fluentd-operator"})
+}
+
+// RecordEvent records an event against the namespace object. The event goes to the namespace
+// itself so that it shows in kubectl get events -n <namespace>. Does nothing if events are disabled
+func (d *kubeInformerConnection) RecordEvent(namespace string, eventType string, reason string, message string) {
+	if d.recorder == nil {
+		return
+	}
+
+	ref := &core.ObjectReference{
+		Kind:       "Namespace",
+		APIVersion: "v1",
+		Name:       namespace,
+		Namespace:  namespace,
+	}
+	if ns, err := d.nslist.Get(namespace); err == nil {
+		ref.UID = ns.UID
+	}
+
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+	d.recorder.Event(ref, eventType, reason, message)
+}
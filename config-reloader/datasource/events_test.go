@@ -0,0 +1,38 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRecordEvent(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", UID: "uid-team-a"}}))
+
+	recorder := record.NewFakeRecorder(2)
+	d := &kubeInformerConnection{
+		nslist:   listerv1.NewNamespaceLister(indexer),
+		recorder: recorder,
+	}
+
+	d.RecordEvent("team-a", EventTypeWarning, EventReasonInvalid, "bad config")
+	assert.Equal(t, "Warning FluentdConfigInvalid bad config", <-recorder.Events)
+
+	d.RecordEvent("team-a", EventTypeWarning, EventReasonInvalid, strings.Repeat("x", 2000))
+	assert.Len(t, <-recorder.Events, len("Warning FluentdConfigInvalid ")+maxEventMessageLength)
+
+	// disabled
+	d.recorder = nil
+	d.RecordEvent("team-a", EventTypeNormal, EventReasonApplied, "ok")
+	assert.Empty(t, recorder.Events)
+}
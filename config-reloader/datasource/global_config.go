@@ -0,0 +1,85 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// the key of the global ConfigMap holding the config, like in the namespace ConfigMaps
+const globalConfigKey = "fluent.conf"
+
+// globalConfig reads the config prepended to the config of every namespace from a single ConfigMap
+type globalConfig struct {
+	name      string
+	namespace string
+	lister    listerv1.ConfigMapLister
+}
+
+// globalConfigName splits --global-config into the namespace and name of the ConfigMap,
+// the admin namespace is the default
+func globalConfigName(cfg *config.Config) (string, string) {
+	if i := strings.Index(cfg.GlobalConfig, "/"); i >= 0 {
+		return cfg.GlobalConfig[:i], cfg.GlobalConfig[i+1:]
+	}
+	return cfg.AdminNamespace, cfg.GlobalConfig
+}
+
+// newGlobalConfig watches the ConfigMap holding the global config and triggers a control loop
+// run whenever it changes
+func newGlobalConfig(ctx context.Context, client kubernetes.Interface, cfg *config.Config, updateChan chan time.Time) (*globalConfig, cache.InformerSynced) {
+	namespace, name := globalConfigName(cfg)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+
+	notify := func(obj interface{}) { util.NotifyUpdate(updateChan) }
+
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(old, new interface{}) { notify(new) },
+		DeleteFunc: notify,
+	})
+
+	gc := &globalConfig{
+		name:      name,
+		namespace: namespace,
+		lister:    factory.Core().V1().ConfigMaps().Lister(),
+	}
+
+	factory.Start(ctx.Done())
+	logrus.Infof("Watching configmap %s/%s for the global config", namespace, name)
+
+	return gc, informer.HasSynced
+}
+
+// get returns the global config, empty if the ConfigMap does not exist
+func (gc *globalConfig) get() (string, error) {
+	cm, err := gc.lister.ConfigMaps(gc.namespace).Get(gc.name)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return cm.Data[globalConfigKey], nil
+}
@@ -0,0 +1,43 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	core "k8s.io/api/core/v1"
+)
+
+// namespaceInputHash hashes what the config of a namespace is generated from: the config data,
+// the labels and annotations of the namespace, its mini containers and the containers listed for the
+// routing checks. The status annotation, written by the reloader itself, is left out. The containers
+// are only listed when the config or the checks depend on them, so pods coming and going change the
+// hash only when they matter
+func namespaceInputHash(configdata string, nsobj *core.Namespace, statusAnnotation string, minis []*MiniContainer, refs []ContainerRef) string {
+	annotations := map[string]string{}
+	for k, v := range nsobj.Annotations {
+		if k != statusAnnotation {
+			annotations[k] = v
+		}
+	}
+
+	// the pods come from the informer cache in no particular order
+	containers := make([]string, 0, len(minis))
+	for _, mini := range minis {
+		b, _ := json.Marshal(mini)
+		containers = append(containers, string(b))
+	}
+	for _, ref := range refs {
+		containers = append(containers, ref.PodName+"/"+ref.Name)
+	}
+	sort.Strings(containers)
+
+	labels, _ := json.Marshal(nsobj.Labels)
+	annots, _ := json.Marshal(annotations)
+	return util.Hash(string(labels)+string(annots)+strings.Join(containers, ""), configdata)
+}
@@ -2,143 +2,894 @@ package datasource
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
 
+	authv1 "k8s.io/api/authentication/v1"
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 )
 
+const (
+	// the source type of processors.mountedFileState, processors depend on the datasource package
+	mountedFileSourceType = "mounted-file"
+
+	statusSummaryFieldManager = "kube-fluentd-operator"
+	serviceAccountNamespace   = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Values of the event field of the log lines about a namespace
+const (
+	logEventFetched       = "fetched"
+	logEventFetchFailed   = "fetch_failed"
+	logEventSkipped       = "skipped"
+	logEventPruned        = "pruned"
+	logEventStatusUpdated = "status_updated"
+	logEventStatusFailed  = "status_failed"
+	logEventConfigChanged = "config_changed"
+)
+
+// resyncPeriodically triggers a control loop run every period, so that a cache left stale by a
+// missed watch event is reconciled without waiting for the next change
+func resyncPeriodically(ctx context.Context, period time.Duration, updateChan chan time.Time) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			util.NotifyUpdate(updateChan)
+		}
+	}
+}
+
+// namespaceLog is the logger of the lines about a namespace, with --log-format=json the namespace,
+// its config hash (if known) and the event are fields of their own
+func namespaceLog(ns string, configHash string, event string) *logrus.Entry {
+	fields := logrus.Fields{
+		"namespace": ns,
+		"event":     event,
+	}
+	if configHash != "" {
+		fields["config_hash"] = configHash
+	}
+	return logrus.WithFields(fields)
+}
+
+// bounds of the wait before a namespace whose config cannot be read is tried again
+var (
+	fetchRetryInitialDelay = 5 * time.Second
+	fetchRetryMaxDelay     = 5 * time.Minute
+)
+
+// statusUpdateBackoff bounds the retries of a conflicting status update, under half a second in total
+var statusUpdateBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 10 * time.Millisecond,
+	Factor:   3.0,
+	Jitter:   0.1,
+}
+
 type kubeInformerConnection struct {
-	client  kubernetes.Interface
-	hashes  map[string]string
-	cfg     *config.Config
-	kubeds  kubedatasource.KubeDS
-	nslist  listerv1.NamespaceLister
-	podlist listerv1.PodLister
+	client kubernetes.Interface
+	hashes map[string]string
+	// input hash of every namespace in the previous run
+	inputHashes map[string]string
+	// guards hashes, inputHashes, graceScheduled and fetchFailures as the namespaces are fetched concurrently
+	hashesMutex sync.Mutex
+	cfg         *config.Config
+	kubeds      kubedatasource.KubeDS
+	nslist      listerv1.NamespaceLister
+	podlist     listerv1.PodLister
+	// indexer of the pod informer with the podIndexers, nil if pods are not watched
+	podIndex cache.Indexer
+	runtime  *runtimeConfig
+	// prepended to the config of every namespace, nil without --global-config
+	global *globalConfig
+	// the snippets the namespace configs may @include, nil without --snippets-namespace
+	snippets *sharedSnippets
+	// consulted in order before a namespace is processed
+	admissions []NamespaceAdmission
+	// triggers a run once the grace window of a new namespace is over
+	updateChan chan time.Time
+	// namespaces in their grace window that have a run scheduled
+	graceScheduled map[string]bool
+	// consecutive failures to read the config of a namespace, a run is scheduled after each of them
+	fetchFailures map[string]int
+	// records the events about the namespaces, nil if events are disabled
+	recorder record.EventRecorder
+	// closed once the informers are stopped, their caches are not updated anymore
+	stopped <-chan struct{}
 }
 
 // GetNamespaces queries the configured Kubernetes API to generate a list of NamespaceConfig objects.
 // It uses options from the configuration to determine which namespaces to inspect and which resources
 // within those namespaces contain fluentd configuration.
 func (d *kubeInformerConnection) GetNamespaces(ctx context.Context) ([]*NamespaceConfig, error) {
+	select {
+	case <-d.stopped:
+		return nil, fmt.Errorf("the informers are stopped: %w", context.Canceled)
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// runtime config changes are applied between runs so that a run always sees a consistent config
+	if d.runtime != nil {
+		if err := d.runtime.apply(d.cfg); err != nil {
+			logrus.Warn(err)
+		}
+	}
+
 	// Get a list of the namespaces which may contain fluentd configuration
-	nses, err := d.discoverNamespaces(ctx)
+	discoverCtx, span := metrics.StartSpan(ctx, metrics.SpanDiscover)
+	nses, err := d.discoverNamespaces(discoverCtx)
+	metrics.EndSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
-	nsconfigs := make([]*NamespaceConfig, 0)
-	for _, ns := range nses {
-		// Get the Namespace object associated with a particular name
-		nsobj, err := d.nslist.Get(ns)
+	nsconfigs, err := d.fetchNamespaces(ctx, nses)
+	if err != nil {
+		return nil, err
+	}
+
+	d.pruneNamespaces(ctx, nses)
+	return nsconfigs, nil
+}
+
+// IsReady tells if the informers still run and the configs can be read
+func (d *kubeInformerConnection) IsReady() bool {
+	select {
+	case <-d.stopped:
+		return false
+	default:
+	}
+	return d.kubeds.IsReady()
+}
+
+// pruneNamespaces forgets the namespaces processed by a previous run that are not discovered
+// anymore, e.g. deleted or not selected anymore. The status of those still there is cleared
+func (d *kubeInformerConnection) pruneNamespaces(ctx context.Context, discovered []string) {
+	seen := make(map[string]bool, len(discovered))
+	for _, ns := range discovered {
+		seen[ns] = true
+	}
+
+	removed := []string{}
+	d.hashesMutex.Lock()
+	for ns := range d.hashes {
+		if !seen[ns] {
+			removed = append(removed, ns)
+			delete(d.hashes, ns)
+			delete(d.inputHashes, ns)
+		}
+	}
+	for ns := range d.fetchFailures {
+		if !seen[ns] {
+			delete(d.fetchFailures, ns)
+		}
+	}
+	d.hashesMutex.Unlock()
+	sort.Strings(removed)
+
+	for _, ns := range removed {
+		_, err := d.nslist.Get(ns)
+		if apierrors.IsNotFound(err) {
+			namespaceLog(ns, "", logEventPruned).Debugf("Forgetting namespace %s: it is gone", ns)
+			continue
+		}
 		if err != nil {
+			namespaceLog(ns, "", logEventPruned).Warnf("Cannot find namespace %s to clear its status: %+v", ns, err)
+			continue
+		}
+
+		namespaceLog(ns, "", logEventPruned).Infof("Namespace %s is not processed anymore, clearing its status", ns)
+		d.UpdateStatus(ctx, ns, "")
+	}
+}
+
+// forgetNamespace drops the state of a namespace deleted while a run reads it, like
+// pruneNamespaces does for the namespaces not discovered anymore
+func (d *kubeInformerConnection) forgetNamespace(ctx context.Context, ns string) {
+	d.hashesMutex.Lock()
+	// a fetch past its --per-namespace-timeout leaves the state to the run
+	if ctx.Err() != nil {
+		d.hashesMutex.Unlock()
+		return
+	}
+	delete(d.hashes, ns)
+	delete(d.inputHashes, ns)
+	delete(d.fetchFailures, ns)
+	d.hashesMutex.Unlock()
+
+	namespaceLog(ns, "", logEventPruned).Debugf("Skipping namespace %s: it was deleted during the run", ns)
+}
+
+// fetchNamespaces reads the namespaces using at most FetchConcurrency goroutines. The configs
+// keep the order of nses. The first error cancels the fetches not started yet and is returned
+func (d *kubeInformerConnection) fetchNamespaces(ctx context.Context, nses []string) ([]*NamespaceConfig, error) {
+	workers := d.cfg.FetchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*NamespaceConfig, len(nses))
+	var firstErr error
+	errOnce := sync.Once{}
+
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				nsconfig, err := d.fetchNamespaceWithin(ctx, nses[idx])
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				results[idx] = nsconfig
+			}
+		}()
+	}
+
+feed:
+	for idx := range nses {
+		select {
+		case queue <- idx:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// the caller gave up
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	nsconfigs := make([]*NamespaceConfig, 0, len(results))
+	for _, nsconfig := range results {
+		if nsconfig != nil {
+			nsconfigs = append(nsconfigs, nsconfig)
+		}
+	}
+	return nsconfigs, nil
+}
+
+// fetchNamespaceWithin reads a namespace within --per-namespace-timeout. A namespace taking longer
+// fails like one whose config cannot be read and the fetch is left to finish in the background,
+// its result is discarded. Only the cancellation of ctx aborts the fetch of the other namespaces
+func (d *kubeInformerConnection) fetchNamespaceWithin(ctx context.Context, ns string) (*NamespaceConfig, error) {
+	if d.cfg.PerNamespaceTimeout <= 0 {
+		return d.fetchNamespace(ctx, ns)
+	}
+
+	nsCtx, cancel := context.WithTimeout(ctx, d.cfg.PerNamespaceTimeout)
+	defer cancel()
+
+	type result struct {
+		nsconfig *NamespaceConfig
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		nsconfig, err := d.fetchNamespace(nsCtx, ns)
+		done <- result{nsconfig, err}
+	}()
+
+	select {
+	case r := <-done:
+		// the error of a call that gave up on the deadline is the timeout of this namespace only
+		if r.err == nil || nsCtx.Err() == nil || ctx.Err() != nil {
+			return r.nsconfig, r.err
+		}
+	case <-nsCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	nsobj, err := d.nslist.Get(ns)
+	if apierrors.IsNotFound(err) {
+		d.forgetNamespace(ctx, ns)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.fetchFailed(ctx, ns, nsobj, fmt.Errorf("reading the namespace took longer than %v", d.cfg.PerNamespaceTimeout)), nil
+}
+
+// fetchNamespace reads the config of a single namespace, nil if the namespace is skipped
+func (d *kubeInformerConnection) fetchNamespace(ctx context.Context, ns string) (nsconfig *NamespaceConfig, err error) {
+	cfg := d.cfg.Current()
+
+	ctx, span := metrics.StartNamespaceSpan(ctx, metrics.SpanFetch, ns)
+	defer func() { metrics.EndSpan(span, err) }()
+
+	start := time.Now()
+
+	// Get the Namespace object associated with a particular name
+	nsobj, err := d.nslist.Get(ns)
+	if apierrors.IsNotFound(err) {
+		// deleted since it was discovered, the other namespaces are processed as usual
+		d.forgetNamespace(ctx, ns)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// a namespace being deleted cannot take a status annotation and its logs are going away too
+	if nsobj.Status.Phase == core.NamespaceTerminating {
+		namespaceLog(ns, "", logEventSkipped).Debugf("Skipping namespace %s: it is terminating", ns)
+		return nil, nil
+	}
+
+	if d.ignored(nsobj) {
+		namespaceLog(ns, "", logEventSkipped).Debugf("Skipping namespace %s: annotated with %s=true", ns, cfg.AnnotIgnore)
+		// forget the namespace, once the annotation is removed its config is applied again like a new one
+		d.hashesMutex.Lock()
+		defer d.hashesMutex.Unlock()
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
+		delete(d.hashes, ns)
+		delete(d.inputHashes, ns)
+		return nil, nil
+	}
 
-		configdata, err := d.kubeds.GetFluentdConfig(ctx, ns)
+	if d.inGraceWindow(ctx, nsobj) {
+		namespaceLog(ns, "", logEventSkipped).Debugf("Skipping namespace %s: created less than %v ago, its config may not be there yet", ns, cfg.NewNamespaceGrace)
+		return nil, nil
+	}
+
+	if missing := d.missingRequiredAnnotations(nsobj); len(missing) > 0 {
+		d.skipNamespace(ctx, ns, fmt.Sprintf("namespace is not processed, missing required annotations: %s", strings.Join(missing, ", ")))
+		return nil, nil
+	}
+
+	if reason := d.admitNamespace(nsobj); reason != "" {
+		d.skipNamespace(ctx, ns, reason)
+		return nil, nil
+	}
+
+	configdata, err := d.kubeds.GetFluentdConfig(ctx, ns)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			if _, nsErr := d.nslist.Get(ns); apierrors.IsNotFound(nsErr) {
+				d.forgetNamespace(ctx, ns)
+				return nil, nil
+			}
+		}
+		if IsInfrastructureError(err) {
+			return nil, err
+		}
+		// only this namespace fails, the others are processed
+		return d.fetchFailed(ctx, ns, nsobj, err), nil
+	}
+	d.fetchSucceeded(ctx, ns)
+
+	snippets, err := d.podConfigSnippets(ns)
+	if err != nil {
+		return nil, err
+	}
+	configdata = appendConfig(configdata, snippets)
+
+	if configdata != "" && d.global != nil && ns != cfg.AdminNamespace {
+		global, err := d.global.get()
 		if err != nil {
 			return nil, err
 		}
+		// the global config goes first, the namespace config cannot override it
+		configdata = appendConfig(global, configdata)
+	}
 
-		// Create a compact representation of the pods running in the namespace
-		// under consideration
-		pods, err := d.podlist.Pods(ns).List(labels.NewSelector())
+	// Create a compact representation of the pods running in the namespace
+	// under consideration, only if the config makes use of them
+	var minis []*MiniContainer
+	if cfg.WarnUnroutedTags || cfg.WarnDuplicateRouting || cfg.StrictTagIsolation || cfg.AnnotParser != "" || cfg.AnnotExclude != "" || configNeedsPods(configdata) {
+		minis, err = d.listMiniContainers(ns, d.namespaceParser(nsobj))
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the routing checks look at the logs of every container, with or without a mount
+	var containers []ContainerRef
+	if cfg.WarnUnroutedTags || cfg.WarnDuplicateRouting || cfg.StrictTagIsolation {
+		containers, err = d.listContainers(ns)
 		if err != nil {
 			return nil, err
 		}
-		podsCopy := make([]core.Pod, len(pods))
-		for i, pod := range pods {
-			podsCopy[i] = *pod.DeepCopy()
+	}
+	metrics.ObserveNamespaceDurationMetric(ns, len(minis), metrics.PhaseFetch, cfg.PerNamespaceMetrics, time.Since(start))
+
+	// the included snippets are part of the input, a config failing to include them too
+	hashed := configdata
+	if d.snippets != nil && HasIncludes(configdata) {
+		if resolved, err := ResolveIncludes(configdata, d); err != nil {
+			hashed = configdata + "\n" + err.Error()
+		} else {
+			hashed = resolved
+		}
+	}
+	inputHash := namespaceInputHash(hashed, nsobj, cfg.AnnotStatus, minis, containers)
+	d.hashesMutex.Lock()
+	defer d.hashesMutex.Unlock()
+	// a namespace past its --per-namespace-timeout is failed already, its input is not remembered
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	previousInputHash := d.inputHashes[ns]
+	d.inputHashes[ns] = inputHash
+	namespaceLog(ns, d.hashes[ns], logEventFetched).Debugf("Fetched namespace %s with %d containers, input changed: %t", ns, len(minis), previousInputHash != inputHash)
+
+	// Create a new NamespaceConfig from the data we've processed up to now
+	return &NamespaceConfig{
+		Name:               ns,
+		FluentdConfig:      configdata,
+		PreviousConfigHash: d.hashes[ns],
+		Labels:             nsobj.Labels,
+		Annotations:        nsobj.Annotations,
+		MiniContainers:     minis,
+		Containers:         containers,
+		InputHash:          inputHash,
+		Unchanged:          previousInputHash == inputHash,
+	}, nil
+}
+
+// fetchFailed makes the config of a namespace whose config cannot be read and schedules a run
+// to read it again, waiting twice as long after every consecutive failure
+func (d *kubeInformerConnection) fetchFailed(ctx context.Context, ns string, nsobj *core.Namespace, err error) *NamespaceConfig {
+	d.hashesMutex.Lock()
+	defer d.hashesMutex.Unlock()
+
+	failed := &NamespaceConfig{
+		Name:               ns,
+		PreviousConfigHash: d.hashes[ns],
+		Labels:             nsobj.Labels,
+		Annotations:        nsobj.Annotations,
+		FetchError:         NewPhaseError(ErrorPhaseFetch, err),
+	}
+	// the run failed this namespace already and discards the result
+	if ctx.Err() != nil {
+		return failed
+	}
+
+	if d.fetchFailures == nil {
+		d.fetchFailures = map[string]int{}
+	}
+	d.fetchFailures[ns]++
+	delay := fetchRetryDelay(d.fetchFailures[ns])
+	namespaceLog(ns, d.hashes[ns], logEventFetchFailed).Warnf("Cannot read the config of namespace %s, retrying in %v: %+v", ns, delay, err)
+
+	if d.updateChan != nil {
+		time.AfterFunc(delay, func() { util.NotifyUpdate(d.updateChan) })
+	}
+
+	// the next successful read is a change whatever the input
+	delete(d.inputHashes, ns)
+
+	return failed
+}
+
+// fetchSucceeded resets the backoff of a namespace once its config is read
+func (d *kubeInformerConnection) fetchSucceeded(ctx context.Context, ns string) {
+	d.hashesMutex.Lock()
+	defer d.hashesMutex.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	delete(d.fetchFailures, ns)
+}
+
+// fetchRetryDelay is the wait before reading a config again after the given number of consecutive failures
+func fetchRetryDelay(failures int) time.Duration {
+	delay := fetchRetryInitialDelay
+	for i := 1; i < failures && delay < fetchRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > fetchRetryMaxDelay {
+		delay = fetchRetryMaxDelay
+	}
+	return delay
+}
+
+// configNeedsPods is a cheap pre-scan telling if a config uses macros that depend on the pods
+// of the namespace. Only the mounted-file source does, a false positive just costs a pod listing
+func configNeedsPods(config string) bool {
+	return strings.Contains(config, mountedFileSourceType)
+}
+
+// missingRequiredAnnotations lists the required annotations that are absent or empty on the namespace.
+// The admin namespace is exempt
+func (d *kubeInformerConnection) missingRequiredAnnotations(nsobj *core.Namespace) []string {
+	missing := []string{}
+	if nsobj.Name == d.cfg.AdminNamespace {
+		return missing
+	}
+
+	for _, key := range d.cfg.Current().RequiredAnnotations {
+		if nsobj.Annotations[key] == "" {
+			missing = append(missing, key)
 		}
-		podList := &core.PodList{
-			Items: podsCopy,
+	}
+
+	return missing
+}
+
+// inGraceWindow tells if the namespace is younger than --new-namespace-grace. The first time it is
+// seen a run is scheduled for when its grace window is over
+func (d *kubeInformerConnection) inGraceWindow(ctx context.Context, nsobj *core.Namespace) bool {
+	if d.cfg.NewNamespaceGrace <= 0 {
+		return false
+	}
+
+	d.hashesMutex.Lock()
+	defer d.hashesMutex.Unlock()
+
+	remaining := d.cfg.NewNamespaceGrace - time.Since(nsobj.CreationTimestamp.Time)
+	if ctx.Err() != nil {
+		return remaining > 0
+	}
+	if remaining <= 0 {
+		delete(d.graceScheduled, nsobj.Name)
+		return false
+	}
+
+	if d.updateChan != nil && !d.graceScheduled[nsobj.Name] {
+		if d.graceScheduled == nil {
+			d.graceScheduled = map[string]bool{}
 		}
-		minis := convertPodToMinis(podList)
+		d.graceScheduled[nsobj.Name] = true
+		time.AfterFunc(remaining, func() { util.NotifyUpdate(d.updateChan) })
+	}
+
+	return true
+}
 
-		// Create a new NamespaceConfig from the data we've processed up to now
-		nsconfigs = append(nsconfigs, &NamespaceConfig{
-			Name:               ns,
-			FluentdConfig:      configdata,
-			PreviousConfigHash: d.hashes[ns],
-			Labels:             nsobj.Labels,
-			MiniContainers:     minis,
-		})
+// skipNamespace reports why a namespace is left out. The status is only written when the reason
+// changes, the namespace then gets a new status once it is processed again
+func (d *kubeInformerConnection) skipNamespace(ctx context.Context, ns string, reason string) {
+	metrics.IncNamespaceErrorsMetric(ErrorPhasePolicy)
+	hash := util.Hash("SKIPPED", reason)
+	d.hashesMutex.Lock()
+	// a fetch past its --per-namespace-timeout does not overwrite the failure of the run
+	if ctx.Err() != nil {
+		d.hashesMutex.Unlock()
+		return
+	}
+	known := d.hashes[ns] == hash
+	d.hashes[ns] = hash
+	d.hashesMutex.Unlock()
+	if known {
+		return
 	}
 
-	return nsconfigs, nil
+	namespaceLog(ns, hash, logEventSkipped).Infof("Skipping namespace %s: %s", ns, reason)
+	d.UpdateStatus(ctx, ns, reason)
+}
+
+// ignored tells if the namespace is annotated to be left alone. The admin namespace is never ignored
+func (d *kubeInformerConnection) ignored(nsobj *core.Namespace) bool {
+	if d.cfg.AnnotIgnore == "" || nsobj.Name == d.cfg.AdminNamespace {
+		return false
+	}
+	return strings.TrimSpace(nsobj.Annotations[d.cfg.AnnotIgnore]) == "true"
+}
+
+// namespaceParser is the log format hint for the containers of a namespace that have none of their own
+func (d *kubeInformerConnection) namespaceParser(nsobj *core.Namespace) string {
+	if d.cfg.AnnotParser == "" {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(nsobj.Annotations[d.cfg.AnnotParser]))
+}
+
+// listMiniContainers converts the pods of a namespace to MiniContainers.
+// Without a pod lister (pods disabled) no containers are returned
+func (d *kubeInformerConnection) listMiniContainers(ns string, defaultParser string) ([]*MiniContainer, error) {
+	if d.podlist == nil {
+		return nil, nil
+	}
+
+	// a namespace parser gives a hint to every container, the index does not know about it
+	index := podIndexMinis
+	if defaultParser != "" {
+		index = ""
+	}
+
+	pods, err := d.indexedPods(index, ns)
+	if err != nil {
+		return nil, err
+	}
+	podsCopy := make([]core.Pod, len(pods))
+	for i, pod := range pods {
+		podsCopy[i] = *pod.DeepCopy()
+	}
+	podList := &core.PodList{
+		Items: podsCopy,
+	}
+	return convertPodToMinis(podList, d.cfg.AnnotParser, d.cfg.AnnotExclude, defaultParser), nil
+}
+
+// listContainers lists every container of the pods of a namespace.
+// Without a pod lister (pods disabled) no containers are returned
+func (d *kubeInformerConnection) listContainers(ns string) ([]ContainerRef, error) {
+	if d.podlist == nil {
+		return nil, nil
+	}
+
+	pods, err := d.podlist.Pods(ns).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return convertPodToContainers(pods, d.cfg.AnnotExclude), nil
+}
+
+// NamespaceMetadata reads the labels and annotations of a namespace from the informer cache
+func (d *kubeInformerConnection) NamespaceMetadata(namespace string) (map[string]string, map[string]string, error) {
+	nsobj, err := d.nslist.Get(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nsobj.Labels, nsobj.Annotations, nil
+}
+
+// Snippet reads a shared snippet from the informer cache of the labelled ConfigMaps of --snippets-namespace
+func (d *kubeInformerConnection) Snippet(name string, key string) (string, bool, error) {
+	if d.snippets == nil {
+		return "", false, NewPhaseError(ErrorPhaseValidation, errSnippetsDisabled)
+	}
+	return d.snippets.get(name, key)
+}
+
+// ReviewToken authenticates a bearer token with a TokenReview, returning the user it belongs to.
+// With audiences the token must be issued for one of them, the API server tells which
+func (d *kubeInformerConnection) ReviewToken(ctx context.Context, token string, audiences []string) (string, bool, error) {
+	review, err := d.client.AuthenticationV1().TokenReviews().Create(ctx, &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{Token: token, Audiences: audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", false, err
+	}
+	if !review.Status.Authenticated {
+		return "", false, nil
+	}
+	if len(audiences) == 0 {
+		return review.Status.User.Username, true, nil
+	}
+
+	// an authenticator ignoring the audiences returns none
+	for _, audience := range review.Status.Audiences {
+		for _, wanted := range audiences {
+			if audience == wanted {
+				return review.Status.User.Username, true, nil
+			}
+		}
+	}
+	return "", false, nil
 }
 
 // WriteCurrentConfigHash is a setter for the hashtable maintained by this Datasource
 func (d *kubeInformerConnection) WriteCurrentConfigHash(namespace string, hash string) {
+	d.hashesMutex.Lock()
+	previous := d.hashes[namespace]
 	d.hashes[namespace] = hash
+	d.hashesMutex.Unlock()
+
+	if previous == hash {
+		return
+	}
+	metrics.IncConfigHashChangesMetric(namespace)
+	previousName := previous
+	if previousName == "" {
+		previousName = "none"
+	}
+	namespaceLog(namespace, hash, logEventConfigChanged).Debugf("Config hash of namespace %s changed from %s to %s", namespace, previousName, hash)
 }
 
 // UpdateStatus updates a namespace's status annotation with the latest result
-// from the config generator.
+// from the config generator. A conflicting update, e.g. by another log-router, is retried
+// on a fresh copy of the namespace a few times before giving up
 func (d *kubeInformerConnection) UpdateStatus(ctx context.Context, namespace string, status string) {
-	ns, err := d.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	cfg := d.cfg.Current()
+
+	// the status annotation is turned off
+	if cfg.AnnotStatus == "" {
+		return
+	}
+
+	status = d.statusValue(status)
+	log := namespaceLog(namespace, d.statusConfigHash(namespace, status), logEventStatusUpdated)
+	attempt := 0
+	err := retry.RetryOnConflict(statusUpdateBackoff, func() error {
+		attempt++
+		if attempt > 1 {
+			log.Debugf("Retrying to save status annotation to namespace %s, attempt %d", namespace, attempt)
+		}
+
+		ns, err := d.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			log.Debugf("Cannot update the status of namespace %s: it is gone", namespace)
+			return nil
+		}
+		if err != nil {
+			log.WithField("event", logEventStatusFailed).Infof("Cannot find namespace to update status for: %v", namespace)
+			return nil
+		}
+
+		// update annotations
+		annotations := ns.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+
+		// a blank status removes the annotation
+		if status != "" {
+			annotations[cfg.AnnotStatus] = status
+		} else {
+			delete(annotations, cfg.AnnotStatus)
+		}
+
+		ns.SetAnnotations(annotations)
+
+		_, err = d.client.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+		log.Debugf("Saving status annotation to namespace %s: %+v", namespace, err)
+		return err
+	})
+
 	if err != nil {
-		logrus.Infof("Cannot find namespace to update status for: %v", namespace)
+		log.WithField("event", logEventStatusFailed).Infof("Cannot set error status on namespace %s: %+v", namespace, err)
 	}
+}
 
-	// update annotations
-	annotations := ns.GetAnnotations()
-	if annotations == nil {
-		annotations = make(map[string]string)
+// statusConfigHash is the config hash a status is about for the log lines: the one in a
+// structured status, else the last one written for the namespace
+func (d *kubeInformerConnection) statusConfigHash(namespace string, status string) string {
+	if strings.HasPrefix(status, "{") {
+		if hash := ParseStatusAnnotation(status).ConfigHash; hash != "" {
+			return hash
+		}
 	}
 
-	statusAnnotationExists := false
-	if _, ok := annotations[d.cfg.AnnotStatus]; ok {
-		statusAnnotationExists = true
+	d.hashesMutex.Lock()
+	defer d.hashesMutex.Unlock()
+	return d.hashes[namespace]
+}
+
+// statusValue is the value of the status annotation for a status. The generator passes the
+// structured status with --status-format=json, a plain one is turned into it without config hash
+func (d *kubeInformerConnection) statusValue(status string) string {
+	if status == "" {
+		return ""
+	}
+	if d.cfg.StatusFormat != config.StatusFormatJSON {
+		return TruncateStatus(status)
 	}
+	if strings.HasPrefix(status, "{") {
+		return status
+	}
+	return NewStatusAnnotation(status, "").String()
+}
 
-	// check the annotation status key and add if status not blank
-	if !statusAnnotationExists && status != "" {
-		// not found add it.
-		// only add status if the status key is not ""
-		annotations[d.cfg.AnnotStatus] = status
+// WriteStatusSummary applies a ConfigMap holding the status of every namespace as JSON keyed by the
+// namespace name. As the data is applied as a whole, entries of removed namespaces are pruned
+func (d *kubeInformerConnection) WriteStatusSummary(ctx context.Context, statuses map[string]*NamespaceStatus) error {
+	if d.cfg.StatusSummaryConfigMap == "" {
+		return nil
 	}
 
-	// check if annotation status key exists and remove if status blank
-	if statusAnnotationExists && status == "" {
-		delete(annotations, d.cfg.AnnotStatus)
+	data := map[string]string{}
+	for ns, st := range statuses {
+		js, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		data[ns] = string(js)
 	}
 
-	ns.SetAnnotations(annotations)
+	cm := &core.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      d.cfg.StatusSummaryConfigMap,
+			Namespace: reloaderNamespace(d.cfg),
+			Labels:    util.ManagedLabels(d.cfg.ID),
+		},
+		Data: data,
+	}
 
-	_, err = d.client.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+	patch, err := json.Marshal(cm)
+	if err != nil {
+		return err
+	}
 
-	logrus.Debugf("Saving status annotation to namespace %s: %+v", namespace, err)
-	// errors.IsConflict is safe to ignore since multiple log-routers try update at same time
-	// (only 1 router can update this unique ResourceVersion, no need to retry, each router is a retry process):
-	if err != nil && !errors.IsConflict(err) {
-		logrus.Infof("Cannot set error status on namespace %s: %+v", namespace, err)
+	force := true
+	_, err = d.client.CoreV1().ConfigMaps(cm.Namespace).Patch(ctx, cm.Name, types.ApplyPatchType, patch, metav1.PatchOptions{
+		FieldManager: statusSummaryFieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to apply status summary configmap %s/%s: %v", cm.Namespace, cm.Name, err)
 	}
+
+	logrus.Debugf("Applied status summary of %d namespaces to configmap %s/%s", len(data), cm.Namespace, cm.Name)
+	return nil
+}
+
+// reloaderNamespace returns the namespace the reloader runs in, falling back to the admin namespace
+func reloaderNamespace(cfg *config.Config) string {
+	if ns, err := ioutil.ReadFile(serviceAccountNamespace); err == nil {
+		if res := strings.TrimSpace(string(ns)); res != "" {
+			return res
+		}
+	}
+
+	return cfg.AdminNamespace
 }
 
 // discoverNamespaces constructs a list of namespaces to inspect for fluentd
-// configuration, using the configured list if provided, otherwise all namespaces are inspected
+// configuration, using the configured list if provided, otherwise all namespaces matching
+// the namespace selector are inspected. The list is in processing order, see prioritizeNamespaces
 func (d *kubeInformerConnection) discoverNamespaces(ctx context.Context) ([]string, error) {
+	cfg := d.cfg.Current()
+
 	var namespaces []string
-	if len(d.cfg.Namespaces) != 0 {
-		namespaces = d.cfg.Namespaces
+	if cfg.SingleNamespace != "" {
+		namespaces = []string{cfg.SingleNamespace}
+	} else if len(cfg.Namespaces) != 0 {
+		namespaces = cfg.Namespaces
 	} else {
-		nses, err := d.nslist.List(labels.NewSelector())
+		selector := cfg.ParsedNamespaceSelector
+		if selector == nil {
+			selector = labels.Everything()
+		}
+		nses, err := d.nslist.List(selector)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to list all namespaces: %v", err)
 		}
@@ -147,10 +898,127 @@ func (d *kubeInformerConnection) discoverNamespaces(ctx context.Context) ([]stri
 			namespaces = append(namespaces, ns.ObjectMeta.Name)
 		}
 	}
+	namespaces = d.excludeNamespaces(namespaces)
 	sort.Strings(namespaces)
+
+	if cfg.MaxNamespaces > 0 && len(namespaces) > cfg.MaxNamespaces {
+		namespaces = d.limitNamespaces(namespaces)
+	} else {
+		metrics.SetDroppedNamespacesMetric(0)
+	}
+
+	if len(cfg.NamespacePriority) > 0 {
+		namespaces = prioritizeNamespaces(namespaces, cfg.NamespacePriority)
+		logrus.Debugf("Processing the namespaces in the order: %s", strings.Join(namespaces, ", "))
+	}
 	return namespaces, nil
 }
 
+// prioritizeNamespaces moves the namespaces listed in priority to the front, in the order of
+// the list. The others keep their order. Listed namespaces that are not processed are ignored
+func prioritizeNamespaces(namespaces []string, priority []string) []string {
+	present := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		present[ns] = true
+	}
+
+	res := make([]string, 0, len(namespaces))
+	first := map[string]bool{}
+	for _, ns := range priority {
+		if present[ns] && !first[ns] {
+			first[ns] = true
+			res = append(res, ns)
+		}
+	}
+	for _, ns := range namespaces {
+		if !first[ns] {
+			res = append(res, ns)
+		}
+	}
+	return res
+}
+
+// excludeNamespaces drops the namespaces matching a pattern of ExcludeNamespaces, except for
+// the admin namespace. The patterns are validated at startup
+func (d *kubeInformerConnection) excludeNamespaces(namespaces []string) []string {
+	cfg := d.cfg.Current()
+	if len(cfg.ExcludeNamespaces) == 0 {
+		return namespaces
+	}
+
+	kept := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		excluded := false
+		for _, pattern := range cfg.ExcludeNamespaces {
+			if ok, _ := path.Match(pattern, ns); ok && ns != cfg.AdminNamespace {
+				excluded = true
+				break
+			}
+		}
+
+		if excluded {
+			logrus.Debugf("Namespace %s is excluded by --exclude-namespaces", ns)
+		} else {
+			kept = append(kept, ns)
+		}
+	}
+
+	return kept
+}
+
+// limitNamespaces keeps at most MaxNamespaces namespaces. The admin namespace and the namespaces
+// processed in previous cycles come first so that the processed set stays stable
+func (d *kubeInformerConnection) limitNamespaces(namespaces []string) []string {
+	cfg := d.cfg.Current()
+
+	prioritized := make([]string, 0, len(namespaces))
+	rest := make([]string, 0, len(namespaces))
+	// the fetches of a previous run past their --per-namespace-timeout may still write the hashes
+	d.hashesMutex.Lock()
+	for _, ns := range namespaces {
+		if _, known := d.hashes[ns]; known || ns == cfg.AdminNamespace {
+			prioritized = append(prioritized, ns)
+		} else {
+			rest = append(rest, ns)
+		}
+	}
+	d.hashesMutex.Unlock()
+
+	all := append(prioritized, rest...)
+	kept := all[:cfg.MaxNamespaces]
+	dropped := len(all) - len(kept)
+
+	logrus.Warnf("Found %d namespaces but --max-namespaces is %d, NOT processing %d namespaces: %s",
+		len(all), cfg.MaxNamespaces, dropped, strings.Join(all[cfg.MaxNamespaces:], ", "))
+	metrics.SetDroppedNamespacesMetric(dropped)
+
+	sort.Strings(kept)
+	return kept
+}
+
+// connect creates a client and checks that the cluster answers, a bad kubeconfig then fails at
+// startup instead of waiting for the informers forever
+func connect(kubeCfg *rest.Config) (kubernetes.Interface, error) {
+	client, err := kubernetes.NewForConfig(kubeCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		return nil, fmt.Errorf("cannot connect to the cluster at %s: %+v", kubeCfg.Host, err)
+	}
+	return client, nil
+}
+
+// configClusterConfig loads the cluster the configs are read from. Without --config-kubeconfig the
+// usual kubeconfig files are searched, without --config-context their current context is used
+func configClusterConfig(cfg *config.Config) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = cfg.ConfigKubeConfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: cfg.ConfigKubeContext}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
+
 // NewKubernetesInformerDatasource builds a new Datasource from the provided config.
 // The returned Datasource uses Informers to efficiently track objects in the kubernetes
 // API by watching for updates to a known state.
@@ -167,52 +1035,202 @@ func NewKubernetesInformerDatasource(ctx context.Context, cfg *config.Config, up
 		return nil, err
 	}
 
-	client, err := kubernetes.NewForConfig(kubeCfg)
+	client, err := connect(kubeCfg)
 	if err != nil {
 		return nil, err
 	}
 
 	logrus.Infof("Connected to cluster at %s", kubeCfg.Host)
 
-	factory := informers.NewSharedInformerFactory(client, 0)
-	namespaceLister := factory.Core().V1().Namespaces().Lister()
-	podLister := factory.Core().V1().Pods().Lister()
+	// the configs are read from another cluster, the pods and the statuses stay in this one
+	configKubeCfg, configClient := kubeCfg, client
+	if cfg.ConfigKubeConfig != "" || cfg.ConfigKubeContext != "" {
+		configKubeCfg, err = configClusterConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the config cluster from --config-kubeconfig/--config-context: %+v", err)
+		}
+
+		configClient, err = connect(configKubeCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		logrus.Infof("Reading the namespace configs from cluster at %s", configKubeCfg.Host)
+	}
+
+	d, err := newKubeInformerConnection(ctx, cfg, client, configClient, configKubeCfg, updateChan)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newKubeInformerConnection starts the informers on the clients and waits for their caches. The
+// configs are read with configClient, the pods and the statuses with client
+func newKubeInformerConnection(ctx context.Context, cfg *config.Config, client, configClient kubernetes.Interface, configKubeCfg *rest.Config, updateChan chan time.Time) (*kubeInformerConnection, error) {
+	var err error
+	var factory informers.SharedInformerFactory
+	var namespaceLister listerv1.NamespaceLister
+	cacheSyncs := []cache.InformerSynced{}
+	if cfg.SingleNamespace != "" {
+		// all informers are scoped to the namespace, namespaces are cluster-wide so they are not watched
+		logrus.Infof("Processing only namespace %s", cfg.SingleNamespace)
+		factory = informers.NewSharedInformerFactoryWithOptions(client, cfg.ResyncPeriod, informers.WithNamespace(cfg.SingleNamespace))
+		namespaceLister = newSingleNamespaceLister(client, cfg.SingleNamespace)
+	} else if len(cfg.Namespaces) > 0 {
+		// only the listed namespaces are watched, the permission to get them by name is enough
+		logrus.Infof("Watching only the namespaces %s", strings.Join(cfg.Namespaces, ", "))
+		factory = informers.NewSharedInformerFactory(client, cfg.ResyncPeriod)
+		var synced []cache.InformerSynced
+		namespaceLister, synced = newNamespacesLister(ctx, client, cfg.Namespaces)
+		cacheSyncs = append(cacheSyncs, synced...)
+	} else {
+		factory = informers.NewSharedInformerFactory(client, cfg.ResyncPeriod)
+		namespaceLister = factory.Core().V1().Namespaces().Lister()
+		cacheSyncs = append(cacheSyncs, factory.Core().V1().Namespaces().Informer().HasSynced)
+	}
+
+	// asking for the lister registers the pod informer with the factory, so don't when pods are disabled
+	var podLister listerv1.PodLister
+	var podIndex cache.Indexer
+	var podFactory informers.SharedInformerFactory
+	if cfg.DisablePods {
+		logrus.Infof("Pod collection disabled, container-based macros will not match any pods")
+	} else {
+		// the list options of a factory apply to all its informers, so narrowed pods get their own
+		podFactory = factory
+		if cfg.PodLabelSelector != "" || cfg.PodFieldSelector != "" {
+			logrus.Infof("Watching only the pods matching label selector '%s' and field selector '%s'", cfg.PodLabelSelector, cfg.PodFieldSelector)
+			podFactory = informers.NewSharedInformerFactoryWithOptions(client, cfg.ResyncPeriod, podInformerOptions(cfg)...)
+		}
+
+		podLister = podFactory.Core().V1().Pods().Lister()
+		if err := podFactory.Core().V1().Pods().Informer().AddIndexers(podIndexers(cfg)); err != nil {
+			return nil, err
+		}
+		podIndex = podFactory.Core().V1().Pods().Informer().GetIndexer()
+		cacheSyncs = append(cacheSyncs, podFactory.Core().V1().Pods().Informer().HasSynced)
+		if cfg.PodConfigAnnotation != "" {
+			podFactory.Core().V1().Pods().Informer().AddEventHandler(podAnnotationHandler(cfg.PodConfigAnnotation, updateChan))
+		}
+		if cfg.AnnotExclude != "" {
+			podFactory.Core().V1().Pods().Informer().AddEventHandler(podAnnotationHandler(cfg.AnnotExclude, updateChan))
+		}
+	}
+
+	var recorder record.EventRecorder
+	if cfg.EmitEvents {
+		recorder = newEventRecorder(client)
+	}
+
+	// the informers of the configs, the same factory unless they are read from another cluster
+	configFactory := factory
+	if configClient != client {
+		if cfg.SingleNamespace != "" {
+			configFactory = informers.NewSharedInformerFactoryWithOptions(configClient, cfg.ResyncPeriod, informers.WithNamespace(cfg.SingleNamespace))
+		} else {
+			configFactory = informers.NewSharedInformerFactory(configClient, cfg.ResyncPeriod)
+		}
+	}
 
 	var kubeds kubedatasource.KubeDS
 	if cfg.Datasource == "crd" {
-		kubeds, err = kubedatasource.NewFluentdConfigDS(ctx, cfg, kubeCfg, updateChan)
+		kubeds, err = kubedatasource.NewFluentdConfigDS(ctx, cfg, configKubeCfg, updateChan)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.Datasource == "secret" {
+		kubeds, err = kubedatasource.NewSecretDS(ctx, cfg, configFactory, namespaceLister, updateChan)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.Datasource == "git" {
+		kubeds, err = kubedatasource.NewGitDS(ctx, cfg, updateChan)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.Datasource == "file" {
+		kubeds, err = kubedatasource.NewFileDS(ctx, cfg, updateChan)
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		if cfg.CRDMigrationMode {
-			kubeds, err = kubedatasource.NewMigrationModeDS(ctx, cfg, kubeCfg, factory, updateChan)
+			kubeds, err = kubedatasource.NewMigrationModeDS(ctx, cfg, configKubeCfg, configFactory, namespaceLister, updateChan)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			kubeds, err = kubedatasource.NewConfigMapDS(ctx, cfg, factory, updateChan)
+			kubeds, err = kubedatasource.NewConfigMapDS(ctx, cfg, configFactory, namespaceLister, updateChan)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
 
-	factory.Start(nil)
-	if !cache.WaitForCacheSync(nil,
-		factory.Core().V1().Namespaces().Informer().HasSynced,
-		factory.Core().V1().Pods().Informer().HasSynced,
-		kubeds.IsReady) {
+	var runtime *runtimeConfig
+	if cfg.RuntimeConfigMap != "" {
+		var synced cache.InformerSynced
+		runtime, synced = newRuntimeConfig(ctx, client, cfg, reloaderNamespace(cfg), updateChan)
+		cacheSyncs = append(cacheSyncs, synced)
+	} else if cfg.RuntimeConfigDir != "" {
+		runtime = newRuntimeConfigDir(ctx, cfg, updateChan)
+	}
+
+	var global *globalConfig
+	if cfg.GlobalConfig != "" {
+		var synced cache.InformerSynced
+		global, synced = newGlobalConfig(ctx, configClient, cfg, updateChan)
+		cacheSyncs = append(cacheSyncs, synced)
+	}
+
+	var snippets *sharedSnippets
+	if cfg.SnippetsNamespace != "" {
+		var synced cache.InformerSynced
+		snippets, synced = newSharedSnippets(ctx, configClient, cfg, updateChan)
+		cacheSyncs = append(cacheSyncs, synced)
+	}
+
+	// the informers stop with ctx, the datasource is of no use afterwards
+	factory.Start(ctx.Done())
+	if configFactory != factory {
+		configFactory.Start(ctx.Done())
+	}
+	// narrowed pods have a factory of their own, its informer must run for the caches to sync
+	if podFactory != nil && podFactory != factory {
+		podFactory.Start(ctx.Done())
+	}
+	cacheSyncs = append(cacheSyncs, kubeds.IsReady)
+	if !cache.WaitForCacheSync(ctx.Done(), cacheSyncs...) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("Failed to sync local informer with upstream Kubernetes API")
 	}
 	logrus.Infof("Synced local informer with upstream Kubernetes API")
 
+	if cfg.ResyncPeriod > 0 {
+		go resyncPeriodically(ctx, cfg.ResyncPeriod, updateChan)
+	}
+
 	return &kubeInformerConnection{
-		client:  client,
-		hashes:  make(map[string]string),
-		cfg:     cfg,
-		kubeds:  kubeds,
-		nslist:  namespaceLister,
-		podlist: podLister,
+		client:      client,
+		hashes:      make(map[string]string),
+		inputHashes: make(map[string]string),
+		cfg:         cfg,
+		kubeds:      kubeds,
+		nslist:      namespaceLister,
+		podlist:     podLister,
+		podIndex:    podIndex,
+		runtime:     runtime,
+		global:      global,
+		snippets:    snippets,
+
+		admissions:     namespaceAdmissions(cfg),
+		updateChan:     updateChan,
+		graceScheduled: map[string]bool{},
+		fetchFailures:  map[string]int{},
+		recorder:       recorder,
+		stopped:        ctx.Done(),
 	}, nil
 }
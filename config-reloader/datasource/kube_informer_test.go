@@ -0,0 +1,1240 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+type staticKubeDS map[string]string
+
+func (s staticKubeDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	return s[namespace], nil
+}
+
+func (s staticKubeDS) IsReady() bool {
+	return true
+}
+
+// countingPodLister records the namespaces whose pods were listed
+type countingPodLister struct {
+	listed []string
+}
+
+type countingPodNamespaceLister struct {
+	parent    *countingPodLister
+	namespace string
+}
+
+func (l *countingPodLister) List(selector labels.Selector) ([]*core.Pod, error) {
+	return nil, nil
+}
+
+func (l *countingPodLister) Pods(namespace string) listerv1.PodNamespaceLister {
+	return &countingPodNamespaceLister{parent: l, namespace: namespace}
+}
+
+func (l *countingPodNamespaceLister) List(selector labels.Selector) ([]*core.Pod, error) {
+	l.parent.listed = append(l.parent.listed, l.namespace)
+	return nil, nil
+}
+
+func (l *countingPodNamespaceLister) Get(name string) (*core.Pod, error) {
+	return nil, nil
+}
+
+func TestConfigNeedsPods(t *testing.T) {
+	withPods := []string{
+		`
+<source>
+  @type mounted-file
+  path /var/log/welcome.log
+  labels app=grafana
+</source>`,
+		`
+<source>
+  @type mounted-file
+  path /var/log/welcome.log
+  labels app=grafana
+</source>
+<match **>
+  @type null
+</match>`,
+	}
+
+	for _, c := range withPods {
+		assert.True(t, configNeedsPods(c), c)
+	}
+
+	withoutPods := []string{
+		"",
+		`
+<match **>
+  @type elasticsearch
+</match>`,
+		`
+<filter $labels(app=nginx)>
+  @type parser
+</filter>
+<match $thisns>
+  @type null
+</match>`,
+	}
+
+	for _, c := range withoutPods {
+		assert.False(t, configNeedsPods(c), c)
+	}
+}
+
+func TestGetNamespacesListsPodsOnlyWhenNeeded(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range []string{"files", "outputs"} {
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}))
+	}
+
+	pods := &countingPodLister{}
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{},
+		kubeds: staticKubeDS{
+			"files":   "<source>\n  @type mounted-file\n  path /a.log\n  labels app=a\n</source>",
+			"outputs": "<match **>\n  @type null\n</match>",
+		},
+		nslist:  listerv1.NewNamespaceLister(indexer),
+		podlist: pods,
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nses))
+	assert.Equal(t, []string{"files"}, pods.listed)
+}
+
+func TestDiscoverNamespacesWithSelector(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, enabled := range map[string]string{"opted-in": "true", "opted-out": "false", "unlabeled": ""} {
+		ns := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if enabled != "" {
+			ns.Labels = map[string]string{"logging.vmware.com/enabled": enabled}
+		}
+		assert.Nil(t, indexer.Add(ns))
+	}
+
+	cfg := &config.Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{"--namespace-selector=logging.vmware.com/enabled=true"}))
+	assert.Nil(t, cfg.Validate())
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         cfg,
+		nslist:      listerv1.NewNamespaceLister(indexer),
+	}
+
+	namespaces, err := d.discoverNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"opted-in"}, namespaces)
+
+	// the explicit list wins
+	cfg.Namespaces = []string{"unlabeled"}
+	namespaces, err = d.discoverNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"unlabeled"}, namespaces)
+
+	cfg.Namespaces = nil
+	cfg.ParsedNamespaceSelector = nil
+	namespaces, err = d.discoverNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"opted-in", "opted-out", "unlabeled"}, namespaces)
+}
+
+func TestDiscoverNamespacesExcludes(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"kube-system", "kube-public", "kube-node-lease", "web", "api"} {
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+
+	cfg := &config.Config{
+		AdminNamespace:    "kube-system",
+		ExcludeNamespaces: []string{"kube-*", "api"},
+	}
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         cfg,
+		nslist:      listerv1.NewNamespaceLister(indexer),
+	}
+
+	namespaces, err := d.discoverNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"kube-system", "web"}, namespaces)
+
+	// the exclusion wins over the explicit list
+	cfg.Namespaces = []string{"api", "web", "kube-public"}
+	namespaces, err = d.discoverNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"web"}, namespaces)
+}
+
+func TestDiscoverNamespacesPriority(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"kube-system", "web", "api", "security"} {
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg: &config.Config{
+			AdminNamespace:    "kube-system",
+			NamespacePriority: []string{"security", "gone", "web", "security"},
+		},
+		nslist: listerv1.NewNamespaceLister(indexer),
+	}
+
+	namespaces, err := d.discoverNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"security", "web", "api", "kube-system"}, namespaces)
+}
+
+func TestLimitNamespaces(t *testing.T) {
+	d := &kubeInformerConnection{
+		hashes: map[string]string{"d": "hash"},
+		cfg: &config.Config{
+			AdminNamespace: "kube-system",
+			MaxNamespaces:  3,
+		},
+	}
+
+	kept := d.limitNamespaces([]string{"a", "b", "c", "d", "kube-system"})
+	assert.Equal(t, []string{"a", "d", "kube-system"}, kept)
+}
+
+func TestGetNamespacesAppendsPodConfigSnippets(t *testing.T) {
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range []string{"kube-system", "web"} {
+		assert.Nil(t, nsIndexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}))
+	}
+
+	annotation := "example.com/fluentd-config"
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	pods := map[string]string{
+		"web/b":         "<match kube.web.b.**>\n  @type null\n</match>",
+		"web/a-2":       "<match kube.web.a.**>\n  @type null\n</match>",
+		"web/a-1":       "<match kube.web.a.**>\n  @type null\n</match>",
+		"web/c":         "",
+		"kube-system/x": "<match **>\n  @type null\n</match>",
+	}
+	for key, snippet := range pods {
+		parts := strings.Split(key, "/")
+		pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: parts[0], Name: parts[1]}}
+		if snippet != "" {
+			pod.Annotations = map[string]string{annotation: snippet}
+		}
+		assert.Nil(t, podIndexer.Add(pod))
+	}
+
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg: &config.Config{
+			AdminNamespace:      "kube-system",
+			PodConfigAnnotation: annotation,
+		},
+		kubeds: staticKubeDS{
+			"kube-system": "<match systemd.**>\n  @type null\n</match>",
+			"web":         "<match kube.web.**>\n  @type elasticsearch\n</match>",
+		},
+		nslist:  listerv1.NewNamespaceLister(nsIndexer),
+		podlist: listerv1.NewPodLister(podIndexer),
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nses))
+
+	// pods can't add to the admin namespace config
+	assert.Equal(t, "<match systemd.**>\n  @type null\n</match>", nses[0].FluentdConfig)
+
+	// ordered by pod name, the snippet of a-2 is the same as a-1
+	expected := `<match kube.web.**>
+  @type elasticsearch
+</match>
+
+# from pod a-1
+<match kube.web.a.**>
+  @type null
+</match>
+
+# from pod b
+<match kube.web.b.**>
+  @type null
+</match>`
+	assert.Equal(t, expected, nses[1].FluentdConfig)
+}
+
+func TestGetNamespacesSkipsTerminatingNamespaces(t *testing.T) {
+	active := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "active"}}
+	leaving := &core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "leaving"},
+		Status:     core.NamespaceStatus{Phase: core.NamespaceTerminating},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(active))
+	assert.Nil(t, indexer.Add(leaving))
+
+	client := fake.NewSimpleClientset(active, leaving)
+	d := &kubeInformerConnection{
+		client:      client,
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg: &config.Config{
+			AnnotStatus:         "example.com/status",
+			RequiredAnnotations: []string{"example.com/owner"},
+		},
+		kubeds: staticKubeDS{
+			"active":  "<match **>\n  @type null\n</match>",
+			"leaving": "<match **>\n  @type null\n</match>",
+		},
+		nslist: listerv1.NewNamespaceLister(indexer),
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(nses))
+
+	// only the active namespace gets a status for its missing annotation
+	updated := []string{}
+	for _, action := range client.Actions() {
+		if update, ok := action.(k8stesting.UpdateAction); ok {
+			updated = append(updated, update.GetObject().(*core.Namespace).Name)
+		}
+	}
+	assert.Equal(t, []string{"active"}, updated)
+	_, skipped := d.hashes["active"]
+	assert.True(t, skipped)
+	_, skipped = d.hashes["leaving"]
+	assert.False(t, skipped)
+}
+
+func TestGetNamespacesRequiredAnnotations(t *testing.T) {
+	owned := &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "owned",
+		Annotations: map[string]string{"example.com/owner": "team-a"},
+	}}
+	orphan := &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "orphan",
+		Annotations: map[string]string{"example.com/owner": ""},
+	}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(owned))
+	assert.Nil(t, indexer.Add(orphan))
+
+	client := fake.NewSimpleClientset(owned, orphan)
+	d := &kubeInformerConnection{
+		client:      client,
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg: &config.Config{
+			AnnotStatus:         "example.com/status",
+			RequiredAnnotations: []string{"example.com/owner"},
+		},
+		kubeds: staticKubeDS{
+			"owned":  "<match **>\n  @type null\n</match>",
+			"orphan": "<match **>\n  @type null\n</match>",
+		},
+		nslist: listerv1.NewNamespaceLister(indexer),
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, "owned", nses[0].Name)
+
+	// an empty annotation counts as missing, the namespace is told why it is skipped
+	nsobj, err := client.CoreV1().Namespaces().Get(context.Background(), "orphan", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "namespace is not processed, missing required annotations: example.com/owner", nsobj.Annotations["example.com/status"])
+}
+
+func TestGetNamespacesSkipsIgnoredNamespaces(t *testing.T) {
+	ignored := &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "ignored",
+		Annotations: map[string]string{"example.com/ignore": "true"},
+	}}
+	admin := &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "kube-system",
+		Annotations: map[string]string{"example.com/ignore": "true"},
+	}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(ignored))
+	assert.Nil(t, indexer.Add(admin))
+
+	client := fake.NewSimpleClientset(ignored, admin)
+	d := &kubeInformerConnection{
+		client:      client,
+		hashes:      map[string]string{"ignored": "applied"},
+		inputHashes: map[string]string{"ignored": "fetched"},
+		cfg: &config.Config{
+			AdminNamespace: "kube-system",
+			AnnotStatus:    "example.com/status",
+			AnnotIgnore:    "example.com/ignore",
+		},
+		kubeds: staticKubeDS{
+			"ignored":     "<match **>\n  @type null\n</match>",
+			"kube-system": "<match **>\n  @type null\n</match>",
+		},
+		nslist: listerv1.NewNamespaceLister(indexer),
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	// the admin namespace cannot be ignored
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, "kube-system", nses[0].Name)
+
+	// the ignored namespace is forgotten and gets no status
+	_, known := d.hashes["ignored"]
+	assert.False(t, known)
+	_, known = d.inputHashes["ignored"]
+	assert.False(t, known)
+	for _, action := range client.Actions() {
+		if update, ok := action.(k8stesting.UpdateAction); ok {
+			assert.NotEqual(t, "ignored", update.GetObject().(*core.Namespace).Name)
+		}
+	}
+}
+
+func TestGetNamespacesPrunesRemovedNamespaces(t *testing.T) {
+	kept := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kept"}}
+	excluded := &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "excluded",
+		Annotations: map[string]string{"example.com/status": "error: bad config"},
+	}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(kept))
+	assert.Nil(t, indexer.Add(excluded))
+
+	client := fake.NewSimpleClientset(kept, excluded)
+	d := &kubeInformerConnection{
+		client:      client,
+		hashes:      map[string]string{"kept": "a", "excluded": "b", "gone": "c"},
+		inputHashes: map[string]string{"kept": "a", "excluded": "b", "gone": "c"},
+		cfg: &config.Config{
+			AnnotStatus:       "example.com/status",
+			ExcludeNamespaces: []string{"excluded"},
+		},
+		kubeds: staticKubeDS{"kept": "<match **>\n  @type null\n</match>"},
+		nslist: listerv1.NewNamespaceLister(indexer),
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, map[string]string{"kept": "a"}, d.hashes)
+	assert.Equal(t, 1, len(d.inputHashes))
+	assert.Contains(t, d.inputHashes, "kept")
+
+	// the status of the excluded namespace is cleared, the deleted one is skipped
+	nsobj, err := client.CoreV1().Namespaces().Get(context.Background(), "excluded", metav1.GetOptions{})
+	assert.Nil(t, err)
+	_, found := nsobj.Annotations["example.com/status"]
+	assert.False(t, found)
+}
+
+func TestGetNamespacesDefersNewNamespaces(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              "fresh",
+		CreationTimestamp: metav1.NewTime(time.Now()),
+	}}))
+	assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              "settled",
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+	}}))
+
+	updateChan := make(chan time.Time, 1)
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{NewNamespaceGrace: 200 * time.Millisecond},
+		kubeds: staticKubeDS{
+			"fresh":   "<match **>\n  @type null\n</match>",
+			"settled": "<match **>\n  @type null\n</match>",
+		},
+		nslist:     listerv1.NewNamespaceLister(indexer),
+		updateChan: updateChan,
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, "settled", nses[0].Name)
+	// skipped without a status
+	assert.Equal(t, "", d.hashes["fresh"])
+
+	// a run is triggered once the grace window is over and the namespace is then processed
+	select {
+	case <-updateChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run was scheduled after the grace window")
+	}
+
+	nses, err = d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nses))
+}
+
+func TestUpdateStatusRetriesOnConflict(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	conflicts := 2
+	client.PrependReactor("update", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "namespaces"}, "team-a", fmt.Errorf("changed"))
+		}
+		return false, nil, nil
+	})
+
+	d := &kubeInformerConnection{
+		client: client,
+		cfg:    &config.Config{AnnotStatus: "example.com/status"},
+	}
+	ctx := context.Background()
+
+	d.UpdateStatus(ctx, "team-a", "bad config")
+	ns, err := client.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, conflicts)
+	assert.Equal(t, "bad config", ns.Annotations["example.com/status"])
+
+	d.UpdateStatus(ctx, "team-a", "")
+	ns, err = client.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.NotContains(t, ns.Annotations, "example.com/status")
+
+	// gives up after the backoff steps
+	conflicts = 100
+	d.UpdateStatus(ctx, "team-a", "bad config")
+	assert.Equal(t, 100-statusUpdateBackoff.Steps, conflicts)
+}
+
+func TestReviewToken(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.TokenReview)
+		if review.Spec.Token == "good" {
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:monitoring:prometheus"
+			// the token is issued for kube-fluentd-operator only
+			for _, audience := range review.Spec.Audiences {
+				if audience == "kube-fluentd-operator" {
+					review.Status.Audiences = []string{audience}
+				}
+			}
+		}
+		return true, review, nil
+	})
+	d := &kubeInformerConnection{client: client}
+
+	user, ok, err := d.ReviewToken(context.Background(), "good", nil)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "system:serviceaccount:monitoring:prometheus", user)
+
+	user, ok, err = d.ReviewToken(context.Background(), "good", []string{"kube-fluentd-operator"})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "system:serviceaccount:monitoring:prometheus", user)
+
+	_, ok, err = d.ReviewToken(context.Background(), "good", []string{"vault"})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = d.ReviewToken(context.Background(), "bad", nil)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestUpdateStatusFormats(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	d := &kubeInformerConnection{
+		client: client,
+		cfg:    &config.Config{AnnotStatus: "example.com/status", StatusFormat: config.StatusFormatText},
+	}
+	ctx := context.Background()
+	annotation := func() string {
+		ns, err := client.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+		assert.Nil(t, err)
+		return ns.Annotations["example.com/status"]
+	}
+
+	// a new status replaces the previous one
+	d.UpdateStatus(ctx, "team-a", "bad config")
+	d.UpdateStatus(ctx, "team-a", "worse config")
+	assert.Equal(t, "worse config", annotation())
+
+	// plain statuses are structured, the structured ones written as is
+	d.cfg.StatusFormat = config.StatusFormatJSON
+	d.UpdateStatus(ctx, "team-a", "namespace is not processed")
+	st := ParseStatusAnnotation(annotation())
+	assert.Equal(t, StatusError, st.Status)
+	assert.Equal(t, "namespace is not processed", st.Message)
+	assert.NotEmpty(t, st.LastUpdated)
+
+	structured := NewStatusAnnotation("", "abc").String()
+	d.UpdateStatus(ctx, "team-a", structured)
+	assert.Equal(t, structured, annotation())
+}
+
+func TestUpdateStatusLogFields(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.DebugLevel)
+
+	client := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	d := &kubeInformerConnection{
+		client: client,
+		hashes: map[string]string{"team-a": "abc"},
+		cfg:    &config.Config{AnnotStatus: "example.com/status", StatusFormat: config.StatusFormatJSON},
+	}
+	ctx := context.Background()
+
+	d.UpdateStatus(ctx, "team-a", NewStatusAnnotation("", "def").String())
+	entry := hook.LastEntry()
+	assert.Equal(t, "team-a", entry.Data["namespace"])
+	assert.Equal(t, "def", entry.Data["config_hash"])
+	assert.Equal(t, logEventStatusUpdated, entry.Data["event"])
+
+	// a plain status is about the last config written
+	d.cfg.StatusFormat = config.StatusFormatText
+	d.UpdateStatus(ctx, "team-a", "bad config")
+	assert.Equal(t, "abc", hook.LastEntry().Data["config_hash"])
+
+	d.UpdateStatus(ctx, "team-b", "bad config")
+	entry = hook.LastEntry()
+	assert.Equal(t, "team-b", entry.Data["namespace"])
+	assert.NotContains(t, entry.Data, "config_hash")
+}
+
+func TestWriteCurrentConfigHashLogsChanges(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.DebugLevel)
+
+	d := &kubeInformerConnection{hashes: map[string]string{}}
+
+	d.WriteCurrentConfigHash("team-a", "abc")
+	entry := hook.LastEntry()
+	assert.Equal(t, logEventConfigChanged, entry.Data["event"])
+	assert.Equal(t, "abc", entry.Data["config_hash"])
+	assert.Equal(t, "Config hash of namespace team-a changed from none to abc", entry.Message)
+
+	d.WriteCurrentConfigHash("team-a", "def")
+	assert.Equal(t, "Config hash of namespace team-a changed from abc to def", hook.LastEntry().Message)
+
+	// the same hash is not a change
+	hook.Reset()
+	d.WriteCurrentConfigHash("team-a", "def")
+	assert.Nil(t, hook.LastEntry())
+	assert.Equal(t, "def", d.hashes["team-a"])
+}
+
+func TestGetNamespacesMarksUnchangedInput(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nsobj := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	assert.Nil(t, indexer.Add(nsobj))
+
+	kubeds := staticKubeDS{"team-a": "<match **>\n  @type null\n</match>"}
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{AnnotStatus: "example.com/status"},
+		kubeds:      kubeds,
+		nslist:      listerv1.NewNamespaceLister(indexer),
+		podlist:     &countingPodLister{},
+	}
+	unchanged := func() bool {
+		nses, err := d.GetNamespaces(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(nses))
+		assert.NotEmpty(t, nses[0].InputHash)
+		return nses[0].Unchanged
+	}
+
+	assert.False(t, unchanged())
+	assert.True(t, unchanged())
+
+	// the status annotation is written by the reloader itself
+	nsobj.Annotations = map[string]string{"example.com/status": "bad config"}
+	assert.True(t, unchanged())
+
+	nsobj.Labels = map[string]string{"team": "a"}
+	assert.False(t, unchanged())
+
+	kubeds["team-a"] = "<match **>\n  @type stdout\n</match>"
+	assert.False(t, unchanged())
+	assert.True(t, unchanged())
+}
+
+// deletingKubeDS deletes a namespace while its config is read, like a kubectl delete racing a run
+type deletingKubeDS struct {
+	indexer cache.Indexer
+}
+
+func (s deletingKubeDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	if namespace == "doomed" {
+		if err := s.indexer.Delete(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil {
+			return "", err
+		}
+		return "", errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "fluentd-config")
+	}
+	return "<match **>\n  @type null\n</match>", nil
+}
+
+func (s deletingKubeDS) IsReady() bool {
+	return true
+}
+
+func TestGetNamespacesSkipsDeletedNamespaces(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"team-a", "doomed"} {
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+
+	d := &kubeInformerConnection{
+		hashes:        map[string]string{"doomed": "abc", "gone": "def"},
+		inputHashes:   map[string]string{"doomed": "abc", "gone": "def"},
+		fetchFailures: map[string]int{"doomed": 2},
+		cfg:           &config.Config{},
+		kubeds:        deletingKubeDS{indexer: indexer},
+		nslist:        listerv1.NewNamespaceLister(indexer),
+	}
+	ctx := context.Background()
+
+	// deleted while its config is read
+	nses, err := d.fetchNamespaces(ctx, []string{"team-a", "doomed"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, "team-a", nses[0].Name)
+	assert.NotContains(t, d.hashes, "doomed")
+	assert.NotContains(t, d.inputHashes, "doomed")
+	assert.NotContains(t, d.fetchFailures, "doomed")
+
+	// deleted after the discovery
+	nsconfig, err := d.fetchNamespace(ctx, "gone")
+	assert.Nil(t, err)
+	assert.Nil(t, nsconfig)
+	assert.NotContains(t, d.hashes, "gone")
+}
+
+// hangingKubeDS never answers for namespace stuck, like a config waiting on an API that does not respond
+type hangingKubeDS struct {
+	release chan struct{}
+}
+
+func (s hangingKubeDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	if namespace == "stuck" {
+		<-s.release
+	}
+	return "<match **>\n  @type null\n</match>", nil
+}
+
+func (s hangingKubeDS) IsReady() bool {
+	return true
+}
+
+func TestGetNamespacesTimesOutStuckNamespaces(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"team-a", "stuck", "team-b"} {
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+
+	kubeds := hangingKubeDS{release: make(chan struct{})}
+	d := &kubeInformerConnection{
+		hashes:        map[string]string{},
+		inputHashes:   map[string]string{},
+		fetchFailures: map[string]int{},
+		cfg:           &config.Config{PerNamespaceTimeout: 50 * time.Millisecond, FetchConcurrency: 1},
+		kubeds:        kubeds,
+		nslist:        listerv1.NewNamespaceLister(indexer),
+	}
+
+	start := time.Now()
+	nses, err := d.fetchNamespaces(context.Background(), []string{"team-a", "stuck", "team-b"})
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, 3, len(nses))
+	assert.Nil(t, nses[0].FetchError)
+	assert.Nil(t, nses[2].FetchError)
+	assert.Equal(t, "stuck", nses[1].Name)
+	assert.Equal(t, ErrorPhaseFetch, ErrorPhase(nses[1].FetchError))
+	assert.Contains(t, nses[1].FetchError.Error(), "took longer than 50ms")
+	assert.Equal(t, 1, d.fetchFailures["stuck"])
+
+	// the late answer is discarded, the next run reads the namespace as changed and keeps its backoff
+	close(kubeds.release)
+	time.Sleep(20 * time.Millisecond)
+	d.hashesMutex.Lock()
+	assert.NotContains(t, d.inputHashes, "stuck")
+	assert.Equal(t, 1, d.fetchFailures["stuck"])
+	d.hashesMutex.Unlock()
+}
+
+func TestNamespaceInputHashIgnoresContainerOrder(t *testing.T) {
+	nsobj := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	a := &MiniContainer{PodName: "a", Name: "main"}
+	b := &MiniContainer{PodName: "b", Name: "main"}
+
+	assert.Equal(t, namespaceInputHash("cfg", nsobj, "", []*MiniContainer{a, b}, nil), namespaceInputHash("cfg", nsobj, "", []*MiniContainer{b, a}, nil))
+	assert.NotEqual(t, namespaceInputHash("cfg", nsobj, "", []*MiniContainer{a, b}, nil), namespaceInputHash("cfg", nsobj, "", []*MiniContainer{a}, nil))
+}
+
+func TestGetNamespacesFailsOnceStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{},
+		stopped:     ctx.Done(),
+	}
+	cancel()
+
+	_, err := d.GetNamespaces(context.Background())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	d.stopped = nil
+	_, err = d.GetNamespaces(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+// failingKubeDS fails for one namespace, with err if set
+type failingKubeDS struct {
+	staticKubeDS
+	failing string
+	err     error
+}
+
+func (f failingKubeDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	if namespace == f.failing {
+		if f.err != nil {
+			return "", f.err
+		}
+		return "", fmt.Errorf("cannot read %s", namespace)
+	}
+	return f.staticKubeDS.GetFluentdConfig(ctx, namespace)
+}
+
+func TestFetchNamespacesConcurrently(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	kubeds := staticKubeDS{}
+	nses := []string{}
+	for i := 0; i < 50; i++ {
+		ns := fmt.Sprintf("ns-%02d", i)
+		nses = append(nses, ns)
+		kubeds[ns] = "<match **>\n  @type null\n</match>"
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}))
+	}
+
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{FetchConcurrency: 4},
+		kubeds:      kubeds,
+		nslist:      listerv1.NewNamespaceLister(indexer),
+		podlist:     &countingPodLister{},
+	}
+
+	nsconfigs, err := d.fetchNamespaces(context.Background(), nses)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, nsconfig := range nsconfigs {
+		names = append(names, nsconfig.Name)
+	}
+	assert.Equal(t, nses, names)
+
+	// a namespace that cannot be read fails alone
+	d.kubeds = failingKubeDS{staticKubeDS: kubeds, failing: "ns-17"}
+	nsconfigs, err = d.fetchNamespaces(context.Background(), nses)
+	assert.Nil(t, err)
+	assert.Len(t, nsconfigs, 50)
+	assert.EqualError(t, nsconfigs[17].FetchError, "cannot read ns-17")
+	assert.Equal(t, ErrorPhaseFetch, ErrorPhase(nsconfigs[17].FetchError))
+	assert.Nil(t, nsconfigs[16].FetchError)
+
+	// an unreachable API fails the run
+	d.kubeds = failingKubeDS{staticKubeDS: kubeds, failing: "ns-17", err: errors.NewServiceUnavailable("overloaded")}
+	_, err = d.fetchNamespaces(context.Background(), nses)
+	assert.True(t, errors.IsServiceUnavailable(err))
+}
+
+func TestFetchRetryBackoff(t *testing.T) {
+	defer func(initial, max time.Duration) {
+		fetchRetryInitialDelay, fetchRetryMaxDelay = initial, max
+	}(fetchRetryInitialDelay, fetchRetryMaxDelay)
+	fetchRetryInitialDelay, fetchRetryMaxDelay = 10*time.Millisecond, 40*time.Millisecond
+
+	assert.Equal(t, 10*time.Millisecond, fetchRetryDelay(1))
+	assert.Equal(t, 20*time.Millisecond, fetchRetryDelay(2))
+	assert.Equal(t, 40*time.Millisecond, fetchRetryDelay(3))
+	assert.Equal(t, 40*time.Millisecond, fetchRetryDelay(10))
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}))
+	updateChan := make(chan time.Time, 1)
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{},
+		kubeds:      failingKubeDS{failing: "team-a"},
+		nslist:      listerv1.NewNamespaceLister(indexer),
+		updateChan:  updateChan,
+	}
+
+	nsconfig, err := d.fetchNamespace(context.Background(), "team-a")
+	assert.Nil(t, err)
+	assert.NotNil(t, nsconfig.FetchError)
+	assert.Equal(t, 1, d.fetchFailures["team-a"])
+
+	// a run is scheduled to read it again
+	select {
+	case <-updateChan:
+	case <-time.After(time.Second):
+		t.Fatal("no run scheduled after the failure")
+	}
+
+	d.kubeds = staticKubeDS{"team-a": "<match **>\n  @type null\n</match>"}
+	nsconfig, err = d.fetchNamespace(context.Background(), "team-a")
+	assert.Nil(t, err)
+	assert.Nil(t, nsconfig.FetchError)
+	assert.NotContains(t, d.fetchFailures, "team-a")
+}
+
+func TestGetNamespacesPrependsGlobalConfig(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range []string{"kube-system", "team-a", "team-b"} {
+		assert.Nil(t, indexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}))
+	}
+	cms := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	global := "<filter **>\n  @type record_transformer\n</filter>"
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{AdminNamespace: "kube-system", GlobalConfig: "logging/global"},
+		kubeds: staticKubeDS{
+			"kube-system": "<match systemd.**>\n  @type null\n</match>",
+			"team-a":      "<match **>\n  @type null\n</match>",
+		},
+		nslist:  listerv1.NewNamespaceLister(indexer),
+		podlist: &countingPodLister{},
+		global:  &globalConfig{namespace: "logging", name: "global", lister: listerv1.NewConfigMapLister(cms)},
+	}
+	configs := func() map[string]*NamespaceConfig {
+		nses, err := d.GetNamespaces(context.Background())
+		assert.Nil(t, err)
+		res := map[string]*NamespaceConfig{}
+		for _, ns := range nses {
+			res[ns.Name] = ns
+		}
+		return res
+	}
+
+	// no ConfigMap yet
+	assert.Equal(t, "<match **>\n  @type null\n</match>", configs()["team-a"].FluentdConfig)
+
+	assert.Nil(t, cms.Add(&core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "global", Namespace: "logging"},
+		Data:       map[string]string{"fluent.conf": global},
+	}))
+	nses := configs()
+	assert.Equal(t, global+"\n\n<match **>\n  @type null\n</match>", nses["team-a"].FluentdConfig)
+	assert.False(t, nses["team-a"].Unchanged)
+	assert.Equal(t, "", nses["team-b"].FluentdConfig)
+	assert.Equal(t, "<match systemd.**>\n  @type null\n</match>", nses["kube-system"].FluentdConfig)
+}
+
+func TestGlobalConfigName(t *testing.T) {
+	ns, name := globalConfigName(&config.Config{AdminNamespace: "kube-system", GlobalConfig: "logging/global"})
+	assert.Equal(t, "logging", ns)
+	assert.Equal(t, "global", name)
+
+	ns, name = globalConfigName(&config.Config{AdminNamespace: "kube-system", GlobalConfig: "global"})
+	assert.Equal(t, "kube-system", ns)
+	assert.Equal(t, "global", name)
+}
+
+func TestConfigClusterConfig(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: logs
+  cluster:
+    server: https://logs.example.com
+- name: management
+  cluster:
+    server: https://management.example.com
+contexts:
+- name: logs
+  context:
+    cluster: logs
+- name: management
+  context:
+    cluster: management
+current-context: logs
+`
+	f, err := ioutil.TempFile("", "kubeconfig")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(kubeconfig)
+	assert.Nil(t, err)
+	f.Close()
+
+	// the current context without --config-context
+	kubeCfg, err := configClusterConfig(&config.Config{ConfigKubeConfig: f.Name()})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://logs.example.com", kubeCfg.Host)
+
+	kubeCfg, err = configClusterConfig(&config.Config{ConfigKubeConfig: f.Name(), ConfigKubeContext: "management"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://management.example.com", kubeCfg.Host)
+
+	_, err = configClusterConfig(&config.Config{ConfigKubeConfig: f.Name(), ConfigKubeContext: "staging"})
+	assert.NotNil(t, err)
+}
+
+func TestResyncPeriodically(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updateChan := make(chan time.Time, 1)
+	go resyncPeriodically(ctx, 20*time.Millisecond, updateChan)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-updateChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no run triggered by the resync")
+		}
+	}
+}
+
+func newTestInformerConnection(t *testing.T, args []string, objects ...runtime.Object) (*kubeInformerConnection, error) {
+	d, _, err := newTestInformerConnectionWithClient(t, args, objects...)
+	return d, err
+}
+
+// newTestInformerConnectionWithClient also returns the fake clientset, whose actions tell what the
+// informers list and watch
+func newTestInformerConnectionWithClient(t *testing.T, args []string, objects ...runtime.Object) (*kubeInformerConnection, *fake.Clientset, error) {
+	cfg := &config.Config{}
+	assert.Nil(t, cfg.ParseFlags(args))
+	assert.Nil(t, cfg.Validate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	client := fake.NewSimpleClientset(objects...)
+	d, err := newKubeInformerConnection(ctx, cfg, client, client, nil, make(chan time.Time, 1))
+	return d, client, err
+}
+
+func TestInformerConnectionWithPodSelectors(t *testing.T) {
+	web := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a", Labels: map[string]string{"app": "web"}}}
+	batch := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "team-a", Labels: map[string]string{"app": "batch"}}}
+
+	for _, args := range [][]string{
+		{"--pod-label-selector=app=web"},
+		{"--pod-field-selector=spec.nodeName=node-1"},
+	} {
+		// the pods informer of its own factory must be started for the caches to sync
+		d, err := newTestInformerConnection(t, args, &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}, web, batch)
+		assert.Nil(t, err, "%v", args)
+		assert.NotNil(t, d.podlist, "%v", args)
+	}
+
+	d, err := newTestInformerConnection(t, []string{"--pod-label-selector=app=web"}, &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}, web, batch)
+	assert.Nil(t, err)
+	pods, err := d.podlist.Pods("team-a").List(labels.Everything())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pods))
+	assert.Equal(t, "web", pods[0].Name)
+}
+
+func TestFetchNamespaceListsPlainContainers(t *testing.T) {
+	volumes := []core.Volume{{Name: "logs", VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}}}
+	nginx := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "team-a"},
+		Spec: core.PodSpec{
+			Volumes:    volumes,
+			Containers: []core.Container{{Name: "main", VolumeMounts: []core.VolumeMount{{Name: "logs", MountPath: "/var/log"}}}},
+		},
+	}
+	// logs to stdout only
+	api := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "team-a"},
+		Spec:       core.PodSpec{Containers: []core.Container{{Name: "server"}}},
+	}
+	objects := []runtime.Object{&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}, nginx, api}
+
+	d, err := newTestInformerConnection(t, []string{"--warn-unrouted-tags"}, objects...)
+	assert.Nil(t, err)
+	d.kubeds = staticKubeDS{"team-a": "<match **>\n  @type null\n</match>"}
+	nsconfig, err := d.fetchNamespace(context.Background(), "team-a")
+	assert.Nil(t, err)
+	assert.Len(t, nsconfig.MiniContainers, 1)
+	assert.ElementsMatch(t, []ContainerRef{{PodName: "nginx", Name: "main"}, {PodName: "api", Name: "server"}}, nsconfig.Containers)
+
+	// without the routing checks they are not listed
+	d, err = newTestInformerConnection(t, nil, objects...)
+	assert.Nil(t, err)
+	d.kubeds = staticKubeDS{"team-a": "<match **>\n  @type null\n</match>"}
+	nsconfig, err = d.fetchNamespace(context.Background(), "team-a")
+	assert.Nil(t, err)
+	assert.Nil(t, nsconfig.Containers)
+}
+
+// applyRecorder records the options of the patches of the configmaps
+type applyRecorder struct {
+	kubernetes.Interface
+	opts []metav1.PatchOptions
+}
+
+func (r *applyRecorder) CoreV1() corev1client.CoreV1Interface {
+	return recordingCoreV1{r.Interface.CoreV1(), r}
+}
+
+type recordingCoreV1 struct {
+	corev1client.CoreV1Interface
+	r *applyRecorder
+}
+
+func (c recordingCoreV1) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return recordingConfigMaps{c.CoreV1Interface.ConfigMaps(namespace), c.r}
+}
+
+type recordingConfigMaps struct {
+	corev1client.ConfigMapInterface
+	r *applyRecorder
+}
+
+func (c recordingConfigMaps) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*core.ConfigMap, error) {
+	c.r.opts = append(c.r.opts, opts)
+	return c.ConfigMapInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func TestWriteStatusSummary(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	// the fake clientset knows no server-side apply, the applied configmap replaces the stored one
+	// like an apply by the only field manager does
+	gvr := core.SchemeGroupVersion.WithResource("configmaps")
+	patchTypes := []types.PatchType{}
+	client.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		patchTypes = append(patchTypes, patch.GetPatchType())
+
+		cm := &core.ConfigMap{}
+		if err := json.Unmarshal(patch.GetPatch(), cm); err != nil {
+			return true, nil, err
+		}
+		if _, err := client.Tracker().Get(gvr, cm.Namespace, cm.Name); errors.IsNotFound(err) {
+			return true, cm, client.Tracker().Create(gvr, cm, cm.Namespace)
+		}
+		return true, cm, client.Tracker().Update(gvr, cm, cm.Namespace)
+	})
+
+	recorder := &applyRecorder{Interface: client}
+	d := &kubeInformerConnection{
+		client: recorder,
+		cfg:    &config.Config{StatusSummaryConfigMap: "logging-status", AdminNamespace: "kube-system", ID: "default"},
+	}
+
+	ctx := context.Background()
+	assert.Nil(t, d.WriteStatusSummary(ctx, map[string]*NamespaceStatus{
+		"team-a": {Status: StatusOK, Hash: "abc"},
+		"team-b": {Status: StatusError, Phase: ErrorPhaseValidation, Message: "bad config", Hash: "def"},
+	}))
+
+	assert.Equal(t, []types.PatchType{types.ApplyPatchType}, patchTypes)
+	assert.Len(t, recorder.opts, 1)
+	assert.Equal(t, statusSummaryFieldManager, recorder.opts[0].FieldManager)
+	assert.NotNil(t, recorder.opts[0].Force)
+	assert.True(t, *recorder.opts[0].Force)
+
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(ctx, "logging-status", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"team-a": `{"status":"ok","hash":"abc"}`,
+		"team-b": `{"status":"error","phase":"ValidationError","message":"bad config","hash":"def"}`,
+	}, cm.Data)
+
+	// the applied data is the whole summary, the entries of removed namespaces are pruned
+	assert.Nil(t, d.WriteStatusSummary(ctx, map[string]*NamespaceStatus{
+		"team-a": {Status: StatusOK, Hash: "abc"},
+	}))
+	cm, err = client.CoreV1().ConfigMaps("kube-system").Get(ctx, "logging-status", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"team-a": `{"status":"ok","hash":"abc"}`}, cm.Data)
+
+	// without a configmap name nothing is written
+	d.cfg.StatusSummaryConfigMap = ""
+	assert.Nil(t, d.WriteStatusSummary(ctx, map[string]*NamespaceStatus{}))
+	assert.Len(t, recorder.opts, 2)
+}
+
+func TestInformerConnectionWithDisabledPods(t *testing.T) {
+	nginx := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "team-a", Labels: map[string]string{"app": "nginx"}},
+		Spec: core.PodSpec{
+			Volumes:    []core.Volume{{Name: "logs", VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}}},
+			Containers: []core.Container{{Name: "main", VolumeMounts: []core.VolumeMount{{Name: "logs", MountPath: "/var/log"}}}},
+		},
+	}
+
+	d, client, err := newTestInformerConnectionWithClient(t, []string{"--disable-pods", "--warn-unrouted-tags"},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}, nginx)
+	assert.Nil(t, err)
+	assert.Nil(t, d.podlist)
+	assert.Nil(t, d.podIndex)
+
+	// the pod informer is neither started nor waited for
+	for _, action := range client.Actions() {
+		assert.NotEqual(t, "pods", action.GetResource().Resource, "%s %s", action.GetVerb(), action.GetResource())
+	}
+
+	// even a config using the pods gets none
+	d.kubeds = staticKubeDS{"team-a": "<match $labels(app=nginx)>\n  @type null\n</match>"}
+	nsconfig, err := d.fetchNamespace(context.Background(), "team-a")
+	assert.Nil(t, err)
+	assert.Empty(t, nsconfig.MiniContainers)
+	assert.Empty(t, nsconfig.Containers)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
 
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,16 +40,16 @@ type ConfigMapDS struct {
 	updateChan chan time.Time
 }
 
-func NewConfigMapDS(ctx context.Context, cfg *config.Config, factory informers.SharedInformerFactory, updateChan chan time.Time) (*ConfigMapDS, error) {
+// NewConfigMapDS reads the configmaps of the namespaces listed by nslist using the informers of factory
+func NewConfigMapDS(ctx context.Context, cfg *config.Config, factory informers.SharedInformerFactory, nslist listerv1.NamespaceLister, updateChan chan time.Time) (*ConfigMapDS, error) {
 	configMapLister := factory.Core().V1().ConfigMaps().Lister()
-	namespaceLister := factory.Core().V1().Namespaces().Lister()
 
 	cmDS := &ConfigMapDS{
 		ctx:        &ctx,
 		cfg:        cfg,
 		cfglist:    configMapLister,
 		cfgready:   factory.Core().V1().ConfigMaps().Informer().HasSynced,
-		nslist:     namespaceLister,
+		nslist:     nslist,
 		updateChan: updateChan,
 	}
 
@@ -57,7 +58,7 @@ func NewConfigMapDS(ctx context.Context, cfg *config.Config, factory informers.S
 			cmDS.handleCMChange(ctx, new)
 		},
 		UpdateFunc: func(old, new interface{}) {
-			cmDS.handleCMChange(ctx, new)
+			cmDS.handleCMUpdate(ctx, old, new)
 		},
 		DeleteFunc: func(new interface{}) {
 			cmDS.handleCMChange(ctx, new)
@@ -81,7 +82,15 @@ func (c *ConfigMapDS) GetFluentdConfig(ctx context.Context, namespace string) (s
 	if err != nil {
 		return "", err
 	}
-	return c.readConfig(configmaps), nil
+	if len(configmaps) == 0 {
+		return "", nil
+	}
+
+	key, explicit, err := configKey(c.cfg, c.nslist, namespace)
+	if err != nil {
+		return "", err
+	}
+	return c.readConfig(configmaps, key, explicit)
 }
 
 func (c *ConfigMapDS) fetchConfigMaps(ctx context.Context, ns string) ([]*core.ConfigMap, error) {
@@ -90,13 +99,17 @@ func (c *ConfigMapDS) fetchConfigMaps(ctx context.Context, ns string) ([]*core.C
 
 	if c.cfg.Datasource == "multimap" {
 		// Get all configmaps which match a specified label, but only if we have a selector
-		mapslist, err := nsmaps.List(c.cfg.ParsedLabelSelector.AsSelector())
+		mapslist, err := nsmaps.List(c.cfg.Current().ParsedLabelSelector.AsSelector())
 		if err != nil {
 			return nil, fmt.Errorf("Failed to list configmaps in namespace '%s': %v", ns, err)
 		}
 		confMapByName := make(map[string]*core.ConfigMap)
 		sortedConfMaps := make([]string, 0, len(mapslist))
 		for _, cfgm := range mapslist {
+			if util.IsManaged(cfgm.Labels) {
+				logrus.Debugf("Ignoring configmap %s/%s, it is written by the operator", ns, cfgm.Name)
+				continue
+			}
 			confMapByName[cfgm.Name] = cfgm
 			sortedConfMaps = append(sortedConfMaps, cfgm.Name)
 		}
@@ -120,7 +133,9 @@ func (c *ConfigMapDS) fetchConfigMaps(ctx context.Context, ns string) ([]*core.C
 		if err != nil {
 			logrus.Debugf("Failed to retrieve configmap '%s' from namespace '%s': %v", mapName, ns, err)
 		}
-		if singlemap != nil {
+		if singlemap != nil && util.IsManaged(singlemap.Labels) {
+			logrus.Warnf("Ignoring configmap %s/%s, it is written by the operator", ns, singlemap.Name)
+		} else if singlemap != nil {
 			configmaps = append(configmaps, singlemap)
 		}
 	}
@@ -128,19 +143,40 @@ func (c *ConfigMapDS) fetchConfigMaps(ctx context.Context, ns string) ([]*core.C
 	return configmaps, nil
 }
 
-// readConfig accepts a list of configmaps in a particular namespace, and concatenates their data together
-func (c *ConfigMapDS) readConfig(configmaps []*core.ConfigMap) string {
+// readConfig accepts a list of configmaps in a particular namespace, and concatenates the data of
+// their key together. A key named by the namespace annotation must exist in every configmap
+func (c *ConfigMapDS) readConfig(configmaps []*core.ConfigMap, key string, explicit bool) (string, error) {
 	configdata := make([]string, 0)
 	for _, cm := range configmaps {
-		mapData, exists := cm.Data[entryName]
+		mapData, exists := cm.Data[key]
 		if exists {
 			configdata = append(configdata, mapData)
 			logrus.Debugf("Loaded config data from config map: %s/%s", cm.ObjectMeta.Namespace, cm.ObjectMeta.Name)
+		} else if explicit {
+			return "", fmt.Errorf("cannot find key '%s' set by the %s annotation in configmap %s/%s", key, c.cfg.AnnotConfigKey, cm.ObjectMeta.Namespace, cm.ObjectMeta.Name)
 		} else {
-			logrus.Warnf("cannot find entry %s in configmap %s/%s", entryName, cm.ObjectMeta.Namespace, cm.ObjectMeta.Name)
+			logrus.Warnf("cannot find entry %s in configmap %s/%s", key, cm.ObjectMeta.Namespace, cm.ObjectMeta.Name)
 		}
 	}
-	return strings.Join(configdata, "\n")
+	return strings.Join(configdata, "\n"), nil
+}
+
+// configKey returns the data key holding the config of a namespace: the one named by its
+// --config-key-annotation, else fluent.conf. The key is explicit when it comes from the annotation
+func configKey(cfg *config.Config, nslist listerv1.NamespaceLister, ns string) (string, bool, error) {
+	if cfg.AnnotConfigKey == "" {
+		return entryName, false, nil
+	}
+
+	namespace, err := nslist.Get(ns)
+	if err != nil {
+		return "", false, fmt.Errorf("Could not get the details of namespace '%s': %v", ns, err)
+	}
+
+	if key := namespace.Annotations[cfg.AnnotConfigKey]; key != "" {
+		return key, true, nil
+	}
+	return entryName, false, nil
 }
 
 // detectConfigMapName calculates the expected name of a configmap containing fluentd
@@ -169,7 +205,16 @@ func (c *ConfigMapDS) detectConfigMapName(ctx context.Context, ns string) (strin
 	return configMapName, nil
 }
 
+// handleCMUpdate also looks at the old version: a configmap losing its label or being renamed away
+// from the annotated name stops contributing to the config, which is a change too
+func (c *ConfigMapDS) handleCMUpdate(ctx context.Context, old, new interface{}) {
+	c.handleCMChange(ctx, old)
+	c.handleCMChange(ctx, new)
+}
+
 func (c *ConfigMapDS) handleCMChange(ctx context.Context, obj interface{}) {
+	cfg := c.cfg.Current()
+
 	var object metav1.Object
 	var ok bool
 	if object, ok = obj.(metav1.Object); !ok {
@@ -185,9 +230,14 @@ func (c *ConfigMapDS) handleCMChange(ctx context.Context, obj interface{}) {
 		}
 	}
 
-	if len(c.cfg.Namespaces) != 0 {
+	// our own writes must not trigger another run
+	if util.IsManaged(object.GetLabels()) {
+		return
+	}
+
+	if len(cfg.Namespaces) != 0 {
 		toProcess := false
-		for _, ns := range c.cfg.Namespaces {
+		for _, ns := range cfg.Namespaces {
 			if object.GetNamespace() == ns {
 				toProcess = true
 				break
@@ -198,9 +248,9 @@ func (c *ConfigMapDS) handleCMChange(ctx context.Context, obj interface{}) {
 		}
 	}
 
-	if c.cfg.Datasource == "multimap" {
+	if cfg.Datasource == "multimap" {
 		cmLabels := object.GetLabels()
-		if len(cmLabels) == 0 || !areLabelsInAllowList(c.cfg.ParsedLabelSelector, labels.Set(cmLabels)) {
+		if len(cmLabels) == 0 || !areLabelsInAllowList(cfg.ParsedLabelSelector, labels.Set(cmLabels)) {
 			return
 		}
 	} else {
@@ -210,12 +260,7 @@ func (c *ConfigMapDS) handleCMChange(ctx context.Context, obj interface{}) {
 		}
 	}
 
-	select {
-	case c.updateChan <- time.Now():
-	default:
-		// There is already one pending notification. Useless to send another one since, when
-		// the pending one will be processed all new changes will be reloaded.
-	}
+	util.NotifyUpdate(c.updateChan)
 }
 
 // areLabelsInAllowList verifies if the provided label list
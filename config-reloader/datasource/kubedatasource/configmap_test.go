@@ -0,0 +1,149 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestConfigMapDSIgnoresManagedConfigMaps(t *testing.T) {
+	selector := map[string]string{util.InstanceLabel: "default"}
+
+	// a status summary as written by the operator, it happens to match the selector
+	summaryLabels := util.ManagedLabels("default")
+	summary := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "fluentd-status-summary", Namespace: "kube-system", Labels: summaryLabels},
+		Data:       map[string]string{entryName: "<match **>\n  @type null\n</match>"},
+	}
+	tenant := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "fluentd-config", Namespace: "kube-system", Labels: selector},
+		Data:       map[string]string{entryName: "<match **>\n  @type stdout\n</match>"},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.Nil(t, indexer.Add(summary))
+	assert.Nil(t, indexer.Add(tenant))
+
+	updateChan := make(chan time.Time, 1)
+	ds := &ConfigMapDS{
+		cfg: &config.Config{
+			Datasource:          "multimap",
+			ParsedLabelSelector: labels.Set(selector),
+		},
+		cfglist:    listerv1.NewConfigMapLister(indexer),
+		updateChan: updateChan,
+	}
+
+	conf, err := ds.GetFluentdConfig(context.Background(), "kube-system")
+	assert.Nil(t, err)
+	assert.Equal(t, tenant.Data[entryName], conf)
+
+	// writing the summary does not trigger another run
+	ds.handleCMChange(context.Background(), summary)
+	assert.Equal(t, 0, len(updateChan))
+
+	ds.handleCMChange(context.Background(), tenant)
+	assert.Equal(t, 1, len(updateChan))
+}
+
+func TestConfigMapDSMultimapUpdates(t *testing.T) {
+	selector := map[string]string{"fluentd-config": "true"}
+	updateChan := make(chan time.Time, 1)
+	ds := &ConfigMapDS{
+		cfg: &config.Config{
+			Datasource:          "multimap",
+			ParsedLabelSelector: labels.Set(selector),
+		},
+		updateChan: updateChan,
+	}
+
+	labeled := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-a", Namespace: "team", Labels: selector}}
+	unlabeled := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-a", Namespace: "team"}}
+
+	ds.handleCMUpdate(context.Background(), unlabeled, unlabeled)
+	assert.Equal(t, 0, len(updateChan))
+
+	// dropping the label removes the configmap from the namespace config
+	ds.handleCMUpdate(context.Background(), labeled, unlabeled)
+	assert.Equal(t, 1, len(updateChan))
+}
+
+func TestConfigMapDSMultimapOrder(t *testing.T) {
+	selector := map[string]string{"fluentd-config": "true"}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, cm := range []*core.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "b-app", Namespace: "team", Labels: selector}, Data: map[string]string{entryName: "b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "a-app", Namespace: "team", Labels: selector}, Data: map[string]string{entryName: "a", "other.conf": "ignored"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c-app", Namespace: "team", Labels: selector}, Data: map[string]string{"other.conf": "ignored"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "0-unlabeled", Namespace: "team"}, Data: map[string]string{entryName: "ignored"}},
+	} {
+		assert.Nil(t, indexer.Add(cm))
+	}
+
+	ds := &ConfigMapDS{
+		cfg: &config.Config{
+			Datasource:          "multimap",
+			ParsedLabelSelector: labels.Set(selector),
+		},
+		cfglist: listerv1.NewConfigMapLister(indexer),
+	}
+
+	conf, err := ds.GetFluentdConfig(context.Background(), "team")
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb", conf)
+}
+
+func TestConfigMapDSConfigKeyAnnotation(t *testing.T) {
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, key := range map[string]string{"default-key": "", "custom-key": "my-fluent.conf", "missing-key": "other.conf"} {
+		ns := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if key != "" {
+			ns.Annotations = map[string]string{"logging.csp.vmware.com/fluentd-config-key": key}
+		}
+		assert.Nil(t, nsIndexer.Add(ns))
+	}
+
+	config1 := "<match **>\n  @type null\n</match>"
+	config2 := "<match **>\n  @type stdout\n</match>"
+	cmIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, ns := range []string{"default-key", "custom-key", "missing-key"} {
+		assert.Nil(t, cmIndexer.Add(&core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "fluentd-config", Namespace: ns},
+			Data:       map[string]string{entryName: config1, "my-fluent.conf": config2},
+		}))
+	}
+
+	ds := &ConfigMapDS{
+		cfg: &config.Config{
+			AnnotConfigmapName:   "logging.csp.vmware.com/fluentd-configmap",
+			AnnotConfigKey:       "logging.csp.vmware.com/fluentd-config-key",
+			DefaultConfigmapName: "fluentd-config",
+		},
+		cfglist: listerv1.NewConfigMapLister(cmIndexer),
+		nslist:  listerv1.NewNamespaceLister(nsIndexer),
+	}
+
+	ctx := context.Background()
+	conf, err := ds.GetFluentdConfig(ctx, "default-key")
+	assert.Nil(t, err)
+	assert.Equal(t, config1, conf)
+
+	conf, err = ds.GetFluentdConfig(ctx, "custom-key")
+	assert.Nil(t, err)
+	assert.Equal(t, config2, conf)
+
+	_, err = ds.GetFluentdConfig(ctx, "missing-key")
+	assert.EqualError(t, err, "cannot find key 'other.conf' set by the logging.csp.vmware.com/fluentd-config-key annotation in configmap missing-key/fluentd-config")
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+	"gopkg.in/fsnotify.v1"
+)
+
+// FileDS reads the fluentd config of a namespace from the file {namespace}.conf of a mounted
+// directory, e.g. a hostPath or a ConfigMap volume. The namespaces and pods still come from the
+// informers and the status is still written to the namespaces
+type FileDS struct {
+	dir        string
+	updateChan chan time.Time
+}
+
+// NewFileDS checks the directory and watches it until ctx is done, every change triggers a run
+func NewFileDS(ctx context.Context, cfg *config.Config, updateChan chan time.Time) (*FileDS, error) {
+	info, err := os.Stat(cfg.FileDatasourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the namespace configs: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cannot read the namespace configs: %s is not a directory", cfg.FileDatasourceDir)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// a mounted ConfigMap swaps a symlink in the directory itself, so watching it is enough
+	if err := watcher.Add(cfg.FileDatasourceDir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("cannot watch %s: %v", cfg.FileDatasourceDir, err)
+	}
+
+	f := &FileDS{
+		dir:        cfg.FileDatasourceDir,
+		updateChan: updateChan,
+	}
+	go f.watch(ctx, watcher)
+
+	logrus.Infof("Reading the namespace configs from the files {namespace}.conf of %s", f.dir)
+	return f, nil
+}
+
+// IsReady returns a boolean specifying whether the FileDS is ready, the files are read on demand
+func (f *FileDS) IsReady() bool {
+	return true
+}
+
+// GetFluentdConfig returns the content of the file of the given ns, empty if there is none
+func (f *FileDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(f.dir, namespace+".conf"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (f *FileDS) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			logrus.Warnf("Error watching the namespace configs in %s: %v", f.dir, err)
+		case event := <-watcher.Events:
+			logrus.Debugf("Namespace configs changed: %s", event)
+			util.NotifyUpdate(f.updateChan)
+		}
+	}
+}
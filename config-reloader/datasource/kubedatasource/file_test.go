@@ -0,0 +1,58 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+)
+
+func TestFileDS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-ds")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config1 := "<match **>\n  @type null\n</match>"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "team-a.conf"), []byte(config1), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updateChan := make(chan time.Time, 1)
+	f, err := NewFileDS(ctx, &config.Config{FileDatasourceDir: dir}, updateChan)
+	assert.Nil(t, err)
+	assert.True(t, f.IsReady())
+
+	fluentdConfig, err := f.GetFluentdConfig(ctx, "team-a")
+	assert.Nil(t, err)
+	assert.Equal(t, config1, fluentdConfig)
+
+	fluentdConfig, err = f.GetFluentdConfig(ctx, "team-b")
+	assert.Nil(t, err)
+	assert.Equal(t, "", fluentdConfig)
+
+	// a new file triggers a run
+	config2 := "<match kube.team-b.**>\n  @type null\n</match>"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "team-b.conf"), []byte(config2), 0644))
+	select {
+	case <-updateChan:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the new file did not trigger a run")
+	}
+	fluentdConfig, err = f.GetFluentdConfig(ctx, "team-b")
+	assert.Nil(t, err)
+	assert.Equal(t, config2, fluentdConfig)
+
+	_, err = NewFileDS(ctx, &config.Config{FileDatasourceDir: filepath.Join(dir, "missing")}, updateChan)
+	assert.NotNil(t, err)
+	_, err = NewFileDS(ctx, &config.Config{FileDatasourceDir: filepath.Join(dir, "team-a.conf")}, updateChan)
+	assert.NotNil(t, err)
+}
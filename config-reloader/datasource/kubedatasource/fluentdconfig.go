@@ -2,6 +2,7 @@ package kubedatasource
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -11,18 +12,25 @@ import (
 	kfo "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/apis/logs.vdp.vmware.com/v1beta1"
 	kfoClient "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/client/clientset/versioned"
 	kfoInformers "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/client/informers/externalversions"
-	kfoListersV1beta1 "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/client/listers/logs.vdp.vmware.com/v1beta1"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/crd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
+// fetchRetryInitialWait is the wait before the first retry, doubled on every further retry
+var fetchRetryInitialWait = 200 * time.Millisecond
+
+// targetNamespaceLabel names the namespace a FluentdConfig of the central namespace applies to
+// when its spec.namespace is empty
+const targetNamespaceLabel = "logging.csp.vmware.com/target-namespace"
+
 type FluentdConfigDS struct {
 	cfg        *config.Config
-	fdlist     kfoListersV1beta1.FluentdConfigLister
+	fdclient   kfoClient.Interface
 	fdready    func() bool
 	updateChan chan time.Time
 }
@@ -33,12 +41,24 @@ func NewFluentdConfigDS(ctx context.Context, cfg *config.Config, kubeCfg *rest.C
 		return nil, err
 	}
 
-	factory := kfoInformers.NewSharedInformerFactory(kfocli, 0)
-	fluentdConfigLister := factory.Logs().V1beta1().FluentdConfigs().Lister()
+	// the generated client takes no context, the timeout of its HTTP requests ends a call given up on
+	fetchCfg := rest.CopyConfig(kubeCfg)
+	fetchCfg.Timeout = time.Duration(cfg.CRDFetchTimeoutSeconds) * time.Second
+	fetchcli, err := kfoClient.NewForConfig(fetchCfg)
+	if err != nil {
+		return nil, err
+	}
 
+	options := []kfoInformers.SharedInformerOption{}
+	if cfg.CentralNamespace != "" {
+		options = append(options, kfoInformers.WithNamespace(cfg.CentralNamespace))
+	} else if cfg.SingleNamespace != "" {
+		options = append(options, kfoInformers.WithNamespace(cfg.SingleNamespace))
+	}
+	factory := kfoInformers.NewSharedInformerFactoryWithOptions(kfocli, cfg.ResyncPeriod, options...)
 	fdDS := &FluentdConfigDS{
 		cfg:        cfg,
-		fdlist:     fluentdConfigLister,
+		fdclient:   fetchcli,
 		fdready:    factory.Logs().V1beta1().FluentdConfigs().Informer().HasSynced,
 		updateChan: updateChan,
 	}
@@ -51,12 +71,15 @@ func NewFluentdConfigDS(ctx context.Context, cfg *config.Config, kubeCfg *rest.C
 		DeleteFunc: fdDS.handleFDChange,
 	})
 
-	// Verify CRD availability
-	if err := crd.CheckAndInstallCRD(ctx, kubeCfg); err != nil {
+	// Verify CRD availability. Installing it needs cluster-wide permissions, in a single namespace
+	// the cluster admin installs it
+	if cfg.SingleNamespace != "" {
+		logrus.Infof("Not installing the FluentdConfig CRD when processing only namespace %s", cfg.SingleNamespace)
+	} else if err := crd.CheckAndInstallCRD(ctx, kubeCfg); err != nil {
 		return nil, err
 	}
 
-	factory.Start(nil)
+	factory.Start(ctx.Done())
 
 	return fdDS, nil
 }
@@ -70,7 +93,7 @@ func (f *FluentdConfigDS) IsReady() bool {
 // by the configured FluentdConfigs k8s resources
 func (f *FluentdConfigDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
 	// Grab all FluentdConfigs k8s resources in the given ns
-	fluentdConfigs, err := f.fdlist.FluentdConfigs(namespace).List(labels.Everything())
+	fluentdConfigs, err := f.fluentdConfigsOf(ctx, namespace)
 	if err != nil {
 		return "", err
 	}
@@ -95,15 +118,117 @@ func (f *FluentdConfigDS) GetFluentdConfig(ctx context.Context, namespace string
 	return strings.Join(configData, "\n"), nil
 }
 
+// fluentdConfigsOf returns the FluentdConfigs applying to a namespace. With a central namespace
+// they are the ones of the central namespace targeting it, untargeted ones apply to the central
+// namespace itself
+func (f *FluentdConfigDS) fluentdConfigsOf(ctx context.Context, namespace string) ([]*kfo.FluentdConfig, error) {
+	if f.cfg.CentralNamespace == "" {
+		return f.listFluentdConfigs(ctx, namespace)
+	}
+
+	fluentdConfigs, err := f.listFluentdConfigs(ctx, f.cfg.CentralNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	targeting := []*kfo.FluentdConfig{}
+	for _, fc := range fluentdConfigs {
+		if targetNamespace(fc) == namespace {
+			targeting = append(targeting, fc)
+		}
+	}
+	return targeting, nil
+}
+
+// targetNamespace returns the namespace a FluentdConfig of the central namespace applies to
+func targetNamespace(fc *kfo.FluentdConfig) string {
+	if fc.Spec.Namespace != "" {
+		return fc.Spec.Namespace
+	}
+	if target := fc.Labels[targetNamespaceLabel]; target != "" {
+		return target
+	}
+	return fc.Namespace
+}
+
+// listFluentdConfigs lists the FluentdConfigs of a namespace, retrying with an exponential
+// backoff on failure. Every attempt is bounded by the configured fetch timeout
+func (f *FluentdConfigDS) listFluentdConfigs(ctx context.Context, namespace string) ([]*kfo.FluentdConfig, error) {
+	var fluentdConfigs []*kfo.FluentdConfig
+	var lastErr error
+
+	backoff := wait.Backoff{
+		Duration: fetchRetryInitialWait,
+		Factor:   2,
+		Steps:    f.cfg.CRDFetchRetries + 1,
+	}
+
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func() (bool, error) {
+		fluentdConfigs, lastErr = f.listWithTimeout(ctx, namespace)
+		if lastErr != nil {
+			logrus.Debugf("Failed to list fluentdconfigs in namespace '%s': %v", namespace, lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return nil, fmt.Errorf("Failed to list fluentdconfigs in namespace '%s' after %d attempts: %v", namespace, backoff.Steps, lastErr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fluentdConfigs, nil
+}
+
+// listWithTimeout lists the FluentdConfigs of a namespace from the API server: the informer cache
+// cannot fail, an API server that does not answer must. The goroutine of a call that timed out
+// ends with the timeout of its HTTP request
+func (f *FluentdConfigDS) listWithTimeout(ctx context.Context, namespace string) ([]*kfo.FluentdConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(f.cfg.CRDFetchTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	type result struct {
+		fluentdConfigs []*kfo.FluentdConfig
+		err            error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		list, err := f.fdclient.LogsV1beta1().FluentdConfigs(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		fluentdConfigs := make([]*kfo.FluentdConfig, 0, len(list.Items))
+		for i := range list.Items {
+			fluentdConfigs = append(fluentdConfigs, &list.Items[i])
+		}
+		done <- result{fluentdConfigs, nil}
+	}()
+
+	select {
+	case res := <-done:
+		return res.fluentdConfigs, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // handleFDChange reacts to changes in the FluentdConfigs k8s resources and notifies the
 // main controller to re-run the main loop and sync the state
 func (f *FluentdConfigDS) handleFDChange(obj interface{}) {
+	cfg := f.cfg.Current()
+
 	// If the controller is monitoring all namespaces, it needs to react
 	// to all notifications of changes to FluentdConfigs resources.
 	// If instead only a subset of namespaces is being monitored, there
 	// is no need to run the control loop unless the changed FluentdConfig
-	// resource is in one of the monitored namespaces
-	if len(f.cfg.Namespaces) != 0 {
+	// resource is in one of the monitored namespaces. The FluentdConfigs of a central
+	// namespace may target any of them
+	if len(cfg.Namespaces) != 0 && cfg.CentralNamespace == "" {
 		var object metav1.Object
 		var ok bool
 		if object, ok = obj.(metav1.Object); !ok {
@@ -120,7 +245,7 @@ func (f *FluentdConfigDS) handleFDChange(obj interface{}) {
 		}
 
 		toProcess := false
-		for _, ns := range f.cfg.Namespaces {
+		for _, ns := range cfg.Namespaces {
 			if object.GetNamespace() == ns {
 				toProcess = true
 				break
@@ -131,10 +256,5 @@ func (f *FluentdConfigDS) handleFDChange(obj interface{}) {
 		}
 	}
 
-	select {
-	case f.updateChan <- time.Now():
-	default:
-		// There is already one pending notification. Useless to send another one since, when
-		// the pending one will be processed all new changes will be reloaded.
-	}
+	util.NotifyUpdate(f.updateChan)
 }
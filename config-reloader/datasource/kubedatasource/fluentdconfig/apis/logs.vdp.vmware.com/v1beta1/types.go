@@ -19,6 +19,9 @@ type FluentdConfig struct {
 // FluentdConfigSpec implements the fluent.conf file as CRD
 type FluentdConfigSpec struct {
 	FluentConf string `json:"fluentconf,omitempty"`
+	// Namespace is the namespace the config applies to when it lives in the central namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
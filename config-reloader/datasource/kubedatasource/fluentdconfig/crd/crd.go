@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
 
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	v1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
@@ -115,7 +116,8 @@ func monitorCRDAvailability(crdManager manager) error {
 
 var fluentdConfigCRD = v1.CustomResourceDefinition{
 	ObjectMeta: metav1.ObjectMeta{
-		Name: "fluentdconfigs.logs.vdp.vmware.com",
+		Name:   "fluentdconfigs.logs.vdp.vmware.com",
+		Labels: map[string]string{util.ManagedByLabel: util.ManagedByValue},
 	},
 	Spec: v1.CustomResourceDefinitionSpec{
 		Group: "logs.vdp.vmware.com",
@@ -139,6 +141,9 @@ var fluentdConfigCRD = v1.CustomResourceDefinition{
 									"fluentconf": {
 										Type: "string",
 									},
+									"namespace": {
+										Type: "string",
+									},
 								},
 							},
 						},
@@ -183,7 +188,8 @@ func (m *v1Manager) GetCRDName(ctx context.Context) string {
 
 var legacyFluentdConfigCRD = v1beta1.CustomResourceDefinition{
 	ObjectMeta: metav1.ObjectMeta{
-		Name: "fluentdconfigs.logs.vdp.vmware.com",
+		Name:   "fluentdconfigs.logs.vdp.vmware.com",
+		Labels: map[string]string{util.ManagedByLabel: util.ManagedByValue},
 	},
 	Spec: v1beta1.CustomResourceDefinitionSpec{
 		Group: "logs.vdp.vmware.com",
@@ -201,6 +207,9 @@ var legacyFluentdConfigCRD = v1beta1.CustomResourceDefinition{
 							"fluentconf": {
 								Type: "string",
 							},
+							"namespace": {
+								Type: "string",
+							},
 						},
 					},
 				},
@@ -0,0 +1,146 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	kfo "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/apis/logs.vdp.vmware.com/v1beta1"
+	kfoFake "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/client/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// flakyLister is a client whose API server fails the first `failures` lists of FluentdConfigs
+// and takes delay to answer every one
+type flakyLister struct {
+	failures int
+	calls    int32
+	delay    time.Duration
+	configs  []*kfo.FluentdConfig
+}
+
+func (l *flakyLister) client() *kfoFake.Clientset {
+	objects := []runtime.Object{}
+	for _, fc := range l.configs {
+		objects = append(objects, fc)
+	}
+	client := kfoFake.NewSimpleClientset(objects...)
+	client.PrependReactor("list", "fluentdconfigs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls := atomic.AddInt32(&l.calls, 1)
+		time.Sleep(l.delay)
+		if int(calls) <= l.failures {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+func newTestFluentdConfigDS(lister *flakyLister, retries int) *FluentdConfigDS {
+	fetchRetryInitialWait = time.Millisecond
+	return &FluentdConfigDS{
+		cfg: &config.Config{
+			CRDFetchTimeoutSeconds: 1,
+			CRDFetchRetries:        retries,
+		},
+		fdclient: lister.client(),
+	}
+}
+
+func makeFluentdConfig(name, conf string) *kfo.FluentdConfig {
+	return &kfo.FluentdConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Spec:       kfo.FluentdConfigSpec{FluentConf: conf},
+	}
+}
+
+func TestGetFluentdConfigRetriesFlakyLister(t *testing.T) {
+	lister := &flakyLister{
+		failures: 2,
+		configs: []*kfo.FluentdConfig{
+			makeFluentdConfig("b", "second"),
+			makeFluentdConfig("a", "first"),
+		},
+	}
+	ds := newTestFluentdConfigDS(lister, 3)
+
+	conf, err := ds.GetFluentdConfig(context.Background(), "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, "first\nsecond", conf)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&lister.calls))
+}
+
+func TestGetFluentdConfigGivesUpAfterRetries(t *testing.T) {
+	lister := &flakyLister{failures: 10}
+	ds := newTestFluentdConfigDS(lister, 2)
+
+	_, err := ds.GetFluentdConfig(context.Background(), "ns")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&lister.calls))
+}
+
+func TestGetFluentdConfigHonorsContext(t *testing.T) {
+	lister := &flakyLister{failures: 10}
+	ds := newTestFluentdConfigDS(lister, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ds.GetFluentdConfig(ctx, "ns")
+	assert.NotNil(t, err)
+	assert.True(t, atomic.LoadInt32(&lister.calls) < 100)
+}
+
+func TestGetFluentdConfigTimesOutSlowCalls(t *testing.T) {
+	lister := &flakyLister{delay: 3 * time.Second}
+	ds := newTestFluentdConfigDS(lister, 0)
+
+	start := time.Now()
+	_, err := ds.GetFluentdConfig(context.Background(), "ns")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 3*time.Second)
+}
+
+func TestGetFluentdConfigCentralNamespace(t *testing.T) {
+	byLabel := makeFluentdConfig("by-label", "labeled")
+	byLabel.Labels = map[string]string{targetNamespaceLabel: "demo"}
+	overridden := makeFluentdConfig("overridden", "spec wins")
+	overridden.Labels = map[string]string{targetNamespaceLabel: "demo"}
+	overridden.Spec.Namespace = "other"
+	bySpec := makeFluentdConfig("a-by-spec", "first")
+	bySpec.Spec.Namespace = "demo"
+
+	lister := &flakyLister{
+		configs: []*kfo.FluentdConfig{byLabel, overridden, bySpec, makeFluentdConfig("central", "own")},
+	}
+	ds := newTestFluentdConfigDS(lister, 0)
+	ds.cfg.CentralNamespace = "ns"
+
+	conf, err := ds.GetFluentdConfig(context.Background(), "demo")
+	assert.Nil(t, err)
+	assert.Equal(t, "first\nlabeled", conf)
+
+	conf, err = ds.GetFluentdConfig(context.Background(), "other")
+	assert.Nil(t, err)
+	assert.Equal(t, "spec wins", conf)
+
+	// untargeted configs apply to the central namespace itself
+	conf, err = ds.GetFluentdConfig(context.Background(), "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, "own", conf)
+
+	conf, err = ds.GetFluentdConfig(context.Background(), "unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, "", conf)
+}
@@ -0,0 +1,353 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+)
+
+// gitTimeout bounds a git command so that an unreachable remote does not hold the pulls forever
+const gitTimeout = 2 * time.Minute
+
+// gitTokenUser is the user name sent with an access token without one, the Git hosts accept any
+const gitTokenUser = "x-access-token"
+
+// minGitTokenVersion is the first git version reading GIT_CONFIG_COUNT, which passes the access
+// token of --git-token-file. The SSH key works with any version
+var minGitTokenVersion = []int{2, 31}
+
+// GitDS reads the fluentd config of a namespace from a clone of a Git repository pulled every
+// --git-poll-interval. The config of a namespace is the file {namespace}.conf under --git-path
+// followed by the *.conf files of the directory {namespace}, in name order
+type GitDS struct {
+	cfg        *config.Config
+	dir        string
+	updateChan chan time.Time
+
+	mutex    sync.RWMutex
+	revision string
+	configs  map[string]string
+}
+
+// NewGitDS clones the repository and reads its configs, then keeps pulling it until ctx is done
+func NewGitDS(ctx context.Context, cfg *config.Config, updateChan chan time.Time) (*GitDS, error) {
+	dir := cfg.GitDir
+	if dir == "" {
+		var err error
+		dir, err = ioutil.TempDir("", "kfo-git")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g := &GitDS{
+		cfg:        cfg,
+		dir:        dir,
+		updateChan: updateChan,
+		configs:    map[string]string{},
+	}
+
+	if err := g.init(ctx); err != nil {
+		return nil, err
+	}
+	if cfg.GitTokenFile != "" {
+		if err := g.checkTokenSupport(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := g.pull(ctx); err != nil {
+		return nil, err
+	}
+
+	go g.pollPeriodically(ctx)
+	return g, nil
+}
+
+// IsReady returns a boolean specifying whether the GitDS is ready, the repository is pulled once
+// before it is created
+func (g *GitDS) IsReady() bool {
+	return true
+}
+
+// GetFluentdConfig returns the fluentd config of the given ns at the last pulled revision
+func (g *GitDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.configs[namespace], nil
+}
+
+// checkTokenSupport fails if the git binary is too old to read the access token from the environment,
+// the pulls would then run unauthenticated
+func (g *GitDS) checkTokenSupport(ctx context.Context) error {
+	out, err := g.git(ctx, "version")
+	if err != nil {
+		return err
+	}
+	return checkGitTokenVersion(out)
+}
+
+// checkGitTokenVersion checks the output of git version, e.g. "git version 2.39.5"
+func checkGitTokenVersion(out string) error {
+	fields := strings.Fields(out)
+	if len(fields) < 3 {
+		return fmt.Errorf("cannot parse the git version '%s'", strings.TrimSpace(out))
+	}
+	parts := strings.SplitN(fields[2], ".", 3)
+	for i, min := range minGitTokenVersion {
+		if i >= len(parts) {
+			break
+		}
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return fmt.Errorf("cannot parse the git version '%s'", fields[2])
+		}
+		if n > min {
+			return nil
+		}
+		if n < min {
+			return fmt.Errorf("--git-token-file needs git %d.%d or later, found %s", minGitTokenVersion[0], minGitTokenVersion[1], fields[2])
+		}
+	}
+	return nil
+}
+
+// init creates the local repository, or reuses the one left in --git-dir by a previous run
+func (g *GitDS) init(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); err != nil {
+		if err := os.MkdirAll(g.dir, 0755); err != nil {
+			return err
+		}
+		if _, err := g.git(ctx, "init", "--quiet"); err != nil {
+			return err
+		}
+	}
+	_, err := g.git(ctx, "config", "remote.origin.url", g.cfg.GitURL)
+	return err
+}
+
+// pull checks out the last revision of the branch and reads its configs, it tells if the revision changed
+func (g *GitDS) pull(ctx context.Context) (bool, error) {
+	ref := g.cfg.GitBranch
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// --git-branch is validated not to look like an option, the -- makes sure
+	if _, err := g.git(ctx, "fetch", "--quiet", "--depth=1", "origin", "--", ref); err != nil {
+		return false, err
+	}
+	if _, err := g.git(ctx, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD"); err != nil {
+		return false, err
+	}
+	out, err := g.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return false, err
+	}
+	revision := strings.TrimSpace(out)
+
+	g.mutex.RLock()
+	unchanged := revision == g.revision
+	g.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	configs, err := readGitConfigs(g.dir, g.cfg.GitPath)
+	if err != nil {
+		return false, err
+	}
+
+	g.mutex.Lock()
+	g.revision = revision
+	g.configs = configs
+	g.mutex.Unlock()
+
+	logrus.Infof("Checked out revision %s of %s with the configs of %d namespaces", revision, g.cfg.GitURL, len(configs))
+	return true, nil
+}
+
+func (g *GitDS) pollPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.GitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := g.pull(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.Warnf("Cannot pull %s, keeping the configs of revision %s: %v", g.cfg.GitURL, g.currentRevision(), err)
+			}
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		util.NotifyUpdate(g.updateChan)
+	}
+}
+
+func (g *GitDS) currentRevision() string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.revision
+}
+
+// git runs a git command in the local repository and returns its output
+func (g *GitDS) git(ctx context.Context, args ...string) (string, error) {
+	env, err := g.env()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// env returns the environment authenticating the git commands, never prompting for credentials.
+// The token goes in the environment and not in the arguments so that it does not show in ps
+func (g *GitDS) env() ([]string, error) {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+
+	ssh := []string{"ssh", "-o BatchMode=yes"}
+	if g.cfg.GitKnownHostsFile != "" {
+		ssh = append(ssh, "-o StrictHostKeyChecking=yes", "-o UserKnownHostsFile="+shellQuote(g.cfg.GitKnownHostsFile))
+	} else {
+		ssh = append(ssh, "-o StrictHostKeyChecking=accept-new", "-o UserKnownHostsFile="+shellQuote(filepath.Join(g.dir, ".git", "known_hosts")))
+	}
+	if g.cfg.GitSSHKeyFile != "" {
+		ssh = append(ssh, "-o IdentitiesOnly=yes", "-i "+shellQuote(g.cfg.GitSSHKeyFile))
+	}
+	env = append(env, "GIT_SSH_COMMAND="+strings.Join(ssh, " "))
+
+	if g.cfg.GitTokenFile != "" {
+		data, err := ioutil.ReadFile(g.cfg.GitTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the Git access token: %v", err)
+		}
+		credentials := strings.TrimSpace(string(data))
+		if credentials == "" {
+			return nil, fmt.Errorf("the Git access token file %s is empty", g.cfg.GitTokenFile)
+		}
+		if !strings.Contains(credentials, ":") {
+			credentials = gitTokenUser + ":" + credentials
+		}
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)),
+		)
+	}
+
+	return env, nil
+}
+
+// readGitConfigs reads the config of every namespace found in the directory configPath of the
+// clone: {namespace}.conf followed by the *.conf files of the directory {namespace}. Dot files and
+// directories are skipped, and so are the symlinks and other non-regular files: a symlink committed
+// to the repository must not expose the files of the reloader
+func readGitConfigs(clone string, configPath string) (map[string]string, error) {
+	root, err := filepath.EvalSymlinks(clone)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(root, configPath))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the namespace configs of the repository: %v", err)
+	}
+	if dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		return nil, fmt.Errorf("cannot read the namespace configs of the repository: %s points outside of the repository", configPath)
+	}
+
+	// ReadDir does not follow the symlinks, they are neither regular files nor directories
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the namespace configs of the repository: %v", err)
+	}
+
+	parts := map[string][]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !entry.Mode().IsRegular() || !strings.HasSuffix(name, ".conf") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		ns := strings.TrimSuffix(name, ".conf")
+		parts[ns] = append(parts[ns], string(data))
+	}
+
+	for _, entry := range entries {
+		ns := entry.Name()
+		if strings.HasPrefix(ns, ".") || !entry.IsDir() {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(dir, ns, "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			if strings.HasPrefix(filepath.Base(f), ".") {
+				continue
+			}
+			info, err := os.Lstat(f)
+			if err != nil {
+				return nil, err
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			parts[ns] = append(parts[ns], string(data))
+		}
+	}
+
+	configs := make(map[string]string, len(parts))
+	for ns, data := range parts {
+		configs[ns] = strings.Join(data, "\n")
+	}
+	return configs, nil
+}
+
+// shellQuote quotes a path for GIT_SSH_COMMAND, which git runs with the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,179 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+)
+
+func commitFiles(t *testing.T, repo string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		if content == "" {
+			assert.Nil(t, os.Remove(path))
+			continue
+		}
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "update"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(out))
+	}
+}
+
+func TestGitDS(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "git-ds")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	assert.Nil(t, os.Mkdir(repo, 0755))
+	cmd := exec.Command("git", "init", "--quiet")
+	cmd.Dir = repo
+	assert.Nil(t, cmd.Run())
+
+	config1 := "<match **>\n  @type null\n</match>"
+	config2 := "<match kube.team-b.api.**>\n  @type null\n</match>"
+	config3 := "<match kube.team-b.web.**>\n  @type null\n</match>"
+	commitFiles(t, repo, map[string]string{
+		"README.md":                   "logging configs",
+		"namespaces/team-a.conf":      config1,
+		"namespaces/team-b/web.conf":  config3,
+		"namespaces/team-b/api.conf":  config2,
+		"namespaces/team-b/notes.txt": "not a config",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &config.Config{
+		Datasource:      "git",
+		GitURL:          repo,
+		GitPath:         "namespaces",
+		GitDir:          filepath.Join(dir, "clone"),
+		GitPollInterval: 20 * time.Millisecond,
+	}
+	updateChan := make(chan time.Time, 1)
+	g, err := NewGitDS(ctx, cfg, updateChan)
+	assert.Nil(t, err)
+	assert.True(t, g.IsReady())
+
+	fluentdConfig, err := g.GetFluentdConfig(ctx, "team-a")
+	assert.Nil(t, err)
+	assert.Equal(t, config1, fluentdConfig)
+
+	fluentdConfig, err = g.GetFluentdConfig(ctx, "team-b")
+	assert.Nil(t, err)
+	assert.Equal(t, config2+"\n"+config3, fluentdConfig)
+
+	fluentdConfig, err = g.GetFluentdConfig(ctx, "not-in-git")
+	assert.Nil(t, err)
+	assert.Equal(t, "", fluentdConfig)
+
+	// a push is picked up by the next poll and triggers a run
+	commitFiles(t, repo, map[string]string{"namespaces/team-a.conf": ""})
+	select {
+	case <-updateChan:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the change of the repository did not trigger a run")
+	}
+	fluentdConfig, err = g.GetFluentdConfig(ctx, "team-a")
+	assert.Nil(t, err)
+	assert.Equal(t, "", fluentdConfig)
+
+	// a clone left by a previous run is reused
+	cancel()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	g, err = NewGitDS(ctx, cfg, updateChan)
+	assert.Nil(t, err)
+	fluentdConfig, err = g.GetFluentdConfig(ctx, "team-b")
+	assert.Nil(t, err)
+	assert.Equal(t, config2+"\n"+config3, fluentdConfig)
+
+	cfg.GitPath = "missing"
+	cfg.GitDir = filepath.Join(dir, "other-clone")
+	_, err = NewGitDS(ctx, cfg, updateChan)
+	assert.NotNil(t, err)
+}
+
+func TestGitDSToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-token")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	g := &GitDS{
+		cfg: &config.Config{GitTokenFile: tokenFile},
+		dir: dir,
+	}
+
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("s3cret\n"), 0600))
+	env, err := g.env()
+	assert.Nil(t, err)
+	assert.Contains(t, env, "GIT_CONFIG_VALUE_0=Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte("x-access-token:s3cret")))
+
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("oauth2:s3cret\n"), 0600))
+	env, err = g.env()
+	assert.Nil(t, err)
+	assert.Contains(t, env, "GIT_CONFIG_VALUE_0=Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte("oauth2:s3cret")))
+
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("\n"), 0600))
+	_, err = g.env()
+	assert.NotNil(t, err)
+}
+
+func TestReadGitConfigsSkipsSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-symlinks")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	clone := filepath.Join(dir, "clone")
+	secrets := filepath.Join(dir, "secrets")
+	assert.Nil(t, os.MkdirAll(filepath.Join(clone, "namespaces", "team-b"), 0755))
+	assert.Nil(t, os.MkdirAll(secrets, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(secrets, "token.conf"), []byte("s3cret"), 0600))
+
+	config1 := "<match **>\n  @type null\n</match>"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(clone, "namespaces", "team-a.conf"), []byte(config1), 0644))
+	assert.Nil(t, os.Symlink(filepath.Join(secrets, "token.conf"), filepath.Join(clone, "namespaces", "leak.conf")))
+	assert.Nil(t, os.Symlink(filepath.Join(secrets, "token.conf"), filepath.Join(clone, "namespaces", "team-b", "leak.conf")))
+	assert.Nil(t, os.Symlink(secrets, filepath.Join(clone, "namespaces", "team-c")))
+	assert.Nil(t, os.Symlink(secrets, filepath.Join(clone, "outside")))
+
+	configs, err := readGitConfigs(clone, "namespaces")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"team-a": config1}, configs)
+
+	// --git-path itself must not lead out of the clone
+	_, err = readGitConfigs(clone, "outside")
+	assert.NotNil(t, err)
+}
+
+func TestCheckGitTokenVersion(t *testing.T) {
+	assert.Nil(t, checkGitTokenVersion("git version 2.39.5\n"))
+	assert.Nil(t, checkGitTokenVersion("git version 2.31.0"))
+	assert.Nil(t, checkGitTokenVersion("git version 3.0"))
+	assert.NotNil(t, checkGitTokenVersion("git version 2.30.2"))
+	assert.NotNil(t, checkGitTokenVersion("git version 1.8.3.1"))
+	assert.NotNil(t, checkGitTokenVersion("not git"))
+}
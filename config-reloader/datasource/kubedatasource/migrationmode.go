@@ -7,6 +7,7 @@ import (
 	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
 
 	"k8s.io/client-go/informers"
+	listerv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 )
 
@@ -18,13 +19,13 @@ type MigrationModeDS struct {
 	cmKubeDS KubeDS
 }
 
-func NewMigrationModeDS(ctx context.Context, cfg *config.Config, kubeCfg *rest.Config, factory informers.SharedInformerFactory, updateChan chan time.Time) (*MigrationModeDS, error) {
+func NewMigrationModeDS(ctx context.Context, cfg *config.Config, kubeCfg *rest.Config, factory informers.SharedInformerFactory, nslist listerv1.NamespaceLister, updateChan chan time.Time) (*MigrationModeDS, error) {
 	fdKubeDS, err := NewFluentdConfigDS(ctx, cfg, kubeCfg, updateChan)
 	if err != nil {
 		return nil, err
 	}
 
-	cmKubeDS, err := NewConfigMapDS(ctx, cfg, factory, updateChan)
+	cmKubeDS, err := NewConfigMapDS(ctx, cfg, factory, nslist, updateChan)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,143 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SecretDS reads the fluentd config of a namespace from the fluent.conf key of a Secret, for
+// configs holding credentials. The Secret and its key are found like the ConfigMap of the default
+// datasource: by the namespace annotations or else the defaults
+type SecretDS struct {
+	cfg         *config.Config
+	secretlist  listerv1.SecretLister
+	secretready func() bool
+	nslist      listerv1.NamespaceLister
+	updateChan  chan time.Time
+}
+
+// NewSecretDS reads the secrets of the namespaces listed by nslist using the informers of factory
+func NewSecretDS(ctx context.Context, cfg *config.Config, factory informers.SharedInformerFactory, nslist listerv1.NamespaceLister, updateChan chan time.Time) (*SecretDS, error) {
+	secretDS := &SecretDS{
+		cfg:         cfg,
+		secretlist:  factory.Core().V1().Secrets().Lister(),
+		secretready: factory.Core().V1().Secrets().Informer().HasSynced,
+		nslist:      nslist,
+		updateChan:  updateChan,
+	}
+
+	factory.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(new interface{}) {
+			secretDS.handleSecretChange(new)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			secretDS.handleSecretChange(new)
+		},
+		DeleteFunc: func(new interface{}) {
+			secretDS.handleSecretChange(new)
+		},
+	})
+
+	return secretDS, nil
+}
+
+// IsReady returns a boolean specifying whether the SecretDS is ready
+func (s *SecretDS) IsReady() bool {
+	return s.secretready()
+}
+
+// GetFluentdConfig returns the fluentd config of the given ns read from its Secret,
+// empty if the namespace has no such Secret
+func (s *SecretDS) GetFluentdConfig(ctx context.Context, namespace string) (string, error) {
+	name, err := s.secretName(namespace)
+	if err != nil {
+		if _, ok := err.(*namespaceNotConfigured); ok {
+			logrus.Debugf("Could not find a named secret for namespace: %v", err)
+			return "", nil
+		}
+		return "", err
+	}
+
+	secret, err := s.secretlist.Secrets(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		logrus.Debugf("Failed to retrieve secret '%s' from namespace '%s': %v", name, namespace, err)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key, explicit, err := configKey(s.cfg, s.nslist, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	data, ok := secret.Data[key]
+	if !ok && explicit {
+		return "", fmt.Errorf("cannot find key '%s' set by the %s annotation in secret %s/%s", key, s.cfg.AnnotConfigKey, namespace, name)
+	}
+	if !ok {
+		logrus.Warnf("cannot find entry %s in secret %s/%s", key, namespace, name)
+		return "", nil
+	}
+
+	logrus.Debugf("Loaded config data from secret: %s/%s", namespace, name)
+	return string(data), nil
+}
+
+// secretName is the name of the Secret holding the config of a namespace, see detectConfigMapName
+func (s *SecretDS) secretName(ns string) (string, error) {
+	namespace, err := s.nslist.Get(ns)
+	if err != nil {
+		return "", fmt.Errorf("Could not get the details of namespace '%s': %v", ns, err)
+	}
+
+	name := namespace.Annotations[s.cfg.AnnotConfigmapName]
+	if name == "" {
+		name = s.cfg.DefaultConfigmapName
+	}
+	if name == "" {
+		return "", &namespaceNotConfigured{Namespace: ns}
+	}
+
+	return name, nil
+}
+
+func (s *SecretDS) handleSecretChange(obj interface{}) {
+	var object metav1.Object
+	var ok bool
+	if object, ok = obj.(metav1.Object); !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			logrus.Warnf("error decoding object, invalid type")
+			return
+		}
+		object, ok = tombstone.Obj.(metav1.Object)
+		if !ok {
+			logrus.Warnf("error decoding object tombstone, invalid type")
+			return
+		}
+	}
+
+	// every Secret of the cluster goes through here, only the config ones trigger a run
+	name, err := s.secretName(object.GetNamespace())
+	if err != nil || object.GetName() != name {
+		return
+	}
+
+	util.NotifyUpdate(s.updateChan)
+}
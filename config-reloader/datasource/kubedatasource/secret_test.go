@@ -0,0 +1,83 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package kubedatasource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSecretDS(t *testing.T) {
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.Nil(t, nsIndexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default-name"}}))
+	assert.Nil(t, nsIndexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "annotated",
+		Annotations: map[string]string{"logging.csp.vmware.com/fluentd-configmap": "splunk-config"},
+	}}))
+	assert.Nil(t, nsIndexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "missing-key"}}))
+	assert.Nil(t, nsIndexer.Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "empty"}}))
+
+	config1 := "<match **>\n  @type null\n</match>"
+	config2 := "<match **>\n  @type splunk_hec\n  hec_token secret\n</match>"
+	secrets := []*core.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "fluentd-config", Namespace: "default-name"},
+			Data:       map[string][]byte{entryName: []byte(config1)},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "splunk-config", Namespace: "annotated"},
+			Data:       map[string][]byte{entryName: []byte(config2)},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "fluentd-config", Namespace: "annotated"},
+			Data:       map[string][]byte{entryName: []byte(config1)},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "fluentd-config", Namespace: "missing-key"},
+			Data:       map[string][]byte{"other": []byte(config1)},
+		},
+	}
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, s := range secrets {
+		assert.Nil(t, secretIndexer.Add(s))
+	}
+
+	updateChan := make(chan time.Time, 1)
+	ds := &SecretDS{
+		cfg: &config.Config{
+			AnnotConfigmapName:   "logging.csp.vmware.com/fluentd-configmap",
+			DefaultConfigmapName: "fluentd-config",
+		},
+		secretlist: listerv1.NewSecretLister(secretIndexer),
+		nslist:     listerv1.NewNamespaceLister(nsIndexer),
+		updateChan: updateChan,
+	}
+
+	ctx := context.Background()
+	for ns, expected := range map[string]string{
+		"default-name": config1,
+		"annotated":    config2,
+		"missing-key":  "",
+		"empty":        "",
+	} {
+		conf, err := ds.GetFluentdConfig(ctx, ns)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, conf, ns)
+	}
+
+	// other Secrets of the namespace don't trigger a run
+	ds.handleSecretChange(secrets[2])
+	assert.Equal(t, 0, len(updateChan))
+
+	ds.handleSecretChange(secrets[1])
+	assert.Equal(t, 1, len(updateChan))
+}
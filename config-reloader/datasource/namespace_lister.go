@@ -0,0 +1,142 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// singleNamespaceLister is the NamespaceLister of --single-namespace. Watching namespaces needs
+// cluster-wide permissions so the one namespace is read on demand. Without the permission to get
+// it the namespace is returned without labels and annotations
+type singleNamespaceLister struct {
+	client    kubernetes.Interface
+	namespace string
+	warnOnce  sync.Once
+}
+
+var _ listerv1.NamespaceLister = &singleNamespaceLister{}
+
+func newSingleNamespaceLister(client kubernetes.Interface, namespace string) *singleNamespaceLister {
+	return &singleNamespaceLister{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+func (l *singleNamespaceLister) List(selector labels.Selector) ([]*core.Namespace, error) {
+	ns, err := l.Get(l.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		return []*core.Namespace{}, nil
+	}
+
+	return []*core.Namespace{ns}, nil
+}
+
+func (l *singleNamespaceLister) Get(name string) (*core.Namespace, error) {
+	if name != l.namespace {
+		return nil, errors.NewNotFound(core.Resource("namespace"), name)
+	}
+
+	ns, err := l.client.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+	if err == nil {
+		return ns, nil
+	}
+
+	if !errors.IsForbidden(err) {
+		return nil, err
+	}
+
+	l.warnOnce.Do(func() {
+		logrus.Warnf("Cannot get namespace %s, its labels and annotations are ignored: %v", name, err)
+	})
+
+	return &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+}
+
+// namespacesLister is the NamespaceLister of --namespaces. Each listed namespace is watched on its
+// own with a field selector on its name, which a ClusterRole limited with resourceNames allows, instead
+// of watching all namespaces. The namespaces not listed at startup, e.g. added by the runtime config,
+// are read on demand
+type namespacesLister struct {
+	client  kubernetes.Interface
+	names   []string
+	listers map[string]listerv1.NamespaceLister
+}
+
+var _ listerv1.NamespaceLister = &namespacesLister{}
+
+// newNamespacesLister starts an informer per namespace, they stop with ctx
+func newNamespacesLister(ctx context.Context, client kubernetes.Interface, names []string) (*namespacesLister, []cache.InformerSynced) {
+	l := &namespacesLister{
+		client:  client,
+		listers: map[string]listerv1.NamespaceLister{},
+	}
+
+	synced := []cache.InformerSynced{}
+	for _, name := range names {
+		if _, ok := l.listers[name]; ok {
+			continue
+		}
+
+		selector := fields.OneTermEqualSelector("metadata.name", name).String()
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.FieldSelector = selector
+			}))
+		l.names = append(l.names, name)
+		l.listers[name] = factory.Core().V1().Namespaces().Lister()
+		synced = append(synced, factory.Core().V1().Namespaces().Informer().HasSynced)
+		factory.Start(ctx.Done())
+	}
+	sort.Strings(l.names)
+
+	return l, synced
+}
+
+// List returns the watched namespaces matching the selector
+func (l *namespacesLister) List(selector labels.Selector) ([]*core.Namespace, error) {
+	res := []*core.Namespace{}
+	for _, name := range l.names {
+		ns, err := l.listers[name].Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if selector.Matches(labels.Set(ns.Labels)) {
+			res = append(res, ns)
+		}
+	}
+
+	return res, nil
+}
+
+func (l *namespacesLister) Get(name string) (*core.Namespace, error) {
+	if lister, ok := l.listers[name]; ok {
+		return lister.Get(name)
+	}
+
+	return l.client.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+}
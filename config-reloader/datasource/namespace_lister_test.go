@@ -0,0 +1,107 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSingleNamespaceLister(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team",
+		Labels:      map[string]string{"tier": "web"},
+		Annotations: map[string]string{"logging.csp.vmware.com/fluentd-configmap": "logs"},
+	}})
+	l := newSingleNamespaceLister(client, "team")
+
+	ns, err := l.Get("team")
+	assert.Nil(t, err)
+	assert.Equal(t, "logs", ns.Annotations["logging.csp.vmware.com/fluentd-configmap"])
+
+	_, err = l.Get("other")
+	assert.True(t, errors.IsNotFound(err))
+
+	nses, err := l.List(labels.SelectorFromSet(labels.Set{"tier": "web"}))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+
+	nses, err = l.List(labels.SelectorFromSet(labels.Set{"tier": "db"}))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(nses))
+}
+
+func TestSingleNamespaceListerWithoutPermissions(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(core.Resource("namespaces"), "team", nil)
+	})
+	l := newSingleNamespaceLister(client, "team")
+
+	ns, err := l.Get("team")
+	assert.Nil(t, err)
+	assert.Equal(t, "team", ns.Name)
+	assert.Equal(t, 0, len(ns.Annotations))
+
+	d := &kubeInformerConnection{
+		hashes:      map[string]string{},
+		inputHashes: map[string]string{},
+		cfg:         &config.Config{SingleNamespace: "team"},
+		kubeds:      staticKubeDS{"team": "<match **>\n  @type null\n</match>"},
+		nslist:      l,
+	}
+
+	nses, err := d.GetNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+	assert.Equal(t, "team", nses[0].Name)
+}
+
+func TestNamespacesLister(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tier": "web"}}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-c"}},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, synced := newNamespacesLister(ctx, client, []string{"team-b", "team-a", "team-a", "gone"})
+	assert.Equal(t, 3, len(synced))
+	assert.True(t, cache.WaitForCacheSync(ctx.Done(), synced...))
+
+	ns, err := l.Get("team-a")
+	assert.Nil(t, err)
+	assert.Equal(t, "web", ns.Labels["tier"])
+
+	_, err = l.Get("gone")
+	assert.True(t, errors.IsNotFound(err))
+
+	// a namespace not listed at startup is read from the API
+	ns, err = l.Get("team-c")
+	assert.Nil(t, err)
+	assert.Equal(t, "team-c", ns.Name)
+
+	nses, err := l.List(labels.Everything())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nses))
+	assert.Equal(t, "team-a", nses[0].Name)
+	assert.Equal(t, "team-b", nses[1].Name)
+
+	nses, err = l.List(labels.SelectorFromSet(labels.Set{"tier": "web"}))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nses))
+}
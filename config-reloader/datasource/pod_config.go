@@ -0,0 +1,93 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podConfigSnippets concatenates the config snippets found in the PodConfigAnnotation of the
+// pods of a namespace, ordered by pod name. Identical snippets, e.g. of the replicas of a
+// deployment, are only added once. The admin namespace is never read from pods
+func (d *kubeInformerConnection) podConfigSnippets(ns string) (string, error) {
+	if d.cfg.PodConfigAnnotation == "" || d.podlist == nil || ns == d.cfg.AdminNamespace {
+		return "", nil
+	}
+
+	pods, err := d.indexedPods(podIndexConfig, ns)
+	if err != nil {
+		return "", err
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+
+	seen := map[string]bool{}
+	snippets := []string{}
+	for _, pod := range pods {
+		snippet := strings.TrimSpace(pod.Annotations[d.cfg.PodConfigAnnotation])
+		if snippet == "" || seen[snippet] {
+			continue
+		}
+		seen[snippet] = true
+		snippets = append(snippets, fmt.Sprintf("# from pod %s\n%s", pod.Name, snippet))
+	}
+
+	return strings.Join(snippets, "\n\n"), nil
+}
+
+// appendConfig joins the namespace config and the snippets read from its pods
+func appendConfig(config string, snippets string) string {
+	if snippets == "" {
+		return config
+	}
+	if config == "" {
+		return snippets
+	}
+
+	return config + "\n\n" + snippets
+}
+
+// podAnnotationHandler notifies the controller when an annotation of the pods, e.g. a pod config
+// snippet, is added, changed or removed
+func podAnnotationHandler(annotation string, updateChan chan time.Time) cache.ResourceEventHandler {
+	notify := func() { util.NotifyUpdate(updateChan) }
+
+	annotated := func(obj interface{}) bool {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		pod, ok := obj.(*core.Pod)
+		return ok && pod.Annotations[annotation] != ""
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if annotated(obj) {
+				notify()
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldPod, ok1 := old.(*core.Pod)
+			newPod, ok2 := new.(*core.Pod)
+			if ok1 && ok2 && oldPod.Annotations[annotation] != newPod.Annotations[annotation] {
+				notify()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if annotated(obj) {
+				notify()
+			}
+		},
+	}
+}
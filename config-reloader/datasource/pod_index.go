@@ -0,0 +1,109 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Indexes of the pod informer, on top of the namespace index every informer has. They are keyed
+// by namespace too but only hold the pods that matter to a lookup, so that the few relevant pods
+// of a large namespace are found without going through all of them
+const (
+	// pods that may make up mini containers: with an emptyDir volume, a parser hint or excluded
+	podIndexMinis = "kfo-minis"
+	// pods with a config snippet annotation
+	podIndexConfig = "kfo-pod-config"
+)
+
+// podIndexers returns the indexers to add to the pod informer before it starts. Annotation names
+// are only read at startup, like the informers themselves
+func podIndexers(cfg *config.Config) cache.Indexers {
+	parserAnnotation := cfg.AnnotParser
+	excludeAnnotation := cfg.AnnotExclude
+	indexers := cache.Indexers{
+		podIndexMinis: func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*core.Pod)
+			if !ok {
+				return nil, nil
+			}
+
+			if parserAnnotation != "" && strings.TrimSpace(pod.Annotations[parserAnnotation]) != "" {
+				return []string{pod.Namespace}, nil
+			}
+			if podExcluded(pod, excludeAnnotation) {
+				return []string{pod.Namespace}, nil
+			}
+			for _, v := range pod.Spec.Volumes {
+				if v.EmptyDir != nil {
+					return []string{pod.Namespace}, nil
+				}
+			}
+			return nil, nil
+		},
+	}
+
+	if annotation := cfg.PodConfigAnnotation; annotation != "" {
+		indexers[podIndexConfig] = func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*core.Pod)
+			if !ok || strings.TrimSpace(pod.Annotations[annotation]) == "" {
+				return nil, nil
+			}
+			return []string{pod.Namespace}, nil
+		}
+	}
+
+	return indexers
+}
+
+// podInformerOptions returns the factory options of the pod informer. With a pod label or field
+// selector only the matching pods are listed and cached, the others are unknown to the macros
+func podInformerOptions(cfg *config.Config) []informers.SharedInformerOption {
+	opts := []informers.SharedInformerOption{}
+	if cfg.SingleNamespace != "" {
+		opts = append(opts, informers.WithNamespace(cfg.SingleNamespace))
+	}
+
+	if cfg.PodLabelSelector != "" || cfg.PodFieldSelector != "" {
+		labelSelector, fieldSelector := cfg.PodLabelSelector, cfg.PodFieldSelector
+		opts = append(opts, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+			options.FieldSelector = fieldSelector
+		}))
+	}
+
+	return opts
+}
+
+// indexedPods returns the pods of a namespace in the given index. Without such an index, e.g.
+// for an empty index name, all pods of the namespace are returned
+func (d *kubeInformerConnection) indexedPods(index string, ns string) ([]*core.Pod, error) {
+	if d.podIndex == nil {
+		return d.podlist.Pods(ns).List(labels.Everything())
+	}
+	if _, ok := d.podIndex.GetIndexers()[index]; !ok {
+		return d.podlist.Pods(ns).List(labels.Everything())
+	}
+
+	objs, err := d.podIndex.ByIndex(index, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]*core.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*core.Pod); ok {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
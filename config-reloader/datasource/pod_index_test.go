@@ -0,0 +1,149 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	testParserAnnotation  = "logging.csp.vmware.com/parser"
+	testConfigAnnotation  = "example.com/fluentd-config"
+	testExcludeAnnotation = "logging.csp.vmware.com/exclude"
+)
+
+func testPod(ns string, name string, emptyDir bool, annotations map[string]string) *core.Pod {
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, UID: types.UID("uid-" + name), Annotations: annotations},
+		Spec:       core.PodSpec{Containers: []core.Container{{Name: "main", Image: "app"}}},
+	}
+	if emptyDir {
+		pod.Spec.Volumes = []core.Volume{{Name: "logs", VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}}}
+		pod.Spec.Containers[0].VolumeMounts = []core.VolumeMount{{Name: "logs", MountPath: "/var/log/app"}}
+	}
+	return pod
+}
+
+// indexedConnection returns a connection reading the pods with and without the pod indexes
+func indexedConnection(t testing.TB, cfg *config.Config, pods []*core.Pod) (*kubeInformerConnection, *kubeInformerConnection) {
+	indexers := podIndexers(cfg)
+	indexers[cache.NamespaceIndex] = cache.MetaNamespaceIndexFunc
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+	for _, pod := range pods {
+		if err := indexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lister := listerv1.NewPodLister(indexer)
+	return &kubeInformerConnection{cfg: cfg, podlist: lister, podIndex: indexer},
+		&kubeInformerConnection{cfg: cfg, podlist: lister}
+}
+
+func TestIndexedPods(t *testing.T) {
+	cfg := &config.Config{AnnotParser: testParserAnnotation, PodConfigAnnotation: testConfigAnnotation, AnnotExclude: testExcludeAnnotation}
+	indexed, plain := indexedConnection(t, cfg, []*core.Pod{
+		testPod("web", "plain", false, nil),
+		testPod("web", "files", true, nil),
+		testPod("web", "json", false, map[string]string{testParserAnnotation: "json"}),
+		testPod("web", "snippet", false, map[string]string{testConfigAnnotation: "<match kube.web.**>\n  @type null\n</match>"}),
+		testPod("web", "noisy", false, map[string]string{testExcludeAnnotation: "true"}),
+		testPod("other", "files", true, nil),
+	})
+
+	for _, defaultParser := range []string{"", "logfmt"} {
+		want, err := plain.listMiniContainers("web", defaultParser)
+		assert.Nil(t, err)
+		got, err := indexed.listMiniContainers("web", defaultParser)
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, want, got)
+	}
+
+	minis, err := indexed.listMiniContainers("web", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(minis))
+
+	// the namespace parser is given to all containers, pods outside the index included
+	minis, err = indexed.listMiniContainers("web", "logfmt")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(minis))
+
+	want, err := plain.podConfigSnippets("web")
+	assert.Nil(t, err)
+	got, err := indexed.podConfigSnippets("web")
+	assert.Nil(t, err)
+	assert.Equal(t, want, got)
+	assert.Contains(t, got, "# from pod snippet")
+}
+
+// BenchmarkListMiniContainers looks up the mini containers of a namespace with 20000 pods, 1% of
+// them having an emptyDir, in a cluster of 200 other namespaces of 50 pods
+func BenchmarkListMiniContainers(b *testing.B) {
+	pods := []*core.Pod{}
+	for i := 0; i < 20000; i++ {
+		pods = append(pods, testPod("big", fmt.Sprintf("pod-%d", i), i%100 == 0, nil))
+	}
+	for n := 0; n < 200; n++ {
+		for i := 0; i < 50; i++ {
+			pods = append(pods, testPod(fmt.Sprintf("small-%d", n), fmt.Sprintf("pod-%d", i), i%10 == 0, nil))
+		}
+	}
+
+	indexed, plain := indexedConnection(b, &config.Config{}, pods)
+
+	for name, d := range map[string]*kubeInformerConnection{"namespace-index": plain, "minis-index": indexed} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				minis, err := d.listMiniContainers("big", "")
+				if err != nil || len(minis) != 200 {
+					b.Fatalf("got %d minis: %+v", len(minis), err)
+				}
+			}
+		})
+	}
+}
+
+func TestPodInformerOptions(t *testing.T) {
+	client := fake.NewSimpleClientset(testPod("team-a", "app", false, nil))
+
+	var listed k8stesting.ListAction
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		listed = action.(k8stesting.ListAction)
+		return false, nil, nil
+	})
+
+	cfg := &config.Config{
+		SingleNamespace:  "team-a",
+		PodLabelSelector: "app=web",
+		PodFieldSelector: "spec.nodeName=node-1",
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, podInformerOptions(cfg)...)
+	informer := factory.Core().V1().Pods().Informer()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop, informer.HasSynced))
+
+	assert.NotNil(t, listed)
+	assert.Equal(t, "team-a", listed.GetNamespace())
+	assert.Equal(t, "app=web", listed.GetListRestrictions().Labels.String())
+	assert.Equal(t, "spec.nodeName=node-1", listed.GetListRestrictions().Fields.String())
+
+	assert.Empty(t, podInformerOptions(&config.Config{}))
+}
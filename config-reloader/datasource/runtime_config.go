@@ -0,0 +1,179 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// runtimeConfigDirPoll is how often the files of --runtime-config-dir are checked for changes
+const runtimeConfigDirPoll = 10 * time.Second
+
+// runtimeConfig applies the reloadable flags stored in a ConfigMap of the reloader's namespace
+// or in a directory
+type runtimeConfig struct {
+	// where the values come from, for the logs
+	source string
+	// read returns the values keyed by flag name, empty if there are none
+	read func() (map[string]string, error)
+	base *config.Config
+	hash string
+}
+
+// newRuntimeConfig watches the single ConfigMap holding the runtime config and triggers
+// a control loop run whenever it changes
+func newRuntimeConfig(ctx context.Context, client kubernetes.Interface, cfg *config.Config, namespace string, updateChan chan time.Time) (*runtimeConfig, cache.InformerSynced) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", cfg.RuntimeConfigMap).String()
+		}))
+
+	notify := func(obj interface{}) { util.NotifyUpdate(updateChan) }
+
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(old, new interface{}) { notify(new) },
+		DeleteFunc: notify,
+	})
+
+	lister := factory.Core().V1().ConfigMaps().Lister()
+	base := *cfg
+	rc := &runtimeConfig{
+		source: fmt.Sprintf("configmap %s/%s", namespace, cfg.RuntimeConfigMap),
+		read: func() (map[string]string, error) {
+			cm, err := lister.ConfigMaps(namespace).Get(cfg.RuntimeConfigMap)
+			if errors.IsNotFound(err) {
+				return map[string]string{}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return cm.Data, nil
+		},
+		base: &base,
+	}
+
+	factory.Start(ctx.Done())
+	logrus.Infof("Watching %s for runtime config, reloadable flags: %s",
+		rc.source, strings.Join(config.ReloadableFlags(), ", "))
+
+	return rc, informer.HasSynced
+}
+
+// newRuntimeConfigDir reads the runtime config from the files of a directory, one per flag,
+// and triggers a control loop run whenever they change. A mounted ConfigMap is updated by the
+// kubelet without any RBAC for the reloader, so the directory is polled instead of watched
+func newRuntimeConfigDir(ctx context.Context, cfg *config.Config, updateChan chan time.Time) *runtimeConfig {
+	dir := cfg.RuntimeConfigDir
+	base := *cfg
+	rc := &runtimeConfig{
+		source: "directory " + dir,
+		read:   func() (map[string]string, error) { return readRuntimeConfigDir(dir) },
+		base:   &base,
+	}
+
+	go func() {
+		ticker := time.NewTicker(runtimeConfigDirPoll)
+		defer ticker.Stop()
+
+		last := rc.valuesHash()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			hash := rc.valuesHash()
+			if hash == last {
+				continue
+			}
+			last = hash
+			util.NotifyUpdate(updateChan)
+		}
+	}()
+
+	logrus.Infof("Watching %s for runtime config, reloadable flags: %s",
+		rc.source, strings.Join(config.ReloadableFlags(), ", "))
+
+	return rc
+}
+
+// readRuntimeConfigDir reads the flags of a runtime config directory, keyed by file name. Hidden
+// files are skipped, like the ..data links of a mounted ConfigMap. A missing directory is empty
+func readRuntimeConfigDir(dir string) (map[string]string, error) {
+	values := map[string]string{}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		values[f.Name()] = string(data)
+	}
+	return values, nil
+}
+
+// valuesHash hashes the current values, empty if they cannot be read
+func (rc *runtimeConfig) valuesHash() string {
+	values, err := rc.read()
+	if err != nil {
+		return ""
+	}
+	return util.Hash("", util.ToRubyMapLiteral(values))
+}
+
+// apply sets the runtime config on cfg if the values changed since the last call.
+// A deleted ConfigMap or directory reverts all reloadable flags to their startup values
+func (rc *runtimeConfig) apply(cfg *config.Config) error {
+	values, err := rc.read()
+	if err != nil {
+		return err
+	}
+
+	hash := util.Hash("", util.ToRubyMapLiteral(values))
+	if hash == rc.hash {
+		return nil
+	}
+
+	// a bad config is reported once, the previous runtime config stays until it is fixed
+	rc.hash = hash
+	applied, err := cfg.ApplyRuntimeConfig(rc.base, values)
+	if err != nil {
+		return fmt.Errorf("Cannot apply runtime config from %s: %v", rc.source, err)
+	}
+
+	logrus.SetLevel(cfg.Current().GetLogLevel())
+	logrus.Infof("Applied runtime config from %s: %v", rc.source, applied)
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runtime-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the layout of a mounted ConfigMap
+	data := filepath.Join(dir, "..2021_01_01")
+	assert.Nil(t, os.Mkdir(data, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(data, "max-reloads-per-minute"), []byte("6\n"), 0644))
+	assert.Nil(t, os.Symlink(data, filepath.Join(dir, "..data")))
+	assert.Nil(t, os.Symlink(filepath.Join("..data", "max-reloads-per-minute"), filepath.Join(dir, "max-reloads-per-minute")))
+
+	values, err := readRuntimeConfigDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"max-reloads-per-minute": "6\n"}, values)
+
+	values, err = readRuntimeConfigDir(filepath.Join(dir, "missing"))
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &config.Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{"--runtime-config-dir=" + dir}))
+	assert.Nil(t, cfg.Validate())
+	rc := newRuntimeConfigDir(ctx, cfg, make(chan time.Time, 1))
+
+	assert.Nil(t, rc.apply(cfg))
+	assert.Equal(t, 6, cfg.Current().MaxReloadsPerMinute)
+	assert.Equal(t, 5*time.Second, cfg.Current().ReloadDebounce)
+
+	// an emptied directory reverts to the startup flags
+	assert.Nil(t, os.Remove(filepath.Join(dir, "max-reloads-per-minute")))
+	assert.Nil(t, os.Remove(filepath.Join(data, "max-reloads-per-minute")))
+	assert.Nil(t, rc.apply(cfg))
+	assert.Equal(t, 0, cfg.Current().MaxReloadsPerMinute)
+}
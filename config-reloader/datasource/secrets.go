@@ -0,0 +1,36 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrSecretsForbidden is returned by a SecretChecker missing the RBAC permission to get Secrets
+var ErrSecretsForbidden = errors.New("not allowed to read secrets, grant get on secrets to the service account")
+
+// SecretKeyExists reads the Secret from the API every time: Secrets are not watched so that
+// the reloader keeps none of them in memory
+func (d *kubeInformerConnection) SecretKeyExists(ctx context.Context, namespace string, name string, key string) (bool, error) {
+	secret, err := d.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if apierrors.IsForbidden(err) {
+		return false, ErrSecretsForbidden
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := secret.Data[key]; ok {
+		return true, nil
+	}
+	_, ok := secret.StringData[key]
+	return ok, nil
+}
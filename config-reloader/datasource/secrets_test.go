@@ -0,0 +1,53 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSecretKeyExists(t *testing.T) {
+	secret := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "es-creds", Namespace: "web"},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+	}
+	d := &kubeInformerConnection{client: fake.NewSimpleClientset(secret)}
+	ctx := context.Background()
+
+	ok, err := d.SecretKeyExists(ctx, "web", "es-creds", "password")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = d.SecretKeyExists(ctx, "web", "es-creds", "user")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// the secret of another namespace is not visible
+	ok, err = d.SecretKeyExists(ctx, "api", "es-creds", "password")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestSecretKeyExistsForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "es-creds", nil)
+	})
+	d := &kubeInformerConnection{client: client}
+
+	ok, err := d.SecretKeyExists(context.Background(), "web", "es-creds", "password")
+	assert.Equal(t, ErrSecretsForbidden, err)
+	assert.False(t, ok)
+}
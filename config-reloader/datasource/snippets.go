@@ -0,0 +1,166 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// SnippetLabel marks the ConfigMaps of --snippets-namespace whose keys the namespace configs may include
+	SnippetLabel = "logging.csp.vmware.com/fluentd-snippets"
+
+	includeDirective = "@include"
+	// maxIncludeDepth bounds the snippets including other snippets
+	maxIncludeDepth = 5
+)
+
+// errSnippetsDisabled is the error of an @include without --snippets-namespace
+var errSnippetsDisabled = errors.New("@include of shared snippets is not enabled, ask the cluster admin to set --snippets-namespace")
+
+// SnippetReader reads a shared config snippet, the key of a ConfigMap managed by the cluster admin.
+// Datasources may optionally implement it
+type SnippetReader interface {
+	Snippet(name string, key string) (string, bool, error)
+}
+
+// sharedSnippets reads the snippets from the labelled ConfigMaps of a single namespace
+type sharedSnippets struct {
+	namespace string
+	lister    listerv1.ConfigMapLister
+}
+
+// newSharedSnippets watches the labelled ConfigMaps of --snippets-namespace and triggers a control
+// loop run whenever one changes
+func newSharedSnippets(ctx context.Context, client kubernetes.Interface, cfg *config.Config, updateChan chan time.Time) (*sharedSnippets, cache.InformerSynced) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, cfg.ResyncPeriod,
+		informers.WithNamespace(cfg.SnippetsNamespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = SnippetLabel + "=true"
+		}))
+
+	notify := func(obj interface{}) { util.NotifyUpdate(updateChan) }
+
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(old, new interface{}) { notify(new) },
+		DeleteFunc: notify,
+	})
+
+	s := &sharedSnippets{
+		namespace: cfg.SnippetsNamespace,
+		lister:    factory.Core().V1().ConfigMaps().Lister(),
+	}
+
+	factory.Start(ctx.Done())
+	logrus.Infof("Watching the configmaps of namespace %s labelled %s=true for the shared snippets", cfg.SnippetsNamespace, SnippetLabel)
+
+	return s, informer.HasSynced
+}
+
+func (s *sharedSnippets) get(name string, key string) (string, bool, error) {
+	cm, err := s.lister.ConfigMaps(s.namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	snippet, ok := cm.Data[key]
+	return snippet, ok, nil
+}
+
+// HasIncludes is a cheap pre-scan telling if a config may include shared snippets
+func HasIncludes(config string) bool {
+	return strings.Contains(config, includeDirective)
+}
+
+// ResolveIncludes replaces every "@include <configmap>/<key>" line of a config with the snippet
+// read by r, recursively. A missing snippet, a cycle or too deep an include fails the config with
+// ErrorPhaseValidation. The other @include lines, e.g. of a file, are native fluentd includes and
+// are left as they are, as is the whole config when r is nil
+func ResolveIncludes(config string, r SnippetReader) (string, error) {
+	if r == nil {
+		return config, nil
+	}
+	return resolveIncludes(config, r, nil)
+}
+
+// snippetRef splits the "<configmap>/<key>" ref of a snippet include, ok is false for any other ref
+func snippetRef(ref string) (name string, key string, ok bool) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || strings.ContainsAny(ref, "*?[]{}") {
+		return "", "", false
+	}
+	if len(validation.IsDNS1123Subdomain(parts[0])) > 0 || len(validation.IsConfigMapKey(parts[1])) > 0 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func resolveIncludes(config string, r SnippetReader, stack []string) (string, error) {
+	if !HasIncludes(config) {
+		return config, nil
+	}
+
+	lines := strings.Split(config, "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != includeDirective {
+			continue
+		}
+
+		if len(fields) != 2 {
+			continue
+		}
+		ref := fields[1]
+		name, key, ok := snippetRef(ref)
+		if !ok {
+			continue
+		}
+
+		for _, seen := range stack {
+			if seen == ref {
+				return "", NewPhaseError(ErrorPhaseValidation, fmt.Errorf("@include cycle: %s -> %s", strings.Join(stack, " -> "), ref))
+			}
+		}
+		if len(stack) >= maxIncludeDepth {
+			return "", NewPhaseError(ErrorPhaseValidation, fmt.Errorf("@include %s is nested more than %d levels deep: %s", ref, maxIncludeDepth, strings.Join(stack, " -> ")))
+		}
+
+		snippet, ok, err := r.Snippet(name, key)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", NewPhaseError(ErrorPhaseValidation, fmt.Errorf("@include %s: no such shared snippet, key %s of configmap %s", ref, key, name))
+		}
+
+		snippet, err = resolveIncludes(snippet, r, append(stack, ref))
+		if err != nil {
+			return "", err
+		}
+		lines[i] = fmt.Sprintf("# from @include %s\n%s", ref, snippet)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
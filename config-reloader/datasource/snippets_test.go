@@ -0,0 +1,98 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type staticSnippets map[string]string
+
+func (s staticSnippets) Snippet(name string, key string) (string, bool, error) {
+	snippet, ok := s[name+"/"+key]
+	return snippet, ok, nil
+}
+
+func TestResolveIncludes(t *testing.T) {
+	snippets := staticSnippets{
+		"parsers/json":  "<filter **>\n  @type parser\n  key_name log\n  @include parsers/parse\n</filter>",
+		"parsers/parse": "<parse>\n  @type json\n</parse>",
+		"loop/a":        "@include loop/b",
+		"loop/b":        "@include loop/a",
+	}
+
+	config := "<match kube.*.*.noise>\n  @type null\n</match>\n@include parsers/json\n"
+	resolved, err := ResolveIncludes(config, snippets)
+	assert.Nil(t, err)
+	assert.Equal(t, "<match kube.*.*.noise>\n  @type null\n</match>\n"+
+		"# from @include parsers/json\n<filter **>\n  @type parser\n  key_name log\n"+
+		"# from @include parsers/parse\n<parse>\n  @type json\n</parse>\n</filter>\n", resolved)
+
+	// without includes the config is left alone, even without snippets
+	resolved, err = ResolveIncludes("<match **>\n  @type null\n</match>", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "<match **>\n  @type null\n</match>", resolved)
+
+	_, err = ResolveIncludes("@include loop/a", snippets)
+	assert.EqualError(t, err, "@include cycle: loop/a -> loop/b -> loop/a")
+	assert.Equal(t, ErrorPhaseValidation, ErrorPhase(err))
+
+	_, err = ResolveIncludes("@include parsers/xml", snippets)
+	assert.EqualError(t, err, "@include parsers/xml: no such shared snippet, key xml of configmap parsers")
+	assert.Equal(t, ErrorPhaseValidation, ErrorPhase(err))
+
+	// native fluentd includes are passed through
+	native := "@include /etc/fluentd/secrets.conf\n@include foo.conf\n@include conf.d/*.conf\n@include http://example.com/fluent.conf\n@include parsers/json"
+	resolved, err = ResolveIncludes(native, snippets)
+	assert.Nil(t, err)
+	assert.Equal(t, "@include /etc/fluentd/secrets.conf\n@include foo.conf\n@include conf.d/*.conf\n@include http://example.com/fluent.conf\n"+
+		"# from @include parsers/json\n<filter **>\n  @type parser\n  key_name log\n"+
+		"# from @include parsers/parse\n<parse>\n  @type json\n</parse>\n</filter>", resolved)
+
+	// without snippets every @include is left to fluentd
+	resolved, err = ResolveIncludes("@include parsers/json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "@include parsers/json", resolved)
+
+	deep := staticSnippets{}
+	for _, level := range []string{"1", "2", "3", "4", "5"} {
+		deep["deep/"+level] = "@include deep/" + level + "0"
+		deep["deep/"+level+"0"] = "@include deep/" + string(level[0]+1)
+	}
+	_, err = ResolveIncludes("@include deep/1", deep)
+	assert.Contains(t, err.Error(), "nested more than 5 levels deep")
+}
+
+func TestSharedSnippets(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.Nil(t, indexer.Add(&core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "parsers", Namespace: "logging"},
+		Data:       map[string]string{"json": "<parse>\n  @type json\n</parse>"},
+	}))
+
+	d := &kubeInformerConnection{
+		snippets: &sharedSnippets{namespace: "logging", lister: listerv1.NewConfigMapLister(indexer)},
+	}
+	snippet, ok, err := d.Snippet("parsers", "json")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "<parse>\n  @type json\n</parse>", snippet)
+
+	_, ok, err = d.Snippet("parsers", "xml")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, ok, err = d.Snippet("other", "json")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	d.snippets = nil
+	_, _, err = d.Snippet("parsers", "json")
+	assert.Equal(t, ErrorPhaseValidation, ErrorPhase(err))
+}
@@ -0,0 +1,87 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Severities of a StatusAnnotation
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// longer status messages are truncated, all the annotations of an object must fit in 256KiB
+var maxStatusMessageLength = 16 * 1024
+
+const truncatedSuffix = "... (truncated)"
+
+// StatusAnnotation is the value of the status annotation with --status-format=json
+type StatusAnnotation struct {
+	Status      string `json:"status"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message,omitempty"`
+	LastUpdated string `json:"lastUpdated"`
+	ConfigHash  string `json:"configHash,omitempty"`
+}
+
+// NewStatusAnnotation makes the structured status of a plain status message. Like in the
+// plain annotation an empty message means ok and the warnings and disabled namespaces start with
+// "warning:" and "disabled:", any other message is an error
+func NewStatusAnnotation(message string, configHash string) *StatusAnnotation {
+	st := &StatusAnnotation{
+		Message:     TruncateStatus(message),
+		LastUpdated: time.Now().UTC().Format(time.RFC3339),
+		ConfigHash:  configHash,
+	}
+
+	switch {
+	case message == "":
+		st.Status, st.Severity = StatusOK, SeverityInfo
+	case strings.HasPrefix(message, "warning:"):
+		st.Status, st.Severity = StatusWarning, SeverityWarning
+	case strings.HasPrefix(message, "disabled:"):
+		st.Status, st.Severity = StatusDisabled, SeverityInfo
+	default:
+		st.Status, st.Severity = StatusError, SeverityError
+	}
+
+	return st
+}
+
+func (st *StatusAnnotation) String() string {
+	js, _ := json.Marshal(st)
+	return string(js)
+}
+
+// ParseStatusAnnotation reads a status annotation in either format. A plain status, e.g. written
+// before --status-format=json was set, has no timestamp nor config hash
+func ParseStatusAnnotation(value string) *StatusAnnotation {
+	st := &StatusAnnotation{}
+	if strings.HasPrefix(value, "{") && json.Unmarshal([]byte(value), st) == nil && st.Status != "" {
+		return st
+	}
+
+	st = NewStatusAnnotation(value, "")
+	st.LastUpdated = ""
+	return st
+}
+
+// TruncateStatus shortens a status message to at most maxStatusMessageLength bytes
+func TruncateStatus(message string) string {
+	if len(message) <= maxStatusMessageLength {
+		return message
+	}
+
+	cut := maxStatusMessageLength - len(truncatedSuffix)
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + truncatedSuffix
+}
@@ -0,0 +1,59 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package datasource
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStatusAnnotation(t *testing.T) {
+	tests := []struct {
+		message  string
+		status   string
+		severity string
+	}{
+		{"", StatusOK, SeverityInfo},
+		{"warning: no <match> routes the tags kube.demo.app", StatusWarning, SeverityWarning},
+		{"disabled: logging disabled by the cluster admin, the logs are dropped", StatusDisabled, SeverityInfo},
+		{"bad tag for <match>: hello-world", StatusError, SeverityError},
+	}
+
+	for _, test := range tests {
+		st := NewStatusAnnotation(test.message, "abc")
+		assert.Equal(t, test.status, st.Status)
+		assert.Equal(t, test.severity, st.Severity)
+		assert.Equal(t, test.message, st.Message)
+		assert.Equal(t, "abc", st.ConfigHash)
+		_, err := time.Parse(time.RFC3339, st.LastUpdated)
+		assert.Nil(t, err)
+	}
+}
+
+func TestParseStatusAnnotation(t *testing.T) {
+	st := NewStatusAnnotation("bad tag for <match>: hello-world", "abc")
+	assert.Equal(t, st, ParseStatusAnnotation(st.String()))
+
+	// the plain format is read too
+	assert.Equal(t, &StatusAnnotation{
+		Status:   StatusWarning,
+		Severity: SeverityWarning,
+		Message:  "warning: rolled back",
+	}, ParseStatusAnnotation("warning: rolled back"))
+	assert.Equal(t, StatusError, ParseStatusAnnotation("{not json").Status)
+}
+
+func TestTruncateStatus(t *testing.T) {
+	defer func(n int) { maxStatusMessageLength = n }(maxStatusMessageLength)
+	maxStatusMessageLength = 20
+
+	assert.Equal(t, "short", TruncateStatus("short"))
+
+	truncated := TruncateStatus(strings.Repeat("é", 20))
+	assert.True(t, len(truncated) <= 20)
+	assert.Equal(t, "éé"+truncatedSuffix, truncated)
+}
@@ -0,0 +1,122 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// how often the monitor_agent is polled while waiting for the buffers to drain
+var drainPollInterval = time.Second
+
+// monitorAgentBuffer is the buffer state of a plugin entry of the monitor_agent /api/plugins.json
+type monitorAgentBuffer struct {
+	PluginID              string   `json:"plugin_id"`
+	BufferQueueLength     *float64 `json:"buffer_queue_length"`
+	BufferTotalQueuedSize *float64 `json:"buffer_total_queued_size"`
+}
+
+func (b *monitorAgentBuffer) empty() bool {
+	if b.BufferTotalQueuedSize != nil {
+		return *b.BufferTotalQueuedSize == 0
+	}
+	return b.BufferQueueLength == nil || *b.BufferQueueLength == 0
+}
+
+// DrainBuffers asks fluentd to flush all its buffers and waits until the buffers of the
+// outputs with the given ids are empty according to the monitor_agent at monitorURL.
+// It gives up after timeout, the data still buffered may then be lost by the reload. If r is nil does nothing
+func (r *Reloader) DrainBuffers(ctx context.Context, monitorURL string, outputIDs []string, timeout time.Duration) error {
+	if r == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// the requests are bounded by ctx: the flush by the whole timeout, a poll by drainPollInterval
+	client := &http.Client{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/api/plugins.flushBuffers", r.port), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot ask fluentd to flush its buffers: %+v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fluentd refused to flush its buffers, got HTTP status %d", resp.StatusCode)
+	}
+
+	for {
+		pending, err := pendingBuffers(ctx, client, monitorURL, outputIDs)
+		if err != nil {
+			logrus.Debugf("Cannot read the buffers from the monitor_agent at %s: %+v", monitorURL, err)
+		} else if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("buffers not drained after %v, cannot read them: %+v", timeout, err)
+			}
+			return fmt.Errorf("buffers of %s not drained after %v", strings.Join(pending, ", "), timeout)
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+// pendingBuffers lists the outputs among outputIDs whose buffer is not empty
+func pendingBuffers(ctx context.Context, client *http.Client, url string, outputIDs []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, drainPollInterval)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	body := struct {
+		Plugins []monitorAgentBuffer `json:"plugins"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("bad response: %+v", err)
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range outputIDs {
+		wanted[id] = true
+	}
+
+	pending := []string{}
+	for _, p := range body.Plugins {
+		if wanted[p.PluginID] && !p.empty() {
+			pending = append(pending, p.PluginID)
+		}
+	}
+	sort.Strings(pending)
+
+	return pending, nil
+}
@@ -0,0 +1,93 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFluentd serves the flush RPC and a monitor_agent whose buffer of output "kfo-a-1"
+// is empty from the given poll on
+func fakeFluentd(t *testing.T, emptyAfter int32) (*Reloader, string, *int32) {
+	flushed := int32(0)
+	polls := int32(0)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/plugins.flushBuffers":
+			atomic.AddInt32(&flushed, 1)
+		case "/api/plugins.json":
+			queued := 1024
+			if atomic.AddInt32(&polls, 1) > emptyAfter {
+				queued = 0
+			}
+			fmt.Fprintf(w, `{"plugins": [
+  {"plugin_id": "kfo-a-1", "buffer_queue_length": 1, "buffer_total_queued_size": %d},
+  {"plugin_id": "kfo-b-1", "buffer_queue_length": 3, "buffer_total_queued_size": 4096},
+  {"plugin_id": "in_tail_container_logs"}
+]}`, queued)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return NewReloader(context.Background(), port), srv.URL + "/api/plugins.json", &flushed
+}
+
+func TestDrainBuffers(t *testing.T) {
+	drainPollInterval = 10 * time.Millisecond
+	defer func() { drainPollInterval = time.Second }()
+
+	r, monitorURL, flushed := fakeFluentd(t, 2)
+	err := r.DrainBuffers(context.Background(), monitorURL, []string{"kfo-a-1"}, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(flushed))
+}
+
+func TestDrainBuffersTimeout(t *testing.T) {
+	drainPollInterval = 10 * time.Millisecond
+	defer func() { drainPollInterval = time.Second }()
+
+	r, monitorURL, _ := fakeFluentd(t, 0)
+	err := r.DrainBuffers(context.Background(), monitorURL, []string{"kfo-a-1", "kfo-b-1"}, 50*time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "buffers of kfo-b-1 not drained")
+}
+
+func TestNullReloaderDrain(t *testing.T) {
+	var r *Reloader
+	assert.Nil(t, r.DrainBuffers(context.Background(), "", []string{"kfo-a-1"}, time.Second))
+}
+
+func TestDrainBuffersStuckFlush(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	r := NewReloader(context.Background(), port)
+
+	start := time.Now()
+	err := r.DrainBuffers(context.Background(), srv.URL+"/api/plugins.json", []string{"kfo-a-1"}, 50*time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot ask fluentd to flush its buffers")
+	assert.True(t, time.Since(start) < time.Second)
+}
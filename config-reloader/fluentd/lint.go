@@ -0,0 +1,177 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lint severities, from the most to the least severe. Only errors prevent a config from being applied
+const (
+	LintError = "error"
+	LintWarn  = "warn"
+	LintInfo  = "info"
+)
+
+var lintSeverityRank = map[string]int{
+	LintError: 0,
+	LintWarn:  1,
+	LintInfo:  2,
+}
+
+// LintFinding is an issue found in a config by a LintRule
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (f *LintFinding) String() string {
+	return fmt.Sprintf("[%s] %s", f.Rule, f.Message)
+}
+
+// LintRule checks a single directive, every directive of a config is checked including the nested ones.
+// Check returns a message per issue
+type LintRule struct {
+	Name     string
+	Severity string
+	Check    func(d *Directive) []string
+}
+
+// deprecatedParams are v0.12 params with their v1 replacement
+var deprecatedParams = map[string]string{
+	"format":             "use a <parse> or <format> section",
+	"buffer_type":        "use @type in a <buffer> section",
+	"buffer_path":        "use path in a <buffer> section",
+	"buffer_chunk_limit": "use chunk_limit_size in a <buffer> section",
+	"buffer_queue_limit": "use queue_limit_length in a <buffer> section",
+	"num_threads":        "use flush_thread_count in a <buffer> section",
+}
+
+// LintRules is the default rule set, append to it to add rules
+var LintRules = []*LintRule{
+	{
+		Name:     "copy-without-store",
+		Severity: LintError,
+		Check: func(d *Directive) []string {
+			if d.Name != "match" || d.Type() != "copy" {
+				return nil
+			}
+			for _, n := range d.Nested {
+				if n.Name == "store" {
+					return nil
+				}
+			}
+			return []string{"a copy output without <store> drops every record"}
+		},
+	},
+	{
+		Name:     "deprecated-param",
+		Severity: LintWarn,
+		Check: func(d *Directive) []string {
+			if d.Name != "source" && d.Name != "match" && d.Name != "filter" && d.Name != "store" {
+				return nil
+			}
+
+			res := []string{}
+			if d.Params["type"] != nil && d.Params["@type"] == nil {
+				res = append(res, "type is deprecated, use @type")
+			}
+			if d.Params["flush_interval"] != nil && d.Name != "source" {
+				res = append(res, "flush_interval is deprecated here, use flush_interval in a <buffer> section")
+			}
+			for name, advice := range deprecatedParams {
+				if d.Params[name] != nil {
+					res = append(res, fmt.Sprintf("%s is deprecated, %s", name, advice))
+				}
+			}
+			sort.Strings(res)
+			return res
+		},
+	},
+	{
+		Name:     "tail-pos-file",
+		Severity: LintWarn,
+		Check: func(d *Directive) []string {
+			if d.Name != "source" || d.Type() != "tail" || d.Param("pos_file") != "" {
+				return nil
+			}
+			return []string{"tail without pos_file reads the files again from the start after every restart"}
+		},
+	},
+	{
+		Name:     "buffer-flush-interval",
+		Severity: LintInfo,
+		Check: func(d *Directive) []string {
+			if d.Name != "buffer" || d.Param("flush_interval") != "" {
+				return nil
+			}
+			if mode := d.Param("flush_mode"); mode == "immediate" || mode == "lazy" {
+				return nil
+			}
+			return []string{"flush_interval is not set, the buffer is flushed every 60s"}
+		},
+	},
+}
+
+// LintSeverityEnabled tells if findings of the given severity are reported with the given lint level
+func LintSeverityEnabled(severity string, level string) bool {
+	levelRank, ok := lintSeverityRank[level]
+	if !ok {
+		return false
+	}
+
+	return lintSeverityRank[severity] <= levelRank
+}
+
+// Lint runs the rules in the order given over every directive in the fragment. Only the findings
+// at least as severe as level are returned
+func Lint(fragment Fragment, rules []*LintRule, level string) []*LintFinding {
+	enabled := []*LintRule{}
+	for _, rule := range rules {
+		if LintSeverityEnabled(rule.Severity, level) {
+			enabled = append(enabled, rule)
+		}
+	}
+
+	res := []*LintFinding{}
+	lintFragment(fragment, enabled, &res)
+	return res
+}
+
+func lintFragment(fragment Fragment, rules []*LintRule, res *[]*LintFinding) {
+	for _, d := range fragment {
+		location := "<" + d.Name
+		if d.Tag != "" {
+			location += " " + d.Tag
+		}
+		location += ">"
+
+		for _, rule := range rules {
+			for _, msg := range rule.Check(d) {
+				*res = append(*res, &LintFinding{
+					Rule:     rule.Name,
+					Severity: rule.Severity,
+					Message:  location + ": " + msg,
+				})
+			}
+		}
+
+		lintFragment(d.Nested, rules, res)
+	}
+}
+
+// LintMessage joins the findings of the given severity, empty if there is none
+func LintMessage(findings []*LintFinding, severity string) string {
+	msgs := []string{}
+	for _, f := range findings {
+		if f.Severity == severity {
+			msgs = append(msgs, f.String())
+		}
+	}
+
+	return strings.Join(msgs, ", ")
+}
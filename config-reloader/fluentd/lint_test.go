@@ -0,0 +1,73 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const lintConfig = `
+<source>
+  @type tail
+  path /var/log/app.log
+  format json
+</source>
+
+<match app.**>
+  @type copy
+</match>
+
+<match other.**>
+  @type elasticsearch
+  <buffer>
+    @type file
+  </buffer>
+</match>
+`
+
+func TestLint(t *testing.T) {
+	fragment, err := ParseString(lintConfig)
+	assert.Nil(t, err)
+
+	findings := Lint(fragment, LintRules, LintInfo)
+	assert.Equal(t, []*LintFinding{
+		{Rule: "deprecated-param", Severity: LintWarn, Message: "<source>: format is deprecated, use a <parse> or <format> section"},
+		{Rule: "tail-pos-file", Severity: LintWarn, Message: "<source>: tail without pos_file reads the files again from the start after every restart"},
+		{Rule: "copy-without-store", Severity: LintError, Message: "<match app.**>: a copy output without <store> drops every record"},
+		{Rule: "buffer-flush-interval", Severity: LintInfo, Message: "<buffer>: flush_interval is not set, the buffer is flushed every 60s"},
+	}, findings)
+
+	findings = Lint(fragment, LintRules, LintWarn)
+	assert.Len(t, findings, 3)
+
+	findings = Lint(fragment, LintRules, LintError)
+	assert.Len(t, findings, 1)
+	assert.Equal(t, "[copy-without-store] <match app.**>: a copy output without <store> drops every record", LintMessage(findings, LintError))
+	assert.Equal(t, "", LintMessage(findings, LintWarn))
+
+	assert.Empty(t, Lint(fragment, LintRules, "off"))
+}
+
+func TestLintCustomRule(t *testing.T) {
+	fragment, err := ParseString("<match **>\n  @type stdout\n</match>\n")
+	assert.Nil(t, err)
+
+	rules := append(LintRules, &LintRule{
+		Name:     "no-stdout",
+		Severity: LintWarn,
+		Check: func(d *Directive) []string {
+			if d.Type() == "stdout" {
+				return []string{"stdout is for debugging only"}
+			}
+			return nil
+		},
+	})
+
+	findings := Lint(fragment, rules, LintWarn)
+	assert.Equal(t, []*LintFinding{
+		{Rule: "no-stdout", Severity: LintWarn, Message: "<match **>: stdout is for debugging only"},
+	}, findings)
+}
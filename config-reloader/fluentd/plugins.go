@@ -0,0 +1,69 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+)
+
+// matches the "name (1.2.3, 1.0.0)" lines of gem list, versions may be prefixed with "default: "
+var reGemLine = regexp.MustCompile(`^([A-Za-z0-9_.-]+) \(([^)]*)\)$`)
+
+// ParseGemList extracts the fluentd and fluentd plugin versions from the output of gem list.
+// When several versions of a gem are installed the first (most recent) one is used
+func ParseGemList(output string) map[string]string {
+	res := map[string]string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		m := reGemLine.FindStringSubmatch(util.Trim(line))
+		if m == nil {
+			continue
+		}
+
+		name := m[1]
+		if name != "fluentd" && !strings.HasPrefix(name, "fluent-plugin-") {
+			continue
+		}
+
+		version := util.Trim(strings.Split(m[2], ",")[0])
+		version = util.Trim(strings.TrimPrefix(version, "default:"))
+		res[name] = version
+	}
+
+	return res
+}
+
+// InstalledPluginVersions lists the installed fluentd plugins using the fluent-gem binary
+func InstalledPluginVersions(gemCommand string, timeout time.Duration) (map[string]string, error) {
+	out, err := util.ExecAndGetOutput(gemCommand, timeout, "list", "--local")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list installed plugins: %v: %s", err, out)
+	}
+
+	return ParseGemList(out), nil
+}
+
+// FindPluginDrift describes every expected plugin that is missing or installed with another version
+func FindPluginDrift(installed map[string]string, expected map[string]string) []string {
+	res := []string{}
+
+	for name, version := range expected {
+		actual, ok := installed[name]
+		switch {
+		case !ok:
+			res = append(res, fmt.Sprintf("%s: expected %s but it is not installed", name, version))
+		case actual != version:
+			res = append(res, fmt.Sprintf("%s: expected %s but %s is installed", name, version, actual))
+		}
+	}
+
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,48 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGemList(t *testing.T) {
+	out := `
+*** LOCAL GEMS ***
+
+bigdecimal (default: 3.1.1)
+fluent-plugin-elasticsearch (5.1.4, 5.0.3)
+fluent-plugin-kafka (0.17.3)
+fluentd (default: 1.14.4)
+json (2.6.1, default: 2.5.1)
+`
+	versions := ParseGemList(out)
+	assert.Equal(t, map[string]string{
+		"fluent-plugin-elasticsearch": "5.1.4",
+		"fluent-plugin-kafka":         "0.17.3",
+		"fluentd":                     "1.14.4",
+	}, versions)
+}
+
+func TestFindPluginDrift(t *testing.T) {
+	installed := map[string]string{
+		"fluent-plugin-elasticsearch": "5.1.4",
+		"fluent-plugin-kafka":         "0.17.3",
+	}
+
+	expected := map[string]string{
+		"fluent-plugin-elasticsearch": "5.0.3",
+		"fluent-plugin-kafka":         "0.17.3",
+		"fluent-plugin-s3":            "1.6.1",
+	}
+
+	assert.Equal(t, []string{
+		"fluent-plugin-elasticsearch: expected 5.0.3 but 5.1.4 is installed",
+		"fluent-plugin-s3: expected 1.6.1 but it is not installed",
+	}, FindPluginDrift(installed, expected))
+
+	assert.Empty(t, FindPluginDrift(installed, nil))
+}
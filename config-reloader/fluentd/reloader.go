@@ -7,10 +7,18 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	reloadFailureConnection = "connection"
+	reloadFailureStatus     = "status"
+)
+
 // Reloader sends a reload signal to fluentd
 type Reloader struct {
 	port int
@@ -29,9 +37,21 @@ func (r *Reloader) ReloadConfiguration() {
 		logrus.Infof("Not reloading fluentd (fake or filesystem datasource used)")
 		return
 	}
-	_, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/api/config.gracefulReload", r.port), "application/json", nil)
+	metrics.IncReloadAttemptsMetric()
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/api/config.gracefulReload", r.port), "application/json", nil)
 
 	if err != nil {
+		metrics.IncReloadFailuresMetric(reloadFailureConnection)
 		logrus.Errorf("cannot notify fluentd: %+v", err)
+		return
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		metrics.IncReloadFailuresMetric(reloadFailureStatus)
+		logrus.Errorf("fluentd refused to reload, got HTTP status %d", resp.StatusCode)
+		return
+	}
+
+	metrics.SetLastReloadTime(time.Now())
 }
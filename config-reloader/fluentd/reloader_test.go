@@ -6,10 +6,16 @@ package fluentd
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,3 +64,77 @@ func TestReloaderCalls(t *testing.T) {
 
 	assert.Equal(t, 3, counter)
 }
+
+var initMetrics sync.Once
+
+// gatheredValue reads the value of a counter or gauge of the default registry, 0 if there is no
+// series with the given labels
+func gatheredValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metric:
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue metric
+				}
+			}
+			if m.GetCounter() != nil {
+				return m.GetCounter().GetValue()
+			}
+			return m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestReloaderMetrics(t *testing.T) {
+	// registers the metrics with the default registry, served on a free port
+	initMetrics.Do(func() {
+		assert.Nil(t, metrics.InitMetrics(0, nil))
+	})
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	r := NewReloader(context.Background(), server.Listener.Addr().(*net.TCPAddr).Port)
+	attempts := func() float64 { return gatheredValue(t, "kube_fluentd_operator_reload_attempts_total", nil) }
+	failures := func(reason string) float64 {
+		return gatheredValue(t, "kube_fluentd_operator_reload_failures_total", map[string]string{"reason": reason})
+	}
+	sinceLastReload := func() float64 {
+		return gatheredValue(t, "kube_fluentd_operator_seconds_since_last_reload", nil)
+	}
+
+	// a successful reload resets the age of the last reload
+	metrics.SetLastReloadTime(time.Now().Add(-time.Hour))
+	assert.True(t, sinceLastReload() >= 3600)
+	before := attempts()
+	r.ReloadConfiguration()
+	assert.Equal(t, before+1, attempts())
+	assert.True(t, sinceLastReload() < 60)
+
+	// a refused reload counts as a status failure and keeps the last reload time
+	metrics.SetLastReloadTime(time.Now().Add(-time.Hour))
+	status = http.StatusInternalServerError
+	before, beforeFailures := attempts(), failures(reloadFailureStatus)
+	r.ReloadConfiguration()
+	assert.Equal(t, before+1, attempts())
+	assert.Equal(t, beforeFailures+1, failures(reloadFailureStatus))
+	assert.True(t, sinceLastReload() >= 3600)
+
+	// fluentd not listening is a connection failure
+	server.Close()
+	before, beforeFailures = attempts(), failures(reloadFailureConnection)
+	r.ReloadConfiguration()
+	assert.Equal(t, before+1, attempts())
+	assert.Equal(t, beforeFailures+1, failures(reloadFailureConnection))
+}
@@ -0,0 +1,247 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RoutingGraphNote labels every routing graph, it is derived from the config and not observed
+const RoutingGraphNote = "Best-effort view of the routing derived from the generated config. " +
+	"Tags emitted using placeholders are guessed, fluentd may route records differently"
+
+// kinds of RoutingNode
+const (
+	RoutingNodeInput     = "input"
+	RoutingNodeFilter    = "filter"
+	RoutingNodeMatch     = "match"
+	RoutingNodeUnmatched = "unmatched"
+)
+
+// stop following re-emitted tags after this many steps, e.g. when a <match> re-emits to itself
+const maxRoutingSteps = 1000
+
+// RoutingNode is an input tag or a directive records pass through
+type RoutingNode struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Directive string `json:"directive"`
+	Type      string `json:"type,omitempty"`
+	Label     string `json:"label,omitempty"`
+}
+
+// RoutingEdge tells that records with Tag go from one node to the other
+type RoutingEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Tag  string `json:"tag"`
+}
+
+// RoutingGraph follows records with the given input tags through the <filter> and <match>
+// directives of a config: every matching <filter> in order, then the first matching <match>.
+// Records relabeled with @label or re-emitted under a new tag are followed too
+type RoutingGraph struct {
+	Note  string         `json:"note"`
+	Nodes []*RoutingNode `json:"nodes"`
+	Edges []*RoutingEdge `json:"edges"`
+}
+
+type routingGraphBuilder struct {
+	graph  *RoutingGraph
+	scopes map[string]Fragment
+	ids    map[*Directive]string
+	edges  map[RoutingEdge]bool
+	seen   map[string]bool
+	// unmatched nodes by label
+	unmatched map[string]string
+}
+
+// BuildRoutingGraph returns the routing graph of records tagged with inputs through the fragment
+func BuildRoutingGraph(fragment Fragment, inputs []string) *RoutingGraph {
+	b := &routingGraphBuilder{
+		graph:     &RoutingGraph{Note: RoutingGraphNote, Nodes: []*RoutingNode{}, Edges: []*RoutingEdge{}},
+		scopes:    map[string]Fragment{},
+		ids:       map[*Directive]string{},
+		edges:     map[RoutingEdge]bool{},
+		seen:      map[string]bool{},
+		unmatched: map[string]string{},
+	}
+
+	for _, d := range fragment {
+		switch d.Name {
+		case "filter", "match":
+			b.scopes[""] = append(b.scopes[""], d)
+		case "label":
+			for _, nested := range d.Nested {
+				if nested.Name == "filter" || nested.Name == "match" {
+					b.scopes[d.Tag] = append(b.scopes[d.Tag], nested)
+				}
+			}
+		}
+	}
+
+	for i, tag := range inputs {
+		id := fmt.Sprintf("in%d", i)
+		b.graph.Nodes = append(b.graph.Nodes, &RoutingNode{ID: id, Kind: RoutingNodeInput, Directive: tag})
+		b.route(id, tag, "")
+	}
+
+	return b.graph
+}
+
+func (b *routingGraphBuilder) node(d *Directive, label string) string {
+	if id, ok := b.ids[d]; ok {
+		return id
+	}
+
+	id := fmt.Sprintf("n%d", len(b.ids))
+	b.ids[d] = id
+	b.graph.Nodes = append(b.graph.Nodes, &RoutingNode{
+		ID:        id,
+		Kind:      d.Name,
+		Directive: fmt.Sprintf("<%s %s>", d.Name, d.Tag),
+		Type:      d.Type(),
+		Label:     label,
+	})
+
+	return id
+}
+
+func (b *routingGraphBuilder) unmatchedNode(label string) string {
+	if id, ok := b.unmatched[label]; ok {
+		return id
+	}
+
+	id := fmt.Sprintf("u%d", len(b.unmatched))
+	b.unmatched[label] = id
+	b.graph.Nodes = append(b.graph.Nodes, &RoutingNode{
+		ID:        id,
+		Kind:      RoutingNodeUnmatched,
+		Directive: "no matching <match>, records are dropped",
+		Label:     label,
+	})
+
+	return id
+}
+
+func (b *routingGraphBuilder) edge(from, to, tag string) {
+	e := RoutingEdge{From: from, To: to, Tag: tag}
+	if b.edges[e] {
+		return
+	}
+
+	b.edges[e] = true
+	b.graph.Edges = append(b.graph.Edges, &e)
+}
+
+func (b *routingGraphBuilder) route(from, tag, label string) {
+	key := from + " " + tag + " " + label
+	if b.seen[key] || len(b.seen) >= maxRoutingSteps {
+		return
+	}
+	b.seen[key] = true
+
+	prev := from
+	for _, d := range b.scopes[label] {
+		if !TagMatches(d.Tag, tag) {
+			continue
+		}
+
+		id := b.node(d, label)
+		b.edge(prev, id, tag)
+		if d.Name == "filter" {
+			prev = id
+			continue
+		}
+
+		b.emit(id, d, tag, label)
+		return
+	}
+
+	b.edge(prev, b.unmatchedNode(label), tag)
+}
+
+// emit follows the records a <match> (or one of its <store> or <rule>) sends elsewhere
+func (b *routingGraphBuilder) emit(from string, d *Directive, tag, label string) {
+	if l := d.Param("@label"); l != "" {
+		b.route(from, tag, l)
+	}
+
+	if t := d.Param("tag"); t != "" {
+		b.route(from, guessTag(t, tag), label)
+	}
+
+	newTag := tag
+	if p := d.Param("remove_tag_prefix"); p != "" {
+		newTag = strings.TrimPrefix(strings.TrimPrefix(newTag, p), ".")
+	}
+	if p := d.Param("add_tag_prefix"); p != "" {
+		newTag = p + "." + newTag
+	}
+	if newTag != tag {
+		b.route(from, newTag, label)
+	}
+
+	for _, nested := range d.Nested {
+		if nested.Name == "store" || nested.Name == "rule" || nested.Name == "route" {
+			b.emit(from, nested, tag, label)
+		}
+	}
+}
+
+var reTagPart = regexp.MustCompile(`\$\{tag_parts\[(\d+)\]\}`)
+var rePlaceholder = regexp.MustCompile(`\$\{[^}]*\}|\$\d+|__[A-Z_]+__`)
+
+// guessTag replaces the placeholders of an emitted tag: the ones referring to the current tag
+// are resolved, the ones depending on the record become x
+func guessTag(emitted string, tag string) string {
+	parts := strings.Split(tag, ".")
+
+	res := strings.ReplaceAll(emitted, "${tag}", tag)
+	res = strings.ReplaceAll(res, "__TAG__", tag)
+	res = reTagPart.ReplaceAllStringFunc(res, func(s string) string {
+		i, _ := strconv.Atoi(reTagPart.FindStringSubmatch(s)[1])
+		if i < len(parts) {
+			return parts[i]
+		}
+		return "x"
+	})
+
+	return rePlaceholder.ReplaceAllString(res, "x")
+}
+
+// DOT renders the graph in the graphviz format
+func (g *RoutingGraph) DOT() string {
+	shapes := map[string]string{
+		RoutingNodeInput:     "ellipse",
+		RoutingNodeFilter:    "box",
+		RoutingNodeMatch:     "box3d",
+		RoutingNodeUnmatched: "plaintext",
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteString("digraph routing {\n")
+	fmt.Fprintf(buf, "  label=%s;\n", strconv.Quote(g.Note))
+
+	for _, n := range g.Nodes {
+		text := n.Directive
+		if n.Type != "" {
+			text += "\n@type " + n.Type
+		}
+		if n.Label != "" {
+			text += "\nin <label " + n.Label + ">"
+		}
+		fmt.Fprintf(buf, "  %s [shape=%s, label=%s];\n", n.ID, shapes[n.Kind], strconv.Quote(text))
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(buf, "  %s -> %s [label=%s];\n", e.From, e.To, strconv.Quote(e.Tag))
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
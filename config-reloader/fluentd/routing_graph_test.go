@@ -0,0 +1,115 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func edgesOf(g *RoutingGraph) []string {
+	directives := map[string]string{}
+	for _, n := range g.Nodes {
+		directives[n.ID] = n.Directive
+	}
+
+	res := []string{}
+	for _, e := range g.Edges {
+		res = append(res, directives[e.From]+" -> "+directives[e.To]+" ["+e.Tag+"]")
+	}
+	return res
+}
+
+func TestBuildRoutingGraph(t *testing.T) {
+	s := `
+<filter kube.demo.**>
+  @type record_transformer
+</filter>
+
+<filter kube.other.**>
+  @type grep
+</filter>
+
+<match kube.demo.web.*>
+  @type rewrite_tag_filter
+  <rule>
+    key level
+    pattern /^(ERROR)$/
+    tag ${tag}.$1
+  </rule>
+</match>
+
+<match kube.demo.web.*.*>
+  @type relabel
+  @label @alerts
+</match>
+
+<match kube.demo.**>
+  @type elasticsearch
+</match>
+
+<label @alerts>
+  <match **>
+    @type slack
+  </match>
+</label>
+`
+	fragment, err := ParseString(s)
+	assert.Nil(t, err)
+
+	g := BuildRoutingGraph(fragment, []string{"kube.demo.web.nginx", "kube.demo.db.postgres", "systemd.kubelet"})
+	assert.Equal(t, RoutingGraphNote, g.Note)
+
+	assert.Equal(t, []string{
+		"kube.demo.web.nginx -> <filter kube.demo.**> [kube.demo.web.nginx]",
+		"<filter kube.demo.**> -> <match kube.demo.web.*> [kube.demo.web.nginx]",
+		"<match kube.demo.web.*> -> <filter kube.demo.**> [kube.demo.web.nginx.x]",
+		"<filter kube.demo.**> -> <match kube.demo.web.*.*> [kube.demo.web.nginx.x]",
+		"<match kube.demo.web.*.*> -> <match **> [kube.demo.web.nginx.x]",
+		"kube.demo.db.postgres -> <filter kube.demo.**> [kube.demo.db.postgres]",
+		"<filter kube.demo.**> -> <match kube.demo.**> [kube.demo.db.postgres]",
+		"systemd.kubelet -> no matching <match>, records are dropped [systemd.kubelet]",
+	}, edgesOf(g))
+
+	for _, n := range g.Nodes {
+		if n.Directive == "<match **>" {
+			assert.Equal(t, "@alerts", n.Label)
+			assert.Equal(t, "slack", n.Type)
+		}
+	}
+}
+
+func TestBuildRoutingGraphStopsOnLoops(t *testing.T) {
+	s := `
+<match **>
+  @type record_reformer
+  tag ${tag}.again
+</match>
+`
+	fragment, err := ParseString(s)
+	assert.Nil(t, err)
+
+	g := BuildRoutingGraph(fragment, []string{"a"})
+	assert.Equal(t, 2, len(g.Nodes))
+	assert.True(t, len(g.Edges) <= maxRoutingSteps+1)
+}
+
+func TestGuessTag(t *testing.T) {
+	assert.Equal(t, "kube.demo.web.nginx.x", guessTag("${tag}.$1", "kube.demo.web.nginx"))
+	assert.Equal(t, "demo.nginx", guessTag("${tag_parts[1]}.${tag_parts[3]}", "kube.demo.web.nginx"))
+	assert.Equal(t, "kube.x.x", guessTag("kube.${record['ns']}.${tag_parts[9]}", "a.b"))
+}
+
+func TestRoutingGraphDOT(t *testing.T) {
+	fragment, err := ParseString("<match kube.**>\n  @type null\n</match>\n")
+	assert.Nil(t, err)
+
+	dot := BuildRoutingGraph(fragment, []string{"kube.a.b.c"}).DOT()
+	assert.True(t, strings.HasPrefix(dot, "digraph routing {\n"))
+	assert.Contains(t, dot, "Best-effort")
+	assert.Contains(t, dot, `n0 [shape=box3d, label="<match kube.**>\n@type null"];`)
+	assert.Contains(t, dot, `in0 -> n0 [label="kube.a.b.c"];`)
+}
@@ -0,0 +1,201 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// reSectionHeader starts a named section of a config: # @section <name> [after=<name>,<name>...]
+var reSectionHeader = regexp.MustCompile(`^\s*#\s*@section\s+(\S+)(?:\s+after=(\S+))?\s*$`)
+
+// Section is a part of a config, from its header up to the next one
+type Section struct {
+	// empty for the text before the first header
+	Name  string
+	After []string
+	Text  string
+}
+
+// SplitSections cuts a config at its section headers
+func SplitSections(config string) []*Section {
+	res := []*Section{}
+	current := &Section{}
+	lines := []string{}
+
+	for _, line := range strings.Split(config, "\n") {
+		header := reSectionHeader.FindStringSubmatch(line)
+		if header == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		current.Text = strings.Join(lines, "\n")
+		if current.Name != "" || strings.TrimSpace(current.Text) != "" {
+			res = append(res, current)
+		}
+
+		current = &Section{Name: header[1]}
+		if header[2] != "" {
+			current.After = strings.Split(header[2], ",")
+		}
+		lines = []string{line}
+	}
+
+	current.Text = strings.Join(lines, "\n")
+	if current.Name != "" || strings.TrimSpace(current.Text) != "" {
+		res = append(res, current)
+	}
+
+	return res
+}
+
+// sectionRank puts sections with sources first, then those with filters, then the others
+func sectionRank(s *Section) (int, error) {
+	fragment, err := ParseString(s.Text)
+	if err != nil {
+		return 0, err
+	}
+
+	rank := 2
+	for _, d := range fragment {
+		switch {
+		case d.Name == "source":
+			rank = 0
+		case d.Name == "filter" && rank > 1:
+			rank = 1
+		}
+	}
+	return rank, nil
+}
+
+// OrderSections reorders the sections of a config so that every section comes after the sections
+// named in its after= list. Among the sections free to go, those with sources come first, then
+// those with filters, then the rest, each in their original order. A config without section headers
+// is returned as is. Unknown dependencies, cycles or sections that don't parse on their own are errors
+func OrderSections(config string) (string, error) {
+	sections := SplitSections(config)
+	if len(sections) < 2 {
+		return config, nil
+	}
+
+	index := map[string]int{}
+	for i, s := range sections {
+		if s.Name == "" {
+			continue
+		}
+		if _, ok := index[s.Name]; ok {
+			return "", fmt.Errorf("section %s is defined twice", s.Name)
+		}
+		index[s.Name] = i
+	}
+
+	ranks := make([]int, len(sections))
+	pending := make([]int, len(sections))
+	dependents := make([][]int, len(sections))
+	for i, s := range sections {
+		rank, err := sectionRank(s)
+		if err != nil {
+			return "", fmt.Errorf("section %s cannot be parsed on its own: %+v", s.Name, err)
+		}
+		ranks[i] = rank
+
+		for _, dep := range s.After {
+			j, ok := index[dep]
+			if !ok {
+				return "", fmt.Errorf("section %s comes after unknown section %s", s.Name, dep)
+			}
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	ready := []int{}
+	for i := range sections {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	ordered := []string{}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(a, b int) bool {
+			if ranks[ready[a]] != ranks[ready[b]] {
+				return ranks[ready[a]] < ranks[ready[b]]
+			}
+			return ready[a] < ready[b]
+		})
+
+		next := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, sections[next].Text)
+
+		for _, j := range dependents[next] {
+			pending[j]--
+			if pending[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	if len(ordered) < len(sections) {
+		cycle := []string{}
+		for i, s := range sections {
+			if pending[i] > 0 {
+				cycle = append(cycle, s.Name)
+			}
+		}
+		return "", fmt.Errorf("dependency cycle between sections %s", strings.Join(cycle, ", "))
+	}
+
+	res := strings.Join(ordered, "\n")
+	if _, err := ParseString(res); err != nil {
+		return "", fmt.Errorf("reordered config is invalid: %+v", err)
+	}
+
+	return res, nil
+}
+
+// MergeSections overlays config on base: a section of config replaces the section of base with the
+// same name, the other sections and the text before the first header of config go after base
+func MergeSections(base string, config string) string {
+	if strings.TrimSpace(base) == "" {
+		return config
+	}
+	if strings.TrimSpace(config) == "" {
+		return base
+	}
+
+	overrides := map[string]*Section{}
+	appended := []string{}
+	for _, s := range SplitSections(config) {
+		if s.Name == "" {
+			appended = append(appended, s.Text)
+		} else {
+			overrides[s.Name] = s
+		}
+	}
+
+	merged := []string{}
+	for _, s := range SplitSections(base) {
+		if o, ok := overrides[s.Name]; ok && s.Name != "" {
+			merged = append(merged, o.Text)
+			delete(overrides, s.Name)
+		} else {
+			merged = append(merged, s.Text)
+		}
+	}
+
+	// keep the order of config for the sections that go after base
+	for _, s := range SplitSections(config) {
+		if _, ok := overrides[s.Name]; ok {
+			appended = append(appended, s.Text)
+		}
+	}
+
+	return strings.Join(append(merged, appended...), "\n")
+}
@@ -0,0 +1,130 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderSections(t *testing.T) {
+	config := `
+# @section ship after=enrich
+<match **>
+  @type elasticsearch
+</match>
+
+# @section enrich
+<filter **>
+  @type record_transformer
+</filter>
+
+# @section files
+<source>
+  @type mounted-file
+  path /var/log/app.log
+  labels app=app
+</source>
+`
+	ordered, err := OrderSections(config)
+	assert.Nil(t, err)
+
+	fragment, err := ParseString(ordered)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(fragment))
+	assert.Equal(t, "source", fragment[0].Name)
+	assert.Equal(t, "filter", fragment[1].Name)
+	assert.Equal(t, "match", fragment[2].Name)
+}
+
+func TestOrderSectionsHonorsDependencies(t *testing.T) {
+	config := `
+# @section audit
+<match audit.**>
+  @type s3
+</match>
+
+# @section late-filter after=audit
+<filter **>
+  @type grep
+</filter>
+`
+	ordered, err := OrderSections(config)
+	assert.Nil(t, err)
+
+	fragment, err := ParseString(ordered)
+	assert.Nil(t, err)
+	// the filter was asked to come after the match, its kind does not override that
+	assert.Equal(t, "match", fragment[0].Name)
+	assert.Equal(t, "filter", fragment[1].Name)
+}
+
+func TestOrderSectionsWithoutHeaders(t *testing.T) {
+	config := "<match **>\n  @type null\n</match>\n<filter **>\n  @type grep\n</filter>\n"
+
+	ordered, err := OrderSections(config)
+	assert.Nil(t, err)
+	assert.Equal(t, config, ordered)
+}
+
+func TestOrderSectionsErrors(t *testing.T) {
+	inputs := []string{
+		// cycle
+		"# @section a after=b\n<match a>\n  @type null\n</match>\n# @section b after=a\n<match b>\n  @type null\n</match>\n",
+		// unknown dependency
+		"# @section a after=c\n<match a>\n  @type null\n</match>\n# @section b\n<match b>\n  @type null\n</match>\n",
+		// twice the same name
+		"# @section a\n<match a>\n  @type null\n</match>\n# @section a\n<match b>\n  @type null\n</match>\n",
+		// a directive split across sections
+		"# @section a\n<label @x>\n# @section b\n</label>\n",
+	}
+
+	for _, config := range inputs {
+		_, err := OrderSections(config)
+		assert.NotNil(t, err, "'%s' must fail", config)
+	}
+}
+
+func TestMergeSections(t *testing.T) {
+	base := `
+# @section parse
+<filter **>
+  @type parser
+</filter>
+
+# @section ship after=parse
+<match **>
+  @type elasticsearch
+</match>
+`
+	// no namespace config: the base as is
+	assert.Equal(t, base, MergeSections(base, ""))
+
+	// replace ship, add audit, drop parse with an empty section
+	config := `
+<filter **>
+  @type record_transformer
+</filter>
+# @section audit
+<match audit.**>
+  @type s3
+</match>
+# @section ship after=parse
+<match **>
+  @type logzio_buffered
+</match>
+# @section parse
+`
+	merged := MergeSections(base, config)
+	fragment, err := ParseString(merged)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(fragment))
+	assert.Equal(t, "logzio_buffered", fragment[0].Type())
+	assert.Equal(t, "record_transformer", fragment[1].Type())
+	assert.Equal(t, "s3", fragment[2].Type())
+
+	// nothing to merge into
+	assert.Equal(t, config, MergeSections("", config))
+}
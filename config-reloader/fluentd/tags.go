@@ -0,0 +1,139 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"regexp"
+	"strings"
+)
+
+// compileTagPattern turns a single fluentd match pattern into a regexp.
+// It follows fluentd's GlobMatchPattern: * matches one tag part, ** matches zero
+// or more tag parts and {a,b} matches any of the alternatives.
+// nolint:gocognit
+func compileTagPattern(pat string) (*regexp.Regexp, error) {
+	var stack [][]string
+	regex := []string{""}
+	dot := false
+
+	appendLast := func(s string) {
+		regex[len(regex)-1] += s
+	}
+
+	for i := 0; i < len(pat); i++ {
+		c := pat[i]
+
+		if c == '\\' && i+1 < len(pat) {
+			appendLast(regexp.QuoteMeta(pat[i+1 : i+2]))
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(pat[i:], "**") {
+			followedByDot := i+2 < len(pat) && pat[i+2] == '.'
+			switch {
+			case dot && followedByDot:
+				appendLast(`\.(?:.*\.)?`)
+			case dot:
+				appendLast(`(?:\..*)?`)
+			case followedByDot:
+				appendLast(`(?:.*\.)?`)
+			default:
+				appendLast(`.*`)
+			}
+			dot = false
+			if followedByDot {
+				i += 2
+			} else {
+				i++
+			}
+			continue
+		}
+
+		if dot {
+			appendLast(`\.`)
+			dot = false
+		}
+
+		switch {
+		case c == '.':
+			dot = true
+		case c == '*':
+			appendLast(`[^.]*`)
+		case c == '{':
+			stack = append(stack, []string{})
+			regex = append(regex, "")
+		case c == '}' && len(stack) > 0:
+			top := stack[len(stack)-1]
+			top = append(top, regex[len(regex)-1])
+			stack = stack[:len(stack)-1]
+			regex = regex[:len(regex)-1]
+			appendLast("(?:" + strings.Join(top, "|") + ")")
+		case c == ',' && len(stack) > 0:
+			stack[len(stack)-1] = append(stack[len(stack)-1], regex[len(regex)-1])
+			regex[len(regex)-1] = ""
+		default:
+			appendLast(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if dot {
+		appendLast(`\.`)
+	}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		top = append(top, regex[len(regex)-1])
+		stack = stack[:len(stack)-1]
+		regex = regex[:len(regex)-1]
+		appendLast("(?:" + strings.Join(top, "|") + ")")
+	}
+
+	return regexp.Compile(`^` + regex[0] + `$`)
+}
+
+// TagMatches reports whether the tag is matched by the space-separated patterns
+// of a <match> or <filter> directive
+func TagMatches(patterns string, tag string) bool {
+	for _, pat := range strings.Fields(patterns) {
+		re, err := compileTagPattern(pat)
+		if err != nil {
+			continue
+		}
+
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindUnroutedTags returns the tags that none of the top-level <match> directives
+// of the fragment consume. Directives inside a <label> are not considered as
+// records only get there after being relabeled. This is a best-effort analysis:
+// a matching <match> counts as routing the tag even if it re-emits it under a new tag.
+func FindUnroutedTags(fragment Fragment, tags []string) []string {
+	res := []string{}
+
+	for _, tag := range tags {
+		if !RoutesTag(fragment, tag) {
+			res = append(res, tag)
+		}
+	}
+
+	return res
+}
+
+// RoutesTag reports whether any top-level <match> directive of the fragment consumes the tag.
+// The same best-effort rules as for FindUnroutedTags apply
+func RoutesTag(fragment Fragment, tag string) bool {
+	for _, dir := range fragment {
+		if dir.Name == "match" && TagMatches(dir.Tag, tag) {
+			return true
+		}
+	}
+
+	return false
+}
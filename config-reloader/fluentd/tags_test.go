@@ -0,0 +1,71 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagMatches(t *testing.T) {
+	matching := [][]string{
+		{"**", "a"},
+		{"**", "a.b.c"},
+		{"a.*", "a.b"},
+		{"a.**", "a"},
+		{"a.**", "a.b.c"},
+		{"a.**.c", "a.c"},
+		{"a.**.c", "a.b.b.c"},
+		{"**.c", "c"},
+		{"**.c", "a.b.c"},
+		{"a.{b,c}.d", "a.c.d"},
+		{"a.{b,c.x}", "a.c.x"},
+		{"kube.ns.*.*", "kube.ns.pod.container"},
+		{"kube.ns.** _proc.kube.ns.**", "_proc.kube.ns.pod.cont"},
+		{"a.b-c", "a.b-c"},
+	}
+
+	for _, m := range matching {
+		assert.True(t, TagMatches(m[0], m[1]), "%s should match %s", m[0], m[1])
+	}
+
+	notMatching := [][]string{
+		{"a.*", "a"},
+		{"a.*", "a.b.c"},
+		{"a.**", "ab"},
+		{"a.**.c", "a.b.d"},
+		{"**.c", "abc"},
+		{"a.{b,c}.d", "a.x.d"},
+		{"kube.ns.*.*", "kube.other.pod.container"},
+		{"a.b", "axb"},
+	}
+
+	for _, m := range notMatching {
+		assert.False(t, TagMatches(m[0], m[1]), "%s should not match %s", m[0], m[1])
+	}
+}
+
+func TestFindUnroutedTags(t *testing.T) {
+	s := `
+<filter kube.ns.web.**>
+  @type stdout
+</filter>
+
+<match kube.ns.api.**>
+  @type null
+</match>
+
+<label @OTHER>
+  <match **>
+    @type null
+  </match>
+</label>
+`
+	fragment, err := ParseString(s)
+	assert.Nil(t, err)
+
+	unrouted := FindUnroutedTags(fragment, []string{"kube.ns.api.nginx", "kube.ns.web.nginx"})
+	assert.Equal(t, []string{"kube.ns.web.nginx"}, unrouted)
+}
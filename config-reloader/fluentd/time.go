@@ -0,0 +1,39 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+}
+
+// ParseTime parses a fluentd time param like 30s, 5m, 1.5h or 2d. A plain number is in seconds
+func ParseTime(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return 0, fmt.Errorf("empty time value")
+	}
+
+	unit := time.Second
+	if u, ok := timeUnits[s[len(s)-1]]; ok {
+		unit = u
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad time value '%s', use a number followed by s, m, h or d", value)
+	}
+
+	return time.Duration(n * float64(unit)), nil
+}
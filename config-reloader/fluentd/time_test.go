@@ -0,0 +1,33 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fluentd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	valid := map[string]time.Duration{
+		"30":   30 * time.Second,
+		"0.5":  500 * time.Millisecond,
+		"10s":  10 * time.Second,
+		"5m":   5 * time.Minute,
+		"1.5h": 90 * time.Minute,
+		"2d":   48 * time.Hour,
+	}
+
+	for value, expected := range valid {
+		d, err := ParseTime(value)
+		assert.Nil(t, err, value)
+		assert.Equal(t, expected, d, value)
+	}
+
+	for _, value := range []string{"", "s", "ten", "-1s", "5w"} {
+		_, err := ParseTime(value)
+		assert.NotNil(t, err, value)
+	}
+}
@@ -4,12 +4,14 @@
 package fluentd
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -138,6 +140,132 @@ func (v *validatorState) ValidateConfig(config string, namespace string) error {
 	return nil
 }
 
+// limitedValidator bounds the number of validation processes running at the same time,
+// no matter how many goroutines validate
+type limitedValidator struct {
+	Validator
+	slots chan struct{}
+}
+
+func (v *limitedValidator) ValidateConfig(config string, namespace string) error {
+	v.slots <- struct{}{}
+	defer func() { <-v.slots }()
+
+	return v.Validator.ValidateConfig(config, namespace)
+}
+
+func (v *limitedValidator) ValidateConfigExtremely(config string, namespace string) error {
+	v.slots <- struct{}{}
+	defer func() { <-v.slots }()
+
+	return v.Validator.ValidateConfigExtremely(config, namespace)
+}
+
+// cachingValidator remembers the configs that passed the validation, keyed by their hash, so
+// that an unchanged config is not validated again. Only successes are cached: a failure may come
+// from a timeout. The least recently used entries are evicted past size, and the entry of a
+// namespace once it validates another config
+type cachingValidator struct {
+	Validator
+	size  int
+	mutex sync.Mutex
+	// hashes of the valid configs, most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+	// the hash of the last valid config of every namespace
+	namespaces map[string]string
+}
+
+// cacheKey keeps the kinds of validation apart
+func cacheKey(kind string, config string) string {
+	return util.Hash(kind, config)
+}
+
+// validated tells if the config is known to be valid, making it the most recently used
+func (v *cachingValidator) validated(key string) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	elem, ok := v.entries[key]
+	if ok {
+		v.lru.MoveToFront(elem)
+	}
+	return ok
+}
+
+// remember records a valid config of a namespace, replacing its previous one
+func (v *cachingValidator) remember(namespace string, key string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if previous, ok := v.namespaces[namespace]; ok && previous != key {
+		v.forget(previous)
+	}
+	v.namespaces[namespace] = key
+
+	if elem, ok := v.entries[key]; ok {
+		v.lru.MoveToFront(elem)
+		return
+	}
+	v.entries[key] = v.lru.PushFront(key)
+
+	for v.lru.Len() > v.size {
+		v.forget(v.lru.Back().Value.(string))
+	}
+}
+
+func (v *cachingValidator) forget(key string) {
+	if elem, ok := v.entries[key]; ok {
+		v.lru.Remove(elem)
+		delete(v.entries, key)
+	}
+}
+
+func (v *cachingValidator) validate(kind string, config string, namespace string, validate func(string, string) error) error {
+	key := cacheKey(kind, config)
+	if v.validated(key) {
+		logrus.Debugf("Config of namespace %s already validated, skipping fluentd", namespace)
+		return nil
+	}
+
+	if err := validate(config, namespace); err != nil {
+		return err
+	}
+	v.remember(namespace, key)
+	return nil
+}
+
+func (v *cachingValidator) ValidateConfig(config string, namespace string) error {
+	return v.validate("dry-run", config, namespace, v.Validator.ValidateConfig)
+}
+
+func (v *cachingValidator) ValidateConfigExtremely(config string, namespace string) error {
+	return v.validate("extreme", config, namespace, v.Validator.ValidateConfigExtremely)
+}
+
+// NewCachingValidator wraps a Validator so that the last size valid configs are not validated again
+func NewCachingValidator(validator Validator, size int) Validator {
+	return &cachingValidator{
+		Validator:  validator,
+		size:       size,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+		namespaces: map[string]string{},
+	}
+}
+
+// NewLimitedValidator wraps a Validator so that at most maxProcesses validations run concurrently
+func NewLimitedValidator(validator Validator, maxProcesses int) Validator {
+	if maxProcesses < 1 {
+		maxProcesses = 1
+	}
+
+	return &limitedValidator{
+		Validator: validator,
+		slots:     make(chan struct{}, maxProcesses),
+	}
+}
+
 // NewValidator creates a Validator using the given command
 func NewValidator(ctx context.Context, command string, timeout time.Duration) Validator {
 	parts := strings.Split(util.Trim(command), " ")
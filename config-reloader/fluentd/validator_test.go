@@ -5,6 +5,8 @@ package fluentd
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -58,3 +60,46 @@ func TestBadConfigString(t *testing.T) {
 	err = validator.ValidateConfigExtremely(s, "namespace-1")
 	assert.NotNil(t, err)
 }
+
+// recordingValidator fails the configs containing ERROR and counts the validations
+type recordingValidator struct {
+	Validator
+	calls int
+}
+
+func (v *recordingValidator) ValidateConfigExtremely(config string, namespace string) error {
+	v.calls++
+	if strings.Contains(config, "ERROR") {
+		return errors.New("bad config")
+	}
+	return nil
+}
+
+func TestCachingValidator(t *testing.T) {
+	inner := &recordingValidator{}
+	validator := NewCachingValidator(inner, 2)
+
+	// a valid config is validated once
+	assert.Nil(t, validator.ValidateConfigExtremely("a", "ns-1"))
+	assert.Nil(t, validator.ValidateConfigExtremely("a", "ns-1"))
+	assert.Equal(t, 1, inner.calls)
+
+	// failures are not cached
+	assert.NotNil(t, validator.ValidateConfigExtremely("ERROR", "ns-1"))
+	assert.NotNil(t, validator.ValidateConfigExtremely("ERROR", "ns-1"))
+	assert.Equal(t, 3, inner.calls)
+
+	// a new valid config of a namespace replaces its previous one
+	assert.Nil(t, validator.ValidateConfigExtremely("b", "ns-1"))
+	assert.Nil(t, validator.ValidateConfigExtremely("a", "ns-1"))
+	assert.Equal(t, 5, inner.calls)
+
+	// the least recently used config is evicted
+	assert.Nil(t, validator.ValidateConfigExtremely("c", "ns-2"))
+	assert.Nil(t, validator.ValidateConfigExtremely("d", "ns-3"))
+	assert.Equal(t, 7, inner.calls)
+	assert.Nil(t, validator.ValidateConfigExtremely("d", "ns-3"))
+	assert.Equal(t, 7, inner.calls)
+	assert.Nil(t, validator.ValidateConfigExtremely("a", "ns-1"))
+	assert.Equal(t, 8, inner.calls)
+}
@@ -0,0 +1,105 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminConfigPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin-position")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		OutputLayout:   config.OutputLayoutSingle,
+	}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name: "kube-system",
+		FluentdConfig: `
+<filter systemd.**>
+  @type stdout
+</filter>
+
+# @section append
+<match **>
+  @type null
+  @id catch-all
+</match>
+`,
+	}
+	a := &datasource.NamespaceConfig{
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.a\n</match>\n",
+	}
+
+	render := func() string {
+		g.SetModel([]*datasource.NamespaceConfig{admin, a})
+		hashes, err := g.RenderToDisk(ctx, dir)
+		assert.Nil(t, err)
+		g.CleanupUnusedFiles(dir, hashes)
+
+		main, err := ioutil.ReadFile(filepath.Join(dir, mainConfigFile))
+		assert.Nil(t, err)
+		return string(main)
+	}
+
+	// the whole admin config goes before the namespace by default
+	main := render()
+	assert.True(t, strings.Index(main, "catch-all") < strings.Index(main, "host es.a"))
+
+	cfg.AdminConfigPosition = config.AdminConfigAppend
+	main = render()
+	assert.True(t, strings.Index(main, "<filter systemd.**>") > strings.Index(main, "host es.a"))
+	assert.True(t, strings.Index(main, "catch-all") > strings.Index(main, "host es.a"))
+
+	cfg.AdminConfigPosition = config.AdminConfigBoth
+	main = render()
+	assert.True(t, strings.Index(main, "<filter systemd.**>") < strings.Index(main, "host es.a"))
+	assert.True(t, strings.Index(main, "catch-all") > strings.Index(main, "host es.a"))
+
+	// per-namespace layout uses a second admin file
+	cfg.OutputLayout = config.OutputLayoutPerNamespace
+	main = render()
+	assert.Contains(t, main, "@include admin-ns.conf")
+	assert.Contains(t, main, "@include admin-ns-append.conf")
+	appended, err := ioutil.ReadFile(filepath.Join(dir, adminAppendConfigFile))
+	assert.Nil(t, err)
+	assert.Contains(t, string(appended), "catch-all")
+	assert.NotContains(t, string(appended), "systemd")
+
+	cfg.AdminConfigPosition = config.AdminConfigPrepend
+	main = render()
+	assert.NotContains(t, main, "admin-ns-append.conf")
+	assert.False(t, fileExists(dir, adminAppendConfigFile))
+}
+
+func TestAdminConfigSectionCutsDirective(t *testing.T) {
+	cfg := &config.Config{
+		TemplatesDir:        "../templates",
+		AdminNamespace:      "kube-system",
+		AdminConfigPosition: config.AdminConfigBoth,
+	}
+	g := New(context.Background(), cfg)
+
+	raw := "<match **>\n# @section append\n  @type null\n</match>\n"
+	_, _, err := g.splitAdminConfig(raw, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,23 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// aggregator returns the aggregator the outputs of the namespace are routed to, taken from its
+// aggregator label or the default one. Empty if aggregator routing is disabled
+func (g *Generator) aggregator(ns *datasource.NamespaceConfig) string {
+	if g.cfg.AggregatorLabel == "" {
+		return ""
+	}
+
+	if name := strings.TrimSpace(ns.Labels[g.cfg.AggregatorLabel]); name != "" {
+		return name
+	}
+	return g.cfg.DefaultAggregator
+}
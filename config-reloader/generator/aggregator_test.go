@@ -0,0 +1,113 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregatorLabel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aggregator")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:    "../templates",
+		AdminNamespace:  "kube-system",
+		AggregatorLabel: "aggregator",
+		Aggregators: map[string]string{
+			"us-east": "agg-us-east",
+			"eu-west": "agg-eu-west",
+		},
+		DefaultAggregator: "us-east",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name: "kube-system",
+		FluentdConfig: `
+<plugin agg-us-east>
+  @type forward
+  <server>
+    host aggregator.us-east
+  </server>
+</plugin>
+
+<plugin agg-eu-west>
+  @type forward
+  <server>
+    host aggregator.eu-west
+  </server>
+</plugin>
+`,
+	}
+	config := `
+<match **>
+  @type forward
+  <server>
+    host my-own-aggregator
+  </server>
+</match>
+`
+	plain := &datasource.NamespaceConfig{
+		Name:          "plain",
+		FluentdConfig: config,
+	}
+	europe := &datasource.NamespaceConfig{
+		Name:          "europe",
+		FluentdConfig: config,
+		Labels:        map[string]string{"aggregator": "eu-west"},
+	}
+	mars := &datasource.NamespaceConfig{
+		Name:          "mars",
+		FluentdConfig: config,
+		Labels:        map[string]string{"aggregator": "mars"},
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{admin, plain, europe, mars})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	routes := map[string]string{}
+	for _, ns := range []string{"plain", "europe"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "ns-"+ns+".conf"))
+		assert.Nil(t, err)
+		assert.NotContains(t, string(data), "my-own-aggregator")
+
+		fragment, err := fluentd.ParseString(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, "relabel", fragment[0].Type())
+		routes[ns] = fragment[0].Param("@label")
+	}
+	assert.Equal(t, map[string]string{
+		"plain":  "@kfo-aggregator-us-east",
+		"europe": "@kfo-aggregator-eu-west",
+	}, routes)
+
+	// an aggregator not defined by the cluster admin fails the namespace
+	assert.False(t, fileExists(dir, "ns-mars.conf"))
+	st := g.StatusSummary([]*datasource.NamespaceConfig{mars})["mars"]
+	assert.Equal(t, datasource.StatusError, st.Status)
+	assert.Equal(t, datasource.ErrorPhasePolicy, st.Phase)
+
+	// the aggregator labels are defined once in the main file
+	data, err := ioutil.ReadFile(filepath.Join(dir, "fluent.conf"))
+	assert.Nil(t, err)
+	for _, name := range []string{"eu-west", "us-east"} {
+		assert.Equal(t, 1, strings.Count(string(data), "<label @kfo-aggregator-"+name+">"))
+		assert.Contains(t, string(data), "host aggregator."+name)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"sort"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fileBufferTypes keep their chunks on disk. When a reload moves or removes such a buffer
+// the new config never picks its chunks up again
+var fileBufferTypes = map[string]bool{
+	"file":        true,
+	"file_single": true,
+}
+
+// fileBuffers maps the file buffers of a rendered namespace config to the @id of their output.
+// A buffer is keyed by its type and path, or by its output if the path comes from root_dir
+func fileBuffers(config string) map[string]string {
+	res := map[string]string{}
+	fragment, err := fluentd.ParseString(config)
+	if err != nil {
+		return res
+	}
+
+	collectFileBuffers(fragment, res)
+	return res
+}
+
+func collectFileBuffers(fragment fluentd.Fragment, res map[string]string) {
+	bufferKey := func(bufferType string, path string, id string) string {
+		if path == "" {
+			return bufferType + " @id " + id
+		}
+		return bufferType + " " + path
+	}
+
+	for _, d := range fragment {
+		if d.Name == "match" || d.Name == "store" {
+			id := d.Param("@id")
+			// v0.12 style buffer params
+			if t := d.Param("buffer_type"); fileBufferTypes[t] {
+				res[bufferKey(t, d.Param("buffer_path"), id)] = id
+			}
+			for _, n := range d.Nested {
+				if n.Name == "buffer" && fileBufferTypes[n.Type()] {
+					res[bufferKey(n.Type(), n.Param("path"), id)] = id
+				}
+			}
+		}
+
+		collectFileBuffers(d.Nested, res)
+	}
+}
+
+// detectDisruptedBuffers compares the file buffers of the rendered configs with the ones of the
+// configs applied by the last cycle. The outputs whose file buffer goes away must be drained
+// before fluentd is reloaded. Nothing is disrupted on the first cycle as the running config is unknown
+func (g *Generator) detectDisruptedBuffers(renderedConfigs map[string]string) {
+	next := map[string]map[string]string{}
+	for ns, config := range renderedConfigs {
+		next[ns] = fileBuffers(config)
+	}
+
+	disrupted := []string{}
+	for ns, buffers := range g.fileBuffers {
+		for key, id := range buffers {
+			if _, ok := next[ns][key]; ok {
+				continue
+			}
+
+			logrus.Infof("The file buffer '%s' of namespace %s goes away with the new config", key, ns)
+			if id != "" {
+				disrupted = append(disrupted, id)
+			}
+		}
+	}
+	sort.Strings(disrupted)
+
+	g.nextFileBuffers = next
+	g.disruptedOutputs = disrupted
+}
+
+// DisruptedOutputs returns the @id of the outputs whose file buffer is moved or removed
+// by the config of the last render
+func (g *Generator) DisruptedOutputs() []string {
+	return g.disruptedOutputs
+}
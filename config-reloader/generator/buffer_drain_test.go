@@ -0,0 +1,92 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileBuffers(t *testing.T) {
+	buffers := fileBuffers(`
+<match kube.a.**>
+  @type copy
+  <store>
+    @type s3
+    @id s3
+    <buffer>
+      @type file
+      path /var/log/fluentd-buffers/s3
+    </buffer>
+  </store>
+  <store>
+    @type elasticsearch
+    @id es
+    <buffer>
+      @type memory
+    </buffer>
+  </store>
+</match>
+
+<match kube.a.legacy.**>
+  @type forward
+  @id legacy
+  buffer_type file
+  buffer_path /var/log/fluentd-buffers/legacy
+</match>
+
+<match kube.a.root.**>
+  @type forward
+  @id root
+  <buffer>
+    @type file_single
+  </buffer>
+</match>
+`)
+
+	assert.Equal(t, map[string]string{
+		"file /var/log/fluentd-buffers/s3":     "s3",
+		"file /var/log/fluentd-buffers/legacy": "legacy",
+		"file_single @id root":                 "root",
+	}, buffers)
+}
+
+func TestDisruptedOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer-drain")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:       "../templates",
+		AdminNamespace:     "kube-system",
+		FluentdMonitorAddr: "127.0.0.1:24220",
+		BufferDrainTimeout: time.Minute,
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	render := func(path string) []string {
+		g.SetModel([]*datasource.NamespaceConfig{
+			{Name: "a", FluentdConfig: "<match **>\n  @type s3\n  <buffer>\n    @type file\n    path " + path + "\n  </buffer>\n</match>\n" +
+				"<match kube.a.other.**>\n  @type forward\n  <buffer>\n    @type memory\n  </buffer>\n</match>\n"},
+		})
+		_, err := g.RenderToDisk(ctx, dir)
+		assert.Nil(t, err)
+		return g.DisruptedOutputs()
+	}
+
+	// the running config is unknown at first
+	assert.Empty(t, render("/var/log/fluentd-buffers/a"))
+	assert.Empty(t, render("/var/log/fluentd-buffers/a"))
+	assert.Equal(t, []string{"kfo-a-1"}, render("/var/log/fluentd-buffers/b"))
+	assert.Empty(t, render("/var/log/fluentd-buffers/b"))
+}
@@ -0,0 +1,53 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferProfileAnnotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer-profile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:       "../templates",
+		AdminNamespace:     "kube-system",
+		AnnotBufferProfile: "logging.csp.vmware.com/buffer-profile",
+	}
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, su)
+
+	conf := "<match **>\n  @type elasticsearch\n  <buffer>\n    flush_interval 30s\n  </buffer>\n</match>\n"
+	g.SetModel([]*datasource.NamespaceConfig{
+		{Name: "fast", FluentdConfig: conf, Annotations: map[string]string{cfg.AnnotBufferProfile: "Low-Latency"}},
+		{Name: "turbo", FluentdConfig: conf, Annotations: map[string]string{cfg.AnnotBufferProfile: "turbo"}},
+		{Name: "plain", FluentdConfig: conf},
+	})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "ns-fast.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "flush_interval 1s")
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, "ns-plain.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "flush_interval 30s")
+
+	assert.Equal(t, "", su.statuses["fast"])
+	assert.Contains(t, su.statuses["turbo"], "unknown buffer profile 'turbo'")
+}
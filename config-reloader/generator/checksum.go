@@ -0,0 +1,77 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+)
+
+const checksumFile = "checksums.sha256"
+
+// normalizeConfig drops comments, blank lines and the indentation so that only
+// meaningful changes alter the checksum
+func normalizeConfig(config string) string {
+	buf := &bytes.Buffer{}
+
+	for _, line := range strings.Split(config, "\n") {
+		line = util.Trim(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteChecksums stores the checksum of every normalized *.conf file of outputDir in
+// checksums.sha256 (in the sha256sum format) and exposes the checksum over all files as a metric.
+// The overall checksum covers the file names and their normalized content in lexical order
+func (g *Generator) WriteChecksums(outputDir string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(outputDir, "*.conf"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	lines := &bytes.Buffer{}
+	all := &bytes.Buffer{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+
+		normalized := normalizeConfig(string(data))
+		fmt.Fprintf(lines, "%s  %s\n", sha256Hex(normalized), filepath.Base(f))
+		fmt.Fprintf(all, "%s\n%s", filepath.Base(f), normalized)
+	}
+
+	checksum := sha256Hex(all.String())
+	fmt.Fprintf(lines, "# total %s\n", checksum)
+
+	err = util.WriteStringToFile(filepath.Join(outputDir, checksumFile), lines.String())
+	if err != nil {
+		return "", err
+	}
+
+	metrics.SetConfigChecksumMetric(checksum)
+	return checksum, nil
+}
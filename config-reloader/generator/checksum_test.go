@@ -0,0 +1,63 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeConfig(t *testing.T) {
+	a := `
+# a comment
+<match **>
+  @type null
+</match>
+`
+	b := "<match **>\n\t@type null   \n</match>"
+
+	assert.Equal(t, normalizeConfig(a), normalizeConfig(b))
+	assert.Equal(t, "<match **>\n@type null\n</match>\n", normalizeConfig(a))
+}
+
+func TestWriteChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksums")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "fluent.conf"), []byte("@include ns-a.conf\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ns-a.conf"), []byte("<match **>\n  @type null\n</match>\n"), 0644))
+
+	g := &Generator{cfg: &config.Config{}}
+	checksum, err := g.WriteChecksums(dir)
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, checksumFile))
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasSuffix(lines[0], "  fluent.conf"))
+	assert.True(t, strings.HasSuffix(lines[1], "  ns-a.conf"))
+	assert.Equal(t, "# total "+checksum, lines[2])
+
+	// comments don't change the checksum
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ns-a.conf"), []byte("# comment\n<match **>\n  @type null\n</match>\n"), 0644))
+	same, err := g.WriteChecksums(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, checksum, same)
+
+	// content does
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ns-a.conf"), []byte("<match **>\n  @type stdout\n</match>\n"), 0644))
+	changed, err := g.WriteChecksums(dir)
+	assert.Nil(t, err)
+	assert.NotEqual(t, checksum, changed)
+}
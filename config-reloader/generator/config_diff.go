@@ -0,0 +1,68 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sirupsen/logrus"
+)
+
+// a diff longer than this is cut, a namespace rewriting its whole config would flood the logs
+const maxConfigDiffLines = 200
+
+// configDiff returns the unified diff between two redacted configs of a namespace, cut after
+// maxConfigDiffLines lines. A changed credential is redacted on both sides and does not show
+func configDiff(namespace string, previous, previousHash, current, currentHash string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(previous),
+		B:        splitLines(current),
+		FromFile: fmt.Sprintf("%s@%s", namespace, previousHash),
+		ToFile:   fmt.Sprintf("%s@%s", namespace, currentHash),
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+
+	lines := splitLines(diff)
+	if len(lines) > maxConfigDiffLines {
+		diff = strings.Join(lines[:maxConfigDiffLines], "") + fmt.Sprintf("... %d more lines\n", len(lines)-maxConfigDiffLines)
+	}
+	return diff
+}
+
+// splitLines splits a text after each newline, the last line gets one if it has none
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// logConfigDiffs logs what changed in the config of every namespace since the last render
+func (g *Generator) logConfigDiffs(next *debugConfigs, previous *debugConfigs) {
+	if !g.cfg.Current().LogConfigDiffs || previous == nil {
+		return
+	}
+
+	names := make([]string, 0, len(next.namespaces))
+	for ns := range next.namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	for _, ns := range names {
+		config := next.namespaces[ns]
+		if old := previous.namespaces[ns]; old != nil && old.Hash != config.Hash && config.Diff != "" {
+			logrus.WithField("namespace", ns).Infof("Config of namespace %s changed:\n%s", ns, config.Diff)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigDiff(t *testing.T) {
+	diff := configDiff("web", "a\nb\nc\n", "h1", "a\nB\nc\n", "h2")
+	assert.Equal(t, "--- web@h1\n+++ web@h2\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n", diff)
+
+	long := ""
+	for i := 0; i < 2*maxConfigDiffLines; i++ {
+		long += fmt.Sprintf("line %d\n", i)
+	}
+	diff = configDiff("web", "", "h1", long, "h2")
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	assert.Equal(t, maxConfigDiffLines+1, len(lines))
+	assert.Equal(t, "... 203 more lines", lines[maxConfigDiffLines])
+}
+
+func TestLogConfigDiffs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-diff")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		LogConfigDiffs: true,
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	web := &datasource.NamespaceConfig{
+		Name:          "web",
+		FluentdConfig: "<match **>\n  @type http\n  endpoint http://logs\n  password s3cr3t\n</match>",
+	}
+	g.SetModel([]*datasource.NamespaceConfig{web})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Empty(t, g.DebugConfig("web").Diff)
+
+	web.FluentdConfig = "<match **>\n  @type http\n  endpoint http://other-logs\n  password n3w-s3cr3t\n</match>"
+	hook.Reset()
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	diff := g.DebugConfig("web").Diff
+	assert.Contains(t, diff, "-  endpoint http://logs\n+  endpoint http://other-logs\n")
+	assert.NotContains(t, diff, "s3cr3t")
+
+	logged := 0
+	for _, e := range hook.AllEntries() {
+		if e.Level == logrus.InfoLevel && e.Data["namespace"] == "web" {
+			logged++
+			assert.Contains(t, e.Message, diff)
+		}
+	}
+	assert.Equal(t, 1, logged)
+
+	// an unchanged config is not logged again
+	hook.Reset()
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	for _, e := range hook.AllEntries() {
+		assert.NotEqual(t, "web", e.Data["namespace"], e.Message)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// checkConfigBytes fails a namespace whose config is larger than --max-config-bytes, before it
+// is parsed
+func (g *Generator) checkConfigBytes(ns *datasource.NamespaceConfig) error {
+	limit := g.cfg.Current().MaxConfigBytes
+	if limit <= 0 {
+		return nil
+	}
+
+	if n := len(ns.FluentdConfig); n > limit {
+		return datasource.PolicyErrorf("the config is %d bytes long, at most %d are allowed per namespace", n, limit)
+	}
+	return nil
+}
+
+// checkRuleCount fails a namespace whose config has more <match> and <filter> directives than
+// --max-rules-per-namespace. The directives are counted as written by the tenant, not the ones
+// added by the macros
+func (g *Generator) checkRuleCount(fragment fluentd.Fragment) error {
+	limit := g.cfg.Current().MaxRulesPerNamespace
+	if limit <= 0 {
+		return nil
+	}
+
+	if n := countRules(fragment); n > limit {
+		return datasource.PolicyErrorf("the config has %d match and filter directives, at most %d are allowed per namespace", n, limit)
+	}
+	return nil
+}
+
+func countRules(fragment fluentd.Fragment) int {
+	n := 0
+	for _, d := range fragment {
+		switch d.Name {
+		case "match", "filter":
+			n++
+		case "label":
+			n += countRules(d.Nested)
+		}
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigLimits(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	}
+	g := New(ctx, cfg)
+
+	ns := &datasource.NamespaceConfig{
+		Name: "demo",
+		FluentdConfig: `
+<filter **>
+  @type record_transformer
+</filter>
+
+<match $labels(app=foo)>
+  @type relabel
+  @label @foo
+</match>
+
+<label @foo>
+  <match **>
+    @type null
+  </match>
+</label>
+`,
+	}
+
+	// no limits by default
+	assert.Nil(t, g.ValidateNamespace(ns))
+
+	cfg.MaxRulesPerNamespace = 3
+	assert.Nil(t, g.ValidateNamespace(ns))
+
+	cfg.MaxRulesPerNamespace = 2
+	err := g.ValidateNamespace(ns)
+	assert.EqualError(t, err, "the config has 3 match and filter directives, at most 2 are allowed per namespace")
+	assert.Equal(t, datasource.ErrorPhasePolicy, datasource.ErrorPhase(err))
+
+	cfg.MaxRulesPerNamespace = 0
+	cfg.MaxConfigBytes = 10
+	err = g.ValidateNamespace(ns)
+	assert.Contains(t, err.Error(), "at most 10 are allowed per namespace")
+	assert.Equal(t, datasource.ErrorPhasePolicy, datasource.ErrorPhase(err))
+}
+
+func TestValidateNamespaceWhileApplyingRuntimeConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	assert.Nil(t, cfg.ParseFlags([]string{"--templates-dir=../templates"}))
+	assert.Nil(t, cfg.Validate())
+	base := *cfg
+	g := New(ctx, cfg)
+
+	ns := &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}
+
+	// run with -race: the runtime config is published while the webhook validates
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_, err := cfg.ApplyRuntimeConfig(&base, map[string]string{
+				"denied-plugins":            "exec",
+				"max-outputs-per-namespace": fmt.Sprint(i + 1),
+			})
+			assert.Nil(t, err)
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, g.ValidateNamespace(ns))
+	}
+	<-done
+
+	assert.Equal(t, 50, cfg.Current().MaxOutputsPerNamespace)
+	assert.Equal(t, 0, cfg.MaxOutputsPerNamespace)
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerRuntimeLogFormat(t *testing.T) {
+	tests := []struct {
+		runtime string
+		parser  string
+		filters []string
+	}{
+		{
+			runtime: config.ContainerRuntimeAuto,
+			parser:  "multiline",
+			filters: []string{"filter_crio_container_logs", "filter_docker_container_logs"},
+		},
+		{
+			runtime: config.ContainerRuntimeDocker,
+			parser:  "json",
+			filters: []string{},
+		},
+		{
+			runtime: config.ContainerRuntimeContainerd,
+			parser:  "multiline",
+			filters: []string{"filter_crio_container_logs"},
+		},
+		{
+			runtime: config.ContainerRuntimeCRIO,
+			parser:  "multiline",
+			filters: []string{"filter_crio_container_logs"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.runtime, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "container-runtime")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			ctx := context.Background()
+			cfg := &config.Config{
+				TemplatesDir:     "../templates",
+				AdminNamespace:   "kube-system",
+				ContainerRuntime: test.runtime,
+			}
+			g := New(ctx, cfg)
+			g.SetStatusUpdater(ctx, nopStatusUpdater{})
+			g.SetModel([]*datasource.NamespaceConfig{{
+				Name:          "kube-system",
+				FluentdConfig: "<match **>\n  @type null\n</match>\n",
+			}})
+			_, err = g.RenderToDisk(ctx, dir)
+			assert.Nil(t, err)
+
+			content, err := ioutil.ReadFile(filepath.Join(dir, "kubernetes.conf"))
+			assert.Nil(t, err)
+			fragment, err := fluentd.ParseString(string(content))
+			assert.Nil(t, err)
+
+			filters := []string{}
+			for _, d := range fragment {
+				switch {
+				case d.Name == "source" && d.Param("@id") == "in_tail_container_logs":
+					assert.Equal(t, test.parser, d.Nested[0].Type())
+					if test.runtime != config.ContainerRuntimeAuto {
+						assert.Empty(t, d.Nested[0].Param("format3"))
+					}
+				case d.Name == "filter" && d.Tag == "kubernetes.**" && d.Param("@id") != "filter_kube_metadata":
+					filters = append(filters, d.Param("@id"))
+				}
+			}
+			assert.Equal(t, test.filters, filters)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const redacted = "<redacted>"
+
+// params holding credentials, their value is never served. A value read from a file or an
+// environment variable at runtime, e.g. "#{File.read(...)}", is not a credential itself
+var reSensitiveParam = regexp.MustCompile(`(?im)^(\s*(?:[a-z0-9_]*(?:password|passwd|secret|token|credential|access_key|api_?key|private_key|shared_key|sec_key|passphrase)[a-z0-9_]*))(\s+)(.*\S)\s*$`)
+
+var reRuntimeValue = regexp.MustCompile(`^"?#\{.*\}"?$`)
+
+// DebugConfig is the last successfully generated config of a namespace, with its credentials redacted
+type DebugConfig struct {
+	Namespace          string `json:"namespace"`
+	Config             string `json:"config"`
+	Hash               string `json:"hash"`
+	PreviousConfigHash string `json:"previousConfigHash,omitempty"`
+	// what changed since the config generated before, empty for the first one
+	Diff string `json:"diff,omitempty"`
+}
+
+// debugConfigs is the main config file and the namespace configs of a render
+type debugConfigs struct {
+	main       string
+	namespaces map[string]*DebugConfig
+}
+
+// redactConfig replaces the values of the params that hold credentials
+func redactConfig(config string) string {
+	return reSensitiveParam.ReplaceAllStringFunc(config, func(line string) string {
+		m := reSensitiveParam.FindStringSubmatch(line)
+		if reRuntimeValue.MatchString(m[3]) {
+			return line
+		}
+		return m[1] + m[2] + redacted
+	})
+}
+
+// stageDebugConfigs keeps the configs of the current render, they replace the served ones once
+// the render succeeds. A namespace that failed keeps serving its previous config
+func (g *Generator) stageDebugConfigs(mainConfig string, renderedConfigs map[string]string, hashes map[string]string) {
+	next := &debugConfigs{
+		main:       redactConfig(mainConfig),
+		namespaces: map[string]*DebugConfig{},
+	}
+
+	g.debugMutex.RLock()
+	previous := g.debug
+	g.debugMutex.RUnlock()
+
+	for _, nsConf := range g.model {
+		if config, ok := renderedConfigs[nsConf.Name]; ok {
+			current := &DebugConfig{
+				Namespace:          nsConf.Name,
+				Config:             redactConfig(config),
+				Hash:               hashes[nsConf.Name],
+				PreviousConfigHash: nsConf.PreviousConfigHash,
+			}
+			if previous != nil && previous.namespaces[nsConf.Name] != nil {
+				old := previous.namespaces[nsConf.Name]
+				if old.Hash == current.Hash {
+					current.Diff = old.Diff
+				} else {
+					current.Diff = configDiff(nsConf.Name, old.Config, old.Hash, current.Config, current.Hash)
+				}
+			}
+			next.namespaces[nsConf.Name] = current
+		} else if previous != nil && previous.namespaces[nsConf.Name] != nil {
+			next.namespaces[nsConf.Name] = previous.namespaces[nsConf.Name]
+		}
+	}
+
+	g.nextDebug = next
+}
+
+// DebugConfig returns the last successfully generated config of a namespace, nil if there is none
+func (g *Generator) DebugConfig(namespace string) *DebugConfig {
+	g.debugMutex.RLock()
+	defer g.debugMutex.RUnlock()
+
+	if g.debug == nil {
+		return nil
+	}
+	return g.debug.namespaces[namespace]
+}
+
+// CombinedDebugConfig returns the last generated main config file followed by the config of
+// every namespace it includes, empty before the first render
+func (g *Generator) CombinedDebugConfig() string {
+	g.debugMutex.RLock()
+	defer g.debugMutex.RUnlock()
+
+	if g.debug == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(g.debug.main)
+	if g.singleFile() {
+		return buf.String()
+	}
+
+	names := make([]string, 0, len(g.debug.namespaces))
+	for ns := range g.debug.namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	for _, ns := range names {
+		fmt.Fprintf(buf, "\n# namespace %s\n%s", ns, g.debug.namespaces[ns].Config)
+	}
+	return buf.String()
+}
@@ -0,0 +1,81 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactConfig(t *testing.T) {
+	config := `
+<match **>
+  @type elasticsearch
+  user elastic
+  password s3cr3t
+  aws_sec_key  abc def
+  hec_token "#{File.read('/etc/fluentd/secrets/splunk/token').strip}"
+  message_key log
+</match>`
+
+	assert.Equal(t, `
+<match **>
+  @type elasticsearch
+  user elastic
+  password <redacted>
+  aws_sec_key  <redacted>
+  hec_token "#{File.read('/etc/fluentd/secrets/splunk/token').strip}"
+  message_key log
+</match>`, redactConfig(config))
+}
+
+func TestDebugConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+	assert.Nil(t, g.DebugConfig("web"))
+	assert.Empty(t, g.CombinedDebugConfig())
+
+	web := &datasource.NamespaceConfig{
+		Name:               "web",
+		FluentdConfig:      "<match **>\n  @type http\n  endpoint http://logs\n  password s3cr3t\n</match>",
+		PreviousConfigHash: "previous",
+	}
+	g.SetModel([]*datasource.NamespaceConfig{web})
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	served := g.DebugConfig("web")
+	assert.NotNil(t, served)
+	assert.Equal(t, hashes["web"], served.Hash)
+	assert.Equal(t, "previous", served.PreviousConfigHash)
+	assert.Contains(t, served.Config, "endpoint http://logs")
+	assert.Contains(t, served.Config, "password <redacted>")
+	assert.NotContains(t, served.Config, "s3cr3t")
+
+	combined := g.CombinedDebugConfig()
+	assert.Contains(t, combined, "# namespace web\n")
+	assert.NotContains(t, combined, "s3cr3t")
+
+	// a failing config keeps serving the last generated one
+	web.FluentdConfig = "<match **>\n  @type http\n"
+	web.PreviousConfigHash = hashes["web"]
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, served, g.DebugConfig("web"))
+}
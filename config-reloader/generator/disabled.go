@@ -0,0 +1,68 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/processors"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Values of the logging disabled annotation
+const (
+	disabledDrop       = "drop"
+	disabledQuarantine = "quarantine"
+)
+
+// disabledRender returns the config replacing the whole config of a namespace whose logging is
+// disabled by the cluster admin, nil if the namespace is not disabled. The logs are dropped or sent
+// to the quarantine plugin, any other value of the annotation drops them too
+func (g *Generator) disabledRender(nsConf *datasource.NamespaceConfig) *namespaceRender {
+	if g.cfg.AnnotDisabled == "" {
+		return nil
+	}
+
+	mode := strings.TrimSpace(nsConf.Annotations[g.cfg.AnnotDisabled])
+	if mode == "" {
+		return nil
+	}
+
+	var fragment fluentd.Fragment
+	message := "disabled: logging disabled by the cluster admin, the logs are dropped"
+
+	if mode == disabledQuarantine {
+		quarantinePlugin := g.cfg.Current().QuarantinePlugin
+		if plugin, ok := g.getPlugins()[quarantinePlugin]; ok && quarantinePlugin != "" {
+			fragment = processors.MakeQuarantineConfig(nsConf.Name, plugin)
+			message = fmt.Sprintf("disabled: logging disabled by the cluster admin, the logs are sent to the quarantine plugin %s", quarantinePlugin)
+		} else {
+			logrus.Warnf("No quarantine plugin defined in the admin namespace %s, dropping the logs of the disabled namespace %s", g.cfg.AdminNamespace, nsConf.Name)
+		}
+	} else if mode != disabledDrop {
+		logrus.Warnf("Unknown value '%s' of %s on namespace %s, dropping its logs", mode, g.cfg.AnnotDisabled, nsConf.Name)
+	}
+
+	if fragment == nil {
+		drop := &fluentd.Directive{
+			Name:   "match",
+			Tag:    fmt.Sprintf("kube.%s.**", nsConf.Name),
+			Params: fluentd.ParamsFromKV("@type", "null"),
+		}
+		fragment = fluentd.Fragment{drop}
+	}
+
+	renderedConfig := fragment.String()
+	return &namespaceRender{
+		nsConf:         nsConf,
+		renderedConfig: renderedConfig,
+		configHash:     util.Hash("DISABLED", renderedConfig),
+		disabled:       message,
+	}
+}
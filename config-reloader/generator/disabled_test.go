@@ -0,0 +1,98 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const disabledAnnotation = "logging.csp.vmware.com/logging-disabled"
+
+func renderDisabled(t *testing.T, mode string, quarantinePlugin string) (*Generator, *datasource.NamespaceConfig, fluentd.Fragment) {
+	dir, err := ioutil.TempDir("", "disabled")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:     "../templates",
+		AdminNamespace:   "kube-system",
+		QuarantinePlugin: quarantinePlugin,
+		AnnotDisabled:    disabledAnnotation,
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name:          "kube-system",
+		FluentdConfig: "<plugin quarantine>\n  @type s3\n  s3_bucket quarantine\n</plugin>\n",
+	}
+	leaky := &datasource.NamespaceConfig{
+		Name:          "leaky",
+		Annotations:   map[string]string{disabledAnnotation: mode},
+		FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.leaky\n</match>\n",
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{admin, leaky})
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, hashes["leaky"])
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "ns-leaky.conf"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "es.leaky")
+
+	fragment, err := fluentd.ParseString(string(data))
+	assert.Nil(t, err)
+	return g, leaky, fragment
+}
+
+func TestDisabledNamespaceDrop(t *testing.T) {
+	g, leaky, fragment := renderDisabled(t, "drop", "quarantine")
+
+	assert.Equal(t, 1, len(fragment))
+	assert.Equal(t, "kube.leaky.**", fragment[0].Tag)
+	assert.Equal(t, "null", fragment[0].Type())
+
+	st := g.StatusSummary([]*datasource.NamespaceConfig{leaky})["leaky"]
+	assert.Equal(t, datasource.StatusDisabled, st.Status)
+	assert.Equal(t, "disabled: logging disabled by the cluster admin, the logs are dropped", st.Message)
+	assert.Equal(t, "", st.LastApplied)
+	assert.Nil(t, g.LastGoodConfig("leaky"))
+}
+
+func TestDisabledNamespaceQuarantine(t *testing.T) {
+	g, leaky, fragment := renderDisabled(t, "quarantine", "quarantine")
+
+	assert.Equal(t, 2, len(fragment))
+	assert.Equal(t, "record_transformer", fragment[0].Type())
+	assert.Equal(t, "leaky", fragment[0].Nested[0].Param("kfo_quarantined_namespace"))
+	assert.Equal(t, "s3", fragment[1].Type())
+	assert.Equal(t, "quarantine", fragment[1].Param("s3_bucket"))
+
+	st := g.StatusSummary([]*datasource.NamespaceConfig{leaky})["leaky"]
+	assert.Equal(t, datasource.StatusDisabled, st.Status)
+	assert.Equal(t, "disabled: logging disabled by the cluster admin, the logs are sent to the quarantine plugin quarantine", st.Message)
+}
+
+func TestDisabledNamespaceFallsBackToDrop(t *testing.T) {
+	// no quarantine plugin configured
+	_, _, fragment := renderDisabled(t, "quarantine", "")
+	assert.Equal(t, 1, len(fragment))
+	assert.Equal(t, "null", fragment[0].Type())
+
+	// unknown mode
+	_, _, fragment = renderDisabled(t, "yes", "quarantine")
+	assert.Equal(t, 1, len(fragment))
+	assert.Equal(t, "null", fragment[0].Type())
+}
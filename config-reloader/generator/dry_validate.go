@@ -0,0 +1,80 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// DryValidation is the outcome of validating a proposed namespace config without applying it
+type DryValidation struct {
+	Namespace string `json:"namespace"`
+	Valid     bool   `json:"valid"`
+	// where the error comes from, e.g. ValidationError, empty for a valid config
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+	// what a run would write to the status of a valid config
+	Warnings []string               `json:"warnings,omitempty"`
+	Findings []*fluentd.LintFinding `json:"findings,omitempty"`
+}
+
+// DryValidateNamespace runs a proposed config of a namespace through every check of a run, in the
+// same order: the required plugins, the processing with the plugin policy, the lint rules, the
+// Secret references of the namespace and the fluentd validator. Nothing is written and the status
+// of the namespace is left alone
+func (g *Generator) DryValidateNamespace(ctx context.Context, ns *datasource.NamespaceConfig) *DryValidation {
+	res := &DryValidation{Namespace: ns.Name}
+
+	warnings, err := g.dryValidate(ctx, ns, res)
+	if err != nil {
+		res.Phase = datasource.ErrorPhase(err)
+		res.Message = err.Error()
+		return res
+	}
+
+	res.Valid = true
+	res.Warnings = warnings
+	return res
+}
+
+func (g *Generator) dryValidate(ctx context.Context, ns *datasource.NamespaceConfig, res *DryValidation) ([]string, error) {
+	ns, err := g.withRequiredPlugins(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	validatedConfig, err := g.processForValidation(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Findings = g.lint(ns)
+	if msg := fluentd.LintMessage(res.Findings, fluentd.LintError); msg != "" {
+		return nil, datasource.NewPhaseError(datasource.ErrorPhaseLint, fmt.Errorf("lint errors: %s", msg))
+	}
+
+	secretsWarning, err := g.checkSecretRefs(ctx, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	if validatedConfig != "" {
+		if err := g.validator.ValidateConfigExtremely(validatedConfig, ns.Name); err != nil {
+			return nil, datasource.NewPhaseError(datasource.ErrorPhaseValidation, err)
+		}
+	}
+
+	warnings := []string{}
+	if msg := fluentd.LintMessage(res.Findings, fluentd.LintWarn); msg != "" {
+		warnings = append(warnings, "warning: lint: "+msg)
+	}
+	if secretsWarning != "" {
+		warnings = append(warnings, secretsWarning)
+	}
+	return warnings, nil
+}
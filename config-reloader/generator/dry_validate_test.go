@@ -0,0 +1,50 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryValidateNamespace(t *testing.T) {
+	ctx := context.Background()
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		AllowedPlugins: []string{"null", "elasticsearch"},
+	})
+	g.SetStatusUpdater(ctx, su)
+
+	res := g.DryValidateNamespace(ctx, &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	})
+	assert.Equal(t, &DryValidation{Namespace: "demo", Valid: true, Warnings: []string{}}, res)
+
+	res = g.DryValidateNamespace(ctx, &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: "<match **>\n  @type forward\n</match>\n",
+	})
+	assert.False(t, res.Valid)
+	assert.Equal(t, datasource.ErrorPhasePolicy, res.Phase)
+	assert.Contains(t, res.Message, "forward")
+
+	res = g.DryValidateNamespace(ctx, &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: "<match **>\n  @type null\n",
+	})
+	assert.False(t, res.Valid)
+	assert.Equal(t, datasource.ErrorPhaseRender, res.Phase)
+
+	// nothing is applied
+	assert.Empty(t, su.statuses)
+	assert.Nil(t, g.DebugConfig("demo"))
+}
@@ -0,0 +1,158 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+)
+
+// findDuplicateRouting maps the tag of every container to the namespaces whose generated
+// config routes it, keeping only the tags routed by more than one namespace.
+// renderedConfigs holds the generated config of every included namespace, the admin one included
+func (g *Generator) findDuplicateRouting(renderedConfigs map[string]string) map[string][]string {
+	fragments := map[string]fluentd.Fragment{}
+	for ns, config := range renderedConfigs {
+		fragment, err := fluentd.ParseString(config)
+		if err == nil {
+			fragments[ns] = fragment
+		}
+	}
+
+	res := map[string][]string{}
+	for _, nsConf := range g.model {
+		for _, tag := range containerTags(nsConf) {
+			claimed := []string{}
+			for ns, fragment := range fragments {
+				if fluentd.RoutesTag(fragment, tag) {
+					claimed = append(claimed, ns)
+				}
+			}
+
+			if len(claimed) > 1 {
+				sort.Strings(claimed)
+				res[tag] = claimed
+			}
+		}
+	}
+
+	return res
+}
+
+// checkDuplicateRouting reports the containers routed by more than one namespace once the namespaces
+// are processed and validated: it logs them, exports their count and warns every namespace involved
+// in its status. With --strict-tag-isolation the namespaces routing the containers of another
+// namespace fail instead, unless it is the admin namespace whose config is copied as is.
+// adminConfigs holds the generated config of the admin namespace
+func (g *Generator) checkDuplicateRouting(adminConfigs map[string]string, renders []*namespaceRender) {
+	cfg := g.cfg.Current()
+	if !cfg.WarnDuplicateRouting && !cfg.StrictTagIsolation {
+		g.collisionWarnings = nil
+		return
+	}
+
+	renderedConfigs := map[string]string{}
+	for ns, config := range adminConfigs {
+		renderedConfigs[ns] = config
+	}
+	for _, r := range renders {
+		if r.err == nil && r.validationErr == nil && r.renderedConfig != "" {
+			renderedConfigs[r.nsConf.Name] = r.renderedConfig
+		}
+	}
+
+	duplicates := g.reportDuplicateRouting(renderedConfigs)
+
+	if cfg.StrictTagIsolation {
+		intruders := map[string][]string{}
+		for tag, claimed := range duplicates {
+			owner := tagNamespace(tag)
+			for _, ns := range claimed {
+				if ns != owner && ns != cfg.AdminNamespace {
+					intruders[ns] = appendUnique(intruders[ns], owner)
+				}
+			}
+		}
+
+		for _, r := range renders {
+			owners, ok := intruders[r.nsConf.Name]
+			if !ok || r.err != nil {
+				continue
+			}
+			sort.Strings(owners)
+			r.err = datasource.PolicyErrorf("the config routes the container logs of namespace %s, forbidden by --strict-tag-isolation", strings.Join(owners, ", "))
+			r.configHash = util.Hash("ERROR", r.err.Error())
+			delete(renderedConfigs, r.nsConf.Name)
+		}
+		// the collisions left are with the admin namespace
+		duplicates = g.findDuplicateRouting(renderedConfigs)
+	}
+
+	others := map[string][]string{}
+	for _, claimed := range duplicates {
+		for _, ns := range claimed {
+			for _, other := range claimed {
+				if other != ns {
+					others[ns] = appendUnique(others[ns], other)
+				}
+			}
+		}
+	}
+
+	warnings := map[string]string{}
+	for _, r := range renders {
+		ns := r.nsConf.Name
+		r.collisionWarning = ""
+		if list, ok := others[ns]; ok && r.err == nil {
+			sort.Strings(list)
+			r.collisionWarning = fmt.Sprintf("warning: the config of %s routes the same container logs, fluentd hands a record to the first <match> only", strings.Join(list, ", "))
+			warnings[ns] = r.collisionWarning
+		}
+		r.collisionChanged = r.collisionWarning != g.collisionWarnings[ns]
+	}
+	g.collisionWarnings = warnings
+}
+
+// tagNamespace returns the namespace of a container tag kube.{namespace}.{pod}.{container}
+func tagNamespace(tag string) string {
+	parts := strings.SplitN(tag, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// reportDuplicateRouting logs the containers routed by more than one namespace, exports their count
+// and returns them
+func (g *Generator) reportDuplicateRouting(renderedConfigs map[string]string) map[string][]string {
+	duplicates := g.findDuplicateRouting(renderedConfigs)
+	metrics.SetDuplicateRoutedContainersMetric(len(duplicates))
+
+	tags := make([]string, 0, len(duplicates))
+	for tag := range duplicates {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		logrus.Warnf("Logs tagged %s are routed by the config of several namespaces: %s", tag, strings.Join(duplicates[tag], ", "))
+	}
+	return duplicates
+}
@@ -0,0 +1,176 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicateRouting(t *testing.T) {
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:         "../templates",
+		AdminNamespace:       "kube-system",
+		WarnDuplicateRouting: true,
+	})
+
+	mini := func(pod string) []*datasource.MiniContainer {
+		return []*datasource.MiniContainer{{PodName: pod, Name: "main"}}
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{
+		{Name: "kube-system", MiniContainers: mini("dns")},
+		{Name: "web", MiniContainers: mini("nginx")},
+		{Name: "api", MiniContainers: mini("server")},
+	})
+
+	duplicates := g.findDuplicateRouting(map[string]string{
+		"kube-system": "<match kube.kube-system.** kube.web.**>\n  @type null\n</match>\n",
+		"web":         "<match kube.web.**>\n  @type elasticsearch\n</match>\n",
+		"api":         "<match kube.api.**>\n  @type elasticsearch\n</match>\n",
+	})
+
+	assert.Equal(t, map[string][]string{
+		"kube.web.nginx.main": {"kube-system", "web"},
+	}, duplicates)
+}
+
+func TestFindDuplicateRoutingOfPlainContainers(t *testing.T) {
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:         "../templates",
+		AdminNamespace:       "kube-system",
+		WarnDuplicateRouting: true,
+	})
+
+	// the server container only logs to stdout, it has no mount and is no mini container
+	g.SetModel([]*datasource.NamespaceConfig{
+		{Name: "kube-system"},
+		{
+			Name:           "api",
+			MiniContainers: []*datasource.MiniContainer{{PodName: "nginx", Name: "main"}},
+			Containers:     []datasource.ContainerRef{{PodName: "nginx", Name: "main"}, {PodName: "server", Name: "app"}},
+		},
+	})
+
+	duplicates := g.findDuplicateRouting(map[string]string{
+		"kube-system": "<match kube.api.server.**>\n  @type null\n</match>\n",
+		"api":         "<match kube.api.**>\n  @type elasticsearch\n</match>\n",
+	})
+
+	assert.Equal(t, map[string][]string{
+		"kube.api.server.app": {"api", "kube-system"},
+	}, duplicates)
+}
+
+func TestDuplicateRoutingStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "duplicate-routing")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:         "../templates",
+		AdminNamespace:       "kube-system",
+		WarnDuplicateRouting: true,
+	})
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g.SetStatusUpdater(ctx, su)
+
+	admin := &datasource.NamespaceConfig{
+		Name:          "kube-system",
+		FluentdConfig: "<match kube.web.**>\n  @type null\n</match>\n",
+	}
+	web := &datasource.NamespaceConfig{
+		Name:           "web",
+		FluentdConfig:  "<match **>\n  @type elasticsearch\n</match>\n",
+		MiniContainers: []*datasource.MiniContainer{{PodName: "nginx", Name: "main"}},
+	}
+	g.SetModel([]*datasource.NamespaceConfig{admin, web})
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "warning: the config of kube-system routes the same container logs, fluentd hands a record to the first <match> only", su.statuses["web"])
+
+	// the collision is gone while the config of web did not change, its status is cleared
+	web.PreviousConfigHash = hashes["web"]
+	admin.FluentdConfig = "<match kube.kube-system.**>\n  @type null\n</match>\n"
+	g.SetModel([]*datasource.NamespaceConfig{admin, web})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "", su.statuses["web"])
+
+	// nothing changed, nothing is written
+	su.statuses["web"] = "untouched"
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "untouched", su.statuses["web"])
+}
+
+func TestStrictTagIsolation(t *testing.T) {
+	g := New(context.Background(), &config.Config{
+		TemplatesDir:       "../templates",
+		AdminNamespace:     "kube-system",
+		StrictTagIsolation: true,
+	})
+
+	mini := func(pod string) []*datasource.MiniContainer {
+		return []*datasource.MiniContainer{{PodName: pod, Name: "main"}}
+	}
+	web := &datasource.NamespaceConfig{Name: "web", MiniContainers: mini("nginx")}
+	api := &datasource.NamespaceConfig{Name: "api", MiniContainers: mini("server")}
+	shop := &datasource.NamespaceConfig{Name: "shop", MiniContainers: mini("cart")}
+	g.SetModel([]*datasource.NamespaceConfig{{Name: "kube-system"}, web, api, shop})
+
+	renders := []*namespaceRender{
+		{nsConf: web, renderedConfig: "<match kube.web.**>\n  @type elasticsearch\n</match>\n"},
+		{nsConf: api, renderedConfig: "<match kube.api.** kube.web.**>\n  @type elasticsearch\n</match>\n"},
+		{nsConf: shop, renderedConfig: "<match kube.shop.**>\n  @type elasticsearch\n</match>\n"},
+	}
+	g.checkDuplicateRouting(map[string]string{
+		"kube-system": "<match kube.shop.**>\n  @type null\n</match>\n",
+	}, renders)
+
+	// the namespace routing the logs of another one fails, not the admin namespace
+	assert.Nil(t, renders[0].err)
+	assert.Equal(t, "", renders[0].collisionWarning)
+	assert.EqualError(t, renders[1].err, "the config routes the container logs of namespace web, forbidden by --strict-tag-isolation")
+	assert.Equal(t, datasource.ErrorPhasePolicy, datasource.ErrorPhase(renders[1].err))
+	assert.Nil(t, renders[2].err)
+	assert.Contains(t, renders[2].collisionWarning, "the config of kube-system routes")
+}
+
+func TestStrictTagIsolationOfPlainContainers(t *testing.T) {
+	g := New(context.Background(), &config.Config{
+		TemplatesDir:       "../templates",
+		AdminNamespace:     "kube-system",
+		StrictTagIsolation: true,
+	})
+
+	// the web containers only log to stdout, none of them is a mini container
+	web := &datasource.NamespaceConfig{Name: "web", Containers: []datasource.ContainerRef{{PodName: "nginx", Name: "main"}}}
+	api := &datasource.NamespaceConfig{Name: "api", Containers: []datasource.ContainerRef{{PodName: "server", Name: "main"}}}
+	shop := &datasource.NamespaceConfig{Name: "shop", Containers: []datasource.ContainerRef{{PodName: "cart", Name: "main"}}}
+	g.SetModel([]*datasource.NamespaceConfig{{Name: "kube-system"}, web, api, shop})
+
+	renders := []*namespaceRender{
+		{nsConf: web, renderedConfig: "<match kube.web.**>\n  @type elasticsearch\n</match>\n"},
+		{nsConf: api, renderedConfig: "<match kube.api.** kube.web.**>\n  @type elasticsearch\n</match>\n"},
+		{nsConf: shop, renderedConfig: "<match kube.shop.**>\n  @type elasticsearch\n</match>\n"},
+	}
+	g.checkDuplicateRouting(map[string]string{
+		"kube-system": "<match kube.shop.**>\n  @type null\n</match>\n",
+	}, renders)
+
+	assert.Nil(t, renders[0].err)
+	assert.EqualError(t, renders[1].err, "the config routes the container logs of namespace web, forbidden by --strict-tag-isolation")
+	assert.Contains(t, renders[2].collisionWarning, "the config of kube-system routes")
+}
@@ -0,0 +1,21 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// SetEventRecorder configures where the events about the namespaces go. nil records no event
+func (g *Generator) SetEventRecorder(er datasource.EventRecorder) {
+	g.events = er
+}
+
+// recordEvent is called next to the status updates, so an event is only recorded when the
+// config of a namespace changes
+func (g *Generator) recordEvent(namespace string, eventType string, reason string, message string) {
+	if g.events != nil {
+		g.events.RecordEvent(namespace, eventType, reason, message)
+	}
+}
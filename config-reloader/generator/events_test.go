@@ -0,0 +1,71 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedEvent struct {
+	eventType string
+	reason    string
+	message   string
+}
+
+// fakeEventRecorder keeps the events by namespace
+type fakeEventRecorder map[string][]recordedEvent
+
+func (r fakeEventRecorder) RecordEvent(namespace string, eventType string, reason string, message string) {
+	r[namespace] = append(r[namespace], recordedEvent{eventType, reason, message})
+}
+
+func TestEventsRecorded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+	events := fakeEventRecorder{}
+	g.SetEventRecorder(events)
+
+	good := &datasource.NamespaceConfig{
+		Name: "good",
+		FluentdConfig: `
+<match **>
+  @type null
+</match>
+`,
+	}
+	bad := &datasource.NamespaceConfig{
+		Name:          "bad",
+		FluentdConfig: "<match **>",
+	}
+	empty := &datasource.NamespaceConfig{
+		Name: "empty",
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{good, bad, empty})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []recordedEvent{{datasource.EventTypeNormal, datasource.EventReasonApplied, "fluentd config generated and validated"}}, events["good"])
+	assert.Len(t, events["bad"], 1)
+	assert.Equal(t, datasource.EventTypeWarning, events["bad"][0].eventType)
+	assert.Equal(t, datasource.EventReasonInvalid, events["bad"][0].reason)
+	assert.NotEmpty(t, events["bad"][0].message)
+	assert.Empty(t, events["empty"])
+}
@@ -0,0 +1,30 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// fanOutPlugins returns the admin plugins the namespace logs are also sent to, taken from the
+// comma-separated list in its fan-out annotation
+func (g *Generator) fanOutPlugins(ns *datasource.NamespaceConfig) []string {
+	if g.cfg.AnnotFanOut == "" {
+		return nil
+	}
+
+	res := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(ns.Annotations[g.cfg.AnnotFanOut], ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
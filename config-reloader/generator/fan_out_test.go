@@ -0,0 +1,86 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOutAnnotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fan-out")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		AnnotFanOut:    "example.com/also-send-to",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name: "kube-system",
+		FluentdConfig: `
+<plugin compliance>
+  @type s3
+  s3_bucket archive
+</plugin>
+
+<plugin audit>
+  @type forward
+</plugin>
+
+<match systemd.**>
+  @type null
+</match>
+`,
+	}
+	config := `
+<match **>
+  @type elasticsearch
+</match>
+`
+	plain := &datasource.NamespaceConfig{
+		Name:          "plain",
+		FluentdConfig: config,
+	}
+	regulated := &datasource.NamespaceConfig{
+		Name:          "regulated",
+		FluentdConfig: config,
+		Annotations:   map[string]string{"example.com/also-send-to": "compliance, audit,compliance"},
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{admin, plain, regulated})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	types := map[string][]string{}
+	for _, ns := range []string{"plain", "regulated"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "ns-"+ns+".conf"))
+		assert.Nil(t, err)
+		fragment, err := fluentd.ParseString(string(data))
+		assert.Nil(t, err)
+
+		types[ns] = []string{fragment[0].Type()}
+		for _, store := range fragment[0].Nested {
+			types[ns] = append(types[ns], store.Type())
+		}
+	}
+
+	assert.Equal(t, map[string][]string{
+		"plain":     {"elasticsearch"},
+		"regulated": {"copy", "elasticsearch", "s3", "forward"},
+	}, types)
+}
@@ -0,0 +1,54 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchErrorFailsOnlyItsNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetch-error")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	}
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, su)
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "good", FluentdConfig: "<match **>\n  @type null\n</match>\n"},
+		{Name: "broken", FetchError: datasource.NewPhaseError(datasource.ErrorPhaseFetch, errors.New("cannot read configmap fluentd-config"))},
+	}
+	g.SetModel(namespaces)
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	assert.Contains(t, hashes, "broken")
+	assert.Equal(t, "cannot read configmap fluentd-config", su.statuses["broken"])
+	_, err = os.Stat(filepath.Join(dir, "ns-broken.conf"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, "", su.statuses["good"])
+	_, err = os.Stat(filepath.Join(dir, "ns-good.conf"))
+	assert.Nil(t, err)
+
+	summary := g.StatusSummary(namespaces)
+	assert.Equal(t, datasource.StatusError, summary["broken"].Status)
+	assert.Equal(t, datasource.ErrorPhaseFetch, summary["broken"].Phase)
+}
@@ -7,10 +7,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -25,8 +27,13 @@ import (
 )
 
 const (
-	mainConfigFile = "fluent.conf"
-	maskDirectory  = 0775
+	mainConfigFile  = "fluent.conf"
+	adminConfigFile = "admin-ns.conf"
+	// the part of the admin config that goes after the namespace configs
+	adminAppendConfigFile = "admin-ns-append.conf"
+	// name of the admin config sections going after the namespace configs in "both" position
+	adminAppendSection = "append"
+	maskDirectory      = 0775
 
 	onlyProcess = 1
 	onlyPrepare = 2
@@ -39,6 +46,47 @@ type Generator struct {
 	cfg          *config.Config
 	validator    fluentd.Validator
 	su           datasource.StatusUpdater
+	secrets      datasource.SecretChecker
+	snippets     datasource.SnippetReader
+	events       datasource.EventRecorder
+	// plugins extracted from the admin namespace during the last render
+	plugins      map[string]*fluentd.Directive
+	pluginsMutex sync.RWMutex
+	// default namespace config defined in the admin namespace, guarded by pluginsMutex too
+	namespaceDefault string
+	// plugin inventory of the fluentd image, nil if unknown, guarded by pluginsMutex too
+	installedPlugins map[string]string
+	// namespaces of the model whose @required_plugin directives fail
+	requiredPluginErrors map[string]error
+	// last known status of every namespace, reported by StatusSummary
+	statuses map[string]*datasource.NamespaceStatus
+	// files written in the current cycle when running in strict mode, nil means removal
+	stagedFiles map[string]*string
+	// namespaces that failed in the current cycle
+	failedNamespaces []string
+	// namespace of every output @id of the last render
+	outputs      map[string]string
+	outputsMutex sync.RWMutex
+	// last good config of every namespace and the rolled back namespaces with the hash of
+	// their config at the time of the rollback
+	lastGood      map[string]*LastGoodConfig
+	rollbacks     map[string]string
+	lastGoodMutex sync.Mutex
+	// file buffers of the applied configs by namespace, the ones of the current cycle
+	// until it succeeds, and the outputs whose file buffer the current cycle moves or removes
+	fileBuffers      map[string]map[string]string
+	nextFileBuffers  map[string]map[string]string
+	disruptedOutputs []string
+	// successful renders of the last run by namespace, reused for the namespaces whose input
+	// did not change, and the render environment of the current run
+	renderCache map[string]*cachedRender
+	renderEnv   string
+	// the collision warnings of the last run by namespace
+	collisionWarnings map[string]string
+	// configs served for debugging, the ones of the current cycle until it succeeds
+	debug      *debugConfigs
+	nextDebug  *debugConfigs
+	debugMutex sync.RWMutex
 }
 
 func ensureDirExists(dir string) {
@@ -48,16 +96,32 @@ func ensureDirExists(dir string) {
 }
 
 func (g *Generator) makeNamespaceConfiguration(ns *datasource.NamespaceConfig, genCtx *processors.GenerationContext, mode int) (string, string, error) {
+	ns = g.withNamespaceDefault(ns)
+
 	// unconfigured namespace
 	if ns.FluentdConfig == "" {
 		return "", "", nil
 	}
 
-	fragment, err := fluentd.ParseString(ns.FluentdConfig)
+	if err := g.checkConfigBytes(ns); err != nil {
+		return "", "", err
+	}
+
+	ns, err := g.withSnippets(ns)
 	if err != nil {
 		return "", "", err
 	}
 
+	cfg := g.cfg.Current()
+	fragment, err := parseNamespaceConfig(ns, cfg.ParsedTemplateEnv, cfg.StrictTemplating)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := g.checkRuleCount(fragment); err != nil {
+		return "", "", err
+	}
+
 	ctx := g.makeContext(ns, genCtx)
 
 	if mode == onlyPrepare {
@@ -66,7 +130,7 @@ func (g *Generator) makeNamespaceConfiguration(ns *datasource.NamespaceConfig, g
 			return "", "", err
 		}
 
-		return "", prep.String(), nil
+		return "", g.pinToWorker(ns.Name, prep).String(), nil
 	}
 
 	if mode == onlyProcess {
@@ -99,6 +163,8 @@ func extractPrepConfig(ns string, prepareConfigs map[string]interface{}) (string
 
 // nolint:gocognit
 func (g *Generator) renderMainFile(ctx context.Context, mainFile string, outputDir string, dest string) (map[string]string, error) {
+	cfg := g.cfg.Current()
+
 	tmpl, err := template.New(filepath.Base(mainFile)).ParseFiles(mainFile)
 	if err != nil {
 		return nil, err
@@ -115,19 +181,37 @@ func (g *Generator) renderMainFile(ctx context.Context, mainFile string, outputD
 		FluentdLogLevel         string
 		BufferMountFolder       string
 		PreprocessingDirectives []string
-	}{}
+		DeadLetter              string
+		Aggregators             string
+		MonitorAgentHost        string
+		MonitorAgentPort        string
+		Workers                 int
+		SingleFile              bool
+		AdminConfig             string
+		AdminAppend             bool
+		AdminAppendConfig       string
+		NamespaceConfigs        []string
+	}{
+		Workers:    cfg.FluentdWorkers,
+		SingleFile: g.singleFile(),
+	}
+
+	if cfg.MetaKey != "" {
+		model.MetaKey = cfg.MetaKey
+		model.MetaValue = util.ToRubyMapLiteral(cfg.ParsedMetaValues)
+	}
 
-	if g.cfg.MetaKey != "" {
-		model.MetaKey = g.cfg.MetaKey
-		model.MetaValue = util.ToRubyMapLiteral(g.cfg.ParsedMetaValues)
+	if cfg.FluentdLogLevel != "" {
+		model.FluentdLogLevel = cfg.FluentdLogLevel
 	}
 
-	if g.cfg.FluentdLogLevel != "" {
-		model.FluentdLogLevel = g.cfg.FluentdLogLevel
+	if cfg.BufferMountFolder != "" {
+		model.BufferMountFolder = cfg.BufferMountFolder
 	}
 
-	if g.cfg.BufferMountFolder != "" {
-		model.BufferMountFolder = g.cfg.BufferMountFolder
+	if cfg.FluentdMonitorAddr != "" {
+		// validated already
+		model.MonitorAgentHost, model.MonitorAgentPort, _ = net.SplitHostPort(cfg.FluentdMonitorAddr)
 	}
 
 	genCtx := &processors.GenerationContext{
@@ -135,125 +219,553 @@ func (g *Generator) renderMainFile(ctx context.Context, mainFile string, outputD
 	}
 
 	prepareConfigs := g.generatePrepareConfigs(genCtx)
+	renderedConfigs := map[string]string{}
 
 	// process the admin namespace first to collect the virtual plugins
 	for _, nsConf := range g.model {
-		if nsConf.Name != g.cfg.AdminNamespace {
+		if nsConf.Name != cfg.AdminNamespace {
 			continue
 		}
 
-		model.AdminNamespace = true
+		model.AdminNamespace = !g.adminAppendOnly()
+		model.AdminAppend = g.adminAppendOnly() || cfg.AdminConfigPosition == config.AdminConfigBoth
 
-		fragment, err := fluentd.ParseString(nsConf.FluentdConfig)
+		// the default namespace config is merged into the namespace configs instead
+		adminConfig, _ := splitNamespaceDefault(nsConf.FluentdConfig)
+		fragment, err := fluentd.ParseString(adminConfig)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("the config of the admin namespace %s: %v", nsConf.Name, err)
 		}
 
 		fragment = processors.ExtractPlugins(genCtx, fragment)
+		g.setPlugins(genCtx.Plugins)
 
 		// normalize system config
-		renderedConfig := fragment.String()
+		prependConfig, appendConfig, err := g.splitAdminConfig(adminConfig, fragment)
+		if err != nil {
+			return nil, fmt.Errorf("the config of the admin namespace %s: %v", nsConf.Name, err)
+		}
+		renderedConfig := prependConfig + appendConfig
+		renderedConfigs[nsConf.Name] = renderedConfig
 		fileHashesByNs[nsConf.Name] = util.Hash("", renderedConfig)
 		// don't validate the admin namespace, just render it
-		err = util.WriteStringToFile(filepath.Join(outputDir, "admin-ns.conf"), renderedConfig)
-		if err != nil {
-			logrus.Infof("Cannot store config file for namespace %s", nsConf.Name)
+		if g.singleFile() {
+			model.AdminConfig = prependConfig
+			model.AdminAppendConfig = appendConfig
+			break
+		}
+
+		if model.AdminNamespace {
+			if err = g.writeFile(filepath.Join(outputDir, adminConfigFile), prependConfig); err != nil {
+				logrus.Infof("Cannot store config file for namespace %s", nsConf.Name)
+			}
+		}
+
+		if model.AdminAppend {
+			if err = g.writeFile(filepath.Join(outputDir, adminAppendConfigFile), appendConfig); err != nil {
+				logrus.Infof("Cannot store config file for namespace %s", nsConf.Name)
+			}
 		}
 
 		break
 	}
 
+	if cfg.DeadLetterPlugin != "" {
+		if plugin, ok := genCtx.Plugins[cfg.DeadLetterPlugin]; ok {
+			model.DeadLetter = processors.MakeDeadLetterLabel(plugin).String()
+		} else {
+			logrus.Warnf("Dead-letter plugin %s is not defined in the admin namespace %s, error events are not routed", cfg.DeadLetterPlugin, cfg.AdminNamespace)
+		}
+	}
+
+	if cfg.AggregatorLabel != "" {
+		for name, plugin := range cfg.Aggregators {
+			if _, ok := genCtx.Plugins[plugin]; !ok {
+				logrus.Warnf("Plugin %s of aggregator %s is not defined in the admin namespace %s, the namespaces using it fail", plugin, name, cfg.AdminNamespace)
+			}
+		}
+		model.Aggregators = processors.MakeAggregatorLabels(genCtx.Plugins, cfg.Aggregators).String()
+	}
+
+	// process serially, the generation context is shared, but validate concurrently
+	g.renderEnv = g.renderEnvironment(genCtx)
+	renders := []*namespaceRender{}
 	for _, nsConf := range g.model {
-		if nsConf.Name == g.cfg.AdminNamespace {
+		if nsConf.Name == cfg.AdminNamespace {
 			continue
 		}
+		renders = append(renders, g.processNamespace(ctx, nsConf, genCtx, prepareConfigs))
+	}
 
-		var renderedConfig, configHash string
-
-		prepConfig, err := extractPrepConfig(nsConf.Name, prepareConfigs)
+	g.validateNamespaces(ctx, renders)
+	g.checkDuplicateRouting(renderedConfigs, renders)
+	g.cacheRenders(renders)
+	g.forgetLastGood()
+	g.recordLintFindings(renders)
 
-		if err == nil {
-			// render config
-			renderedConfig, _, err = g.makeNamespaceConfiguration(nsConf, genCtx, onlyProcess)
-			configHash = util.Hash("", renderedConfig+prepConfig)
+	for _, r := range renders {
+		start := time.Now()
+		nsConf := r.nsConf
+		configHash, prepConfig, renderedConfig := g.renderNamespaceFile(ctx, r, outputDir)
+		fileHashesByNs[nsConf.Name] = configHash
+		g.recordConfigHash(nsConf, configHash, renderedConfig != "")
+		if renderedConfig != "" {
+			renderedConfigs[nsConf.Name] = renderedConfig
+			if g.singleFile() {
+				model.NamespaceConfigs = append(model.NamespaceConfigs, renderedConfig)
+			} else {
+				newFiles = append(newFiles, fmt.Sprintf("ns-%s.conf", nsConf.Name))
+			}
+			model.PreprocessingDirectives = append(model.PreprocessingDirectives, prepConfig)
 		}
+		metrics.ObserveNamespaceDurationMetric(nsConf.Name, len(nsConf.MiniContainers), metrics.PhaseGenerate, cfg.PerNamespaceMetrics, r.duration+time.Since(start))
+	}
 
-		if err != nil {
-			configHash = util.Hash("ERROR", err.Error())
-			logrus.Infof("Configuration for namespace %s cannot be validated: %+v", nsConf.Name, err)
-			if nsConf.PreviousConfigHash != configHash {
-				g.updateStatus(ctx, nsConf.Name, err.Error())
-			}
-			fileHashesByNs[nsConf.Name] = configHash
-			continue
+	if cfg.FluentdMonitorAddr != "" {
+		g.recordOutputIDs(renderedConfigs)
+	}
+
+	if cfg.BufferDrainTimeout > 0 {
+		g.detectDisruptedBuffers(renderedConfigs)
+	}
+
+	model.Namespaces = newFiles
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, model)
+	if err != nil {
+		return nil, fmt.Errorf("cannot assemble %s from the admin namespace and %d namespaces: %v", filepath.Base(dest), len(renders), err)
+	}
+
+	err = g.writeFile(dest, buf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	g.stageDebugConfigs(buf.String(), renderedConfigs, fileHashesByNs)
+	return fileHashesByNs, nil
+}
+
+// namespaceRender holds the processed config of a namespace until it is validated and written
+type namespaceRender struct {
+	nsConf            *datasource.NamespaceConfig
+	prepConfig        string
+	renderedConfig    string
+	configHash        string
+	validationTrailer string
+	// processing error
+	err error
+	// fluentd validator error
+	validationErr error
+	// time spent processing and validating
+	duration time.Duration
+	// the last good config is used instead of the current one
+	rolledBack bool
+	// lint findings of the namespace config
+	findings []*fluentd.LintFinding
+	// the status message of a namespace disabled by the cluster admin, whose config is replaced
+	disabled string
+	// set when the Secrets referenced by the config could not be checked
+	secretsWarning string
+	// the render of the previous run is reused, it is not validated again
+	reused bool
+	// set when the config routes the same container logs as other namespaces
+	collisionWarning string
+	// the collision warning differs from the previous run, the status must be written again
+	collisionChanged bool
+}
+
+// processNamespace runs the processors over the config of a single namespace
+func (g *Generator) processNamespace(ctx context.Context, nsConf *datasource.NamespaceConfig, genCtx *processors.GenerationContext, prepareConfigs map[string]interface{}) *namespaceRender {
+	if r := g.disabledRender(nsConf); r != nil {
+		return r
+	}
+
+	// the config could not be read or needs missing plugins, the namespace fails like a config
+	// that cannot be processed
+	err := nsConf.FetchError
+	if err == nil {
+		err = g.requiredPluginErrors[nsConf.Name]
+	}
+	if err != nil {
+		return &namespaceRender{
+			nsConf:     nsConf,
+			err:        err,
+			configHash: util.Hash("ERROR", err.Error()),
 		}
+	}
 
-		// namespace is not configured
-		if renderedConfig == "" {
-			fileHashesByNs[nsConf.Name] = configHash
-			if nsConf.PreviousConfigHash != configHash {
-				// empty config is a valid input, clear error status
-				g.updateStatus(ctx, nsConf.Name, "")
-			}
-			// If a config file had been created, remove it
-			unusedFile := filepath.Join(outputDir, fmt.Sprintf("ns-%s.conf", nsConf.Name))
-			err := os.Remove(unusedFile)
-			if err != nil && !os.IsNotExist(err) {
-				logrus.Warnf("Error removing unused file %s: %+v", unusedFile, err)
-			}
-			continue
+	if r := g.rolledBackRender(nsConf); r != nil {
+		return r
+	}
+
+	if r := g.reusedRender(nsConf, prepareConfigs); r != nil {
+		return r
+	}
+
+	_, span := metrics.StartNamespaceSpan(ctx, metrics.SpanGenerate, nsConf.Name)
+	start := time.Now()
+	r := &namespaceRender{nsConf: nsConf}
+	defer func() { metrics.EndSpan(span, r.err) }()
+
+	prepConfig, err := extractPrepConfig(nsConf.Name, prepareConfigs)
+	if err == nil {
+		r.prepConfig = prepConfig
+		r.renderedConfig, _, err = g.makeNamespaceConfiguration(nsConf, genCtx, onlyProcess)
+		r.configHash = util.Hash("", r.renderedConfig+prepConfig)
+	}
+
+	if err == nil {
+		r.findings = g.lint(nsConf)
+		if msg := fluentd.LintMessage(r.findings, fluentd.LintError); msg != "" {
+			err = datasource.NewPhaseError(datasource.ErrorPhaseLint, fmt.Errorf("lint errors: %s", msg))
 		}
+	}
 
-		var validationTrailer string
+	if err == nil {
+		r.secretsWarning, err = g.checkSecretRefs(ctx, nsConf)
+	}
 
-		if g.validator != nil {
-			validationTrailer = g.makeValidationTrailer(nsConf, genCtx).String()
-			err = g.validator.ValidateConfigExtremely(renderedConfig+"\n# validation  trailer:\n"+validationTrailer, nsConf.Name)
+	if err != nil {
+		r.err = err
+		r.configHash = util.Hash("ERROR", err.Error())
+	} else if r.renderedConfig != "" && g.validator != nil {
+		r.validationTrailer = g.makeValidationTrailer(nsConf, genCtx).String()
+	}
 
-			if err != nil {
-				logrus.Infof("Configuration for namespace %s cannot be validated with fluentd validator", nsConf.Name)
-				if nsConf.PreviousConfigHash != configHash {
-					// only update status if error caused by different input
-					g.updateStatus(ctx, nsConf.Name, err.Error())
-				}
-				fileHashesByNs[nsConf.Name] = configHash
-				continue
+	r.duration = time.Since(start)
+	return r
+}
+
+// validateNamespaces runs the fluentd validator over the processed configs using at most
+// ValidationConcurrency goroutines
+func (g *Generator) validateNamespaces(ctx context.Context, renders []*namespaceRender) {
+	if g.validator == nil {
+		return
+	}
+
+	workers := g.cfg.ValidationConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan *namespaceRender)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				_, span := metrics.StartNamespaceSpan(ctx, metrics.SpanValidate, r.nsConf.Name)
+				start := time.Now()
+				r.validationErr = g.validator.ValidateConfigExtremely(r.renderedConfig+"\n# validation  trailer:\n"+r.validationTrailer, r.nsConf.Name)
+				r.duration += time.Since(start)
+				metrics.EndSpan(span, r.validationErr)
 			}
+		}()
+	}
+
+	for _, r := range renders {
+		if r.err == nil && r.renderedConfig != "" && !r.rolledBack && r.disabled == "" && !r.reused {
+			queue <- r
 		}
+	}
+	close(queue)
+	wg.Wait()
+}
 
-		filename := fmt.Sprintf("ns-%s.conf", nsConf.Name)
-		newFiles = append(newFiles, filename)
-		model.PreprocessingDirectives = append(model.PreprocessingDirectives, prepConfig)
-		fileHashesByNs[nsConf.Name] = configHash
+// renderNamespaceFile records the outcome of a processed and validated namespace and writes its config file.
+// It returns the config hash, the preprocessing directives for the main file and the rendered
+// config, empty if the namespace must not be included. The file is not written in single file layout
+func (g *Generator) renderNamespaceFile(ctx context.Context, r *namespaceRender, outputDir string) (string, string, string) {
+	nsConf := r.nsConf
+	configHash := r.configHash
+	renderedConfig := r.renderedConfig
+	prepConfig := r.prepConfig
+	g.getStatus(nsConf.Name).Findings = r.findings
+
+	if err := r.err; err != nil {
+		logrus.Infof("Configuration for namespace %s cannot be validated: %+v", nsConf.Name, err)
+		g.failedNamespaces = append(g.failedNamespaces, nsConf.Name)
+		g.updateStatusError(ctx, nsConf, configHash, datasource.ErrorPhase(err), err)
+		return configHash, "", g.quarantine(nsConf, outputDir)
+	}
+
+	// namespace is not configured
+	if renderedConfig == "" {
+		if nsConf.PreviousConfigHash != configHash {
+			// empty config is a valid input, clear error status
+			g.updateStatus(ctx, nsConf.Name, configHash, "")
+		}
+		// If a config file had been created, remove it
+		unusedFile := filepath.Join(outputDir, fmt.Sprintf("ns-%s.conf", nsConf.Name))
+		err := g.removeFile(unusedFile)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Error removing unused file %s: %+v", unusedFile, err)
+		}
+		return configHash, "", ""
+	}
+
+	if err := r.validationErr; err != nil {
+		logrus.Infof("Configuration for namespace %s cannot be validated with fluentd validator", nsConf.Name)
+		g.failedNamespaces = append(g.failedNamespaces, nsConf.Name)
+		g.updateStatusError(ctx, nsConf, configHash, datasource.ErrorPhaseValidation, err)
+		return configHash, "", g.quarantine(nsConf, outputDir)
+	}
+
+	if !g.singleFile() {
+		fileConfig := renderedConfig
 		if g.cfg.FsDatasourceDir != "" {
 			// if the source is the filesystem, preserve the validation trailer
 			// so that generated files are valid in isolation
-			renderedConfig = renderedConfig + "\n# validation  trailer:\n" + validationTrailer
+			fileConfig = fileConfig + "\n# validation  trailer:\n" + r.validationTrailer
 		}
-		err = util.WriteStringToFile(filepath.Join(outputDir, filename), renderedConfig)
+		err := g.writeFile(filepath.Join(outputDir, fmt.Sprintf("ns-%s.conf", nsConf.Name)), fileConfig)
 		if err != nil {
 			logrus.Infof("Cannot store config file for namespace %s", nsConf.Name)
 		}
+	}
+
+	if r.disabled != "" {
+		if nsConf.PreviousConfigHash != configHash {
+			g.updateStatusDisabled(ctx, nsConf.Name, configHash, r.disabled)
+		}
+		return configHash, prepConfig, renderedConfig
+	}
 
+	g.recordLastGood(r)
+
+	if r.rolledBack {
 		if nsConf.PreviousConfigHash != configHash {
+			g.updateStatusWarning(ctx, nsConf.Name, configHash, rolledBackWarning)
+		}
+	} else if nsConf.PreviousConfigHash != configHash || r.collisionChanged {
+		metrics.IncNamespaceConfigAppliedMetric(nsConf.Name)
+		warnings := []string{}
+		if r.collisionWarning != "" {
+			warnings = append(warnings, r.collisionWarning)
+		}
+		if warning := g.findUnroutedTags(nsConf, renderedConfig, prepConfig); warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if msg := fluentd.LintMessage(r.findings, fluentd.LintWarn); msg != "" {
+			warnings = append(warnings, "warning: lint: "+msg)
+		}
+		if r.secretsWarning != "" {
+			warnings = append(warnings, r.secretsWarning)
+		}
+
+		if len(warnings) > 0 {
+			g.updateStatusWarning(ctx, nsConf.Name, configHash, strings.Join(warnings, "; "))
+		} else {
 			// clear error
-			g.updateStatus(ctx, nsConf.Name, "")
+			g.updateStatus(ctx, nsConf.Name, configHash, "")
+			g.recordEvent(nsConf.Name, datasource.EventTypeNormal, datasource.EventReasonApplied, "fluentd config generated and validated")
 		}
 	}
 
-	model.Namespaces = newFiles
-	buf := &bytes.Buffer{}
-	err = tmpl.Execute(buf, model)
+	return configHash, prepConfig, renderedConfig
+}
+
+// quarantine writes the config shipping the logs of a failed namespace to the QuarantinePlugin
+// and returns it. It returns an empty string if there is no quarantine
+func (g *Generator) quarantine(nsConf *datasource.NamespaceConfig, outputDir string) string {
+	quarantinePlugin := g.cfg.Current().QuarantinePlugin
+	if quarantinePlugin == "" {
+		return ""
+	}
+
+	plugin, ok := g.getPlugins()[quarantinePlugin]
+	if !ok {
+		logrus.Warnf("Quarantine plugin %s is not defined in the admin namespace %s, the logs of namespace %s are dropped", quarantinePlugin, g.cfg.AdminNamespace, nsConf.Name)
+		return ""
+	}
+
+	logrus.Warnf("Sending the logs of namespace %s to the quarantine plugin %s until its config is fixed", nsConf.Name, quarantinePlugin)
+	renderedConfig := processors.MakeQuarantineConfig(nsConf.Name, plugin).String()
+
+	if !g.singleFile() {
+		err := g.writeFile(filepath.Join(outputDir, fmt.Sprintf("ns-%s.conf", nsConf.Name)), renderedConfig)
+		if err != nil {
+			logrus.Infof("Cannot store config file for namespace %s", nsConf.Name)
+		}
+	}
+
+	return renderedConfig
+}
+
+// containerTags returns the tags of the container logs of a namespace, of all its containers when the
+// datasource lists them and of its mini containers otherwise
+func containerTags(nsConf *datasource.NamespaceConfig) []string {
+	tags := []string{}
+	if nsConf.Containers != nil {
+		for _, c := range nsConf.Containers {
+			tags = append(tags, fmt.Sprintf("kube.%s.%s.%s", nsConf.Name, c.PodName, c.Name))
+		}
+		return tags
+	}
+
+	for _, mc := range nsConf.MiniContainers {
+		if mc.Excluded {
+			continue
+		}
+		tags = append(tags, fmt.Sprintf("kube.%s.%s.%s", nsConf.Name, mc.PodName, mc.Name))
+	}
+	return tags
+}
+
+// findUnroutedTags returns a warning listing the tags produced for the namespace
+// that none of its <match> directives consume. Empty when the check is disabled
+func (g *Generator) findUnroutedTags(nsConf *datasource.NamespaceConfig, renderedConfig string, prepConfig string) string {
+	if !g.cfg.Current().WarnUnroutedTags {
+		return ""
+	}
+
+	fragment, err := fluentd.ParseString(renderedConfig)
 	if err != nil {
-		return nil, err
+		return ""
 	}
 
-	err = util.WriteStringToFile(dest, buf.String())
+	// container logs and the sources emitted for the namespace at preprocessing
+	tags := containerTags(nsConf)
+
+	prep, err := fluentd.ParseString(prepConfig)
+	if err == nil {
+		for _, dir := range prep {
+			if dir.Name == "source" && dir.Param("tag") != "" {
+				tags = append(tags, dir.Param("tag"))
+			}
+		}
+	}
+
+	// with --isolate-namespaces the records are routed inside the label of the namespace
+	unrouted := fluentd.FindUnroutedTags(processors.IsolatedBody(fragment, nsConf.Name), tags)
+	if len(unrouted) == 0 {
+		return ""
+	}
+
+	const maxReported = 10
+	more := ""
+	if len(unrouted) > maxReported {
+		more = fmt.Sprintf(" and %d more", len(unrouted)-maxReported)
+		unrouted = unrouted[:maxReported]
+	}
+
+	return fmt.Sprintf("warning: no <match> routes the tags %s%s", strings.Join(unrouted, ", "), more)
+}
+
+// ValidateNamespace runs a single namespace config through the same processing and
+// fluentd validation used when rendering to disk. Virtual plugins known from the last
+// render of the admin namespace are taken into account.
+func (g *Generator) ValidateNamespace(ns *datasource.NamespaceConfig) error {
+	ns, err := g.withRequiredPlugins(ns)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return fileHashesByNs, nil
+	validatedConfig, err := g.processForValidation(ns)
+	if err != nil || validatedConfig == "" {
+		return err
+	}
+	return g.validator.ValidateConfigExtremely(validatedConfig, ns.Name)
+}
+
+// processForValidation processes a single namespace config and returns it with its validation
+// trailer, ready for the fluentd validator. Empty if there is nothing to validate
+func (g *Generator) processForValidation(ns *datasource.NamespaceConfig) (string, error) {
+	genCtx := &processors.GenerationContext{
+		ReferencedBridges: map[string]bool{},
+		Plugins:           g.getPlugins(),
+	}
+
+	_, _, err := g.makeNamespaceConfiguration(ns, genCtx, onlyPrepare)
+	if err != nil {
+		return "", err
+	}
+
+	renderedConfig, _, err := g.makeNamespaceConfiguration(ns, genCtx, onlyProcess)
+	if err != nil {
+		return "", err
+	}
+
+	if renderedConfig == "" || g.validator == nil {
+		return "", nil
+	}
+
+	validationTrailer := g.makeValidationTrailer(ns, genCtx).String()
+	return renderedConfig + "\n# validation  trailer:\n" + validationTrailer, nil
+}
+
+// SetAdminConfig takes the virtual plugins and the default namespace config from the config of
+// the admin namespace, as a render would. For validating namespace configs without rendering
+func (g *Generator) SetAdminConfig(adminConfig string) error {
+	adminConfig, defaults := splitNamespaceDefault(adminConfig)
+	fragment, err := fluentd.ParseString(adminConfig)
+	if err != nil {
+		return err
+	}
+
+	genCtx := &processors.GenerationContext{
+		ReferencedBridges: map[string]bool{},
+	}
+	processors.ExtractPlugins(genCtx, fragment)
+	g.setPlugins(genCtx.Plugins)
+	g.setNamespaceDefault(defaults)
+	return nil
+}
+
+// splitAdminConfig returns the parts of the admin config going before and after the namespace configs.
+// In "both" position the sections named "append" go after, everything else before
+func (g *Generator) splitAdminConfig(raw string, fragment fluentd.Fragment) (string, string, error) {
+	switch g.cfg.AdminConfigPosition {
+	case config.AdminConfigAppend:
+		return "", fragment.String(), nil
+	case config.AdminConfigBoth:
+	default:
+		return fragment.String(), "", nil
+	}
+
+	prependText := []string{}
+	appendText := []string{}
+	for _, s := range fluentd.SplitSections(raw) {
+		if s.Name == adminAppendSection {
+			appendText = append(appendText, s.Text)
+		} else {
+			prependText = append(prependText, s.Text)
+		}
+	}
+
+	// every part must hold on its own: a section header inside a directive would cut it in half
+	render := func(part string, text []string) (string, error) {
+		frag, err := fluentd.ParseString(strings.Join(text, "\n"))
+		if err != nil {
+			return "", fmt.Errorf("bad %s part of the admin config: %+v", part, err)
+		}
+		// plugins are already extracted from the whole config
+		return processors.ExtractPlugins(&processors.GenerationContext{}, frag).String(), nil
+	}
+
+	prependConfig, err := render(config.AdminConfigPrepend, prependText)
+	if err != nil {
+		return "", "", err
+	}
+	appendConfig, err := render(config.AdminConfigAppend, appendText)
+	if err != nil {
+		return "", "", err
+	}
+
+	return prependConfig, appendConfig, nil
+}
+
+func (g *Generator) setPlugins(plugins map[string]*fluentd.Directive) {
+	g.pluginsMutex.Lock()
+	defer g.pluginsMutex.Unlock()
+	g.plugins = plugins
+}
+
+func (g *Generator) getPlugins() map[string]*fluentd.Directive {
+	g.pluginsMutex.RLock()
+	defer g.pluginsMutex.RUnlock()
+	return g.plugins
 }
 
 func (g *Generator) generatePrepareConfigs(genCtx *processors.GenerationContext) map[string]interface{} {
@@ -274,7 +786,13 @@ func (g *Generator) generatePrepareConfigs(genCtx *processors.GenerationContext)
 }
 
 func (g *Generator) makeValidationTrailer(ns *datasource.NamespaceConfig, genCtx *processors.GenerationContext) fluentd.Fragment {
-	fragment, err := fluentd.ParseString(ns.FluentdConfig)
+	ns, err := g.withSnippets(ns)
+	if err != nil {
+		return nil
+	}
+
+	cfg := g.cfg.Current()
+	fragment, err := parseNamespaceConfig(ns, cfg.ParsedTemplateEnv, cfg.StrictTemplating)
 	if err != nil {
 		return nil
 	}
@@ -285,25 +803,101 @@ func (g *Generator) makeValidationTrailer(ns *datasource.NamespaceConfig, genCtx
 }
 
 func (g *Generator) makeContext(ns *datasource.NamespaceConfig, genCtx *processors.GenerationContext) *processors.ProcessorContext {
+	cfg := g.cfg.Current()
+
 	ctx := &processors.ProcessorContext{
-		Namespace:         ns.Name,
-		NamespaceLabels:   ns.Labels,
-		AllowFile:         g.cfg.AllowFile,
-		DeploymentID:      g.cfg.ID,
-		MiniContainers:    ns.MiniContainers,
-		KubeletRoot:       g.cfg.KubeletRoot,
-		BufferMountFolder: g.cfg.BufferMountFolder,
-		GenerationContext: genCtx,
-		AllowTagExpansion: g.cfg.AllowTagExpansion,
+		Namespace:            ns.Name,
+		NamespaceLabels:      ns.Labels,
+		NamespaceAnnotations: ns.Annotations,
+		MetadataFields:       cfg.MetadataFields,
+		AllowFile:            cfg.AllowFile,
+		DeploymentID:         cfg.ID,
+		MiniContainers:       ns.MiniContainers,
+		KubeletRoot:          cfg.KubeletRoot,
+		BufferMountFolder:    cfg.BufferMountFolder,
+		GenerationContext:    genCtx,
+		AllowTagExpansion:    cfg.AllowTagExpansion,
+		AllowedTailPaths:     cfg.AllowedTailPaths,
+		AllowedPlugins:       cfg.AllowedPlugins,
+		DeniedPlugins:        cfg.DeniedPlugins,
+		ReservedTagPrefixes:  cfg.ReservedTagPrefixes,
+		OutputHostOverride:   cfg.OutputHostOverride,
+		DeadLetterEnabled:    cfg.DeadLetterPlugin != "",
+		MaxFlushThreads:      g.maxFlushThreads(ns),
+		MaxOutputs:           cfg.MaxOutputsPerNamespace,
+		FanOutPlugins:        g.fanOutPlugins(ns),
+		DefaultTimeFormat:    g.defaultTimeFormat(ns),
+		DefaultTimezone:      cfg.DefaultTimezone,
+		AssignOutputIDs:      cfg.FluentdMonitorAddr != "",
+		IsolateNamespaces:    cfg.IsolateNamespaces,
+		Aggregator:           g.aggregator(ns),
+		Aggregators:          cfg.Aggregators,
+		Sources:              g.namespaceSources(ns),
+		SourceTemplates:      cfg.ParsedNamespaceSources,
+		DefaultOutput:        g.defaultOutput(ns),
+		BufferProfile:        g.bufferProfile(ns),
+		RetryPolicy: &processors.RetryPolicy{
+			DefaultMaxTimes: cfg.DefaultRetryMaxTimes,
+			MaxMaxTimes:     cfg.MaxRetryMaxTimes,
+			DefaultWait:     cfg.DefaultRetryWait,
+			MinWait:         cfg.MinRetryWait,
+			DefaultTimeout:  cfg.DefaultRetryTimeout,
+			MaxTimeout:      cfg.MaxRetryTimeout,
+		},
 	}
 	return ctx
 }
 
-func (g *Generator) updateStatus(ctx context.Context, namespace string, status string) {
+func (g *Generator) updateStatus(ctx context.Context, namespace string, configHash string, status string) {
 	metrics.SetNamespaceConfigStatusMetric(namespace, status == "")
+	if status == "" {
+		g.recordStatus(namespace, datasource.StatusOK, "", "")
+	} else {
+		g.recordStatus(namespace, datasource.StatusError, datasource.ErrorPhaseRender, status)
+	}
+	g.writeStatus(ctx, namespace, configHash, status)
+}
+
+// writeStatus stores the status annotation of a namespace. With --status-format=json it is the
+// structured status about the given config hash, written for the namespaces that are ok too
+func (g *Generator) writeStatus(ctx context.Context, namespace string, configHash string, status string) {
+	if g.cfg.StatusFormat == config.StatusFormatJSON {
+		status = datasource.NewStatusAnnotation(status, configHash).String()
+	}
 	g.su.UpdateStatus(ctx, namespace, status)
 }
 
+// updateStatusError counts the failure of a namespace and stores the error with its phase.
+// Like other statuses it is only written if the error is caused by a different input
+func (g *Generator) updateStatusError(ctx context.Context, nsConf *datasource.NamespaceConfig, configHash string, phase string, err error) {
+	metrics.IncNamespaceErrorsMetric(phase)
+	metrics.IncNamespaceConfigErrorsMetric(nsConf.Name)
+	if nsConf.PreviousConfigHash == configHash {
+		return
+	}
+
+	metrics.SetNamespaceConfigStatusMetric(nsConf.Name, false)
+	g.recordStatus(nsConf.Name, datasource.StatusError, phase, err.Error())
+	g.writeStatus(ctx, nsConf.Name, configHash, err.Error())
+	g.recordEvent(nsConf.Name, datasource.EventTypeWarning, datasource.EventReasonInvalid, err.Error())
+}
+
+// updateStatusWarning stores a warning for a namespace whose config is nevertheless applied
+func (g *Generator) updateStatusWarning(ctx context.Context, namespace string, configHash string, warning string) {
+	metrics.SetNamespaceConfigStatusMetric(namespace, true)
+	g.recordStatus(namespace, datasource.StatusWarning, "", warning)
+	g.writeStatus(ctx, namespace, configHash, warning)
+	g.recordEvent(namespace, datasource.EventTypeWarning, datasource.EventReasonWarning, warning)
+}
+
+// updateStatusDisabled stores the status of a namespace whose logging is disabled by the cluster admin
+func (g *Generator) updateStatusDisabled(ctx context.Context, namespace string, configHash string, message string) {
+	metrics.SetNamespaceConfigStatusMetric(namespace, true)
+	g.recordStatus(namespace, datasource.StatusDisabled, "", message)
+	g.writeStatus(ctx, namespace, configHash, message)
+	g.recordEvent(namespace, datasource.EventTypeNormal, datasource.EventReasonDisabled, message)
+}
+
 func (g *Generator) renderIncludableFile(templateFile string, dest string) {
 	tmpl, err := template.New(filepath.Base(templateFile)).ParseFiles(templateFile)
 	if err != nil {
@@ -313,12 +907,29 @@ func (g *Generator) renderIncludableFile(templateFile string, dest string) {
 
 	// this is the model for the includable files
 	model := struct {
-		ID                string
-		PrometheusEnabled bool
+		ID                      string
+		PrometheusEnabled       bool
+		PrometheusFilterEnabled bool
+		// the container log formats to parse
+		DockerLogs bool
+		CRILogs    bool
+		// the Kubernetes metadata fields kept on the records as Ruby strings, empty keeps them all
+		MetadataFields      string
+		MetadataAnnotations bool
 	}{
-		ID:                util.MakeFluentdSafeName(g.cfg.ID),
-		PrometheusEnabled: g.cfg.PrometheusEnabled,
+		ID:                      util.MakeFluentdSafeName(g.cfg.ID),
+		PrometheusEnabled:       g.cfg.PrometheusEnabled,
+		PrometheusFilterEnabled: g.cfg.EnablePrometheusFilter,
+		DockerLogs:              g.cfg.ContainerRuntime != config.ContainerRuntimeContainerd && g.cfg.ContainerRuntime != config.ContainerRuntimeCRIO,
+		CRILogs:                 g.cfg.ContainerRuntime != config.ContainerRuntimeDocker,
+	}
+
+	fields := make([]string, 0, len(g.cfg.MetadataFields))
+	for _, field := range g.cfg.MetadataFields {
+		fields = append(fields, fmt.Sprintf("'%s'", field))
+		model.MetadataAnnotations = model.MetadataAnnotations || field == "annotations" || field == "namespace_annotations"
 	}
+	model.MetadataFields = strings.Join(fields, ", ")
 
 	buf := &bytes.Buffer{}
 	err = tmpl.Execute(buf, model)
@@ -327,11 +938,31 @@ func (g *Generator) renderIncludableFile(templateFile string, dest string) {
 		return
 	}
 
-	util.WriteStringToFile(dest, buf.String())
+	g.writeFile(dest, buf.String())
 }
 
-// CleanupUnusedFiles removes "ns-*.conf" files of namespaces that are no more existent
+// CleanupUnusedFiles removes "ns-*.conf" files of namespaces that are no more existent.
+// In single file layout all namespace files are unused, and so are the admin files the
+// --admin-config-position does not use
 func (g *Generator) CleanupUnusedFiles(outputDir string, namespaces map[string]string) {
+	if g.cfg.DryRun {
+		return
+	}
+
+	unusedAdminFiles := []string{}
+	if g.singleFile() || g.adminAppendOnly() {
+		unusedAdminFiles = append(unusedAdminFiles, adminConfigFile)
+	}
+	if g.singleFile() || (!g.adminAppendOnly() && g.cfg.AdminConfigPosition != config.AdminConfigBoth) {
+		unusedAdminFiles = append(unusedAdminFiles, adminAppendConfigFile)
+	}
+	for _, name := range unusedAdminFiles {
+		adminFile := filepath.Join(outputDir, name)
+		if err := os.Remove(adminFile); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Error removing unused file %s: %+v", adminFile, err)
+		}
+	}
+
 	files, err := filepath.Glob(fmt.Sprintf("%s/ns-*.conf", outputDir))
 	if err != nil {
 		logrus.Warnf("Error finding unused files: %+v", err)
@@ -340,11 +971,14 @@ func (g *Generator) CleanupUnusedFiles(outputDir string, namespaces map[string]s
 
 	for _, f := range files {
 		ns := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "ns-"), ".conf")
-		if _, ok := namespaces[ns]; !ok {
+		_, ok := namespaces[ns]
+		if !ok || g.singleFile() {
 			if err := os.Remove(f); err != nil {
 				logrus.Warnf("Error removing unused file %s: %+v", f, err)
 			}
-			metrics.DeleteNamespaceConfigStatusMetric(ns)
+		}
+		if !ok {
+			metrics.DeleteNamespaceMetrics(ns)
 		}
 	}
 }
@@ -354,6 +988,11 @@ func (g *Generator) RenderToDisk(ctx context.Context, outputDir string) (map[str
 	ensureDirExists(outputDir)
 	outputDir, _ = filepath.Abs(outputDir)
 	res := map[string]string{}
+	g.failedNamespaces = nil
+	g.nextFileBuffers = nil
+	g.nextDebug = nil
+	g.disruptedOutputs = nil
+	defer g.discardStagedFiles()
 
 	files, err := filepath.Glob(fmt.Sprintf("%s/*.conf", g.templatesDir))
 	if err != nil {
@@ -369,18 +1008,74 @@ func (g *Generator) RenderToDisk(ctx context.Context, outputDir string) (map[str
 		} else {
 			res, err = g.renderMainFile(ctx, f, outputDir, targetDest)
 			if err != nil {
-				logrus.Warnf("Cannot write main file %s: %+v", f, err)
+				g.combinedConfigFailed(err)
 				return nil, err
 			}
 		}
 	}
 
+	if g.cfg.Current().StrictMode && len(g.failedNamespaces) > 0 {
+		return nil, fmt.Errorf("strict mode: keeping the last applied config as namespaces %s failed",
+			strings.Join(g.failedNamespaces, ", "))
+	}
+
+	if err := g.commitStagedFiles(); err != nil {
+		g.combinedConfigFailed(err)
+		return nil, err
+	}
+	metrics.SetCombinedConfigLastSuccessMetric(time.Now())
+
+	if g.nextFileBuffers != nil {
+		g.fileBuffers = g.nextFileBuffers
+	}
+
+	if g.nextDebug != nil {
+		g.debugMutex.Lock()
+		previous := g.debug
+		g.debug = g.nextDebug
+		g.debugMutex.Unlock()
+		g.logConfigDiffs(g.nextDebug, previous)
+	}
+
 	return res, nil
 }
 
+// combinedConfigFailed reports that the combined config could not be assembled or written, none
+// of its files are written so fluentd keeps running with the previous one
+func (g *Generator) combinedConfigFailed(err error) {
+	metrics.IncCombinedConfigFailuresMetric()
+	logrus.Errorf("Cannot generate the combined fluentd config, keeping the previous one: %v", err)
+}
+
+// singleFile tells if the namespace configs are inlined in the main file instead of included
+func (g *Generator) singleFile() bool {
+	return g.cfg.OutputLayout == config.OutputLayoutSingle
+}
+
+func (g *Generator) adminAppendOnly() bool {
+	return g.cfg.AdminConfigPosition == config.AdminConfigAppend
+}
+
 // SetModel stores the model for later
 func (g *Generator) SetModel(model []*datasource.NamespaceConfig) {
-	g.model = model
+	// the @required_plugin lines are checked once here, the processors never see them
+	g.model = make([]*datasource.NamespaceConfig, 0, len(model))
+	g.requiredPluginErrors = map[string]error{}
+	for _, nsConf := range model {
+		nsConf, err := g.withRequiredPlugins(nsConf)
+		if err != nil {
+			g.requiredPluginErrors[nsConf.Name] = err
+		}
+		g.model = append(g.model, nsConf)
+	}
+
+	defaults := ""
+	for _, nsConf := range g.model {
+		if nsConf.Name == g.cfg.AdminNamespace {
+			_, defaults = splitNamespaceDefault(nsConf.FluentdConfig)
+		}
+	}
+	g.setNamespaceDefault(defaults)
 }
 
 // SetStatusUpdater configures a statusUpdater for later. nil updater is fine
@@ -395,11 +1090,20 @@ func New(ctx context.Context, cfg *config.Config) *Generator {
 
 	if cfg.FluentdValidateCommand != "" {
 		validator = fluentd.NewValidator(ctx, cfg.FluentdValidateCommand, time.Second*time.Duration(cfg.ExecTimeoutSeconds))
+		validator = fluentd.NewLimitedValidator(validator, cfg.ValidationConcurrency)
+		// a cached config does not wait for a free validation process
+		if cfg.ValidationCacheSize > 0 {
+			validator = fluentd.NewCachingValidator(validator, cfg.ValidationCacheSize)
+		}
 	}
 
 	return &Generator{
 		templatesDir: templatesDir,
 		cfg:          cfg,
 		validator:    validator,
+		statuses:     map[string]*datasource.NamespaceStatus{},
+		stagedFiles:  map[string]*string{},
+		lastGood:     loadLastGood(cfg.LastGoodDir),
+		rollbacks:    map[string]string{},
 	}
 }
@@ -0,0 +1,30 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// SetSnippetReader configures where the shared snippets of the @include directives are read from.
+// nil, without --snippets-namespace, leaves every @include line to fluentd
+func (g *Generator) SetSnippetReader(r datasource.SnippetReader) {
+	g.snippets = r
+}
+
+// withSnippets returns the namespace with the shared snippets its config includes inlined
+func (g *Generator) withSnippets(ns *datasource.NamespaceConfig) (*datasource.NamespaceConfig, error) {
+	if !datasource.HasIncludes(ns.FluentdConfig) {
+		return ns, nil
+	}
+
+	config, err := datasource.ResolveIncludes(ns.FluentdConfig, g.snippets)
+	if err != nil {
+		return nil, err
+	}
+
+	res := *ns
+	res.FluentdConfig = config
+	return &res, nil
+}
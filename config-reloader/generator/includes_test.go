@@ -0,0 +1,68 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticSnippets map[string]string
+
+func (s staticSnippets) Snippet(name string, key string) (string, bool, error) {
+	snippet, ok := s[name+"/"+key]
+	return snippet, ok, nil
+}
+
+func TestIncludesSharedSnippets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "includes")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	}
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, su)
+	g.SetSnippetReader(staticSnippets{
+		"outputs/drop-health": "<match $labels(probe=health)>\n  @type null\n</match>",
+	})
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "good", FluentdConfig: "@include outputs/drop-health\n<match **>\n  @type null\n</match>\n"},
+		{Name: "broken", FluentdConfig: "@include outputs/missing\n<match **>\n  @type null\n</match>\n"},
+		{Name: "native", FluentdConfig: "<match **>\n  @type null\n  @include /etc/fluentd/extra.conf\n</match>\n"},
+	}
+	g.SetModel(namespaces)
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", su.statuses["good"])
+	content, err := ioutil.ReadFile(filepath.Join(dir, "ns-good.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "probe")
+	assert.NotContains(t, string(content), "@include")
+
+	assert.Equal(t, "@include outputs/missing: no such shared snippet, key missing of configmap outputs", su.statuses["broken"])
+
+	// a native fluentd include is handed to fluentd as is
+	assert.Equal(t, "", su.statuses["native"])
+	content, err = ioutil.ReadFile(filepath.Join(dir, "ns-native.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "@include /etc/fluentd/extra.conf")
+
+	summary := g.StatusSummary(namespaces)
+	assert.Equal(t, datasource.ErrorPhaseValidation, summary["broken"].Phase)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsolatedNamespacesOnlySeeTheirRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isolation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:      "../templates",
+		AdminNamespace:    "kube-system",
+		OutputLayout:      config.OutputLayoutSingle,
+		IsolateNamespaces: true,
+	}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "a", FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.a\n</match>\n"},
+		{Name: "b", FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.b\n</match>\n"},
+	}
+	g.SetModel(namespaces)
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	main, err := ioutil.ReadFile(filepath.Join(dir, mainConfigFile))
+	assert.Nil(t, err)
+	// the parser does not know about @include
+	lines := []string{}
+	for _, line := range strings.Split(string(main), "\n") {
+		if !strings.HasPrefix(line, "@include") {
+			lines = append(lines, line)
+		}
+	}
+	fragment, err := fluentd.ParseString(strings.Join(lines, "\n"))
+	assert.Nil(t, err)
+
+	// the first top-level match of a record decides where it goes
+	firstMatch := func(tag string) *fluentd.Directive {
+		for _, d := range fragment {
+			if d.Name == "match" && fluentd.TagMatches(d.Tag, tag) {
+				return d
+			}
+		}
+		return nil
+	}
+
+	for _, ns := range []string{"a", "b"} {
+		route := firstMatch("kube." + ns + ".web.nginx")
+		assert.NotNil(t, route)
+		assert.Equal(t, "@kfo-ns-"+ns, route.Param("@label"))
+	}
+
+	// each label holds the outputs of its own namespace only
+	labels := 0
+	for _, d := range fragment {
+		if d.Name != "label" {
+			continue
+		}
+		labels++
+		switch d.Tag {
+		case "@kfo-ns-a":
+			assert.Equal(t, "es.a", d.Nested[0].Param("host"))
+		case "@kfo-ns-b":
+			assert.Equal(t, "es.b", d.Nested[0].Param("host"))
+		}
+	}
+	assert.Equal(t, 2, labels)
+}
@@ -0,0 +1,19 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// defaultOutput returns the template of the output the namespace also sends its records to: the
+// first --label-route matching the namespace labels, else the --default-output. Empty if none
+func (g *Generator) defaultOutput(ns *datasource.NamespaceConfig) string {
+	for _, rule := range g.cfg.LabelRoutingRules {
+		if value, ok := ns.Labels[rule.Label]; ok && value == rule.Value {
+			return rule.Output
+		}
+	}
+	return g.cfg.ParsedDefaultOutput
+}
@@ -0,0 +1,70 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sinkOutput(host string) string {
+	return "<match **>\n  @type forward\n  <server>\n    host " + host + "\n  </server>\n</match>\n"
+}
+
+func TestLabelRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "label-routes")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:        "../templates",
+		AdminNamespace:      "kube-system",
+		ParsedDefaultOutput: sinkOutput("central-sink"),
+		LabelRoutingRules: []config.LabelRoutingRule{
+			{Label: "tier", Value: "prod", Output: sinkOutput("durable-sink")},
+			{Label: "tier", Value: "dev", Output: sinkOutput("cheap-sink")},
+			{Label: "compliance", Value: "pci", Output: sinkOutput("pci-sink")},
+		},
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	tenant := "<match **>\n  @type elasticsearch\n</match>\n"
+	g.SetModel([]*datasource.NamespaceConfig{
+		{Name: "shop", FluentdConfig: tenant, Labels: map[string]string{"tier": "prod"}},
+		{Name: "sandbox", FluentdConfig: tenant, Labels: map[string]string{"tier": "dev"}},
+		// the first matching route wins
+		{Name: "payments", FluentdConfig: tenant, Labels: map[string]string{"compliance": "pci", "tier": "prod"}},
+		{Name: "other", FluentdConfig: tenant, Labels: map[string]string{"tier": "staging"}},
+	})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	sinks := map[string]string{
+		"shop":     "durable-sink",
+		"sandbox":  "cheap-sink",
+		"payments": "durable-sink",
+		"other":    "central-sink",
+	}
+	for ns, sink := range sinks {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "ns-"+ns+".conf"))
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), "host "+sink, ns)
+		// the outputs of the tenant still get the records
+		assert.Contains(t, string(content), "@type elasticsearch", ns)
+		for _, other := range sinks {
+			if other != sink {
+				assert.NotContains(t, string(content), "host "+other, ns)
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+const rolledBackWarning = "warning: rolled back to the last good config, the current config is ignored until it changes"
+
+// LastGoodConfig is the last config of a namespace that was applied without error
+type LastGoodConfig struct {
+	Config     string `json:"config"`
+	PrepConfig string `json:"prepConfig,omitempty"`
+	Hash       string `json:"hash"`
+}
+
+// LastGoodConfig returns the last good config of a namespace with its credentials redacted, nil
+// if there is none. The raw snapshot is only used to roll back
+func (g *Generator) LastGoodConfig(namespace string) *LastGoodConfig {
+	g.lastGoodMutex.Lock()
+	defer g.lastGoodMutex.Unlock()
+
+	snapshot := g.lastGood[namespace]
+	if snapshot == nil {
+		return nil
+	}
+
+	return &LastGoodConfig{
+		Config:     redactConfig(snapshot.Config),
+		PrepConfig: redactConfig(snapshot.PrepConfig),
+		Hash:       snapshot.Hash,
+	}
+}
+
+// Rollback applies the last good config of a namespace from the next run on, instead of its
+// current config. The rollback ends as soon as the config of the namespace changes
+func (g *Generator) Rollback(namespace string) error {
+	g.lastGoodMutex.Lock()
+	defer g.lastGoodMutex.Unlock()
+
+	if g.lastGood[namespace] == nil {
+		return fmt.Errorf("no last good config known for namespace %s", namespace)
+	}
+
+	// the hash of the current config is taken at the next run
+	g.rollbacks[namespace] = ""
+	logrus.Infof("Rolling back namespace %s to its last good config %s", namespace, g.lastGood[namespace].Hash)
+	return nil
+}
+
+// rolledBackRender returns the last good config of a rolled back namespace, nil if the namespace
+// is not rolled back or its config changed since the rollback
+func (g *Generator) rolledBackRender(nsConf *datasource.NamespaceConfig) *namespaceRender {
+	g.lastGoodMutex.Lock()
+	defer g.lastGoodMutex.Unlock()
+
+	sourceHash, ok := g.rollbacks[nsConf.Name]
+	if !ok {
+		return nil
+	}
+
+	currentHash := util.Hash("", nsConf.FluentdConfig)
+	if sourceHash == "" {
+		g.rollbacks[nsConf.Name] = currentHash
+	} else if sourceHash != currentHash {
+		logrus.Infof("Config of namespace %s changed, ending its rollback", nsConf.Name)
+		delete(g.rollbacks, nsConf.Name)
+		return nil
+	}
+
+	snapshot := g.lastGood[nsConf.Name]
+	return &namespaceRender{
+		nsConf:         nsConf,
+		prepConfig:     snapshot.PrepConfig,
+		renderedConfig: snapshot.Config,
+		configHash:     snapshot.Hash,
+		rolledBack:     true,
+	}
+}
+
+// recordLastGood remembers an applied config and stores it in --last-good-dir if it changed
+func (g *Generator) recordLastGood(r *namespaceRender) {
+	if r.rolledBack {
+		return
+	}
+
+	g.lastGoodMutex.Lock()
+	defer g.lastGoodMutex.Unlock()
+
+	if prev := g.lastGood[r.nsConf.Name]; prev != nil && prev.Hash == r.configHash {
+		return
+	}
+
+	snapshot := &LastGoodConfig{
+		Config:     r.renderedConfig,
+		PrepConfig: r.prepConfig,
+		Hash:       r.configHash,
+	}
+	g.lastGood[r.nsConf.Name] = snapshot
+
+	if g.cfg.LastGoodDir == "" {
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err == nil {
+		// the snapshot holds the credentials of the namespace
+		err = ioutil.WriteFile(filepath.Join(g.cfg.LastGoodDir, r.nsConf.Name+".json"), data, 0600)
+	}
+	if err != nil {
+		logrus.Warnf("Cannot store the last good config of namespace %s: %+v", r.nsConf.Name, err)
+	}
+}
+
+// forgetLastGood drops the last good configs of the namespaces not in the model
+func (g *Generator) forgetLastGood() {
+	existing := map[string]bool{}
+	for _, ns := range g.model {
+		existing[ns.Name] = true
+	}
+
+	g.lastGoodMutex.Lock()
+	defer g.lastGoodMutex.Unlock()
+
+	for ns := range g.lastGood {
+		if existing[ns] {
+			continue
+		}
+
+		delete(g.lastGood, ns)
+		delete(g.rollbacks, ns)
+		if g.cfg.LastGoodDir != "" {
+			if err := os.Remove(filepath.Join(g.cfg.LastGoodDir, ns+".json")); err != nil && !os.IsNotExist(err) {
+				logrus.Warnf("Cannot remove the last good config of namespace %s: %+v", ns, err)
+			}
+		}
+	}
+}
+
+// loadLastGood reads the last good configs stored in --last-good-dir by a previous run
+func loadLastGood(dir string) map[string]*LastGoodConfig {
+	res := map[string]*LastGoodConfig{}
+	if dir == "" {
+		return res
+	}
+
+	if err := os.MkdirAll(dir, maskDirectory); err != nil {
+		logrus.Warnf("Cannot create %s for the last good configs: %+v", dir, err)
+		return res
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logrus.Warnf("Cannot read the last good configs from %s: %+v", dir, err)
+		return res
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		snapshot := &LastGoodConfig{}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err == nil {
+			err = json.Unmarshal(data, snapshot)
+		}
+		if err != nil {
+			logrus.Warnf("Ignoring bad last good config %s: %+v", f.Name(), err)
+			continue
+		}
+
+		res[strings.TrimSuffix(f.Name(), ".json")] = snapshot
+	}
+
+	return res
+}
@@ -0,0 +1,110 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollbackToLastGoodConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "last-good")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		LastGoodDir:    filepath.Join(dir, "last-good"),
+	}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	ns := &datasource.NamespaceConfig{
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.good\n</match>\n",
+	}
+	render := func() string {
+		g.SetModel([]*datasource.NamespaceConfig{ns})
+		hashes, err := g.RenderToDisk(ctx, dir)
+		assert.Nil(t, err)
+		ns.PreviousConfigHash = hashes["a"]
+		return hashes["a"]
+	}
+
+	goodHash := render()
+	assert.NotNil(t, g.Rollback("nope"))
+	assert.NotNil(t, g.LastGoodConfig("a"))
+	assert.Equal(t, goodHash, g.LastGoodConfig("a").Hash)
+
+	// a broken config does not replace the last good one
+	ns.FluentdConfig = "<match **>\n  @type elasticsearch\n"
+	brokenHash := render()
+	assert.NotEqual(t, goodHash, brokenHash)
+	assert.Equal(t, goodHash, g.LastGoodConfig("a").Hash)
+
+	// the rollback applies the last good config while the source is unchanged
+	assert.Nil(t, g.Rollback("a"))
+	assert.Equal(t, goodHash, render())
+	assert.Equal(t, datasource.StatusWarning, g.StatusSummary([]*datasource.NamespaceConfig{ns})["a"].Status)
+	file, err := ioutil.ReadFile(filepath.Join(dir, "ns-a.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(file), "es.good")
+	assert.Equal(t, goodHash, render())
+
+	// fixing the source ends the rollback
+	ns.FluentdConfig = "<match **>\n  @type elasticsearch\n  host es.fixed\n</match>\n"
+	fixedHash := render()
+	assert.NotEqual(t, goodHash, fixedHash)
+	assert.Equal(t, fixedHash, g.LastGoodConfig("a").Hash)
+
+	// the last good config survives a restart
+	restarted := New(ctx, cfg)
+	assert.NotNil(t, restarted.LastGoodConfig("a"))
+	assert.Contains(t, restarted.LastGoodConfig("a").Config, "es.fixed")
+}
+
+func TestLastGoodConfigIsRedacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "last-good")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		LastGoodDir:    filepath.Join(dir, "last-good"),
+	}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	g.SetModel([]*datasource.NamespaceConfig{{
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.good\n  password hunter2\n</match>\n",
+	}})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	snapshot := g.LastGoodConfig("a")
+	assert.NotNil(t, snapshot)
+	assert.Contains(t, snapshot.Config, "es.good")
+	assert.NotContains(t, snapshot.Config, "hunter2")
+	assert.NotContains(t, snapshot.PrepConfig, "hunter2")
+
+	// the raw snapshot is kept for the rollback, readable only by the reloader
+	info, err := os.Stat(filepath.Join(cfg.LastGoodDir, "a.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	restarted := New(ctx, cfg)
+	assert.Contains(t, restarted.lastGood["a"].Config, "hunter2")
+}
@@ -0,0 +1,85 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fileExists(dir string, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+func TestCleanupStaleNamespaceFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		OutputLayout:   config.OutputLayoutPerNamespace,
+	}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name:          "kube-system",
+		FluentdConfig: "<match systemd.**>\n  @type null\n</match>\n",
+	}
+	a := &datasource.NamespaceConfig{
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.a\n</match>\n",
+	}
+	b := &datasource.NamespaceConfig{
+		Name:          "b",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n  host es.b\n</match>\n",
+	}
+
+	render := func(namespaces ...*datasource.NamespaceConfig) string {
+		g.SetModel(namespaces)
+		hashes, err := g.RenderToDisk(ctx, dir)
+		assert.Nil(t, err)
+		g.CleanupUnusedFiles(dir, hashes)
+
+		main, err := ioutil.ReadFile(filepath.Join(dir, mainConfigFile))
+		assert.Nil(t, err)
+		return string(main)
+	}
+
+	main := render(admin, a, b)
+	assert.True(t, fileExists(dir, "ns-a.conf"))
+	assert.True(t, fileExists(dir, "ns-b.conf"))
+	assert.Contains(t, main, "@include admin-ns.conf")
+	assert.Contains(t, main, "@include ns-b.conf")
+
+	// b is deleted
+	main = render(admin, a)
+	assert.True(t, fileExists(dir, "ns-a.conf"))
+	assert.False(t, fileExists(dir, "ns-b.conf"))
+	assert.NotContains(t, main, "ns-b.conf")
+
+	// switching to a single file removes all namespace files
+	cfg.OutputLayout = config.OutputLayoutSingle
+	main = render(admin, a, b)
+	assert.False(t, fileExists(dir, "ns-a.conf"))
+	assert.False(t, fileExists(dir, "ns-b.conf"))
+	assert.False(t, fileExists(dir, adminConfigFile))
+	assert.NotContains(t, main, "@include ns-")
+	assert.NotContains(t, main, "@include admin-ns.conf")
+	assert.Contains(t, main, "<match systemd.**>")
+	assert.Contains(t, main, "host es.a")
+	assert.Contains(t, main, "host es.b")
+}
@@ -0,0 +1,56 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
+)
+
+// lint runs the enabled lint rules over the config of a namespace as written by the namespace,
+// before any processing. Nothing is reported for a config that does not parse, processing fails it anyway
+func (g *Generator) lint(nsConf *datasource.NamespaceConfig) []*fluentd.LintFinding {
+	cfg := g.cfg.Current()
+	if cfg.LintLevel == "" || cfg.LintLevel == config.LintOff || nsConf.FluentdConfig == "" {
+		return nil
+	}
+
+	fragment, err := fluentd.ParseString(nsConf.FluentdConfig)
+	if err != nil {
+		return nil
+	}
+
+	disabled := map[string]bool{}
+	for _, name := range cfg.LintDisabledRules {
+		disabled[name] = true
+	}
+
+	rules := []*fluentd.LintRule{}
+	for _, rule := range fluentd.LintRules {
+		if !disabled[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+
+	return fluentd.Lint(fragment, rules, cfg.LintLevel)
+}
+
+// recordLintFindings exports the number of findings of the cycle by severity and rule
+func (g *Generator) recordLintFindings(renders []*namespaceRender) {
+	counts := map[[2]string]int{}
+	for _, r := range renders {
+		for _, f := range r.findings {
+			counts[[2]string{f.Severity, f.Rule}]++
+		}
+	}
+
+	res := make([]metrics.LintCount, 0, len(counts))
+	for k, n := range counts {
+		res = append(res, metrics.LintCount{Severity: k[0], Rule: k[1], Count: n})
+	}
+
+	metrics.SetLintFindingsMetric(res)
+}
@@ -0,0 +1,66 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintFindings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:      "../templates",
+		AdminNamespace:    "kube-system",
+		LintLevel:         fluentd.LintInfo,
+		LintDisabledRules: []string{"buffer-flush-interval"},
+	}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "clean", FluentdConfig: "<match **>\n  @type null\n</match>\n"},
+		{Name: "advice", FluentdConfig: "<match **>\n  @type elasticsearch\n  num_threads 4\n  <buffer>\n    @type file\n  </buffer>\n</match>\n"},
+		{Name: "broken", FluentdConfig: "<match **>\n  @type copy\n</match>\n"},
+	}
+	g.SetModel(namespaces)
+
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	statuses := g.StatusSummary(namespaces)
+	assert.Equal(t, datasource.StatusOK, statuses["clean"].Status)
+	assert.Empty(t, statuses["clean"].Findings)
+
+	// warnings do not block the config
+	assert.True(t, fileExists(dir, "ns-advice.conf"))
+	assert.Equal(t, datasource.StatusWarning, statuses["advice"].Status)
+	assert.Equal(t, "warning: lint: [deprecated-param] <match **>: num_threads is deprecated, use flush_thread_count in a <buffer> section", statuses["advice"].Message)
+	assert.Len(t, statuses["advice"].Findings, 1)
+
+	// errors do
+	assert.False(t, fileExists(dir, "ns-broken.conf"))
+	assert.Equal(t, datasource.StatusError, statuses["broken"].Status)
+	assert.Equal(t, datasource.ErrorPhaseLint, statuses["broken"].Phase)
+	assert.Contains(t, statuses["broken"].Message, "copy-without-store")
+
+	// the lint pass is off by default
+	cfg.LintLevel = config.LintOff
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.True(t, fileExists(dir, "ns-broken.conf"))
+	assert.Empty(t, g.StatusSummary(namespaces)["advice"].Findings)
+}
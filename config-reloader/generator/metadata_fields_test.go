@@ -0,0 +1,65 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataFields(t *testing.T) {
+	render := func(fields ...string) fluentd.Fragment {
+		dir, err := ioutil.TempDir("", "metadata-fields")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		ctx := context.Background()
+		cfg := &config.Config{
+			TemplatesDir:   "../templates",
+			AdminNamespace: "kube-system",
+			MetadataFields: fields,
+		}
+		g := New(ctx, cfg)
+		g.SetStatusUpdater(ctx, nopStatusUpdater{})
+		g.SetModel([]*datasource.NamespaceConfig{{
+			Name:          "kube-system",
+			FluentdConfig: "<match **>\n  @type null\n</match>\n",
+		}})
+		_, err = g.RenderToDisk(ctx, dir)
+		assert.Nil(t, err)
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, "kubernetes-postprocess.conf"))
+		assert.Nil(t, err)
+		fragment, err := fluentd.ParseString(string(content))
+		assert.Nil(t, err)
+		return fragment
+	}
+
+	fragment := render()
+	assert.Equal(t, "", fragment[0].Param("annotation_match"))
+	for _, d := range fragment {
+		assert.NotContains(t, d.String(), "slice(")
+	}
+
+	fragment = render("pod_name", "labels", "annotations")
+	assert.Equal(t, "kubernetes_metadata", fragment[0].Type())
+	assert.Equal(t, `[".*"]`, fragment[0].Param("annotation_match"))
+	slices := []string{}
+	for _, d := range fragment {
+		if d.Name == "filter" && d.Tag == "kube.*.*.*" && len(d.Nested) > 0 && strings.Contains(d.Nested[0].Param("dummy_"), "slice(") {
+			slices = append(slices, d.Nested[0].Param("dummy_"))
+		}
+	}
+	assert.Equal(t, []string{`${record["kubernetes"] = record["kubernetes"].slice('pod_name', 'labels', 'annotations') if record["kubernetes"]; nil}`}, slices)
+}
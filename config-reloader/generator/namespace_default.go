@@ -0,0 +1,67 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// sections of the admin config named namespace-default:<name> make up the default namespace config
+const namespaceDefaultPrefix = "namespace-default:"
+
+// splitNamespaceDefault takes the default namespace config out of the admin config. The sections of
+// the default config lose their prefix so that namespaces override them by their plain name
+func splitNamespaceDefault(adminConfig string) (string, string) {
+	if !strings.Contains(adminConfig, namespaceDefaultPrefix) {
+		return adminConfig, ""
+	}
+
+	admin := []string{}
+	defaults := []string{}
+	for _, s := range fluentd.SplitSections(adminConfig) {
+		if !strings.HasPrefix(s.Name, namespaceDefaultPrefix) {
+			admin = append(admin, s.Text)
+			continue
+		}
+
+		header := fmt.Sprintf("# @section %s", strings.TrimPrefix(s.Name, namespaceDefaultPrefix))
+		if len(s.After) > 0 {
+			header += " after=" + strings.Join(s.After, ",")
+		}
+
+		// the first line is the original header
+		body := ""
+		if i := strings.Index(s.Text, "\n"); i >= 0 {
+			body = s.Text[i:]
+		}
+		defaults = append(defaults, header+body)
+	}
+
+	return strings.Join(admin, "\n"), strings.Join(defaults, "\n")
+}
+
+func (g *Generator) setNamespaceDefault(config string) {
+	g.pluginsMutex.Lock()
+	defer g.pluginsMutex.Unlock()
+	g.namespaceDefault = config
+}
+
+// withNamespaceDefault returns the namespace with its config merged on top of the default namespace config
+func (g *Generator) withNamespaceDefault(ns *datasource.NamespaceConfig) *datasource.NamespaceConfig {
+	g.pluginsMutex.RLock()
+	defaults := g.namespaceDefault
+	g.pluginsMutex.RUnlock()
+
+	if defaults == "" || ns.Name == g.cfg.AdminNamespace {
+		return ns
+	}
+
+	merged := *ns
+	merged.FluentdConfig = fluentd.MergeSections(defaults, ns.FluentdConfig)
+	return &merged
+}
@@ -0,0 +1,102 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const adminWithNamespaceDefault = `
+<match systemd.**>
+  @type null
+</match>
+
+# @section namespace-default:enrich
+#!template
+<filter **>
+  @type record_transformer
+  <record>
+    namespace {{ .Labels.team }}
+  </record>
+</filter>
+
+# @section namespace-default:ship after=enrich
+<match **>
+  @type elasticsearch
+  host es.shared
+</match>
+`
+
+func TestSplitNamespaceDefault(t *testing.T) {
+	admin, defaults := splitNamespaceDefault(adminWithNamespaceDefault)
+	assert.Contains(t, admin, "systemd.**")
+	assert.NotContains(t, admin, "es.shared")
+	assert.NotContains(t, defaults, "systemd.**")
+	assert.Contains(t, defaults, "# @section enrich\n")
+	assert.Contains(t, defaults, "# @section ship after=enrich\n")
+
+	admin, defaults = splitNamespaceDefault("<match **>\n  @type null\n</match>\n")
+	assert.Equal(t, "<match **>\n  @type null\n</match>\n", admin)
+	assert.Equal(t, "", defaults)
+}
+
+func TestNamespaceDefaultConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namespace-default")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "kube-system", FluentdConfig: adminWithNamespaceDefault},
+		// no config of its own
+		{Name: "plain", Labels: map[string]string{"team": "blue"}},
+		// overrides the output, appends an audit output
+		{Name: "custom", Labels: map[string]string{"team": "red"}, FluentdConfig: `
+# @section ship after=enrich
+<match **>
+  @type elasticsearch
+  host es.custom
+</match>
+
+# @section audit
+<match kube.custom.audit.**>
+  @type s3
+</match>
+`},
+	}
+	g.SetModel(namespaces)
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	admin, err := ioutil.ReadFile(filepath.Join(dir, adminConfigFile))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(admin), "es.shared")
+
+	plain, err := ioutil.ReadFile(filepath.Join(dir, "ns-plain.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(plain), "namespace blue")
+	assert.Contains(t, string(plain), "es.shared")
+
+	custom, err := ioutil.ReadFile(filepath.Join(dir, "ns-custom.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(custom), "namespace red")
+	assert.Contains(t, string(custom), "es.custom")
+	assert.NotContains(t, string(custom), "es.shared")
+	assert.Contains(t, string(custom), "@type s3")
+}
@@ -0,0 +1,147 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// namespaceTemplateModel is what the conditional blocks of a namespace config are evaluated against
+type namespaceTemplateModel struct {
+	Namespace string
+	Labels    map[string]string
+	// only the environment variables allowed by --template-env
+	Env map[string]string
+}
+
+// reEnvReference finds the environment variables a template refers to as .Env.NAME or index .Env "NAME"
+var reEnvReference = regexp.MustCompile(`\.Env\.([A-Za-z_][A-Za-z0-9_]*)|index\s+\.Env\s+"([^"]*)"`)
+
+// reTemplateMarker finds the #!template line that turns on the templating of a namespace config
+var reTemplateMarker = regexp.MustCompile(`(?m)^[ \t]*#!template[ \t]*$`)
+
+// checkEnvReferences fails on the first environment variable the config refers to that is not allowed
+func checkEnvReferences(config string, env map[string]string) error {
+	for _, m := range reEnvReference.FindAllStringSubmatch(config, -1) {
+		name := m[1] + m[2]
+		if _, ok := env[name]; !ok {
+			return datasource.PolicyErrorf("environment variable %s is not available to namespace configs", name)
+		}
+	}
+	return nil
+}
+
+// renderNamespaceTemplate evaluates the {{ }} blocks of a namespace config against the namespace
+// labels using the text/template syntax, e.g. {{ if eq .Labels.env "prod" }}...{{ end }}.
+// Missing labels evaluate to "", unless strict. env holds the environment variables available as .Env.
+// Only the configs with a #!template line are evaluated, a {{ in the others is fluentd's, e.g. in a
+// regexp. The marker is a fluentd comment and stays in the config
+func renderNamespaceTemplate(ns *datasource.NamespaceConfig, env map[string]string, strict bool) (string, error) {
+	if !reTemplateMarker.MatchString(ns.FluentdConfig) {
+		return ns.FluentdConfig, nil
+	}
+
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	if err := checkEnvReferences(ns.FluentdConfig, env); err != nil {
+		return "", err
+	}
+
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+	tmpl, err := template.New(ns.Name).Option(missingKey).Parse(ns.FluentdConfig)
+	if err != nil {
+		return "", fmt.Errorf("bad template syntax in config: %s", strings.TrimPrefix(err.Error(), "template: "))
+	}
+
+	labels := ns.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, &namespaceTemplateModel{
+		Namespace: ns.Name,
+		Labels:    labels,
+		Env:       env,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot evaluate template in config: %s", strings.TrimPrefix(err.Error(), "template: "))
+	}
+
+	return buf.String(), nil
+}
+
+// reNamespaceVariable finds ${namespace} and ${namespace_labels['name']}, also with double quotes.
+// A leading $ escapes them
+var reNamespaceVariable = regexp.MustCompile(`\$?\$\{namespace(?:_labels\[(?:'([^']*)'|"([^"]*)")\])?\}`)
+
+// expandNamespaceVariables replaces ${namespace} with the name of the namespace and
+// ${namespace_labels['name']} with the value of its label, "" for a missing label unless strict.
+// $${namespace} is the literal ${namespace}. The fluentd placeholders like ${tag} are left alone
+func expandNamespaceVariables(config string, ns *datasource.NamespaceConfig, strict bool) (string, error) {
+	if !strings.Contains(config, "${namespace") {
+		return config, nil
+	}
+
+	var err error
+	expanded := reNamespaceVariable.ReplaceAllStringFunc(config, func(variable string) string {
+		if strings.HasPrefix(variable, "$$") {
+			return variable[1:]
+		}
+
+		if !strings.HasPrefix(variable, "${namespace_labels") {
+			return ns.Name
+		}
+
+		m := reNamespaceVariable.FindStringSubmatch(variable)
+		label := m[1] + m[2]
+		value, ok := ns.Labels[label]
+		if !ok && strict && err == nil {
+			err = fmt.Errorf("%s refers to label %s that namespace %s does not have", variable, label, ns.Name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return expanded, nil
+}
+
+// parseNamespaceConfig evaluates the conditional blocks and the namespace variables, puts the config
+// sections in dependency order and parses the resulting config. If the sections cannot be ordered
+// they are kept as they are
+func parseNamespaceConfig(ns *datasource.NamespaceConfig, env map[string]string, strict bool) (fluentd.Fragment, error) {
+	config, err := renderNamespaceTemplate(ns, env, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err = expandNamespaceVariables(config, ns, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered, err := fluentd.OrderSections(config)
+	if err != nil {
+		logrus.Warnf("Keeping the original order of the config sections of namespace %s: %+v", ns.Name, err)
+	} else {
+		config = ordered
+	}
+
+	return fluentd.ParseString(config)
+}
@@ -0,0 +1,189 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const conditionalConfig = `
+#!template
+<match **>
+{{- if eq .Labels.env "prod" }}
+  @type elasticsearch
+{{- else }}
+  @type null
+{{- end }}
+</match>
+`
+
+func TestNamespaceTemplateUsesLabels(t *testing.T) {
+	ns := &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: conditionalConfig,
+		Labels:        map[string]string{"env": "prod"},
+	}
+
+	fragment, err := parseNamespaceConfig(ns, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "elasticsearch", fragment[0].Type())
+
+	ns.Labels = map[string]string{"env": "dev"}
+	fragment, err = parseNamespaceConfig(ns, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "null", fragment[0].Type())
+
+	// missing labels are empty strings
+	ns.Labels = nil
+	fragment, err = parseNamespaceConfig(ns, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "null", fragment[0].Type())
+}
+
+func TestNamespaceTemplateIndexAndNamespace(t *testing.T) {
+	ns := &datasource.NamespaceConfig{
+		Name: "demo",
+		FluentdConfig: `
+#!template
+<match **>
+  @type elasticsearch
+  index_name {{ .Namespace }}-{{ index .Labels "app.kubernetes.io/part-of" }}
+</match>
+`,
+		Labels: map[string]string{"app.kubernetes.io/part-of": "shop"},
+	}
+
+	fragment, err := parseNamespaceConfig(ns, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "demo-shop", fragment[0].Param("index_name"))
+}
+
+func TestNamespaceTemplatePlainConfigUnchanged(t *testing.T) {
+	ns := &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}
+
+	config, err := renderNamespaceTemplate(ns, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, ns.FluentdConfig, config)
+}
+
+func TestNamespaceTemplateNeedsMarker(t *testing.T) {
+	// a literal {{ is fluentd's, e.g. in a regexp, and the config is not a template without #!template
+	ns := &datasource.NamespaceConfig{
+		Name: "demo",
+		FluentdConfig: `
+<filter **>
+  @type grep
+  <regexp>
+    key message
+    pattern /^\{{2}[a-z]+\}{2}$|{{ .Labels.env }}/
+  </regexp>
+</filter>
+`,
+		Labels: map[string]string{"env": "prod"},
+	}
+
+	config, err := renderNamespaceTemplate(ns, nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, ns.FluentdConfig, config)
+
+	// an escaped {{ of a template
+	ns.FluentdConfig = "#!template\n<match **>\n  @type null\n  id {{ .Labels.env }}-{{ \"{{\" }}x}}\n</match>\n"
+	config, err = renderNamespaceTemplate(ns, nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "#!template\n<match **>\n  @type null\n  id prod-{{x}}\n</match>\n", config)
+}
+
+func TestNamespaceTemplateBadSyntax(t *testing.T) {
+	bad := []string{
+		`{{ if eq .Labels.env "prod" }}<match **>`,
+		`{{ .Labels.env == "prod" }}`,
+		`{{ len 1 }}`,
+	}
+
+	for _, c := range bad {
+		ns := &datasource.NamespaceConfig{
+			Name:          "demo",
+			FluentdConfig: "#!template\n" + c,
+		}
+
+		_, err := parseNamespaceConfig(ns, nil, false)
+		assert.NotNil(t, err, c)
+		assert.Contains(t, err.Error(), "template", c)
+	}
+}
+
+func TestNamespaceTemplateEnv(t *testing.T) {
+	env := map[string]string{"REGION": "eu-west-2", "DNS_SUFFIX": "prod.example.com"}
+	ns := &datasource.NamespaceConfig{
+		Name: "demo",
+		FluentdConfig: `
+#!template
+<match **>
+  @type elasticsearch
+  host es.{{ .Env.REGION }}.{{ index .Env "DNS_SUFFIX" }}
+</match>
+`,
+	}
+
+	fragment, err := parseNamespaceConfig(ns, env, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "es.eu-west-2.prod.example.com", fragment[0].Param("host"))
+
+	for _, c := range []string{
+		"#!template\n<match **>\n  @type null\n  token {{ .Env.AWS_SECRET_ACCESS_KEY }}\n</match>",
+		"#!template\n<match **>\n  @type null\n  token {{ index .Env \"HOME\" }}\n</match>",
+	} {
+		ns.FluentdConfig = c
+		_, err = parseNamespaceConfig(ns, env, false)
+		assert.NotNil(t, err, c)
+		assert.Contains(t, err.Error(), "is not available to namespace configs")
+	}
+}
+
+func TestNamespaceVariables(t *testing.T) {
+	ns := &datasource.NamespaceConfig{
+		Name: "demo",
+		FluentdConfig: `
+<filter **>
+  @type record_transformer
+  <record>
+    namespace_label_team ${namespace_labels['team']}
+    owner ${namespace_labels["owner"]}-${namespace}
+    literal $${namespace}
+    tag ${tag}
+  </record>
+</filter>
+`,
+		Labels: map[string]string{"team": "payments"},
+	}
+
+	fragment, err := parseNamespaceConfig(ns, nil, false)
+	assert.Nil(t, err)
+	record := fragment[0].Nested[0]
+	assert.Equal(t, "payments", record.Param("namespace_label_team"))
+	assert.Equal(t, "-demo", record.Param("owner"))
+	assert.Equal(t, "${namespace}", record.Param("literal"))
+	assert.Equal(t, "${tag}", record.Param("tag"))
+
+	// a missing label fails in strict mode, also in a template block
+	_, err = parseNamespaceConfig(ns, nil, true)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "label owner")
+
+	ns.FluentdConfig = "#!template\n<match **>\n  @type null\n  id {{ .Labels.owner }}\n</match>\n"
+	_, err = parseNamespaceConfig(ns, nil, true)
+	assert.NotNil(t, err)
+
+	ns.Labels["owner"] = "alice"
+	fragment, err = parseNamespaceConfig(ns, nil, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", fragment[0].Param("id"))
+}
@@ -0,0 +1,36 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/processors"
+)
+
+// recordOutputIDs remembers which namespace every output @id of the rendered configs belongs to
+func (g *Generator) recordOutputIDs(renderedConfigs map[string]string) {
+	outputs := map[string]string{}
+	for ns, config := range renderedConfigs {
+		fragment, err := fluentd.ParseString(config)
+		if err != nil {
+			continue
+		}
+
+		for _, id := range processors.OutputIDs(fragment) {
+			outputs[id] = ns
+		}
+	}
+
+	g.outputsMutex.Lock()
+	defer g.outputsMutex.Unlock()
+	g.outputs = outputs
+}
+
+// NamespaceOfOutput returns the namespace of the output with the given @id as of the last
+// render or an empty string if it is unknown. It is safe to call from any goroutine
+func (g *Generator) NamespaceOfOutput(id string) string {
+	g.outputsMutex.RLock()
+	defer g.outputsMutex.RUnlock()
+	return g.outputs[id]
+}
@@ -0,0 +1,74 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantineFailedNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:     "../templates",
+		AdminNamespace:   "kube-system",
+		QuarantinePlugin: "quarantine",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name: "kube-system",
+		FluentdConfig: `
+<plugin quarantine>
+  @type s3
+  s3_bucket quarantine
+</plugin>
+`,
+	}
+	broken := &datasource.NamespaceConfig{
+		Name:          "broken",
+		FluentdConfig: "<match other.**>\n  @type null\n</match>\n",
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{admin, broken})
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, hashes["broken"])
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "ns-broken.conf"))
+	assert.Nil(t, err)
+	fragment, err := fluentd.ParseString(string(data))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(fragment))
+	assert.Equal(t, "kube.broken.**", fragment[0].Tag)
+	assert.Equal(t, "record_transformer", fragment[0].Type())
+	assert.Equal(t, "broken", fragment[0].Nested[0].Param("kfo_quarantined_namespace"))
+	assert.Equal(t, "kube.broken.**", fragment[1].Tag)
+	assert.Equal(t, "s3", fragment[1].Type())
+	assert.Equal(t, "quarantine", fragment[1].Param("s3_bucket"))
+
+	main, err := ioutil.ReadFile(filepath.Join(dir, mainConfigFile))
+	assert.Nil(t, err)
+	assert.Contains(t, string(main), "@include ns-broken.conf")
+
+	// the real error is still reported
+	st := g.StatusSummary([]*datasource.NamespaceConfig{admin, broken})["broken"]
+	assert.Equal(t, datasource.StatusError, st.Status)
+	assert.NotEmpty(t, st.Message)
+	assert.Empty(t, st.LastApplied)
+}
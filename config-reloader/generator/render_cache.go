@@ -0,0 +1,88 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/processors"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cachedRender is the successful render of a namespace with the inputs it was made from
+type cachedRender struct {
+	inputHash  string
+	renderEnv  string
+	prepConfig string
+	render     *namespaceRender
+}
+
+// renderEnvironment hashes what the render of every namespace depends on besides its own input:
+// the admin namespace config, the state the prepare phase shares across the namespaces and the
+// reloader config, which runtime changes update in place
+func (g *Generator) renderEnvironment(genCtx *processors.GenerationContext) string {
+	admin := ""
+	for _, nsConf := range g.model {
+		if nsConf.Name == g.cfg.AdminNamespace {
+			admin = nsConf.FluentdConfig
+		}
+	}
+
+	bridges := make([]string, 0, len(genCtx.ReferencedBridges))
+	for bridge := range genCtx.ReferencedBridges {
+		bridges = append(bridges, bridge)
+	}
+	sort.Strings(bridges)
+
+	return util.Hash(fmt.Sprintf("%v %v %+v", genCtx.NeedsProcessing, strings.Join(bridges, ","), *g.cfg), admin)
+}
+
+// reusedRender returns the previous render of a namespace whose input and environment did not
+// change since, nil if it must be processed again. Secret references are checked on every run,
+// so nothing is reused with --validate-secret-refs
+func (g *Generator) reusedRender(nsConf *datasource.NamespaceConfig, prepareConfigs map[string]interface{}) *namespaceRender {
+	if !nsConf.Unchanged || nsConf.InputHash == "" || g.cfg.Current().ValidateSecretRefs {
+		return nil
+	}
+
+	cached, ok := g.renderCache[nsConf.Name]
+	if !ok || cached.inputHash != nsConf.InputHash || cached.renderEnv != g.renderEnv {
+		return nil
+	}
+
+	prepConfig, err := extractPrepConfig(nsConf.Name, prepareConfigs)
+	if err != nil || prepConfig != cached.prepConfig {
+		return nil
+	}
+
+	logrus.Debugf("Reusing the config of namespace %s, its input is unchanged", nsConf.Name)
+	r := *cached.render
+	r.nsConf = nsConf
+	r.duration = 0
+	r.reused = true
+	return &r
+}
+
+// cacheRenders keeps the successful renders of this run for the next one, the others are forgotten
+func (g *Generator) cacheRenders(renders []*namespaceRender) {
+	cache := map[string]*cachedRender{}
+	for _, r := range renders {
+		if r.err != nil || r.validationErr != nil || r.rolledBack || r.disabled != "" || r.nsConf.InputHash == "" {
+			continue
+		}
+
+		cache[r.nsConf.Name] = &cachedRender{
+			inputHash:  r.nsConf.InputHash,
+			renderEnv:  g.renderEnv,
+			prepConfig: r.prepConfig,
+			render:     r,
+		}
+	}
+	g.renderCache = cache
+}
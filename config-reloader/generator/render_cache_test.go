@@ -0,0 +1,73 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingValidator counts the validations of every namespace
+type countingValidator struct {
+	slowValidator
+	mutex sync.Mutex
+	calls map[string]int
+}
+
+func (v *countingValidator) ValidateConfigExtremely(config string, namespace string) error {
+	v.mutex.Lock()
+	v.calls[namespace]++
+	v.mutex.Unlock()
+	return v.slowValidator.ValidateConfigExtremely(config, namespace)
+}
+
+func TestUnchangedNamespacesReuseTheirRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	validator := &countingValidator{calls: map[string]int{}}
+	g := newValidatingGenerator(ctx, validator, 2)
+
+	// the datasource is stood in for: every run reads the same input
+	run := func(unchanged bool, admin string) map[string]string {
+		namespaces := sampleNamespaces(3)
+		namespaces[2].FluentdConfig = "<match **>\n  @type elasticsearch\n  index_name broken\n</match>\n"
+		for _, ns := range namespaces {
+			ns.InputHash = "input-" + ns.Name
+			ns.Unchanged = unchanged
+		}
+		namespaces = append(namespaces, &datasource.NamespaceConfig{Name: "kube-system", FluentdConfig: admin})
+		g.SetModel(namespaces)
+
+		hashes, err := g.RenderToDisk(ctx, dir)
+		assert.Nil(t, err)
+		return hashes
+	}
+
+	first := run(false, "")
+	assert.Equal(t, map[string]int{"ns-00": 1, "ns-01": 1, "ns-02": 1}, validator.calls)
+
+	// same input, only the failed namespace is processed again
+	second := run(true, "")
+	assert.Equal(t, map[string]int{"ns-00": 1, "ns-01": 1, "ns-02": 2}, validator.calls)
+	assert.Equal(t, first, second)
+	assert.True(t, fileExists(dir, "ns-ns-00.conf"))
+
+	// a changed admin namespace invalidates every render
+	run(true, "<match systemd.**>\n  @type null\n</match>\n")
+	assert.Equal(t, map[string]int{"ns-00": 2, "ns-01": 2, "ns-02": 3}, validator.calls)
+
+	// the datasource saw a change
+	run(false, "<match systemd.**>\n  @type null\n</match>\n")
+	assert.Equal(t, map[string]int{"ns-00": 3, "ns-01": 3, "ns-02": 4}, validator.calls)
+}
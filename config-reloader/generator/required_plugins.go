@@ -0,0 +1,101 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+const (
+	requiredPluginDirective = "@required_plugin"
+	pluginGemPrefix         = "fluent-plugin-"
+)
+
+// splitRequiredPlugins removes the @required_plugin lines from a namespace config and returns
+// the plugins they name. There is one plugin per line, the gem name with or without its
+// fluent-plugin- prefix. The lines are removed even if one of them is malformed
+func splitRequiredPlugins(config string) (string, []string, error) {
+	if !strings.Contains(config, requiredPluginDirective) {
+		return config, nil, nil
+	}
+
+	lines := []string{}
+	plugins := []string{}
+	var err error
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != requiredPluginDirective {
+			lines = append(lines, line)
+			continue
+		}
+
+		if len(fields) != 2 {
+			if err == nil {
+				err = fmt.Errorf("bad %s directive '%s', expected one plugin name", requiredPluginDirective, strings.TrimSpace(line))
+			}
+			continue
+		}
+		plugins = append(plugins, fields[1])
+	}
+
+	return strings.Join(lines, "\n"), plugins, err
+}
+
+// missingPlugins lists the required plugins that are not installed
+func missingPlugins(required []string, installed map[string]string) []string {
+	missing := []string{}
+	for _, name := range required {
+		_, found := installed[name]
+		if !found {
+			_, found = installed[pluginGemPrefix+name]
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// withRequiredPlugins returns the config of a namespace without its @required_plugin lines and
+// an error naming the required plugins missing from the fluentd image. Without a plugin inventory
+// the requirements cannot be checked and are ignored
+func (g *Generator) withRequiredPlugins(ns *datasource.NamespaceConfig) (*datasource.NamespaceConfig, error) {
+	config, required, err := splitRequiredPlugins(ns.FluentdConfig)
+	if config == ns.FluentdConfig {
+		return ns, nil
+	}
+
+	stripped := *ns
+	stripped.FluentdConfig = config
+	if err != nil {
+		return &stripped, err
+	}
+
+	if installed := g.InstalledPlugins(); installed != nil {
+		if missing := missingPlugins(required, installed); len(missing) > 0 {
+			return &stripped, datasource.NewPhaseError(datasource.ErrorPhaseValidation,
+				fmt.Errorf("required plugins not installed in the fluentd image: %s, ask the cluster admin to install them", strings.Join(missing, ", ")))
+		}
+	}
+	return &stripped, nil
+}
+
+// SetInstalledPlugins sets the plugin inventory of the fluentd image, gem name to version
+func (g *Generator) SetInstalledPlugins(installed map[string]string) {
+	g.pluginsMutex.Lock()
+	defer g.pluginsMutex.Unlock()
+	g.installedPlugins = installed
+}
+
+// InstalledPlugins returns the plugin inventory of the fluentd image, nil if it is not known
+func (g *Generator) InstalledPlugins() map[string]string {
+	g.pluginsMutex.RLock()
+	defer g.pluginsMutex.RUnlock()
+	return g.installedPlugins
+}
@@ -0,0 +1,78 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRequiredPlugins(t *testing.T) {
+	config, plugins, err := splitRequiredPlugins("@required_plugin fluent-plugin-s3\n  @required_plugin concat\n<match **>\n  @type s3\n</match>")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fluent-plugin-s3", "concat"}, plugins)
+	assert.Equal(t, "<match **>\n  @type s3\n</match>", config)
+
+	config, _, err = splitRequiredPlugins("@required_plugin\n<match **>\n  @type null\n</match>")
+	assert.EqualError(t, err, "bad @required_plugin directive '@required_plugin', expected one plugin name")
+	assert.Equal(t, "<match **>\n  @type null\n</match>", config)
+
+	missing := missingPlugins(
+		[]string{"s3", "fluent-plugin-concat", "fluent-plugin-bar", "foo"},
+		map[string]string{"fluent-plugin-s3": "1.6.1", "fluent-plugin-concat": "2.5.0"},
+	)
+	assert.Equal(t, []string{"fluent-plugin-bar", "foo"}, missing)
+}
+
+func TestRequiredPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "required-plugins")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	}
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, su)
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "installed", FluentdConfig: "@required_plugin concat\n<match **>\n  @type null\n</match>\n"},
+		{Name: "missing", FluentdConfig: "@required_plugin fluent-plugin-foo\n<match **>\n  @type foo\n</match>\n"},
+	}
+
+	// without an inventory the requirements are not checked
+	g.SetModel(namespaces)
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "", su.statuses["missing"])
+
+	g.SetInstalledPlugins(map[string]string{"fluent-plugin-concat": "2.5.0"})
+	g.SetModel(namespaces)
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", su.statuses["installed"])
+	content, err := ioutil.ReadFile(filepath.Join(dir, "ns-installed.conf"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), "@required_plugin")
+
+	assert.Equal(t, "required plugins not installed in the fluentd image: fluent-plugin-foo, ask the cluster admin to install them", su.statuses["missing"])
+	assert.Equal(t, datasource.ErrorPhaseValidation, g.StatusSummary(namespaces)["missing"].Phase)
+
+	// the webhook and the validate command check them too
+	err = g.ValidateNamespace(namespaces[1])
+	assert.Equal(t, datasource.ErrorPhaseValidation, datasource.ErrorPhase(err))
+	assert.Nil(t, g.ValidateNamespace(namespaces[0]))
+}
@@ -0,0 +1,131 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// includes are inlined up to this depth, the generated files only include one level deep
+const maxIncludeDepth = 5
+
+// at most this many container log tags are guessed for a namespace
+const maxExampleTags = 20
+
+var reAlternatives = regexp.MustCompile(`\{([^,}]*)[^}]*\}`)
+
+// RoutingGraph returns a best-effort routing graph of the container logs and file sources of the namespace
+// through the config last generated in outputDir, admin and other namespaces included
+func RoutingGraph(outputDir string, namespace string) (*fluentd.RoutingGraph, error) {
+	text, err := loadGeneratedConfig(outputDir, mainConfigFile, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fragment, err := fluentd.ParseString(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the generated config in %s: %+v", outputDir, err)
+	}
+
+	return fluentd.BuildRoutingGraph(fragment, namespaceInputTags(fragment, namespace)), nil
+}
+
+// loadGeneratedConfig reads a generated file with all @include directives inlined
+func loadGeneratedConfig(outputDir string, name string, depth int) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, name))
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "@include" {
+			continue
+		}
+
+		if depth >= maxIncludeDepth {
+			return "", fmt.Errorf("includes nested too deep in %s", name)
+		}
+
+		included, err := loadGeneratedConfig(outputDir, fields[1], depth+1)
+		if err != nil {
+			return "", err
+		}
+		lines[i] = included
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// namespaceInputTags returns the tags of the sources of the namespace and guesses the tags
+// of its container logs (kube.<namespace>.<pod>.<container>) from the patterns matching them
+func namespaceInputTags(fragment fluentd.Fragment, namespace string) []string {
+	prefix := fmt.Sprintf("kube.%s.", namespace)
+	sources := []string{}
+	examples := map[string]bool{}
+
+	for _, d := range fragment {
+		if d.Name == "source" && strings.HasPrefix(d.Param("tag"), prefix) {
+			sources = append(sources, d.Param("tag"))
+			continue
+		}
+
+		if d.Name != "match" && d.Name != "filter" {
+			continue
+		}
+
+		for _, pattern := range strings.Fields(d.Tag) {
+			// the tags re-emitted by retag are not container logs
+			if !strings.HasPrefix(pattern, prefix) || strings.HasPrefix(pattern, prefix+"_retag.") {
+				continue
+			}
+
+			if tag := exampleContainerTag(pattern); tag != "" && fluentd.TagMatches(pattern, tag) {
+				examples[tag] = true
+			}
+		}
+	}
+
+	res := []string{}
+	for tag := range examples {
+		res = append(res, tag)
+	}
+	sort.Strings(res)
+	if len(res) > maxExampleTags {
+		res = res[:maxExampleTags]
+	}
+
+	return append(sources, res...)
+}
+
+// exampleContainerTag returns a container log tag of 4 parts matched by the pattern, or empty
+func exampleContainerTag(pattern string) string {
+	parts := strings.Split(reAlternatives.ReplaceAllString(pattern, "$1"), ".")
+
+	res := []string{}
+	for i, p := range parts {
+		if p == "**" {
+			for len(res)+len(parts)-i-1 < 4 {
+				res = append(res, "any")
+			}
+			continue
+		}
+
+		res = append(res, strings.ReplaceAll(p, "*", "any"))
+	}
+
+	if len(res) != 4 {
+		return ""
+	}
+
+	return strings.Join(res, ".")
+}
@@ -0,0 +1,87 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingGraphOfGeneratedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routing-graph")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"fluent.conf": `
+@include kubernetes.conf
+
+<source>
+  @type tail
+  tag kube.demo.app.nginx-0
+</source>
+
+@include ns-demo.conf
+
+<match **>
+  @type null
+</match>
+`,
+		"kubernetes.conf": `
+<filter kube.*.*.*>
+  @type record_modifier
+</filter>
+`,
+		"ns-demo.conf": `
+<match kube.demo.*.nginx>
+  @type elasticsearch
+</match>
+
+<match kube.demo._retag.errors>
+  @type null
+</match>
+`,
+	}
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	g, err := RoutingGraph(dir, "demo")
+	assert.Nil(t, err)
+
+	inputs := []string{}
+	for _, n := range g.Nodes {
+		if n.Kind == "input" {
+			inputs = append(inputs, n.Directive)
+		}
+	}
+	assert.Equal(t, []string{"kube.demo.app.nginx-0", "kube.demo.any.nginx"}, inputs)
+
+	// both pass the admin filter of the included file, the file source ends in the catch-all
+	directives := map[string]string{}
+	for _, n := range g.Nodes {
+		directives[n.ID] = n.Directive
+	}
+	targets := []string{}
+	for _, e := range g.Edges {
+		targets = append(targets, directives[e.To])
+	}
+	assert.Equal(t, []string{"<filter kube.*.*.*>", "<match **>", "<filter kube.*.*.*>", "<match kube.demo.*.nginx>"}, targets)
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "ns-demo.conf")))
+	_, err = RoutingGraph(dir, "demo")
+	assert.NotNil(t, err)
+}
+
+func TestExampleContainerTag(t *testing.T) {
+	assert.Equal(t, "kube.demo.any.any", exampleContainerTag("kube.demo.**"))
+	assert.Equal(t, "kube.demo.web-any.nginx", exampleContainerTag("kube.demo.web-*.nginx"))
+	assert.Equal(t, "kube.demo.a.any", exampleContainerTag("kube.demo.{a,b}.*"))
+	assert.Equal(t, "kube.demo.any.any", exampleContainerTag("kube.demo.*.*.**"))
+	assert.Equal(t, "", exampleContainerTag("kube.demo.*.*._labels.app"))
+}
@@ -0,0 +1,94 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/sirupsen/logrus"
+)
+
+// secretRef is a key of a Secret of the namespace an output refers to
+type secretRef struct {
+	name string
+	key  string
+}
+
+func (r secretRef) String() string {
+	return r.name + "/" + r.key
+}
+
+// secretRefs lists the Secret keys the outputs of a config refer to as files <root>/<secret>/<key>,
+// given as is or embedded in a value, e.g. "#{File.read('<root>/es-creds/password')}"
+func secretRefs(fragment fluentd.Fragment, root string) []secretRef {
+	re := regexp.MustCompile(regexp.QuoteMeta(strings.TrimSuffix(root, "/")) + `/([^/\s"'\\]+)/([^/\s"'\\]+)`)
+
+	seen := map[secretRef]bool{}
+	var collect func(fragment fluentd.Fragment, inOutput bool)
+	collect = func(fragment fluentd.Fragment, inOutput bool) {
+		for _, d := range fragment {
+			output := inOutput || d.Name == "match" || d.Name == "store"
+			if output {
+				for _, p := range d.Params {
+					for _, m := range re.FindAllStringSubmatch(p.Value, -1) {
+						seen[secretRef{name: m[1], key: m[2]}] = true
+					}
+				}
+			}
+			collect(d.Nested, output)
+		}
+	}
+	collect(fragment, false)
+
+	res := make([]secretRef, 0, len(seen))
+	for ref := range seen {
+		res = append(res, ref)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].String() < res[j].String() })
+	return res
+}
+
+// checkSecretRefs fails a namespace whose outputs refer to Secret keys missing from the namespace.
+// If the Secrets cannot be read the config is let through with the returned warning
+func (g *Generator) checkSecretRefs(ctx context.Context, nsConf *datasource.NamespaceConfig) (string, error) {
+	if !g.cfg.Current().ValidateSecretRefs || g.secrets == nil || nsConf.FluentdConfig == "" {
+		return "", nil
+	}
+
+	fragment, err := fluentd.ParseString(nsConf.FluentdConfig)
+	if err != nil {
+		return "", nil
+	}
+
+	missing := []string{}
+	for _, ref := range secretRefs(fragment, g.cfg.SecretMountRoot) {
+		ok, err := g.secrets.SecretKeyExists(ctx, nsConf.Name, ref.name, ref.key)
+		if err != nil {
+			logrus.Warnf("Cannot check the secret %s referenced by namespace %s: %+v", ref, nsConf.Name, err)
+			return fmt.Sprintf("warning: secret references not checked: %v", err), nil
+		}
+		if !ok {
+			missing = append(missing, ref.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", datasource.NewPhaseError(datasource.ErrorPhaseValidation,
+			fmt.Errorf("missing secret keys: %s, create them in the namespace or fix the paths under %s", strings.Join(missing, ", "), g.cfg.SecretMountRoot))
+	}
+	return "", nil
+}
+
+// SetSecretChecker configures how the Secrets referenced by the namespace configs are checked.
+// nil checks nothing
+func (g *Generator) SetSecretChecker(sc datasource.SecretChecker) {
+	g.secrets = sc
+}
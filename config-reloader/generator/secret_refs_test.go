@@ -0,0 +1,132 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticSecrets holds the keys of the secrets by namespace/name, err is returned for every lookup
+type staticSecrets struct {
+	keys map[string][]string
+	err  error
+}
+
+func (s *staticSecrets) SecretKeyExists(ctx context.Context, namespace string, name string, key string) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	for _, k := range s.keys[namespace+"/"+name] {
+		if k == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+const secretRefsConfig = `
+<filter **>
+  @type record_transformer
+  <record>
+    hint /etc/fluentd/secrets/not/an-output
+  </record>
+</filter>
+
+<match **>
+  @type copy
+  <store>
+    @type elasticsearch
+    password "#{File.read('/etc/fluentd/secrets/es-creds/password').strip}"
+    <buffer>
+      @type file
+      path /var/log/buffer
+    </buffer>
+  </store>
+  <store>
+    @type http
+    <auth>
+      method basic
+      password "#{File.read('/etc/fluentd/secrets/es-creds/password')}"
+    </auth>
+    tls_client_cert_path /etc/fluentd/secrets/http-tls/tls.crt
+  </store>
+</match>
+`
+
+func TestSecretRefs(t *testing.T) {
+	fragment, err := fluentd.ParseString(secretRefsConfig)
+	assert.Nil(t, err)
+
+	refs := secretRefs(fragment, "/etc/fluentd/secrets/")
+	assert.Equal(t, []secretRef{
+		{name: "es-creds", key: "password"},
+		{name: "http-tls", key: "tls.crt"},
+	}, refs)
+
+	assert.Empty(t, secretRefs(fragment, "/var/run/secrets"))
+}
+
+func renderSecretRefs(t *testing.T, secrets *staticSecrets) (*datasource.NamespaceStatus, map[string]string) {
+	dir, err := ioutil.TempDir("", "secret-refs")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:       "../templates",
+		AdminNamespace:     "kube-system",
+		ValidateSecretRefs: true,
+		SecretMountRoot:    "/etc/fluentd/secrets",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+	g.SetSecretChecker(secrets)
+
+	web := &datasource.NamespaceConfig{
+		Name:          "web",
+		FluentdConfig: secretRefsConfig,
+	}
+	g.SetModel([]*datasource.NamespaceConfig{web})
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	return g.StatusSummary([]*datasource.NamespaceConfig{web})["web"], hashes
+}
+
+func TestCheckSecretRefsAllFound(t *testing.T) {
+	st, _ := renderSecretRefs(t, &staticSecrets{keys: map[string][]string{
+		"web/es-creds": {"user", "password"},
+		"web/http-tls": {"tls.crt", "tls.key"},
+	}})
+
+	assert.Equal(t, datasource.StatusOK, st.Status)
+}
+
+func TestCheckSecretRefsMissingKey(t *testing.T) {
+	st, _ := renderSecretRefs(t, &staticSecrets{keys: map[string][]string{
+		"web/es-creds": {"user"},
+		// that namespace is not the one of the config
+		"api/es-creds": {"password"},
+		"web/http-tls": {"tls.crt"},
+	}})
+
+	assert.Equal(t, datasource.StatusError, st.Status)
+	assert.Equal(t, datasource.ErrorPhaseValidation, st.Phase)
+	assert.Contains(t, st.Message, "missing secret keys: es-creds/password,")
+}
+
+func TestCheckSecretRefsForbidden(t *testing.T) {
+	st, _ := renderSecretRefs(t, &staticSecrets{err: datasource.ErrSecretsForbidden})
+
+	assert.Equal(t, datasource.StatusWarning, st.Status)
+	assert.Contains(t, st.Message, "warning: secret references not checked: not allowed to read secrets")
+}
@@ -0,0 +1,43 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// namespaceSources returns the log sources a namespace selected in its sources annotation,
+// nil if it did not select any
+func (g *Generator) namespaceSources(ns *datasource.NamespaceConfig) []string {
+	if g.cfg.AnnotSources == "" {
+		return nil
+	}
+
+	value := strings.TrimSpace(ns.Annotations[g.cfg.AnnotSources])
+	if value == "" {
+		return nil
+	}
+
+	res := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
+
+// bufferProfile returns the buffer profile a namespace selected in its annotation, empty if none
+func (g *Generator) bufferProfile(ns *datasource.NamespaceConfig) string {
+	if g.cfg.AnnotBufferProfile == "" {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(ns.Annotations[g.cfg.AnnotBufferProfile]))
+}
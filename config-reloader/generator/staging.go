@@ -0,0 +1,78 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeFile stages a generated file, it is only written once the combined config is assembled
+// and, in strict mode, the whole cycle succeeds
+func (g *Generator) writeFile(filename string, data string) error {
+	if g.cfg.DryRun {
+		logrus.Debugf("Dry run: not writing %s", filename)
+		return nil
+	}
+
+	g.stagedFiles[filename] = &data
+	return nil
+}
+
+// removeFile stages the removal of a generated file like writeFile
+func (g *Generator) removeFile(filename string) error {
+	if g.cfg.DryRun {
+		logrus.Debugf("Dry run: not removing %s", filename)
+		return nil
+	}
+
+	g.stagedFiles[filename] = nil
+	return nil
+}
+
+// commitStagedFiles applies the files staged during the cycle. The files the main file includes
+// are written first and removed last so that fluentd never sees a main file including a file
+// that is not there yet, or not anymore
+func (g *Generator) commitStagedFiles() error {
+	filenames := make([]string, 0, len(g.stagedFiles))
+	for f := range g.stagedFiles {
+		filenames = append(filenames, f)
+	}
+	sort.Slice(filenames, func(i, j int) bool {
+		mi, mj := filepath.Base(filenames[i]) == mainConfigFile, filepath.Base(filenames[j]) == mainConfigFile
+		if mi != mj {
+			return mj
+		}
+		return filenames[i] < filenames[j]
+	})
+
+	for _, f := range filenames {
+		if data := g.stagedFiles[f]; data != nil {
+			if _, err := util.WriteStringToFileIfChanged(f, *data); err != nil {
+				return fmt.Errorf("cannot write %s: %v", f, err)
+			}
+		}
+	}
+
+	for _, f := range filenames {
+		if g.stagedFiles[f] == nil {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				logrus.Warnf("Error removing unused file %s: %+v", f, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// discardStagedFiles drops the files staged during the cycle, keeping the last applied config
+func (g *Generator) discardStagedFiles() {
+	g.stagedFiles = map[string]*string{}
+}
@@ -0,0 +1,168 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopStatusUpdater struct{}
+
+func (nopStatusUpdater) UpdateStatus(ctx context.Context, namespace string, status string) {}
+
+func TestStrictModeKeepsLastAppliedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strict")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		StrictMode:     true,
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	good := &datasource.NamespaceConfig{
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}
+	other := &datasource.NamespaceConfig{
+		Name:          "b",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{good, other})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	applied, err := ioutil.ReadFile(filepath.Join(dir, "ns-a.conf"))
+	assert.Nil(t, err)
+
+	// a valid change in a is not applied while b is broken
+	changed := &datasource.NamespaceConfig{
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n</match>\n",
+	}
+	broken := &datasource.NamespaceConfig{
+		Name:          "b",
+		FluentdConfig: "<match other.**>\n  @type null\n</match>\n",
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{changed, broken})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.NotNil(t, err)
+
+	current, err := ioutil.ReadFile(filepath.Join(dir, "ns-a.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(applied), string(current))
+
+	_, err = os.Stat(filepath.Join(dir, "ns-b.conf"))
+	assert.Nil(t, err)
+
+	// once b is fixed everything is applied
+	g.SetModel([]*datasource.NamespaceConfig{changed, other})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	current, err = ioutil.ReadFile(filepath.Join(dir, "ns-a.conf"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, string(applied), string(current))
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dry-run")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ns-stale.conf"), []byte("# running config\n"), 0644))
+
+	ctx := context.Background()
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		DryRun:         true,
+	})
+	g.SetStatusUpdater(ctx, su)
+
+	g.SetModel([]*datasource.NamespaceConfig{
+		{Name: "a", FluentdConfig: "<match **>\n  @type null\n</match>\n"},
+		{Name: "b", FluentdConfig: "<match other.**>\n  @type null\n</match>\n"},
+	})
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	g.CleanupUnusedFiles(dir, hashes)
+
+	// the configs are generated and validated but the running config is left alone
+	assert.Contains(t, hashes, "a")
+	assert.NotNil(t, g.DebugConfig("a"))
+	assert.Contains(t, su.statuses["b"], "other.**")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "ns-stale.conf", files[0].Name())
+}
+
+func TestCombinedConfigFailureKeepsPreviousConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combined")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	admin := &datasource.NamespaceConfig{
+		Name:          "kube-system",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}
+	g.SetModel([]*datasource.NamespaceConfig{admin, {
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	applied, err := ioutil.ReadFile(filepath.Join(dir, "fluent.conf"))
+	assert.Nil(t, err)
+	appliedA, err := ioutil.ReadFile(filepath.Join(dir, "ns-a.conf"))
+	assert.Nil(t, err)
+
+	// the changed namespaces are not written either while the admin config is broken
+	broken := &datasource.NamespaceConfig{
+		Name:          "kube-system",
+		FluentdConfig: "<match **>\n  @type null\n",
+	}
+	g.SetModel([]*datasource.NamespaceConfig{broken, {
+		Name:          "a",
+		FluentdConfig: "<match **>\n  @type elasticsearch\n</match>\n",
+	}, {
+		Name:          "b",
+		FluentdConfig: "<match **>\n  @type null\n</match>\n",
+	}})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Contains(t, err.Error(), "the config of the admin namespace kube-system")
+
+	current, err := ioutil.ReadFile(filepath.Join(dir, "fluent.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(applied), string(current))
+	current, err = ioutil.ReadFile(filepath.Join(dir, "ns-a.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(appliedA), string(current))
+	_, err = os.Stat(filepath.Join(dir, "ns-b.conf"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,67 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingStatusUpdater keeps the last status written for every namespace
+type recordingStatusUpdater struct {
+	statuses map[string]string
+	mutex    sync.Mutex
+}
+
+func (su *recordingStatusUpdater) UpdateStatus(ctx context.Context, namespace string, status string) {
+	su.mutex.Lock()
+	defer su.mutex.Unlock()
+	su.statuses[namespace] = status
+}
+
+func TestJSONStatusFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "status-format")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		StatusFormat:   config.StatusFormatJSON,
+	}
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g := New(ctx, cfg)
+	g.SetStatusUpdater(ctx, su)
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "good", FluentdConfig: "<match **>\n  @type null\n</match>\n"},
+		{Name: "bad", FluentdConfig: "<match hello-world>\n  @type null\n</match>\n"},
+	}
+	g.SetModel(namespaces)
+
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	// the namespaces that are ok get a status too
+	good := datasource.ParseStatusAnnotation(su.statuses["good"])
+	assert.Equal(t, datasource.StatusOK, good.Status)
+	assert.Equal(t, datasource.SeverityInfo, good.Severity)
+	assert.Equal(t, hashes["good"], good.ConfigHash)
+	assert.NotEmpty(t, good.LastUpdated)
+
+	bad := datasource.ParseStatusAnnotation(su.statuses["bad"])
+	assert.Equal(t, datasource.StatusError, bad.Status)
+	assert.Equal(t, datasource.SeverityError, bad.Severity)
+	assert.Contains(t, bad.Message, "hello-world")
+	assert.Equal(t, hashes["bad"], bad.ConfigHash)
+}
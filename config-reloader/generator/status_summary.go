@@ -0,0 +1,61 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+func (g *Generator) getStatus(namespace string) *datasource.NamespaceStatus {
+	st, ok := g.statuses[namespace]
+	if !ok {
+		st = &datasource.NamespaceStatus{Status: datasource.StatusOK}
+		g.statuses[namespace] = st
+	}
+
+	return st
+}
+
+func (g *Generator) recordStatus(namespace string, status string, phase string, message string) {
+	st := g.getStatus(namespace)
+	st.Status = status
+	st.Phase = phase
+	st.Message = message
+}
+
+// recordConfigHash remembers the hash of a namespace and when a changed config was last applied.
+// A quarantined namespace is rendered but its config is not applied
+func (g *Generator) recordConfigHash(nsConf *datasource.NamespaceConfig, configHash string, rendered bool) {
+	st := g.getStatus(nsConf.Name)
+	st.Hash = configHash
+
+	if rendered && st.Status != datasource.StatusError && st.Status != datasource.StatusDisabled && nsConf.PreviousConfigHash != configHash {
+		st.LastApplied = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// StatusSummary returns the last status of the given namespaces. The statuses of
+// namespaces not in the list are forgotten
+func (g *Generator) StatusSummary(namespaces []*datasource.NamespaceConfig) map[string]*datasource.NamespaceStatus {
+	existing := map[string]bool{}
+	for _, ns := range namespaces {
+		existing[ns.Name] = true
+	}
+
+	for ns := range g.statuses {
+		if !existing[ns] {
+			delete(g.statuses, ns)
+		}
+	}
+
+	res := map[string]*datasource.NamespaceStatus{}
+	for ns, st := range g.statuses {
+		stCopy := *st
+		res[ns] = &stCopy
+	}
+
+	return res
+}
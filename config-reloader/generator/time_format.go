@@ -0,0 +1,23 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"strconv"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+)
+
+// defaultTimeFormat returns --default-time-format unless the namespace opted out with its annotation
+func (g *Generator) defaultTimeFormat(ns *datasource.NamespaceConfig) string {
+	if g.cfg.AnnotKeepTimeFormat == "" {
+		return g.cfg.DefaultTimeFormat
+	}
+
+	if keep, _ := strconv.ParseBool(ns.Annotations[g.cfg.AnnotKeepTimeFormat]); keep {
+		return ""
+	}
+
+	return g.cfg.DefaultTimeFormat
+}
@@ -0,0 +1,45 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnroutedTagsOfPlainContainers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unrouted-tags")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:     "../templates",
+		AdminNamespace:   "kube-system",
+		WarnUnroutedTags: true,
+	})
+	su := &recordingStatusUpdater{statuses: map[string]string{}}
+	g.SetStatusUpdater(ctx, su)
+
+	// the api container only logs to stdout, it has no mount and is no mini container
+	g.SetModel([]*datasource.NamespaceConfig{{
+		Name:           "web",
+		FluentdConfig:  "<match kube.web.nginx.main>\n  @type null\n</match>\n",
+		MiniContainers: []*datasource.MiniContainer{{PodName: "nginx", Name: "main"}},
+		Containers: []datasource.ContainerRef{
+			{PodName: "nginx", Name: "main"},
+			{PodName: "api", Name: "server"},
+		},
+	}})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "warning: no <match> routes the tags kube.web.api.server", su.statuses["web"])
+}
@@ -0,0 +1,202 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowValidator stands in for the fluentd dry-run: it takes its time, tracks how many
+// validations run at once and rejects configs mentioning "broken"
+type slowValidator struct {
+	delay    time.Duration
+	mutex    sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (v *slowValidator) ValidateConfig(config string, namespace string) error {
+	return v.ValidateConfigExtremely(config, namespace)
+}
+
+func (v *slowValidator) ValidateConfigExtremely(config string, namespace string) error {
+	v.mutex.Lock()
+	v.inFlight++
+	if v.inFlight > v.peak {
+		v.peak = v.inFlight
+	}
+	v.mutex.Unlock()
+
+	time.Sleep(v.delay)
+
+	v.mutex.Lock()
+	v.inFlight--
+	v.mutex.Unlock()
+
+	if strings.Contains(config, "broken") {
+		return errors.New("bad config in " + namespace)
+	}
+	return nil
+}
+
+func (v *slowValidator) EnsureUsable() error {
+	return nil
+}
+
+func sampleNamespaces(n int) []*datasource.NamespaceConfig {
+	res := []*datasource.NamespaceConfig{}
+	for i := 0; i < n; i++ {
+		res = append(res, &datasource.NamespaceConfig{
+			Name: fmt.Sprintf("ns-%02d", i),
+			FluentdConfig: fmt.Sprintf(`
+<filter $labels(app=web-%d)>
+  @type parser
+  key_name log
+  <parse>
+    @type json
+  </parse>
+</filter>
+
+<match **>
+  @type elasticsearch
+  index_name logs-%d
+</match>
+`, i, i),
+		})
+	}
+	return res
+}
+
+func newValidatingGenerator(ctx context.Context, validator fluentd.Validator, concurrency int) *Generator {
+	g := New(ctx, &config.Config{
+		TemplatesDir:          "../templates",
+		AdminNamespace:        "kube-system",
+		ValidationConcurrency: concurrency,
+	})
+	g.validator = fluentd.NewLimitedValidator(validator, concurrency)
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+	return g
+}
+
+func TestValidateNamespacesConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	validator := &slowValidator{delay: 10 * time.Millisecond}
+	g := newValidatingGenerator(ctx, validator, 3)
+
+	namespaces := sampleNamespaces(10)
+	namespaces[4].FluentdConfig = "<match **>\n  @type elasticsearch\n  index_name broken\n</match>\n"
+	g.SetModel(namespaces)
+
+	hashes, err := g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(hashes))
+	assert.True(t, validator.peak > 1 && validator.peak <= 3, "peak of %d validations", validator.peak)
+
+	statuses := g.StatusSummary(namespaces)
+	for _, ns := range namespaces {
+		if ns.Name == "ns-04" {
+			assert.Equal(t, datasource.StatusError, statuses[ns.Name].Status)
+			assert.Equal(t, "bad config in ns-04", statuses[ns.Name].Message)
+			assert.False(t, fileExists(dir, "ns-ns-04.conf"))
+		} else {
+			assert.Equal(t, datasource.StatusOK, statuses[ns.Name].Status, ns.Name)
+			assert.True(t, fileExists(dir, "ns-"+ns.Name+".conf"), ns.Name)
+		}
+	}
+}
+
+func BenchmarkValidation(b *testing.B) {
+	dir, err := ioutil.TempDir("", "validation")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	namespaces := sampleNamespaces(32)
+
+	for _, concurrency := range []int{1, 4, 8} {
+		name := fmt.Sprintf("concurrency-%d", concurrency)
+		if concurrency == 1 {
+			name = "serial"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			g := newValidatingGenerator(ctx, &slowValidator{delay: 2 * time.Millisecond}, concurrency)
+			g.SetModel(namespaces)
+			for i := 0; i < b.N; i++ {
+				if _, err := g.RenderToDisk(ctx, dir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorPhases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := newValidatingGenerator(ctx, &slowValidator{}, 1)
+
+	namespaces := []*datasource.NamespaceConfig{
+		{Name: "ok", FluentdConfig: "<match **>\n  @type null\n</match>\n"},
+		{Name: "render", FluentdConfig: "<match **>\n  @type null\n"},
+		{Name: "validation", FluentdConfig: "<match **>\n  @type elasticsearch\n  index_name broken\n</match>\n"},
+		{Name: "policy", FluentdConfig: "<match **>\n  @type exec\n</match>\n"},
+	}
+	g.SetModel(namespaces)
+
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	statuses := g.StatusSummary(namespaces)
+	assert.Equal(t, "", statuses["ok"].Phase)
+	assert.Equal(t, datasource.ErrorPhaseRender, statuses["render"].Phase)
+	assert.Equal(t, datasource.ErrorPhaseValidation, statuses["validation"].Phase)
+	assert.Equal(t, datasource.ErrorPhasePolicy, statuses["policy"].Phase)
+	assert.Equal(t, "cannot use '@type exec' in <match>", statuses["policy"].Message)
+}
+
+func TestValidateNamespaceWithAdminConfig(t *testing.T) {
+	g := New(context.Background(), &config.Config{
+		TemplatesDir:   "../templates",
+		AdminNamespace: "kube-system",
+		AllowedPlugins: []string{"null"},
+	})
+	ns := &datasource.NamespaceConfig{
+		Name:          "demo",
+		FluentdConfig: "<match **>\n  @type blackhole\n</match>",
+	}
+
+	err := g.ValidateNamespace(ns)
+	assert.NotNil(t, err)
+	assert.Equal(t, "plugins not allowed by the cluster policy: blackhole", err.Error())
+
+	// the virtual plugin is checked with its real type
+	assert.Nil(t, g.SetAdminConfig("<plugin blackhole>\n  @type null\n</plugin>"))
+	assert.Nil(t, g.ValidateNamespace(ns))
+
+	assert.NotNil(t, g.SetAdminConfig("<plugin blackhole>\n"))
+}
@@ -0,0 +1,60 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// maxFlushThreads returns the flush thread limit of a namespace, taken from its annotation
+// or else from --max-flush-threads
+func (g *Generator) maxFlushThreads(ns *datasource.NamespaceConfig) int {
+	cfg := g.cfg.Current()
+	if cfg.AnnotFlushThreads == "" {
+		return cfg.MaxFlushThreads
+	}
+
+	value, ok := ns.Annotations[cfg.AnnotFlushThreads]
+	if !ok {
+		return cfg.MaxFlushThreads
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		logrus.Warnf("Bad value '%s' of annotation %s on namespace %s, using the default flush thread limit", value, cfg.AnnotFlushThreads, ns.Name)
+		return cfg.MaxFlushThreads
+	}
+
+	return limit
+}
+
+// workerFor assigns a namespace to one of the fluentd workers. The assignment only
+// depends on the namespace name so it stays stable across runs
+func workerFor(namespace string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// pinToWorker wraps the directives a namespace adds to the main file, i.e. its sources,
+// in a <worker> directive. Most inputs, in_tail included, don't support multiple workers
+func (g *Generator) pinToWorker(namespace string, prep fluentd.Fragment) fluentd.Fragment {
+	if g.cfg.FluentdWorkers <= 1 || len(prep) == 0 {
+		return prep
+	}
+
+	return fluentd.Fragment{
+		&fluentd.Directive{
+			Name:   "worker",
+			Tag:    strconv.Itoa(workerFor(namespace, g.cfg.FluentdWorkers)),
+			Params: fluentd.Params{},
+			Nested: prep,
+		},
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkersAndFlushThreads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workers")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	g := New(ctx, &config.Config{
+		TemplatesDir:      "../templates",
+		AdminNamespace:    "kube-system",
+		AllowedTailPaths:  []string{"/var/log/audit"},
+		FluentdWorkers:    4,
+		MaxFlushThreads:   2,
+		AnnotFlushThreads: "example.com/max-flush-threads",
+	})
+	g.SetStatusUpdater(ctx, nopStatusUpdater{})
+
+	config := `
+<source>
+  @type host-file
+  path /var/log/audit/audit.log
+  tag audit
+</source>
+
+<match **>
+  @type elasticsearch
+  <buffer>
+    flush_thread_count 8
+  </buffer>
+</match>
+`
+	limited := &datasource.NamespaceConfig{
+		Name:          "limited",
+		FluentdConfig: config,
+	}
+	trusted := &datasource.NamespaceConfig{
+		Name:          "trusted",
+		FluentdConfig: config,
+		Annotations:   map[string]string{"example.com/max-flush-threads": "6"},
+	}
+
+	g.SetModel([]*datasource.NamespaceConfig{limited, trusted})
+	_, err = g.RenderToDisk(ctx, dir)
+	assert.Nil(t, err)
+
+	for ns, limit := range map[string]string{"limited": "2", "trusted": "6"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "ns-"+ns+".conf"))
+		assert.Nil(t, err)
+		fragment, err := fluentd.ParseString(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, limit, fragment[0].Nested[0].Param("flush_thread_count"), ns)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, mainConfigFile))
+	assert.Nil(t, err)
+
+	// the parser doesn't know about top-level @include
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "@include") {
+			lines = append(lines, line)
+		}
+	}
+	main, err := fluentd.ParseString(strings.Join(lines, "\n"))
+	assert.Nil(t, err)
+
+	pinned := map[string]string{}
+	for _, d := range main {
+		switch d.Name {
+		case "system":
+			assert.Equal(t, "4", d.Param("workers"))
+			assert.Equal(t, "127.0.0.1:24444", d.Param("rpc_endpoint"))
+		case "worker":
+			for _, nested := range d.Nested {
+				if nested.Name == "source" {
+					pinned[nested.Param("tag")] = d.Tag
+				}
+			}
+		}
+	}
+
+	// the tail source of every namespace is pinned to the worker of the namespace
+	assert.Equal(t, map[string]string{
+		"kube.limited.host.audit": strconv.Itoa(workerFor("limited", 4)),
+		"kube.trusted.host.audit": strconv.Itoa(workerFor("trusted", 4)),
+	}, pinned)
+}
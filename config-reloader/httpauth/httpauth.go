@@ -0,0 +1,227 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package httpauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reviewTimeout bounds a TokenReview so that a slow API server does not hold the requests
+const reviewTimeout = 10 * time.Second
+
+// reviewCacheTTL is how long the result of a TokenReview is reused, so that every scrape or
+// request does not create a TokenReview
+const reviewCacheTTL = time.Minute
+
+// maxCachedReviews bounds the review cache, it is emptied when full
+const maxCachedReviews = 1024
+
+// TokenReviewer authenticates a bearer token, e.g. with a Kubernetes TokenReview. It returns
+// the user name of a token authenticated for one of the audiences and false for a token that is not
+type TokenReviewer interface {
+	ReviewToken(ctx context.Context, token string, audiences []string) (string, bool, error)
+}
+
+// cachedReview is the result of a TokenReview, keyed by the hash of the token
+type cachedReview struct {
+	user          string
+	authenticated bool
+	expires       time.Time
+}
+
+// Gate serves the HTTP endpoints of the reloader over TLS and checks their bearer tokens.
+// A zero Gate serves plain HTTP to anyone
+type Gate struct {
+	// CertFile and KeyFile serve the endpoints over TLS, both or none must be set
+	CertFile string
+	KeyFile  string
+	// Token is a static bearer token accepted by the endpoints
+	Token string
+	// TokenReview accepts the tokens authenticated by the reviewer set with SetTokenReviewer
+	TokenReview bool
+	// AllowedUsers restricts the users authenticated by a TokenReview, empty allows all of them
+	AllowedUsers []string
+	// Audiences are the audiences a reviewed token must be issued for, empty accepts the tokens of
+	// the API server
+	Audiences []string
+
+	mutex    sync.RWMutex
+	reviewer TokenReviewer
+	reviews  map[[sha256.Size]byte]cachedReview
+}
+
+// NewGate creates the gate of the endpoints, reading the static bearer token from a file if set
+func NewGate(certFile, keyFile, tokenFile string, tokenReview bool, allowedUsers []string, audiences []string) (*Gate, error) {
+	g := &Gate{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		TokenReview:  tokenReview,
+		AllowedUsers: allowedUsers,
+	}
+	// --http-token-audience= accepts the tokens of the API server
+	for _, audience := range audiences {
+		if audience != "" {
+			g.Audiences = append(g.Audiences, audience)
+		}
+	}
+
+	if tokenFile != "" {
+		data, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the bearer token: %v", err)
+		}
+		g.Token = strings.TrimSpace(string(data))
+		if g.Token == "" {
+			return nil, fmt.Errorf("the bearer token file %s is empty", tokenFile)
+		}
+	}
+
+	return g, nil
+}
+
+// SetTokenReviewer sets how the tokens are reviewed, until then only the static token is accepted
+func (g *Gate) SetTokenReviewer(r TokenReviewer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.reviewer = r
+	g.reviews = nil
+}
+
+// authenticates tells if a gate checks the bearer tokens
+func (g *Gate) authenticates() bool {
+	return g != nil && (g.Token != "" || g.TokenReview)
+}
+
+// Handler requires a valid bearer token for all paths of h but the exempt ones
+func (g *Gate) Handler(h http.Handler, exempt ...string) http.Handler {
+	if !g.authenticates() {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range exempt {
+			if r.URL.Path == path {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if err := g.check(r.Context(), r.Header.Get("Authorization")); err != nil {
+			logrus.Debugf("Rejecting %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-fluentd-operator"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Authorize checks the value of the Authorization header of a request that is not HTTP, e.g. the
+// metadata of a gRPC call. It accepts anything if the gate does not check the bearer tokens
+func (g *Gate) Authorize(ctx context.Context, authorization string) error {
+	if !g.authenticates() {
+		return nil
+	}
+	return g.check(ctx, authorization)
+}
+
+func (g *Gate) check(ctx context.Context, header string) error {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return errors.New("a bearer token is required")
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	if token == "" {
+		return errors.New("a bearer token is required")
+	}
+
+	if g.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(g.Token)) == 1 {
+		return nil
+	}
+
+	if !g.TokenReview {
+		return errors.New("invalid bearer token")
+	}
+
+	g.mutex.RLock()
+	reviewer := g.reviewer
+	g.mutex.RUnlock()
+	if reviewer == nil {
+		return errors.New("the tokens cannot be reviewed yet")
+	}
+
+	user, ok, err := g.review(ctx, reviewer, token)
+	if err != nil {
+		return fmt.Errorf("cannot review the bearer token: %v", err)
+	}
+	if !ok {
+		return errors.New("invalid bearer token")
+	}
+	if len(g.AllowedUsers) == 0 {
+		return nil
+	}
+	for _, allowed := range g.AllowedUsers {
+		if user == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s is not allowed", user)
+}
+
+// review reviews a token, or returns the result of its review within the last reviewCacheTTL.
+// Only the hash of the token is kept. A failed review is not cached, the next request tries again
+func (g *Gate) review(ctx context.Context, reviewer TokenReviewer, token string) (string, bool, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	g.mutex.RLock()
+	cached, found := g.reviews[key]
+	g.mutex.RUnlock()
+	if found && now.Before(cached.expires) {
+		return cached.user, cached.authenticated, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reviewTimeout)
+	defer cancel()
+	user, ok, err := reviewer.ReviewToken(ctx, token, g.Audiences)
+	if err != nil {
+		return "", false, err
+	}
+
+	g.mutex.Lock()
+	if g.reviews == nil || len(g.reviews) >= maxCachedReviews {
+		g.reviews = map[[sha256.Size]byte]cachedReview{}
+	}
+	g.reviews[key] = cachedReview{user: user, authenticated: ok, expires: now.Add(reviewCacheTTL)}
+	g.mutex.Unlock()
+
+	return user, ok, nil
+}
+
+// ListenAndServe serves srv, over TLS if the gate has a certificate
+func (g *Gate) ListenAndServe(srv *http.Server) error {
+	if g != nil && g.CertFile != "" {
+		return srv.ListenAndServeTLS(g.CertFile, g.KeyFile)
+	}
+	return srv.ListenAndServe()
+}
+
+// Serve serves srv on a listener, over TLS if the gate has a certificate
+func (g *Gate) Serve(srv *http.Server, ln net.Listener) error {
+	if g != nil && g.CertFile != "" {
+		return srv.ServeTLS(ln, g.CertFile, g.KeyFile)
+	}
+	return srv.Serve(ln)
+}
@@ -0,0 +1,138 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticReviewer map[string]string
+
+func (s staticReviewer) ReviewToken(ctx context.Context, token string, audiences []string) (string, bool, error) {
+	if token == "broken" {
+		return "", false, errors.New("connection refused")
+	}
+	user, ok := s[token]
+	return user, ok, nil
+}
+
+// countingReviewer records the reviews reaching the API server
+type countingReviewer struct {
+	staticReviewer
+	calls     map[string]int
+	audiences []string
+}
+
+func (c *countingReviewer) ReviewToken(ctx context.Context, token string, audiences []string) (string, bool, error) {
+	c.calls[token]++
+	c.audiences = audiences
+	return c.staticReviewer.ReviewToken(ctx, token, audiences)
+}
+
+func status(t *testing.T, h http.Handler, path string, token string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+})
+
+func TestGateOpen(t *testing.T) {
+	var nilGate *Gate
+	assert.Equal(t, http.StatusOK, status(t, nilGate.Handler(ok), "/metrics", ""))
+	assert.Equal(t, http.StatusOK, status(t, (&Gate{}).Handler(ok), "/metrics", ""))
+}
+
+func TestGateStaticToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("s3cret\n"), 0600))
+	g, err := NewGate("", "", tokenFile, false, nil, nil)
+	assert.Nil(t, err)
+
+	h := g.Handler(ok, "/healthz")
+	assert.Equal(t, http.StatusUnauthorized, status(t, h, "/metrics", ""))
+	assert.Equal(t, http.StatusUnauthorized, status(t, h, "/metrics", "wrong"))
+	assert.Equal(t, http.StatusOK, status(t, h, "/metrics", "s3cret"))
+	assert.Equal(t, http.StatusOK, status(t, h, "/healthz", ""))
+
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("\n"), 0600))
+	_, err = NewGate("", "", tokenFile, false, nil, nil)
+	assert.NotNil(t, err)
+	_, err = NewGate("", "", filepath.Join(dir, "missing"), false, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestGateTokenReview(t *testing.T) {
+	g, err := NewGate("", "", "", true, []string{"system:serviceaccount:monitoring:prometheus"}, nil)
+	assert.Nil(t, err)
+	h := g.Handler(ok)
+
+	// not reviewed until the datasource is there
+	assert.Equal(t, http.StatusUnauthorized, status(t, h, "/config", "prometheus"))
+
+	g.SetTokenReviewer(staticReviewer{
+		"prometheus": "system:serviceaccount:monitoring:prometheus",
+		"other":      "system:serviceaccount:team-a:default",
+	})
+	assert.Equal(t, http.StatusOK, status(t, h, "/config", "prometheus"))
+	assert.Equal(t, http.StatusUnauthorized, status(t, h, "/config", "other"))
+	assert.Equal(t, http.StatusUnauthorized, status(t, h, "/config", "unknown"))
+	assert.Equal(t, http.StatusUnauthorized, status(t, h, "/config", "broken"))
+
+	// any authenticated user without a restriction
+	g.AllowedUsers = nil
+	assert.Equal(t, http.StatusOK, status(t, h, "/config", "other"))
+}
+
+func TestGateCachesTokenReviews(t *testing.T) {
+	g, err := NewGate("", "", "", true, []string{"system:serviceaccount:monitoring:prometheus"}, []string{"", "kube-fluentd-operator"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"kube-fluentd-operator"}, g.Audiences)
+	h := g.Handler(ok)
+
+	r := &countingReviewer{
+		staticReviewer: staticReviewer{"prometheus": "system:serviceaccount:monitoring:prometheus"},
+		calls:          map[string]int{},
+	}
+	g.SetTokenReviewer(r)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, status(t, h, "/metrics", "prometheus"))
+		assert.Equal(t, http.StatusUnauthorized, status(t, h, "/metrics", "unknown"))
+		assert.Equal(t, http.StatusUnauthorized, status(t, h, "/metrics", "broken"))
+	}
+	assert.Equal(t, 1, r.calls["prometheus"])
+	assert.Equal(t, 1, r.calls["unknown"])
+	// errors are not cached
+	assert.Equal(t, 3, r.calls["broken"])
+	assert.Equal(t, []string{"kube-fluentd-operator"}, r.audiences)
+
+	// expired results are reviewed again
+	for key, review := range g.reviews {
+		review.expires = time.Now().Add(-time.Second)
+		g.reviews[key] = review
+	}
+	assert.Equal(t, http.StatusOK, status(t, h, "/metrics", "prometheus"))
+	assert.Equal(t, 2, r.calls["prometheus"])
+}
@@ -5,26 +5,46 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/controller"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/metrics"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/stateapi"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/webhook"
 
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	ctx := context.Background()
+	// with --once the exit code is set last, once the traces are flushed
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// cancelling ctx stops the informers, after the traces are flushed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	cfg := &config.Config{}
 
 	if err := cfg.ParseFlags(os.Args[1:]); err != nil {
 		logrus.Fatalf("flag parsing error: %v", err)
 	}
+	logrus.SetFormatter(cfg.GetLogFormatter())
 	logrus.Infof("Version: %s", config.Version)
 
 	logrus.Infof("Config: %+v", cfg)
@@ -43,10 +63,63 @@ func main() {
 
 	logrus.SetLevel(cfg.GetLogLevel())
 
+	if cfg.Command == config.CommandValidate {
+		if err := validateFile(ctx, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("The config of namespace %s is valid\n", cfg.ValidateNamespace)
+		return
+	}
+
+	if cfg.RoutingGraph != "" {
+		printRoutingGraph(cfg)
+		return
+	}
+
+	var installedPlugins map[string]string
+	if cfg.FluentGemCommand != "" {
+		installedPlugins = recordPluginVersions(cfg)
+	}
+
+	shutdownTracing, err := metrics.InitTracing(ctx, cfg.OTLPEndpoint)
+	if err != nil {
+		logrus.Fatalf("Cannot set up tracing: %+v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.Warnf("Cannot flush the traces: %+v", err)
+		}
+	}()
+
+	gate, err := httpauth.NewGate(cfg.HTTPCertFile, cfg.HTTPKeyFile, cfg.HTTPTokenFile, cfg.HTTPTokenReview, cfg.HTTPAllowedUsers, cfg.HTTPTokenAudiences)
+	if err != nil {
+		logrus.Fatalf("Cannot secure the HTTP endpoints: %+v", err)
+	}
+
+	// the probes answer while the informers are syncing
+	var health *controller.Health
+	if cfg.HealthAddr != "" && cfg.IntervalSeconds != 0 && !cfg.RunOnce {
+		health = controller.NewHealth(cfg.HealthStaleAfter)
+		health.Serve(cfg.HealthAddr, gate, cfg.HTTPAuthProbes)
+	}
+
 	ctrl, err := controller.New(ctx, cfg)
 	if err != nil {
 		logrus.Fatalf("Cannot start control loop %+v", err)
 	}
+	if health != nil {
+		ctrl.SetHealth(health)
+	}
+	if r, ok := ctrl.Datasource.(httpauth.TokenReviewer); ok && cfg.HTTPTokenReview {
+		gate.SetTokenReviewer(r)
+	}
+	ctrl.Generator.SetInstalledPlugins(installedPlugins)
+
+	if cfg.RunOnce {
+		exitCode = runOnce(ctx, ctrl)
+		return
+	}
 
 	// Add this for a timeout between 0-120 seconds (default: 30 (ExecTimeoutSeconds))
 	// This is for golang/fluentd race condition when KFO starts/restarts:
@@ -64,12 +137,133 @@ func main() {
 	go handleSigterm(stopChan)
 
 	if cfg.PrometheusEnabled {
-		metrics.InitMetrics(cfg.MetricsPort)
+		metrics.InitMetrics(cfg.MetricsPort, gate)
+	}
+
+	if cfg.FluentdMonitorAddr != "" {
+		url := fmt.Sprintf("http://%s/api/plugins.json", cfg.FluentdMonitorAddr)
+		go metrics.ScrapeFluentdBuffers(ctx, url, time.Second*time.Duration(cfg.FluentdMonitorInterval), ctrl.Generator.NamespaceOfOutput)
+	}
+
+	if cfg.WebhookAddr != "" {
+		wh := webhook.New(ctx, cfg, ctrl.Generator)
+		if r, ok := ctrl.Datasource.(datasource.NamespaceMetadataReader); ok {
+			wh.SetNamespaceMetadataReader(r)
+		}
+		wh.Start()
+	}
+
+	if cfg.RollbackAddr != "" {
+		ctrl.ServeRollback(cfg.RollbackAddr, gate)
+	}
+
+	if cfg.DebugConfigAddr != "" {
+		ctrl.ServeDebugConfig(cfg.DebugConfigAddr, gate)
+	}
+
+	if cfg.DryValidateAddr != "" {
+		ctrl.ServeDryValidate(cfg.DryValidateAddr, gate)
+	}
+
+	if cfg.GRPCAddr != "" {
+		if err := stateapi.New(ctrl, ctrl.Source).Start(cfg.GRPCAddr, gate); err != nil {
+			logrus.Fatalf("Cannot serve the gRPC API on %s: %+v", cfg.GRPCAddr, err)
+		}
 	}
 
 	ctrl.Run(ctx, stopChan)
 }
 
+// runOnce runs a single cycle and returns the exit code: 1 if the config of a namespace failed,
+// 2 if the cycle itself failed
+func runOnce(ctx context.Context, ctrl *controller.Controller) int {
+	if err := ctrl.RunOnce(ctx); err != nil {
+		logrus.Errorf("The run failed: %+v", err)
+		return 2
+	}
+
+	failed := ctrl.FailedNamespaces()
+	if len(failed) > 0 {
+		logrus.Errorf("The config of %d namespaces failed: %s", len(failed), strings.Join(failed, ", "))
+		return 1
+	}
+
+	logrus.Infof("The configs of all %d namespaces are valid", len(ctrl.NamespaceStates()))
+	return 0
+}
+
+// recordPluginVersions exposes the installed plugin versions and warns about drift from the expected
+// ones. It returns the installed plugins, nil if they cannot be listed
+func recordPluginVersions(cfg *config.Config) map[string]string {
+	timeout := time.Second * time.Duration(cfg.ExecTimeoutSeconds)
+	if timeout == 0 {
+		// a zero exec timeout only disables the startup sleep
+		timeout = 30 * time.Second
+	}
+
+	installed, err := fluentd.InstalledPluginVersions(cfg.FluentGemCommand, timeout)
+	if err != nil {
+		logrus.Warnf("Cannot record installed plugin versions: %+v", err)
+		return nil
+	}
+
+	logrus.Infof("Installed plugin versions: %v", installed)
+
+	drift := fluentd.FindPluginDrift(installed, cfg.ExpectedPlugins)
+	for _, d := range drift {
+		logrus.Warnf("Plugin version drift: %s", d)
+	}
+
+	metrics.SetPluginVersions(installed, cfg.ExpectedPlugins, drift)
+	return installed
+}
+
+// validateFile runs a namespace config from a file through the processing and fluentd validation
+// of the control loop. The error is the status the namespace would get
+func validateFile(ctx context.Context, cfg *config.Config) error {
+	data, err := ioutil.ReadFile(cfg.ValidateFile)
+	if err != nil {
+		return err
+	}
+
+	gen := generator.New(ctx, cfg)
+	if cfg.ValidateAdminFile != "" {
+		admin, err := ioutil.ReadFile(cfg.ValidateAdminFile)
+		if err != nil {
+			return err
+		}
+		if err := gen.SetAdminConfig(string(admin)); err != nil {
+			return fmt.Errorf("bad admin config %s: %v", cfg.ValidateAdminFile, err)
+		}
+	}
+
+	return gen.ValidateNamespace(&datasource.NamespaceConfig{
+		Name:          cfg.ValidateNamespace,
+		FluentdConfig: string(data),
+		Labels:        cfg.ValidateLabels,
+	})
+}
+
+// printRoutingGraph prints the routing graph of a namespace to stdout, for debugging
+func printRoutingGraph(cfg *config.Config) {
+	graph, err := generator.RoutingGraph(cfg.OutputDir, cfg.RoutingGraph)
+	if err != nil {
+		logrus.Fatalf("Cannot build the routing graph of namespace %s: %+v", cfg.RoutingGraph, err)
+	}
+
+	if cfg.RoutingGraphFormat == "dot" {
+		fmt.Print(graph.DOT())
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(graph); err != nil {
+		logrus.Fatalf("Cannot encode the routing graph: %+v", err)
+	}
+}
+
 func handleSigterm(stopChan chan struct{}) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
@@ -0,0 +1,115 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const LabelPluginID = "plugin_id"
+
+var fluentdBufferQueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "fluentd_buffer_queue_length",
+	Help:      "Length of the buffer queue of the fluentd outputs of a namespace, scraped from the monitor_agent",
+}, []string{LabelTargetNamespace, LabelPluginID})
+
+var fluentdRetryCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "fluentd_retry_count",
+	Help:      "Retries of the fluentd outputs of a namespace since fluentd started, scraped from the monitor_agent",
+}, []string{LabelTargetNamespace, LabelPluginID})
+
+var fluentdMonitorUp = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "fluentd_monitor_up",
+	Help:      "1 if the last scrape of the fluentd monitor_agent succeeded, 0 otherwise",
+})
+
+// monitorAgentPlugin is the subset of a plugin entry of the monitor_agent /api/plugins.json.
+// Plugins without a buffer have no queue length
+type monitorAgentPlugin struct {
+	PluginID          string   `json:"plugin_id"`
+	BufferQueueLength *float64 `json:"buffer_queue_length"`
+	RetryCount        *float64 `json:"retry_count"`
+}
+
+// ScrapeFluentdBuffers polls the monitor_agent at url every interval until ctx is done and exports
+// the buffer state of the outputs that namespaceOf maps to a namespace. While fluentd cannot be
+// reached the series are dropped and fluentd_monitor_up is 0
+func ScrapeFluentdBuffers(ctx context.Context, url string, interval time.Duration, namespaceOf func(pluginID string) string) {
+	client := &http.Client{Timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		err := scrapeFluentdBuffers(client, url, namespaceOf)
+		if err != nil {
+			if healthy {
+				logrus.Warnf("Cannot scrape the fluentd monitor_agent at %s, will keep trying: %+v", url, err)
+			}
+			fluentdMonitorUp.Set(0)
+			fluentdBufferQueueLength.Reset()
+			fluentdRetryCount.Reset()
+		} else {
+			if !healthy {
+				logrus.Infof("Scraping the fluentd monitor_agent at %s again", url)
+			}
+			fluentdMonitorUp.Set(1)
+		}
+		healthy = err == nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func scrapeFluentdBuffers(client *http.Client, url string, namespaceOf func(pluginID string) string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	body := struct {
+		Plugins []monitorAgentPlugin `json:"plugins"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("bad response: %+v", err)
+	}
+
+	fluentdBufferQueueLength.Reset()
+	fluentdRetryCount.Reset()
+	for _, p := range body.Plugins {
+		namespace := namespaceOf(p.PluginID)
+		if namespace == "" {
+			continue
+		}
+
+		labels := prometheus.Labels{LabelTargetNamespace: namespace, LabelPluginID: p.PluginID}
+		if p.BufferQueueLength != nil {
+			fluentdBufferQueueLength.With(labels).Set(*p.BufferQueueLength)
+		}
+		if p.RetryCount != nil {
+			fluentdRetryCount.With(labels).Set(*p.RetryCount)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeFluentdBuffers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/plugins.json", r.URL.Path)
+		w.Write([]byte(`{"plugins": [
+  {"plugin_id": "in_tail_container_logs", "type": "tail"},
+  {"plugin_id": "kfo-shop-1", "type": "elasticsearch", "buffer_queue_length": 3, "retry_count": 7},
+  {"plugin_id": "kfo-shop-2", "type": "relabel", "retry_count": 0},
+  {"plugin_id": "object:3fe", "type": "stdout", "buffer_queue_length": 1, "retry_count": 1}
+]}`))
+	}))
+	defer srv.Close()
+
+	namespaces := map[string]string{"kfo-shop-1": "shop", "kfo-shop-2": "shop"}
+	err := scrapeFluentdBuffers(srv.Client(), srv.URL+"/api/plugins.json", func(id string) string { return namespaces[id] })
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(fluentdBufferQueueLength.With(prometheus.Labels{LabelTargetNamespace: "shop", LabelPluginID: "kfo-shop-1"})))
+	assert.Equal(t, 7.0, testutil.ToFloat64(fluentdRetryCount.With(prometheus.Labels{LabelTargetNamespace: "shop", LabelPluginID: "kfo-shop-1"})))
+	// no buffer, no queue length; unknown plugins are left out
+	assert.Equal(t, 1, testutil.CollectAndCount(fluentdBufferQueueLength))
+	assert.Equal(t, 2, testutil.CollectAndCount(fluentdRetryCount))
+}
+
+func TestScrapeFluentdBuffersUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := scrapeFluentdBuffers(srv.Client(), srv.URL, func(id string) string { return "shop" })
+	assert.NotNil(t, err)
+
+	srv.Close()
+	err = scrapeFluentdBuffers(srv.Client(), srv.URL, func(id string) string { return "shop" })
+	assert.NotNil(t, err)
+}
@@ -1,10 +1,15 @@
 package metrics
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -12,6 +17,28 @@ import (
 
 const (
 	LabelTargetNamespace = "target_namespace"
+	LabelReason          = "reason"
+	LabelSizeClass       = "size_class"
+	LabelPhase           = "phase"
+	LabelPlugin          = "plugin"
+	LabelVersion         = "version"
+	LabelChecksum        = "checksum"
+	LabelNamespace       = "namespace"
+	LabelStatus          = "status"
+	LabelSource          = "source"
+	LabelConfigHash      = "config_hash"
+	LabelSeverity        = "severity"
+	LabelRule            = "rule"
+	LabelResult          = "result"
+
+	// DrainResultDrained and DrainResultTimeout are the results of a buffer drain before a reload
+	DrainResultDrained = "drained"
+	DrainResultTimeout = "timeout"
+
+	// PhaseFetch covers reading the config and building the mini containers of a namespace
+	PhaseFetch = "fetch"
+	// PhaseGenerate covers processing, validating and writing the config of a namespace
+	PhaseGenerate = "generate"
 )
 
 var namespaceConfigStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -20,6 +47,156 @@ var namespaceConfigStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 	Help:      "Current validation status of fluentd configs in the namespace. Values are 0 (validation error) or 1 (validation successful)",
 }, []string{LabelTargetNamespace})
 
+var (
+	lastReloadMutex sync.RWMutex
+	// until the first successful reload the age is measured from startup
+	lastReloadTime = time.Now()
+)
+
+var secondsSinceLastReload = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "seconds_since_last_reload",
+	Help:      "Seconds elapsed since fluentd was last successfully reloaded (measured from startup until the first reload)",
+}, func() float64 {
+	lastReloadMutex.RLock()
+	defer lastReloadMutex.RUnlock()
+	return time.Since(lastReloadTime).Seconds()
+})
+
+var reloadAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "reload_attempts_total",
+	Help:      "Number of times a fluentd reload was attempted",
+})
+
+var reloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "reload_failures_total",
+	Help:      "Number of failed fluentd reloads by reason",
+}, []string{LabelReason})
+
+var reloadsDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "reloads_deferred_total",
+	Help:      "Number of fluentd reloads deferred by --max-reloads-per-minute, a later reload applies their changes",
+})
+
+var bufferDrains = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "buffer_drains_total",
+	Help:      "Number of buffer drains before a reload moving or removing file buffers by result: drained or timeout",
+}, []string{LabelResult})
+
+var namespaceErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "namespace_errors_total",
+	Help:      "Number of times the config of a namespace failed by phase: FetchError, RenderError, ValidationError, PolicyError or LintError",
+}, []string{LabelPhase})
+
+var namespaceConfigErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "namespace_config_errors_total",
+	Help:      "Number of cycles in which the config of the namespace failed, whatever the phase",
+}, []string{LabelTargetNamespace})
+
+var namespaceConfigApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "namespace_config_applied_total",
+	Help:      "Number of times a changed config of the namespace was applied",
+}, []string{LabelTargetNamespace})
+
+var configHashChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "config_hash_changes_total",
+	Help:      "Number of times the config hash of the namespace changed, i.e. how often its generated config churns",
+}, []string{LabelTargetNamespace})
+
+var combinedConfigFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "combined_config_generation_failures_total",
+	Help:      "Number of cycles in which the combined fluentd config could not be assembled or written, the previous one is kept",
+})
+
+var combinedConfigLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "combined_config_last_success_timestamp_seconds",
+	Help:      "Unix time of the last cycle in which the combined fluentd config was assembled and written",
+})
+
+var getNamespacesDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "get_namespaces_duration_seconds",
+	Help:      "Time spent reading the namespaces with their config and pods from the datasource at the start of a cycle",
+	Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+})
+
+var lintFindings = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "lint_findings",
+	Help:      "Number of lint findings in the namespace configs of the last cycle by severity and rule",
+}, []string{LabelSeverity, LabelRule})
+
+var namespaceInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "logging_namespace_info",
+	Help:      "Discovered namespaces with their last status, config source and config hash, the value is always 1",
+}, []string{LabelTargetNamespace, LabelStatus, LabelSource, LabelConfigHash})
+
+var changedNamespaces = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "changed_namespaces",
+	Help:      "Number of namespaces whose config changed in the last cycle. fluentd is reloaded only when it is not 0",
+})
+
+var droppedNamespaces = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "dropped_namespaces",
+	Help:      "Number of namespaces not processed in the last cycle because of --max-namespaces",
+})
+
+var duplicateRoutedContainers = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "duplicate_routed_containers",
+	Help:      "Number of containers whose logs are routed by the config of more than one namespace, set only with --warn-duplicate-routing",
+})
+
+var namespaceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "namespace_duration_seconds",
+	Help:      "Time spent per namespace and phase. The target_namespace is only set when per-namespace metrics are enabled",
+	Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+}, []string{LabelTargetNamespace, LabelSizeClass, LabelPhase})
+
+var pluginInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "plugin_info",
+	Help:      "Installed fluentd plugins and their version, the value is always 1",
+}, []string{LabelPlugin, LabelVersion})
+
+var pluginVersionDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "plugin_version_drift",
+	Help:      "For every expected plugin 1 if it is missing or installed with another version, 0 otherwise",
+}, []string{LabelPlugin})
+
+var configChecksum = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kube_fluentd_operator",
+	Name:      "config_checksum_info",
+	Help:      "Checksum of the last generated and normalized fluentd config, the value is always 1",
+}, []string{LabelChecksum})
+
+// pluginVersions is the snapshot served by the /plugins endpoint
+type pluginVersions struct {
+	Installed map[string]string `json:"installed"`
+	Expected  map[string]string `json:"expected,omitempty"`
+	Drift     []string          `json:"drift,omitempty"`
+}
+
+var (
+	pluginVersionsMutex sync.RWMutex
+	lastPluginVersions  = &pluginVersions{Installed: map[string]string{}}
+)
+
 // SetNamespaceConfigStatusMetric sets the current metric value for a given namespace
 func SetNamespaceConfigStatusMetric(namespace string, valid bool) {
 	var value float64
@@ -30,14 +207,197 @@ func SetNamespaceConfigStatusMetric(namespace string, valid bool) {
 	namespaceConfigStatus.With(prometheus.Labels{LabelTargetNamespace: namespace}).Set(value)
 }
 
-// DeleteNamespaceConfigStatusMetric deletes the metric value for a given namespace
-func DeleteNamespaceConfigStatusMetric(namespace string) {
-	namespaceConfigStatus.Delete(prometheus.Labels{LabelTargetNamespace: namespace})
+// DeleteNamespaceMetrics deletes the series of a given namespace
+func DeleteNamespaceMetrics(namespace string) {
+	labels := prometheus.Labels{LabelTargetNamespace: namespace}
+	namespaceConfigStatus.Delete(labels)
+	namespaceConfigErrors.Delete(labels)
+	namespaceConfigApplied.Delete(labels)
+	configHashChanges.Delete(labels)
+}
+
+// ObserveNamespaceDurationMetric records the time spent on a namespace in the given phase.
+// Unless perNamespace is set namespaces are only distinguished by their size class
+// to keep the cardinality bounded
+func ObserveNamespaceDurationMetric(namespace string, containers int, phase string, perNamespace bool, d time.Duration) {
+	if !perNamespace {
+		namespace = ""
+	}
+
+	namespaceDuration.With(prometheus.Labels{
+		LabelTargetNamespace: namespace,
+		LabelSizeClass:       sizeClass(containers),
+		LabelPhase:           phase,
+	}).Observe(d.Seconds())
+}
+
+func sizeClass(containers int) string {
+	switch {
+	case containers < 10:
+		return "small"
+	case containers < 100:
+		return "medium"
+	}
+	return "large"
+}
+
+// IncReloadAttemptsMetric counts one fluentd reload attempt
+func IncReloadAttemptsMetric() {
+	reloadAttempts.Inc()
+}
+
+// IncReloadFailuresMetric counts one failed fluentd reload for the given reason
+func IncReloadFailuresMetric(reason string) {
+	reloadFailures.With(prometheus.Labels{LabelReason: reason}).Inc()
+}
+
+// IncReloadsDeferredMetric counts one fluentd reload deferred by the rate limit
+func IncReloadsDeferredMetric() {
+	reloadsDeferred.Inc()
+}
+
+// IncBufferDrainsMetric counts one buffer drain with its result
+func IncBufferDrainsMetric(result string) {
+	bufferDrains.With(prometheus.Labels{LabelResult: result}).Inc()
+}
+
+// IncNamespaceErrorsMetric counts one failed namespace for the phase the error comes from
+func IncNamespaceErrorsMetric(phase string) {
+	namespaceErrors.With(prometheus.Labels{LabelPhase: phase}).Inc()
+}
+
+// IncNamespaceConfigErrorsMetric counts one cycle in which the config of a namespace failed
+func IncNamespaceConfigErrorsMetric(namespace string) {
+	namespaceConfigErrors.With(prometheus.Labels{LabelTargetNamespace: namespace}).Inc()
+}
+
+// IncNamespaceConfigAppliedMetric counts one changed config of a namespace that is applied
+func IncNamespaceConfigAppliedMetric(namespace string) {
+	namespaceConfigApplied.With(prometheus.Labels{LabelTargetNamespace: namespace}).Inc()
+}
+
+// IncConfigHashChangesMetric counts one change of the config hash of a namespace
+func IncConfigHashChangesMetric(namespace string) {
+	configHashChanges.With(prometheus.Labels{LabelTargetNamespace: namespace}).Inc()
+}
+
+// IncCombinedConfigFailuresMetric counts one cycle in which the combined config could not be generated
+func IncCombinedConfigFailuresMetric() {
+	combinedConfigFailures.Inc()
+}
+
+// SetCombinedConfigLastSuccessMetric records the time the combined config was last generated
+func SetCombinedConfigLastSuccessMetric(t time.Time) {
+	combinedConfigLastSuccess.Set(float64(t.Unix()))
+}
+
+// ObserveGetNamespacesDurationMetric records the time spent reading the namespaces from the datasource
+func ObserveGetNamespacesDurationMetric(d time.Duration) {
+	getNamespacesDuration.Observe(d.Seconds())
+}
+
+// NamespaceInfo is the state of a namespace exported by the kube_fluentd_operator_logging_namespace_info metric
+type NamespaceInfo struct {
+	Namespace  string
+	Status     string
+	ConfigHash string
+}
+
+// SetNamespaceInfoMetric replaces the namespace info series with the given ones,
+// series of namespaces that are gone are dropped
+func SetNamespaceInfoMetric(infos []NamespaceInfo, source string) {
+	namespaceInfo.Reset()
+	for _, info := range infos {
+		namespaceInfo.With(prometheus.Labels{
+			LabelTargetNamespace: info.Namespace,
+			LabelStatus:          info.Status,
+			LabelSource:          source,
+			LabelConfigHash:      info.ConfigHash,
+		}).Set(1)
+	}
+}
+
+// LintCount is the number of findings of a lint rule exported by the lint_findings metric
+type LintCount struct {
+	Severity string
+	Rule     string
+	Count    int
+}
+
+// SetLintFindingsMetric replaces the lint findings series with the given ones
+func SetLintFindingsMetric(counts []LintCount) {
+	lintFindings.Reset()
+	for _, c := range counts {
+		lintFindings.With(prometheus.Labels{LabelSeverity: c.Severity, LabelRule: c.Rule}).Set(float64(c.Count))
+	}
+}
+
+// SetChangedNamespacesMetric records how many namespace configs changed in the last cycle
+func SetChangedNamespacesMetric(count int) {
+	changedNamespaces.Set(float64(count))
+}
+
+// SetDroppedNamespacesMetric records how many namespaces were left out by the namespace limit
+func SetDroppedNamespacesMetric(count int) {
+	droppedNamespaces.Set(float64(count))
+}
+
+// SetDuplicateRoutedContainersMetric records how many containers are routed by more than one namespace
+func SetDuplicateRoutedContainersMetric(count int) {
+	duplicateRoutedContainers.Set(float64(count))
+}
+
+// SetLastReloadTime records the time of the last successful fluentd reload
+func SetLastReloadTime(t time.Time) {
+	lastReloadMutex.Lock()
+	defer lastReloadMutex.Unlock()
+	lastReloadTime = t
+}
+
+// SetPluginVersions records the installed plugin versions and the drift from the expected ones
+func SetPluginVersions(installed map[string]string, expected map[string]string, drift []string) {
+	pluginInfo.Reset()
+	for name, version := range installed {
+		pluginInfo.With(prometheus.Labels{LabelPlugin: name, LabelVersion: version}).Set(1)
+	}
+
+	pluginVersionDrift.Reset()
+	for name, version := range expected {
+		var value float64
+		if installed[name] != version {
+			value = 1
+		}
+		pluginVersionDrift.With(prometheus.Labels{LabelPlugin: name}).Set(value)
+	}
+
+	pluginVersionsMutex.Lock()
+	defer pluginVersionsMutex.Unlock()
+	lastPluginVersions = &pluginVersions{
+		Installed: installed,
+		Expected:  expected,
+		Drift:     drift,
+	}
+}
+
+func servePluginVersions(w http.ResponseWriter, r *http.Request) {
+	pluginVersionsMutex.RLock()
+	defer pluginVersionsMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lastPluginVersions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SetConfigChecksumMetric exposes the checksum of the generated config
+func SetConfigChecksumMetric(checksum string) {
+	configChecksum.Reset()
+	configChecksum.With(prometheus.Labels{LabelChecksum: checksum}).Set(1)
 }
 
-// InitMetrics should be called to initialize metrics and start the HTTP handler
-func InitMetrics(port int) error {
-	if err := serveMetrics(port); err != nil {
+// InitMetrics should be called to initialize metrics and start the HTTP handler, served through the gate
+func InitMetrics(port int, gate *httpauth.Gate) error {
+	if err := serveMetrics(port, gate); err != nil {
 		return fmt.Errorf("Failed to start metrics handler: %s", err)
 	}
 
@@ -47,9 +407,33 @@ func InitMetrics(port int) error {
 
 func registerMetrics() {
 	prometheus.MustRegister(namespaceConfigStatus)
+	prometheus.MustRegister(secondsSinceLastReload)
+	prometheus.MustRegister(reloadAttempts)
+	prometheus.MustRegister(reloadFailures)
+	prometheus.MustRegister(reloadsDeferred)
+	prometheus.MustRegister(bufferDrains)
+	prometheus.MustRegister(namespaceErrors)
+	prometheus.MustRegister(namespaceConfigErrors)
+	prometheus.MustRegister(namespaceConfigApplied)
+	prometheus.MustRegister(configHashChanges)
+	prometheus.MustRegister(combinedConfigFailures)
+	prometheus.MustRegister(combinedConfigLastSuccess)
+	prometheus.MustRegister(getNamespacesDuration)
+	prometheus.MustRegister(lintFindings)
+	prometheus.MustRegister(namespaceDuration)
+	prometheus.MustRegister(changedNamespaces)
+	prometheus.MustRegister(namespaceInfo)
+	prometheus.MustRegister(droppedNamespaces)
+	prometheus.MustRegister(duplicateRoutedContainers)
+	prometheus.MustRegister(pluginInfo)
+	prometheus.MustRegister(pluginVersionDrift)
+	prometheus.MustRegister(configChecksum)
+	prometheus.MustRegister(fluentdBufferQueueLength)
+	prometheus.MustRegister(fluentdRetryCount)
+	prometheus.MustRegister(fluentdMonitorUp)
 }
 
-func serveMetrics(port int) error {
+func serveMetrics(port int, gate *httpauth.Gate) error {
 	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if err != nil {
 		return err
@@ -57,9 +441,10 @@ func serveMetrics(port int) error {
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
-	srv := &http.Server{Handler: mux}
+	mux.HandleFunc("/plugins", servePluginVersions)
+	srv := &http.Server{Handler: gate.Handler(mux)}
 	go func() {
-		srv.Serve(ln)
+		gate.Serve(srv, ln)
 	}()
 	return nil
 }
@@ -0,0 +1,79 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceConfigCounters(t *testing.T) {
+	labels := prometheus.Labels{LabelTargetNamespace: "shop"}
+
+	IncNamespaceConfigErrorsMetric("shop")
+	IncNamespaceConfigErrorsMetric("shop")
+	IncNamespaceConfigAppliedMetric("shop")
+	IncConfigHashChangesMetric("shop")
+	SetNamespaceConfigStatusMetric("shop", true)
+	assert.Equal(t, 2.0, testutil.ToFloat64(namespaceConfigErrors.With(labels)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(namespaceConfigApplied.With(labels)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(configHashChanges.With(labels)))
+
+	DeleteNamespaceMetrics("shop")
+	assert.Equal(t, 0, testutil.CollectAndCount(namespaceConfigErrors))
+	assert.Equal(t, 0, testutil.CollectAndCount(namespaceConfigApplied))
+	assert.Equal(t, 0, testutil.CollectAndCount(namespaceConfigStatus))
+	assert.Equal(t, 0, testutil.CollectAndCount(configHashChanges))
+}
+
+func TestSetNamespaceInfoMetric(t *testing.T) {
+	SetNamespaceInfoMetric([]NamespaceInfo{
+		{Namespace: "shop", Status: "", ConfigHash: "abc"},
+		{Namespace: "blog", Status: "bad config", ConfigHash: "def"},
+	}, "configmap")
+	assert.Equal(t, 2, testutil.CollectAndCount(namespaceInfo))
+	assert.Equal(t, 1.0, testutil.ToFloat64(namespaceInfo.With(prometheus.Labels{
+		LabelTargetNamespace: "blog",
+		LabelStatus:          "bad config",
+		LabelSource:          "configmap",
+		LabelConfigHash:      "def",
+	})))
+
+	// the series of the namespaces that are gone are dropped
+	SetNamespaceInfoMetric([]NamespaceInfo{{Namespace: "shop", ConfigHash: "abc"}}, "configmap")
+	assert.Equal(t, 1, testutil.CollectAndCount(namespaceInfo, "kube_fluentd_operator_logging_namespace_info"))
+}
+
+func TestObserveNamespaceDurationPerNamespace(t *testing.T) {
+	namespaceDuration.Reset()
+
+	// without per-namespace metrics the namespaces of a size class share the series
+	ObserveNamespaceDurationMetric("shop", 3, PhaseFetch, false, time.Millisecond)
+	ObserveNamespaceDurationMetric("blog", 5, PhaseFetch, false, time.Millisecond)
+	assert.Equal(t, 1, testutil.CollectAndCount(namespaceDuration))
+	assert.False(t, namespaceDuration.Delete(prometheus.Labels{LabelTargetNamespace: "shop", LabelSizeClass: "small", LabelPhase: PhaseFetch}))
+	assert.True(t, namespaceDuration.Delete(prometheus.Labels{LabelTargetNamespace: "", LabelSizeClass: "small", LabelPhase: PhaseFetch}))
+
+	ObserveNamespaceDurationMetric("shop", 3, PhaseFetch, true, time.Millisecond)
+	ObserveNamespaceDurationMetric("blog", 5, PhaseFetch, true, time.Millisecond)
+	assert.Equal(t, 2, testutil.CollectAndCount(namespaceDuration))
+	assert.True(t, namespaceDuration.Delete(prometheus.Labels{LabelTargetNamespace: "shop", LabelSizeClass: "small", LabelPhase: PhaseFetch}))
+}
+
+func TestObserveGetNamespacesDuration(t *testing.T) {
+	ObserveGetNamespacesDurationMetric(20 * time.Millisecond)
+	assert.Equal(t, 1, testutil.CollectAndCount(getNamespacesDuration))
+}
+
+func TestCombinedConfigMetrics(t *testing.T) {
+	IncCombinedConfigFailuresMetric()
+	assert.Equal(t, 1.0, testutil.ToFloat64(combinedConfigFailures))
+
+	SetCombinedConfigLastSuccessMetric(time.Unix(1600000000, 0))
+	assert.Equal(t, 1600000000.0, testutil.ToFloat64(combinedConfigLastSuccess))
+}
@@ -0,0 +1,100 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// SpanCycle is the root span of a run of the control loop
+	SpanCycle = "reload-cycle"
+	// SpanDiscover covers listing the namespaces to process
+	SpanDiscover = "discover-namespaces"
+	// SpanFetch covers reading the config and the pods of a namespace
+	SpanFetch = "fetch"
+	// SpanGenerate covers processing the config of a namespace
+	SpanGenerate = "generate"
+	// SpanValidate covers running the fluentd validator over the config of a namespace
+	SpanValidate = "validate"
+	// SpanDrain covers flushing fluentd and waiting for the buffers moved by the new config to drain
+	SpanDrain = "drain"
+	// SpanReload covers asking fluentd to reload its config
+	SpanReload = "reload"
+
+	tracerName  = "github.com/vmware/kube-fluentd-operator/config-reloader"
+	serviceName = "kube-fluentd-operator"
+)
+
+// the global tracer provider is a no-op until InitTracing replaces it
+var tracer = otel.Tracer(tracerName)
+
+// InitTracing exports the spans to the OTLP/HTTP collector at endpoint, e.g. http://otel-collector:4318.
+// Without an endpoint nothing is exported and spans cost next to nothing. The returned function
+// flushes the pending spans
+func InitTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("unsupported scheme '%s' in OTLP endpoint %s, use http or https", u.Scheme, endpoint)
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// StartSpan starts a span, child of the span in ctx if any
+func StartSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// StartNamespaceSpan starts a span about a single namespace
+func StartNamespaceSpan(ctx context.Context, name string, namespace string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String(LabelNamespace, namespace)))
+}
+
+// EndSpan ends a span, marking it failed if err is not nil
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
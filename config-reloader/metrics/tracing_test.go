@@ -0,0 +1,61 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingDisabledByDefault(t *testing.T) {
+	shutdown, err := InitTracing(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+
+	_, span := StartSpan(context.Background(), SpanCycle)
+	assert.False(t, span.IsRecording())
+	span.End()
+}
+
+func TestTracingBadEndpoint(t *testing.T) {
+	_, err := InitTracing(context.Background(), "grpc://otel-collector:4317")
+	assert.NotNil(t, err)
+}
+
+func TestNamespaceSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	ctx, cycle := StartSpan(context.Background(), SpanCycle)
+	_, fetch := StartNamespaceSpan(ctx, SpanFetch, "team-a")
+	EndSpan(fetch, nil)
+	_, generate := StartNamespaceSpan(ctx, SpanGenerate, "team-b")
+	EndSpan(generate, errors.New("bad config"))
+	EndSpan(cycle, nil)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+
+	assert.Equal(t, SpanFetch, spans[0].Name())
+	assert.Equal(t, []attribute.KeyValue{attribute.String(LabelNamespace, "team-a")}, spans[0].Attributes())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, cycle.SpanContext().SpanID(), spans[0].Parent().SpanID())
+
+	assert.Equal(t, SpanGenerate, spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "bad config", spans[1].Status().Description)
+
+	assert.Equal(t, SpanCycle, spans[2].Name())
+	assert.False(t, spans[2].Parent().IsValid())
+}
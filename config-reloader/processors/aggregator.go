@@ -0,0 +1,120 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// aggregatorState routes the namespace to the aggregator in ctx.Aggregator: the body of every
+// output is replaced by a relabel to the label of the aggregator, holding the admin plugin of the
+// aggregator. Only the routing of the namespace is kept, its own outputs do not run except for
+// the null ones dropping records on purpose. As the labels of the namespace are normalized
+// beforehand, a tenant cannot route to an aggregator by itself
+type aggregatorState struct {
+	BaseProcessorState
+}
+
+// AggregatorLabel is the label forwarding the records to an aggregator
+func AggregatorLabel(aggregator string) string {
+	return fmt.Sprintf("@kfo-aggregator-%s", aggregator)
+}
+
+// MakeAggregatorLabels returns the label of every aggregator whose plugin is defined in the admin namespace,
+// sorted by name. aggregators maps the names to the plugins
+func MakeAggregatorLabels(plugins map[string]*fluentd.Directive, aggregators map[string]string) fluentd.Fragment {
+	names := make([]string, 0, len(aggregators))
+	for name := range aggregators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := fluentd.Fragment{}
+	for _, name := range names {
+		plugin, ok := plugins[aggregators[name]]
+		if !ok {
+			continue
+		}
+
+		res = append(res, &fluentd.Directive{
+			Name:   "label",
+			Tag:    AggregatorLabel(name),
+			Params: fluentd.Params{},
+			Nested: fluentd.Fragment{
+				&fluentd.Directive{
+					Name:   "match",
+					Tag:    "**",
+					Params: plugin.Params.Clone(),
+					Nested: plugin.Nested.Clone(),
+				},
+			},
+		})
+	}
+
+	return res
+}
+
+func (state *aggregatorState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	aggregator := state.Context.Aggregator
+	if aggregator == "" {
+		return input, nil
+	}
+
+	plugin, ok := state.Context.Aggregators[aggregator]
+	if !ok {
+		known := []string{}
+		for name := range state.Context.Aggregators {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return nil, datasource.PolicyErrorf("unknown aggregator %s, the namespace can use one of: %s", aggregator, strings.Join(known, ", "))
+	}
+	if genCtx := state.Context.GenerationContext; genCtx != nil {
+		if _, ok := genCtx.Plugins[plugin]; !ok {
+			return nil, fmt.Errorf("the plugin %s of aggregator %s is not defined in the admin namespace", plugin, aggregator)
+		}
+	}
+
+	label := AggregatorLabel(aggregator)
+	var apply func(frag fluentd.Fragment)
+	apply = func(frag fluentd.Fragment) {
+		for _, d := range frag {
+			switch {
+			case d.Name == "label":
+				apply(d.Nested)
+			case d.Name == "match" && !reroutingTypes[d.Type()] && d.Type() != "null":
+				d.Params = fluentd.ParamsFromKV("@type", "relabel", "@label", label)
+				d.Nested = nil
+			}
+		}
+	}
+	apply(input)
+
+	return input, nil
+}
+
+func (state *aggregatorState) GetValidationTrailer(directives fluentd.Fragment) fluentd.Fragment {
+	if state.Context.Aggregator == "" {
+		return nil
+	}
+
+	return fluentd.Fragment{
+		&fluentd.Directive{
+			Name: "label",
+			Tag:  AggregatorLabel(state.Context.Aggregator),
+			Nested: fluentd.Fragment{
+				&fluentd.Directive{
+					Name:   "match",
+					Tag:    "**",
+					Params: fluentd.ParamsFromKV("@type", "null"),
+				},
+			},
+		},
+	}
+}
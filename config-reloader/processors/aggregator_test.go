@@ -0,0 +1,146 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func aggregatorContext(t *testing.T, aggregator string) *ProcessorContext {
+	admin := `
+<plugin agg-us-east>
+  @type forward
+  <server>
+    host aggregator.us-east
+  </server>
+</plugin>
+
+<plugin agg-eu-west>
+  @type forward
+  <server>
+    host aggregator.eu-west
+  </server>
+</plugin>
+`
+	fragment, err := fluentd.ParseString(admin)
+	assert.Nil(t, err)
+
+	genCtx := &GenerationContext{}
+	ExtractPlugins(genCtx, fragment)
+
+	return &ProcessorContext{
+		Namespace:         "demo",
+		DeploymentID:      "default",
+		GenerationContext: genCtx,
+		Aggregator:        aggregator,
+		Aggregators: map[string]string{
+			"us-east": "agg-us-east",
+			"eu-west": "agg-eu-west",
+			"ap-east": "agg-ap-east",
+		},
+	}
+}
+
+func TestAggregatorRoutesOutputs(t *testing.T) {
+	s := `
+<match kube.demo.web.**>
+  @type forward
+  <server>
+    host anywhere.example.com
+  </server>
+</match>
+
+<match kube.demo.noise.**>
+  @type null
+</match>
+
+<match kube.demo.app.**>
+  @type relabel
+  @label @apps
+</match>
+
+<label @apps>
+  <match **>
+    @type copy
+    <store>
+      @type elasticsearch
+    </store>
+  </match>
+</label>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := aggregatorContext(t, "eu-west")
+	fragment, err = Process(fragment, ctx, &rewriteLabelsState{}, &aggregatorState{})
+	assert.Nil(t, err)
+
+	// the tenant cannot forward anywhere else
+	assert.Equal(t, "relabel", fragment[0].Type())
+	assert.Equal(t, "@kfo-aggregator-eu-west", fragment[0].Param("@label"))
+	assert.Equal(t, 0, len(fragment[0].Nested))
+
+	assert.Equal(t, "null", fragment[1].Type())
+
+	// the routing of the namespace is kept
+	assert.Equal(t, "relabel", fragment[2].Type())
+	assert.Equal(t, fragment[3].Tag, fragment[2].Param("@label"))
+	apps := fragment[3].Nested[0]
+	assert.Equal(t, "relabel", apps.Type())
+	assert.Equal(t, "@kfo-aggregator-eu-west", apps.Param("@label"))
+
+	trailer := GetValidationTrailer(fragment, ctx, &aggregatorState{})
+	assert.Equal(t, 1, len(trailer))
+	assert.Equal(t, "@kfo-aggregator-eu-west", trailer[0].Tag)
+}
+
+func TestAggregatorTenantCannotTargetAggregatorLabel(t *testing.T) {
+	s := `
+<match **>
+  @type relabel
+  @label @kfo-aggregator-us-east
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	fragment, err = Process(fragment, aggregatorContext(t, "eu-west"), &rewriteLabelsState{}, &aggregatorState{})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "@kfo-aggregator-us-east", fragment[0].Param("@label"))
+}
+
+func TestAggregatorUnknown(t *testing.T) {
+	fragment, err := fluentd.ParseString("<match **>\n  @type null\n</match>")
+	assert.Nil(t, err)
+
+	_, err = Process(fragment, aggregatorContext(t, "mars"), &aggregatorState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, datasource.ErrorPhasePolicy, datasource.ErrorPhase(err))
+	assert.Equal(t, "unknown aggregator mars, the namespace can use one of: ap-east, eu-west, us-east", err.Error())
+
+	// defined by the flags but not in the admin namespace
+	_, err = Process(fragment, aggregatorContext(t, "ap-east"), &aggregatorState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, datasource.ErrorPhaseRender, datasource.ErrorPhase(err))
+}
+
+func TestMakeAggregatorLabels(t *testing.T) {
+	ctx := aggregatorContext(t, "")
+	labels := MakeAggregatorLabels(ctx.GenerationContext.Plugins, ctx.Aggregators)
+
+	// ap-east has no plugin
+	assert.Equal(t, 2, len(labels))
+	assert.Equal(t, "@kfo-aggregator-eu-west", labels[0].Tag)
+	assert.Equal(t, "@kfo-aggregator-us-east", labels[1].Tag)
+
+	match := labels[1].Nested[0]
+	assert.Equal(t, "**", match.Tag)
+	assert.Equal(t, "forward", match.Type())
+	assert.Equal(t, "aggregator.us-east", match.Nested[0].Param("host"))
+}
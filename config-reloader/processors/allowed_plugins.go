@@ -0,0 +1,71 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// allowedPluginsState rejects configs using plugins outside of the admin-defined allowlist or in
+// its denylist. It runs after the plugin expansion so that virtual plugins are checked against their real type.
+type allowedPluginsState struct {
+	BaseProcessorState
+}
+
+// isMacroType tells if a @type is expanded by kube-fluentd-operator itself and never reaches fluentd
+func isMacroType(t string) bool {
+	return t == mountedFileSourceType || t == hostFileSourceType
+}
+
+func (state *allowedPluginsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if len(state.Context.AllowedPlugins) == 0 && len(state.Context.DeniedPlugins) == 0 {
+		// no policy
+		return input, nil
+	}
+
+	allowed := map[string]bool{}
+	for _, p := range state.Context.AllowedPlugins {
+		allowed[p] = true
+	}
+	denied := map[string]bool{}
+	for _, p := range state.Context.DeniedPlugins {
+		denied[p] = true
+	}
+
+	offending := map[string]bool{}
+	f := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		t := d.Type()
+		if t == "" {
+			return nil
+		}
+
+		// the macros can be denied but are always allowed
+		if denied[t] {
+			offending[t] = true
+		} else if len(allowed) > 0 && !allowed[t] && !isMacroType(t) {
+			offending[t] = true
+		}
+
+		return nil
+	}
+
+	// the callback never fails
+	_ = applyRecursivelyInPlace(input, state.Context, f)
+
+	if len(offending) > 0 {
+		types := make([]string, 0, len(offending))
+		for t := range offending {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+
+		return nil, datasource.PolicyErrorf("plugins not allowed by the cluster policy: %s", strings.Join(types, ", "))
+	}
+
+	return input, nil
+}
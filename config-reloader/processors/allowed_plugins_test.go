@@ -0,0 +1,223 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var allowedPluginsForTest = []string{"elasticsearch", "grep", "copy", "json", "ltsv", "file", "tail"}
+
+func TestAllowedPluginsMatrix(t *testing.T) {
+	cases := []struct {
+		category  string
+		config    string
+		offending string
+	}{
+		{"input", `
+<source>
+  @type http
+</source>`, "http"},
+		{"macro input", `
+<source>
+  @type mounted-file
+  path /var/log/a.log
+  labels app=nginx
+</source>`, ""},
+		{"filter", `
+<filter **>
+  @type record_transformer
+</filter>`, "record_transformer"},
+		{"output", `
+<match **>
+  @type s3
+</match>`, "s3"},
+		{"nested output", `
+<match **>
+  @type copy
+  <store>
+    @type kafka
+  </store>
+  <store>
+    @type elasticsearch
+  </store>
+</match>`, "kafka"},
+		{"parser", `
+<source>
+  @type mounted-file
+  path /var/log/a.log
+  labels app=nginx
+  <parse>
+    @type regexp
+  </parse>
+</source>`, "regexp"},
+		{"formatter", `
+<match **>
+  @type elasticsearch
+  <format>
+    @type msgpack
+  </format>
+</match>`, "msgpack"},
+		{"buffer", `
+<match **>
+  @type elasticsearch
+  <buffer>
+    @type memory
+  </buffer>
+</match>`, "memory"},
+		{"all allowed", `
+<filter **>
+  @type grep
+</filter>
+<match **>
+  @type elasticsearch
+  <format>
+    @type json
+  </format>
+  <buffer>
+    @type file
+  </buffer>
+</match>`, ""},
+	}
+
+	for _, c := range cases {
+		fragment, err := fluentd.ParseString(c.config)
+		assert.Nil(t, err, c.category)
+
+		ctx := &ProcessorContext{
+			Namespace:      "monitoring",
+			AllowedPlugins: allowedPluginsForTest,
+		}
+
+		_, err = Process(fragment, ctx, &allowedPluginsState{})
+		if c.offending == "" {
+			assert.Nil(t, err, c.category)
+		} else {
+			assert.NotNil(t, err, c.category)
+			assert.Contains(t, err.Error(), c.offending, c.category)
+		}
+	}
+}
+
+func TestAllowedPluginsListsAllOffendingTypes(t *testing.T) {
+	s := `
+<filter **>
+  @type stdout
+</filter>
+
+<match **>
+  @type s3
+  <format>
+    @type csv
+  </format>
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:      "monitoring",
+		AllowedPlugins: allowedPluginsForTest,
+	}
+
+	_, err = Process(fragment, ctx, &allowedPluginsState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "plugins not allowed by the cluster policy: csv, s3, stdout", err.Error())
+}
+
+func TestAllowedPluginsEmptyAllowsEverything(t *testing.T) {
+	s := `
+<match **>
+  @type s3
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "monitoring",
+	}
+
+	processed, err := Process(fragment, ctx, &allowedPluginsState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(processed))
+}
+
+func TestAllowedPluginsChecksExpandedPlugins(t *testing.T) {
+	s := `
+<match **>
+  @type logzio
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	admin, err := fluentd.ParseString(`
+<plugin logzio>
+  @type logzio_buffered
+</plugin>
+`)
+	assert.Nil(t, err)
+
+	genCtx := &GenerationContext{}
+	ExtractPlugins(genCtx, admin)
+
+	ctx := &ProcessorContext{
+		Namespace:         "monitoring",
+		AllowedPlugins:    []string{"logzio"},
+		GenerationContext: genCtx,
+	}
+
+	_, err = Process(fragment, ctx, &expandPluginsState{}, &allowedPluginsState{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "logzio_buffered")
+}
+
+func TestDeniedPlugins(t *testing.T) {
+	s := `
+<source>
+  @type host-file
+  path /var/log/syslog
+</source>
+
+<filter **>
+  @type grep
+</filter>
+
+<match **>
+  @type copy
+  <store>
+    @type exec
+  </store>
+  <store>
+    @type elasticsearch
+  </store>
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	// denied alone, everything else is allowed
+	ctx := &ProcessorContext{
+		Namespace:     "monitoring",
+		DeniedPlugins: []string{"exec", "host-file"},
+	}
+	_, err = Process(fragment, ctx, &allowedPluginsState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "plugins not allowed by the cluster policy: exec, host-file", err.Error())
+
+	// combined with the allowlist
+	ctx = &ProcessorContext{
+		Namespace:      "monitoring",
+		AllowedPlugins: []string{"grep", "copy", "elasticsearch"},
+		DeniedPlugins:  []string{"exec"},
+	}
+	_, err = Process(fragment, ctx, &allowedPluginsState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "plugins not allowed by the cluster policy: exec", err.Error())
+}
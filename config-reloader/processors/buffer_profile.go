@@ -0,0 +1,90 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// BufferProfiles are the buffer settings a namespace can select by name, keyed by profile name.
+// A file buffer gets a path of its own for every output
+var BufferProfiles = map[string]map[string]string{
+	"low-latency": {
+		"@type":              "memory",
+		"flush_mode":         "interval",
+		"flush_interval":     "1s",
+		"flush_thread_count": "2",
+		"chunk_limit_size":   "1m",
+		"overflow_action":    "drop_oldest_chunk",
+	},
+	"high-durability": {
+		"@type":             "file",
+		"flush_mode":        "interval",
+		"flush_interval":    "10s",
+		"flush_at_shutdown": "true",
+		"chunk_limit_size":  "8m",
+		"total_limit_size":  "4g",
+		"overflow_action":   "block",
+	},
+}
+
+// bufferProfileState pins the <buffer> sections of the outputs of a namespace to the settings of
+// the profile it selected. The params of the profile replace the ones of the namespace, the others
+// are kept. Outputs without a <buffer> section are left alone as they may not be buffered
+type bufferProfileState struct {
+	BaseProcessorState
+}
+
+func (state *bufferProfileState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	name := state.Context.BufferProfile
+	if name == "" {
+		return input, nil
+	}
+
+	profile, ok := BufferProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown buffer profile '%s', the available profiles are: %s", name, strings.Join(bufferProfileNames(), ", "))
+	}
+
+	n := 0
+	f := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if d.Name != "buffer" {
+			return nil
+		}
+
+		n++
+		wasFile := d.Type() == "file"
+		delete(d.Params, "type")
+		for param, value := range profile {
+			d.SetParam(param, value)
+		}
+
+		if d.Type() != "file" {
+			d.SetParam("path", "")
+		} else if !wasFile || d.Param("path") == "" {
+			d.SetParam("path", makeSafeBufferPath(ctx, fmt.Sprintf("buffer-profile-%d", n)))
+		}
+		return nil
+	}
+
+	err := applyRecursivelyInPlace(input, state.Context, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
+
+func bufferProfileNames() []string {
+	res := make([]string, 0, len(BufferProfiles))
+	for name := range BufferProfiles {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,94 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const bufferProfileConfig = `
+<match a.**>
+  @type elasticsearch
+  <buffer tag>
+    @type memory
+    flush_interval 30s
+    retry_max_times 5
+  </buffer>
+</match>
+
+<match b.**>
+  @type copy
+  <store>
+    @type s3
+    <buffer>
+      @type file
+      path /var/log/kfo-x-shop-1234.buf
+    </buffer>
+  </store>
+</match>
+
+<match c.**>
+  @type null
+</match>
+`
+
+func TestBufferProfileDurability(t *testing.T) {
+	fragment, err := fluentd.ParseString(bufferProfileConfig)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{Namespace: "shop", DeploymentID: "x", BufferProfile: "high-durability"}
+	fragment, err = Process(fragment, ctx, &bufferProfileState{})
+	assert.Nil(t, err)
+
+	// the profile params replace the namespace ones, the others and the chunk keys are kept
+	buf := fragment[0].Nested[0]
+	assert.Equal(t, "tag", buf.Tag)
+	assert.Equal(t, "file", buf.Type())
+	assert.Equal(t, "10s", buf.Param("flush_interval"))
+	assert.Equal(t, "block", buf.Param("overflow_action"))
+	assert.Equal(t, "5", buf.Param("retry_max_times"))
+	assert.True(t, strings.HasPrefix(buf.Param("path"), "/var/log/kfo-x-shop-"), buf.Param("path"))
+
+	// a file buffer keeps its path
+	buf = fragment[1].Nested[0].Nested[0]
+	assert.Equal(t, "/var/log/kfo-x-shop-1234.buf", buf.Param("path"))
+	assert.NotEqual(t, fragment[0].Nested[0].Param("path"), buf.Param("path"))
+
+	// outputs without a buffer are left alone
+	assert.Equal(t, 0, len(fragment[2].Nested))
+}
+
+func TestBufferProfileLatency(t *testing.T) {
+	fragment, err := fluentd.ParseString(bufferProfileConfig)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{Namespace: "shop", BufferProfile: "low-latency"}
+	fragment, err = Process(fragment, ctx, &bufferProfileState{})
+	assert.Nil(t, err)
+
+	buf := fragment[1].Nested[0].Nested[0]
+	assert.Equal(t, "memory", buf.Type())
+	assert.Equal(t, "", buf.Param("path"))
+	assert.Equal(t, "1s", buf.Param("flush_interval"))
+}
+
+func TestBufferProfileUnknown(t *testing.T) {
+	fragment, err := fluentd.ParseString(bufferProfileConfig)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{Namespace: "shop", BufferProfile: "turbo"}
+	_, err = Process(fragment, ctx, &bufferProfileState{})
+	assert.EqualError(t, err, "unknown buffer profile 'turbo', the available profiles are: high-durability, low-latency")
+
+	// without a profile nothing changes
+	ctx.BufferProfile = ""
+	fragment, err = Process(fragment, ctx, &bufferProfileState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "30s", fragment[0].Nested[0].Param("flush_interval"))
+}
@@ -0,0 +1,38 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+const errorLabel = "@ERROR"
+
+// MakeDeadLetterLabel builds the <label @ERROR> routing all error events, e.g. parse failures,
+// to the given plugin definition from the admin namespace
+func MakeDeadLetterLabel(plugin *fluentd.Directive) *fluentd.Directive {
+	match := &fluentd.Directive{
+		Name:   "match",
+		Tag:    "**",
+		Params: plugin.Params.Clone(),
+		Nested: plugin.Nested.Clone(),
+	}
+
+	return &fluentd.Directive{
+		Name:   "label",
+		Tag:    errorLabel,
+		Params: fluentd.Params{},
+		Nested: fluentd.Fragment{match},
+	}
+}
+
+// prohibitErrorLabel keeps tenants from redefining the dead-letter route
+func prohibitErrorLabel(d *fluentd.Directive, ctx *ProcessorContext) error {
+	if ctx.DeadLetterEnabled && d.Name == "label" && d.Tag == errorLabel {
+		return datasource.PolicyErrorf("cannot define <label %s>, error events are routed to the cluster dead-letter output", errorLabel)
+	}
+
+	return nil
+}
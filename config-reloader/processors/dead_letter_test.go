@@ -0,0 +1,72 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeDeadLetterLabel(t *testing.T) {
+	admin, err := fluentd.ParseString(`
+<plugin dlq>
+  @type s3
+  s3_bucket dead-letters
+  <buffer>
+    @type file
+  </buffer>
+</plugin>
+`)
+	assert.Nil(t, err)
+
+	genCtx := &GenerationContext{}
+	ExtractPlugins(genCtx, admin)
+
+	label := MakeDeadLetterLabel(genCtx.Plugins["dlq"])
+	assert.Equal(t, "label", label.Name)
+	assert.Equal(t, "@ERROR", label.Tag)
+
+	match := label.Nested[0]
+	assert.Equal(t, "match", match.Name)
+	assert.Equal(t, "**", match.Tag)
+	assert.Equal(t, "s3", match.Type())
+	assert.Equal(t, "dead-letters", match.Param("s3_bucket"))
+	assert.Equal(t, "buffer", match.Nested[0].Name)
+
+	// the result must be parseable again
+	_, err = fluentd.ParseString(label.String())
+	assert.Nil(t, err)
+}
+
+func TestTenantsCannotDefineErrorLabel(t *testing.T) {
+	s := `
+<label @ERROR>
+  <match **>
+    @type null
+  </match>
+</label>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:         "monitoring",
+		DeadLetterEnabled: true,
+	}
+
+	_, err = Process(fragment, ctx, &fixDestinations{})
+	assert.NotNil(t, err)
+	assert.Equal(t, datasource.ErrorPhasePolicy, datasource.ErrorPhase(err))
+
+	fragment, err = fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx.DeadLetterEnabled = false
+	_, err = Process(fragment, ctx, &fixDestinations{})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,47 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// defaultOutputStore renders the default output template for the namespace. The <match> it
+// renders becomes the last store of the copy routing the namespace records, ignoring its errors
+// like the fan-out stores so that it cannot break the outputs of the namespace
+func (state *isolationState) defaultOutputStore() (*fluentd.Directive, error) {
+	tmpl, err := template.New("default-output").Parse(state.Context.DefaultOutput)
+	if err != nil {
+		return nil, fmt.Errorf("bad template of the default output: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, &sourceTemplateModel{Namespace: state.Context.Namespace}); err != nil {
+		return nil, fmt.Errorf("bad template of the default output: %v", err)
+	}
+
+	fragment, err := fluentd.ParseString(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad config of the default output: %v", err)
+	}
+
+	if len(fragment) != 1 || fragment[0].Name != "match" {
+		return nil, fmt.Errorf("the default output must be a single <match>")
+	}
+
+	store := &fluentd.Directive{
+		Name:   "store",
+		Tag:    "ignore_error",
+		Params: fragment[0].Params,
+		Nested: fragment[0].Nested,
+	}
+	// every namespace sending to the default output needs its own buffer
+	uniqueBufferPaths(store, state.Context, "default-output")
+
+	return store, nil
+}
@@ -0,0 +1,95 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDefaultOutput = `
+<match **>
+  @type forward
+  <server>
+    host central-sink
+  </server>
+  <buffer>
+    path /var/log/central.buf
+  </buffer>
+  <inject>
+    tag_key {{ .Namespace }}
+  </inject>
+</match>
+`
+
+func TestDefaultOutputCopiesNamespaceRecords(t *testing.T) {
+	// the exclusive match on ** would swallow the records before any output appended after it
+	fragment, err := fluentd.ParseString("<match **>\n  @type elasticsearch\n</match>\n")
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:         "shop",
+		DefaultOutput:     testDefaultOutput,
+		GenerationContext: &GenerationContext{ReferencedBridges: map[string]bool{}},
+	}
+	fragment, err = Process(fragment, ctx, DefaultProcessors()...)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(fragment))
+	route := fragment[0]
+	assert.Equal(t, "kube.shop.**", route.Tag)
+	assert.Equal(t, "copy", route.Type())
+	assert.Equal(t, 2, len(route.Nested))
+	assert.Equal(t, "relabel", route.Nested[0].Type())
+	assert.Equal(t, "@kfo-ns-shop", route.Nested[0].Param("@label"))
+
+	store := route.Nested[1]
+	assert.Equal(t, "ignore_error", store.Tag)
+	assert.Equal(t, "forward", store.Type())
+	assert.Contains(t, store.String(), "tag_key shop")
+	assert.NotContains(t, store.String(), "/var/log/central.buf")
+
+	body := IsolatedBody(fragment, "shop")
+	assert.Equal(t, 1, len(body))
+	assert.Equal(t, "elasticsearch", body[0].Type())
+}
+
+func TestDefaultOutputWithoutNamespaceOutputs(t *testing.T) {
+	fragment, err := fluentd.ParseString("<label @unused>\n  <match **>\n    @type null\n  </match>\n</label>\n")
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:     "shop",
+		DefaultOutput: testDefaultOutput,
+	}
+	fragment, err = Process(fragment, ctx, &isolationState{})
+	assert.Nil(t, err)
+
+	// nothing to relabel to, the records only go to the default output
+	assert.Equal(t, 2, len(fragment))
+	assert.Equal(t, 1, len(fragment[0].Nested))
+	assert.Equal(t, "forward", fragment[0].Nested[0].Type())
+	assert.Equal(t, "@unused", fragment[1].Tag)
+}
+
+func TestDefaultOutputBadTemplate(t *testing.T) {
+	for _, text := range []string{
+		"<match **>\n  @type forward\n</match>\n<match **>\n  @type null\n</match>\n",
+		"<filter **>\n  @type stdout\n</filter>\n",
+		"<match **>\n  @type {{ .Nope }}\n</match>\n",
+	} {
+		ctx := &ProcessorContext{
+			Namespace:     "shop",
+			DefaultOutput: text,
+		}
+		fragment, err := fluentd.ParseString("<match **>\n  @type elasticsearch\n</match>\n")
+		assert.Nil(t, err)
+		_, err = Process(fragment, ctx, &isolationState{})
+		assert.NotNil(t, err, strings.TrimSpace(text))
+	}
+}
@@ -4,9 +4,9 @@
 package processors
 
 import (
-	"errors"
 	"fmt"
 
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
 	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
 )
@@ -29,8 +29,8 @@ func makeSafeBufferPath(ctx *ProcessorContext, origBufPath string) string {
 
 func prohibitSources(d *fluentd.Directive, ctx *ProcessorContext) error {
 	if d.Name == "source" {
-		if d.Type() != mountedFileSourceType {
-			return errors.New("cannot use <source> directive")
+		if d.Type() != mountedFileSourceType && d.Type() != hostFileSourceType {
+			return datasource.PolicyErrorf("cannot use <source> directive")
 		}
 	}
 
@@ -47,19 +47,19 @@ func prohibitTypes(d *fluentd.Directive, ctx *ProcessorContext) error {
 	switch d.Type() {
 	case "exec", "exec_filter",
 		"stdout", "rewrite_tag_filter":
-		return fmt.Errorf("cannot use '@type %s' in <%s>", d.Type(), d.Name)
+		return datasource.PolicyErrorf("cannot use '@type %s' in <%s>", d.Type(), d.Name)
 	case "detect_exceptions":
 		if d.Name == "match" {
-			return fmt.Errorf("cannot use '@type %s' in <%s>", d.Type(), d.Name)
+			return datasource.PolicyErrorf("cannot use '@type %s' in <%s>", d.Type(), d.Name)
 		}
 	case "file":
 		if !ctx.AllowFile {
-			return fmt.Errorf("cannot use '@type %s' in <%s>", d.Type(), d.Name)
+			return datasource.PolicyErrorf("cannot use '@type %s' in <%s>", d.Type(), d.Name)
 		}
 	case "fields_parser":
 		if d.Param("remove_tag_prefix") != "" ||
 			d.Param("add_tag_prefix") != "" {
-			return fmt.Errorf("cannot modify tags using the plugin %s", d.Type())
+			return datasource.PolicyErrorf("cannot modify tags using the plugin %s", d.Type())
 		}
 	}
 
@@ -90,6 +90,7 @@ func (p *fixDestinations) Process(input fluentd.Fragment) (fluentd.Fragment, err
 		prohibitTypes,
 		rewriteBufferPath,
 		prohibitSources,
+		prohibitErrorLabel,
 	}
 
 	for _, f := range funcs {
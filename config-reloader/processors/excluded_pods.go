@@ -0,0 +1,40 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// excludedPodsState drops the logs of the pods annotated with --exclude-annotation. The matches go
+// to the main file so they run before any routing done by the namespace or the admin
+type excludedPodsState struct {
+	BaseProcessorState
+}
+
+func (state *excludedPodsState) Prepare(input fluentd.Fragment) (fluentd.Fragment, error) {
+	res := fluentd.Fragment{}
+
+	seen := map[string]bool{}
+	for _, mc := range state.Context.MiniContainers {
+		if !mc.Excluded || seen[mc.PodName] {
+			continue
+		}
+		seen[mc.PodName] = true
+
+		res = append(res, &fluentd.Directive{
+			Name:   "match",
+			Tag:    fmt.Sprintf("kube.%s.%s.**", state.Context.Namespace, mc.PodName),
+			Params: fluentd.ParamsFromKV("@type", "null"),
+		})
+	}
+
+	return res, nil
+}
+
+func (state *excludedPodsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	return input, nil
+}
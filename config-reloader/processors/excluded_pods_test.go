@@ -0,0 +1,37 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExcludedPods(t *testing.T) {
+	ctx := &ProcessorContext{
+		Namespace: "shop",
+		MiniContainers: []*datasource.MiniContainer{
+			{PodName: "loadgen-1", Name: "app", Excluded: true},
+			{PodName: "loadgen-1", Name: "sidecar", Excluded: true},
+			{PodName: "api-1", Name: "app", ParserHint: "json"},
+		},
+	}
+
+	prep, err := Prepare(fluentd.Fragment{}, ctx, &excludedPodsState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(prep))
+	assert.Equal(t, "match", prep[0].Name)
+	assert.Equal(t, "kube.shop.loadgen-1.**", prep[0].Tag)
+	assert.Equal(t, "null", prep[0].Type())
+
+	// the excluded containers get no parser filter
+	prep, err = Prepare(fluentd.Fragment{}, ctx, &parserHintsState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(prep))
+	assert.Equal(t, "kube.shop.api-1.app", prep[0].Tag)
+}
@@ -0,0 +1,110 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// outputs that only send the records elsewhere in the config, they are fanned out where they end up
+var reroutingTypes = map[string]bool{
+	"retag":              true,
+	"rewrite_tag_filter": true,
+	"relabel":            true,
+}
+
+// fanOutState sends the records of every output of a namespace to the admin plugins named
+// in ctx.FanOutPlugins too. The tenant output stays the first store of a <match @type copy>,
+// the admin plugins are added as stores ignoring errors so they cannot break it
+type fanOutState struct {
+	BaseProcessorState
+}
+
+func (state *fanOutState) stores() []*fluentd.Directive {
+	res := []*fluentd.Directive{}
+	for _, name := range state.Context.FanOutPlugins {
+		plugin, ok := state.Context.GenerationContext.Plugins[name]
+		if !ok {
+			logrus.Warnf("Plugin %s is not defined in the admin namespace, the logs of namespace %s are not sent to it", name, state.Context.Namespace)
+			continue
+		}
+
+		res = append(res, &fluentd.Directive{
+			Name:   "store",
+			Tag:    "ignore_error",
+			Params: plugin.Params.Clone(),
+			Nested: plugin.Nested.Clone(),
+		})
+	}
+
+	return res
+}
+
+// fanOut adds the stores to a <match>, turning it into a <match @type copy> if needed
+func (state *fanOutState) fanOut(d *fluentd.Directive, stores []*fluentd.Directive, n int) {
+	if d.Type() != "copy" {
+		primary := &fluentd.Directive{
+			Name:   "store",
+			Params: d.Params,
+			Nested: d.Nested,
+		}
+		d.Params = fluentd.Params{}
+		d.SetParam("@type", "copy")
+		d.Nested = fluentd.Fragment{primary}
+	}
+
+	for _, s := range stores {
+		store := s.Clone()
+		// every copy of a plugin needs its own buffer
+		uniqueBufferPaths(store, state.Context, fmt.Sprintf("fan-out-%d", n))
+		d.Nested = append(d.Nested, store)
+	}
+}
+
+// uniqueBufferPaths gives the buffers of an output a path of their own, derived from
+// their original path and key
+func uniqueBufferPaths(d *fluentd.Directive, ctx *ProcessorContext, key string) {
+	if path := d.Param(paramBufferPath); path != "" {
+		d.SetParam(paramBufferPath, makeSafeBufferPath(ctx, path+key))
+	}
+
+	for _, nested := range d.Nested {
+		if nested.Name == "buffer" && nested.Param("path") != "" {
+			nested.SetParam("path", makeSafeBufferPath(ctx, nested.Param("path")+key))
+		}
+	}
+}
+
+func (state *fanOutState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if len(state.Context.FanOutPlugins) == 0 || state.Context.GenerationContext == nil {
+		return input, nil
+	}
+
+	stores := state.stores()
+	if len(stores) == 0 {
+		return input, nil
+	}
+
+	n := 0
+	var apply func(frag fluentd.Fragment)
+	apply = func(frag fluentd.Fragment) {
+		for _, d := range frag {
+			switch {
+			case d.Name == "label" && !strings.HasPrefix(d.Tag, "@"+macroFrom):
+				// logs shared by other namespaces are fanned out by their own namespace
+				apply(d.Nested)
+			case d.Name == "match" && !reroutingTypes[d.Type()]:
+				state.fanOut(d, stores, n)
+				n++
+			}
+		}
+	}
+	apply(input)
+
+	return input, nil
+}
@@ -0,0 +1,125 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fanOutContext(t *testing.T, plugins ...string) *ProcessorContext {
+	admin := `
+<plugin compliance>
+  @type s3
+  s3_bucket archive
+  <buffer>
+    @type file
+    path /var/log/compliance.buf
+  </buffer>
+</plugin>
+`
+	fragment, err := fluentd.ParseString(admin)
+	assert.Nil(t, err)
+
+	genCtx := &GenerationContext{}
+	ExtractPlugins(genCtx, fragment)
+
+	return &ProcessorContext{
+		Namespace:         "demo",
+		DeploymentID:      "default",
+		GenerationContext: genCtx,
+		FanOutPlugins:     plugins,
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	s := `
+<match kube.demo.web.**>
+  @type elasticsearch
+  host es.team
+  <buffer>
+    flush_interval 5s
+  </buffer>
+</match>
+
+<match kube.demo.db.**>
+  @type copy
+  <store>
+    @type loggly
+  </store>
+</match>
+
+<match kube.demo.app.**>
+  @type relabel
+  @label @apps
+</match>
+
+<label @apps>
+  <match **>
+    @type null
+  </match>
+</label>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := fanOutContext(t, "compliance", "missing")
+	fragment, err = Process(fragment, ctx, &fanOutState{})
+	assert.Nil(t, err)
+
+	// the tenant output is the first store, untouched
+	web := fragment[0]
+	assert.Equal(t, "copy", web.Type())
+	assert.Equal(t, 2, len(web.Nested))
+	assert.Equal(t, "elasticsearch", web.Nested[0].Type())
+	assert.Equal(t, "es.team", web.Nested[0].Param("host"))
+	assert.Equal(t, "5s", web.Nested[0].Nested[0].Param("flush_interval"))
+	assert.Equal(t, "", web.Nested[0].Tag)
+
+	archive := web.Nested[1]
+	assert.Equal(t, "ignore_error", archive.Tag)
+	assert.Equal(t, "s3", archive.Type())
+	assert.Equal(t, "archive", archive.Param("s3_bucket"))
+
+	db := fragment[1]
+	assert.Equal(t, 2, len(db.Nested))
+	assert.Equal(t, "loggly", db.Nested[0].Type())
+	assert.Equal(t, "s3", db.Nested[1].Type())
+
+	// relabeled records are fanned out in the label
+	assert.Equal(t, "relabel", fragment[2].Type())
+	assert.Equal(t, 0, len(fragment[2].Nested))
+	apps := fragment[3].Nested[0]
+	assert.Equal(t, "copy", apps.Type())
+	assert.Equal(t, "null", apps.Nested[0].Type())
+	assert.Equal(t, "s3", apps.Nested[1].Type())
+
+	// every copy of the admin plugin has a buffer of its own
+	paths := map[string]bool{}
+	for _, d := range []*fluentd.Directive{archive, db.Nested[1], apps.Nested[1]} {
+		path := d.Nested[0].Param("path")
+		assert.NotEqual(t, "/var/log/compliance.buf", path)
+		paths[path] = true
+	}
+	assert.Equal(t, 3, len(paths))
+}
+
+func TestFanOutUnknownPlugins(t *testing.T) {
+	s := `
+<match **>
+  @type elasticsearch
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	fragment, err = Process(fragment, fanOutContext(t, "missing"), &fanOutState{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "elasticsearch", fragment[0].Type())
+	assert.Equal(t, 0, len(fragment[0].Nested))
+}
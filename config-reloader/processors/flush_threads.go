@@ -0,0 +1,56 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// flush thread params of the buffer section, num_threads is the v0.12 name still accepted at output level
+var flushThreadParams = []string{"flush_thread_count", "num_threads"}
+
+// limitFlushThreadsState caps the flush threads of every output of a namespace to MaxFlushThreads
+// so that a single namespace cannot take all threads of the shared fluentd
+type limitFlushThreadsState struct {
+	BaseProcessorState
+}
+
+func (state *limitFlushThreadsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	limit := state.Context.MaxFlushThreads
+	if limit <= 0 {
+		return input, nil
+	}
+
+	f := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		for _, param := range flushThreadParams {
+			value := d.Param(param)
+			if value == "" {
+				continue
+			}
+
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%s must be a positive number, got '%s'", param, value)
+			}
+
+			if n > limit {
+				logrus.Infof("Lowering %s from %d to %d in namespace %s", param, n, limit, ctx.Namespace)
+				d.SetParam(param, strconv.Itoa(limit))
+			}
+		}
+
+		return nil
+	}
+
+	err := applyRecursivelyInPlace(input, state.Context, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
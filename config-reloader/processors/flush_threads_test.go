@@ -0,0 +1,78 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitFlushThreads(t *testing.T) {
+	s := `
+<match a.**>
+  @type elasticsearch
+  <buffer>
+    flush_thread_count 16
+  </buffer>
+</match>
+
+<match b.**>
+  @type copy
+  <store>
+    @type forward
+    num_threads 2
+  </store>
+  <store>
+    @type s3
+    <buffer>
+      flush_thread_count 8
+    </buffer>
+  </store>
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:       "noisy",
+		MaxFlushThreads: 4,
+	}
+
+	fragment, err = Process(fragment, ctx, &limitFlushThreadsState{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "4", fragment[0].Nested[0].Param("flush_thread_count"))
+	// values below the limit are kept
+	assert.Equal(t, "2", fragment[1].Nested[0].Param("num_threads"))
+	assert.Equal(t, "4", fragment[1].Nested[1].Nested[0].Param("flush_thread_count"))
+}
+
+func TestLimitFlushThreadsBadValue(t *testing.T) {
+	s := `
+<match **>
+  @type elasticsearch
+  <buffer>
+    flush_thread_count many
+  </buffer>
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:       "noisy",
+		MaxFlushThreads: 4,
+	}
+
+	_, err = Process(fragment, ctx, &limitFlushThreadsState{})
+	assert.NotNil(t, err)
+
+	// without a limit nothing is checked
+	ctx.MaxFlushThreads = 0
+	_, err = Process(fragment, ctx, &limitFlushThreadsState{})
+	assert.Nil(t, err)
+}
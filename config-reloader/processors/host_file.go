@@ -0,0 +1,131 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/util"
+)
+
+const hostFileSourceType = "host-file"
+
+type hostFileState struct {
+	BaseProcessorState
+}
+
+func isHostFile(frag *fluentd.Directive) bool {
+	return frag.Name == "source" && frag.Type() == hostFileSourceType
+}
+
+const globChars = "*?[]{}"
+
+// isAllowedHostPath checks the path against the admin-defined list of allowed paths.
+// An allowed entry is either a glob pattern or a directory prefix. in_tail accepts a
+// comma-separated list of paths, so every element must be allowed on its own.
+func isAllowedHostPath(p string, allowed []string) bool {
+	for _, elem := range strings.Split(p, ",") {
+		if !isAllowedHostPathElem(strings.TrimSpace(elem), allowed) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isAllowedHostPathElem(p string, allowed []string) bool {
+	if !path.IsAbs(p) || path.Clean(p) != p {
+		// reject relative paths and attempts to escape using ..
+		return false
+	}
+
+	// in_tail expands globs itself, a path with a wildcard is only allowed by a glob entry
+	// that covers it, never by a directory prefix
+	isGlob := strings.ContainsAny(p, globChars)
+
+	for _, a := range allowed {
+		if strings.ContainsAny(a, globChars) {
+			if ok, _ := filepath.Match(a, p); ok {
+				return true
+			}
+			continue
+		}
+
+		if !isGlob && (p == a || strings.HasPrefix(p, strings.TrimSuffix(a, "/")+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (state *hostFileState) Prepare(input fluentd.Fragment) (fluentd.Fragment, error) {
+	res := fluentd.Fragment{}
+
+	for _, frag := range input {
+		if !isHostFile(frag) {
+			continue
+		}
+
+		paramPath := frag.Param("path")
+		if paramPath == "" {
+			return nil, fmt.Errorf("'path' is required when using @type %s", hostFileSourceType)
+		}
+
+		if !isAllowedHostPath(paramPath, state.Context.AllowedTailPaths) {
+			return nil, datasource.PolicyErrorf("path %s is not allowed for @type %s, allowed paths are: %s",
+				paramPath, hostFileSourceType, strings.Join(state.Context.AllowedTailPaths, ", "))
+		}
+
+		paramTag := frag.Param("tag")
+		if paramTag == "" {
+			return nil, fmt.Errorf("'tag' is required when using @type %s", hostFileSourceType)
+		}
+
+		if len(frag.Nested) >= 2 {
+			return nil, fmt.Errorf("One or zero <parse> directives required when using @type %s, found %d", hostFileSourceType, len(frag.Nested))
+		}
+
+		pos := util.Hash(state.Context.DeploymentID, fmt.Sprintf("%s-%s", state.Context.Namespace, paramPath))
+
+		dir := &fluentd.Directive{
+			Name:   "source",
+			Params: fluentd.Params{},
+		}
+		dir.SetParam("@type", "tail")
+		dir.SetParam("path", paramPath)
+		dir.SetParam("tag", fmt.Sprintf("kube.%s.host.%s", state.Context.Namespace, paramTag))
+		dir.SetParam("pos_file", fmt.Sprintf("/var/log/kfohost-%s.pos", pos))
+		dir.SetParam("read_from_head", "true")
+		dir.SetParam("path_key", "path")
+
+		if len(frag.Nested) == 1 {
+			dir.Nested = fluentd.Fragment{frag.Nested[0]}
+		} else {
+			dir.Nested = fluentd.Fragment{makeDefaultParseDirective()}
+		}
+
+		res = append(res, dir)
+	}
+
+	return res, nil
+}
+
+func (state *hostFileState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	res := fluentd.Fragment{}
+
+	// the sources are emitted by Prepare
+	for _, dir := range input {
+		if !isHostFile(dir) {
+			res = append(res, dir)
+		}
+	}
+
+	return res, nil
+}
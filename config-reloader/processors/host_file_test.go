@@ -0,0 +1,120 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostFileExpandedToTail(t *testing.T) {
+	s := `
+<source>
+  @type host-file
+  path /var/log/audit/audit.log
+  tag audit
+</source>
+
+<match **>
+  @type logzio
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:        "monitoring",
+		DeploymentID:     "default",
+		AllowedTailPaths: []string{"/var/log/audit"},
+	}
+
+	prep, err := Prepare(fragment, ctx, &hostFileState{})
+	assert.Nil(t, err)
+	fmt.Printf("Prepared: %s", prep)
+
+	assert.Equal(t, 1, len(prep))
+	tail := prep[0]
+	assert.Equal(t, "tail", tail.Type())
+	assert.Equal(t, "/var/log/audit/audit.log", tail.Param("path"))
+	assert.Equal(t, "kube.monitoring.host.audit", tail.Param("tag"))
+	assert.Equal(t, "true", tail.Param("read_from_head"))
+	assert.Equal(t, "path", tail.Param("path_key"))
+	assert.True(t, strings.HasPrefix(tail.Param("pos_file"), "/var/log/kfohost-"))
+	assert.Equal(t, "none", tail.Nested[0].Type())
+
+	processed, err := Process(fragment, ctx, &hostFileState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(processed))
+	assert.Equal(t, "match", processed[0].Name)
+}
+
+func TestHostFileRejectsDisallowedPaths(t *testing.T) {
+	paths := []string{
+		"/etc/shadow",
+		"/var/log/audit/../../../etc/shadow",
+		"var/log/audit/audit.log",
+		"/var/log/auditing.log",
+		"/var/log/audit/a.log,/etc/shadow",
+		"/var/log/audit/a.log, /etc/shadow",
+		"/var/log/audit/*",
+		"/var/log/audit/../*",
+		"/var/log/{audit/a.log,../../etc/shadow}",
+	}
+
+	for _, p := range paths {
+		s := fmt.Sprintf(`
+<source>
+  @type host-file
+  path %s
+  tag audit
+</source>
+`, p)
+		fragment, err := fluentd.ParseString(s)
+		assert.Nil(t, err)
+
+		ctx := &ProcessorContext{
+			Namespace:        "monitoring",
+			AllowedTailPaths: []string{"/var/log/audit", "/var/log/*.json"},
+		}
+
+		_, err = Prepare(fragment, ctx, &hostFileState{})
+		assert.NotNil(t, err, "path %s must be rejected", p)
+	}
+}
+
+func TestHostFileAllowedGlob(t *testing.T) {
+	assert.True(t, isAllowedHostPath("/var/log/app.json", []string{"/var/log/*.json"}))
+	assert.True(t, isAllowedHostPath("/var/log/audit/a.log", []string{"/var/log/audit/"}))
+	assert.False(t, isAllowedHostPath("/var/log/app.log", []string{"/var/log/*.json"}))
+	assert.False(t, isAllowedHostPath("/var/log/app.log", nil))
+	assert.True(t, isAllowedHostPath("/var/log/a.json,/var/log/audit/b.log", []string{"/var/log/*.json", "/var/log/audit"}))
+	assert.False(t, isAllowedHostPath("/var/log/a.json,/etc/shadow", []string{"/var/log/*.json"}))
+	assert.False(t, isAllowedHostPath("/var/log/audit/*.log", []string{"/var/log/audit"}))
+	assert.True(t, isAllowedHostPath("/var/log/audit/*.log", []string{"/var/log/audit/*.log"}))
+	assert.False(t, isAllowedHostPath("/var/log/*/x.json", []string{"/var/log/*.json"}))
+}
+
+func TestHostFileRequiresTag(t *testing.T) {
+	s := `
+<source>
+  @type host-file
+  path /var/log/audit/audit.log
+</source>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:        "monitoring",
+		AllowedTailPaths: []string{"/var/log/audit"},
+	}
+
+	_, err = Prepare(fragment, ctx, &hostFileState{})
+	assert.NotNil(t, err)
+}
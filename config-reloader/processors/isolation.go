@@ -0,0 +1,90 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// isolationState moves the config of a namespace into a <label> of its own. The only way into this
+// label is a <match> on the tags of the namespace, so the namespace cannot match the records of
+// another one whatever its tags are. Records re-emitted inside the label stay in it.
+// The labels of the namespace stay at the top level as fluentd does not nest them.
+// A namespace with a default output is always isolated: the top-level match copies its records to
+// the label and to the default output, so no <match **> of the namespace can swallow them first
+type isolationState struct {
+	BaseProcessorState
+}
+
+// IsolationLabel is the label holding the config of a namespace with --isolate-namespaces
+func IsolationLabel(namespace string) string {
+	return fmt.Sprintf("@kfo-ns-%s", namespace)
+}
+
+func (state *isolationState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if !state.Context.IsolateNamespaces && state.Context.DefaultOutput == "" {
+		return input, nil
+	}
+
+	body := fluentd.Fragment{}
+	topLevel := fluentd.Fragment{}
+	for _, d := range input {
+		if d.Name == "label" || d.Name == "source" {
+			topLevel = append(topLevel, d)
+		} else {
+			body = append(body, d)
+		}
+	}
+
+	if len(body) == 0 && state.Context.DefaultOutput == "" {
+		return input, nil
+	}
+
+	label := IsolationLabel(state.Context.Namespace)
+	relabel := fluentd.ParamsFromKV("@type", "relabel", "@label", label)
+	route := &fluentd.Directive{
+		Name:   "match",
+		Tag:    fmt.Sprintf("kube.%s.**", state.Context.Namespace),
+		Params: relabel,
+	}
+
+	if state.Context.DefaultOutput != "" {
+		store, err := state.defaultOutputStore()
+		if err != nil {
+			return nil, err
+		}
+
+		route.Params = fluentd.ParamsFromKV("@type", "copy")
+		if len(body) > 0 {
+			route.Nested = append(route.Nested, &fluentd.Directive{Name: "store", Params: relabel})
+		}
+		route.Nested = append(route.Nested, store)
+	}
+
+	res := fluentd.Fragment{route}
+	if len(body) > 0 {
+		res = append(res, &fluentd.Directive{
+			Name:   "label",
+			Tag:    label,
+			Nested: body,
+		})
+	}
+
+	return append(res, topLevel...), nil
+}
+
+// IsolatedBody returns the directives inside the isolation label of a processed config,
+// or the config itself if it is not isolated
+func IsolatedBody(fragment fluentd.Fragment, namespace string) fluentd.Fragment {
+	label := IsolationLabel(namespace)
+	for _, d := range fragment {
+		if d.Name == "label" && d.Tag == label {
+			return d.Nested
+		}
+	}
+
+	return fragment
+}
@@ -0,0 +1,97 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsolationWrapsNamespaceConfig(t *testing.T) {
+	s := `
+<filter **>
+  @type record_transformer
+</filter>
+
+<match **>
+  @type relabel
+  @label @parsed
+</match>
+
+<label @parsed>
+  <match **>
+    @type elasticsearch
+  </match>
+</label>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:         "shop",
+		IsolateNamespaces: true,
+		GenerationContext: &GenerationContext{ReferencedBridges: map[string]bool{}},
+	}
+	fragment, err = Process(fragment, ctx, DefaultProcessors()...)
+	assert.Nil(t, err)
+
+	// the route into the isolation label, the label itself and the label of the namespace
+	assert.Equal(t, 3, len(fragment))
+	assert.Equal(t, "kube.shop.**", fragment[0].Tag)
+	assert.Equal(t, "relabel", fragment[0].Type())
+	assert.Equal(t, "@kfo-ns-shop", fragment[0].Param("@label"))
+	assert.Equal(t, "@kfo-ns-shop", fragment[1].Tag)
+	assert.Equal(t, "label", fragment[2].Name)
+	assert.NotEqual(t, "@kfo-ns-shop", fragment[2].Tag)
+
+	body := IsolatedBody(fragment, "shop")
+	assert.Equal(t, 2, len(body))
+	assert.Equal(t, "filter", body[0].Name)
+	assert.Equal(t, "match", body[1].Name)
+}
+
+func TestIsolationKeepsOtherNamespacesOut(t *testing.T) {
+	// a tenant of namespace shop trying to match the records of namespace bank
+	s := `
+<match bank.**>
+  @type elasticsearch
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	// the tag check rejects it outright
+	ctx := &ProcessorContext{
+		Namespace:         "shop",
+		IsolateNamespaces: true,
+		GenerationContext: &GenerationContext{ReferencedBridges: map[string]bool{}},
+	}
+	_, err = Process(fragment, ctx, DefaultProcessors()...)
+	assert.NotNil(t, err)
+
+	// the isolation does not depend on the tag check: a match on every tag inside the label
+	// still only sees what the top-level route relabels, i.e. the records of shop
+	fragment, err = fluentd.ParseString("<match **>\n  @type elasticsearch\n</match>\n")
+	assert.Nil(t, err)
+	fragment, err = Process(fragment, ctx, &isolationState{})
+	assert.Nil(t, err)
+
+	assert.True(t, fluentd.RoutesTag(fragment, "kube.shop.web.nginx"))
+	assert.False(t, fluentd.RoutesTag(fragment, "kube.bank.web.nginx"))
+	assert.True(t, fluentd.RoutesTag(IsolatedBody(fragment, "shop"), "kube.bank.web.nginx"))
+}
+
+func TestIsolationDisabled(t *testing.T) {
+	fragment, err := fluentd.ParseString("<match **>\n  @type null\n</match>")
+	assert.Nil(t, err)
+
+	fragment, err = Process(fragment, &ProcessorContext{Namespace: "shop"}, &isolationState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(fragment))
+	assert.Equal(t, "match", fragment[0].Name)
+	assert.Equal(t, fragment, IsolatedBody(fragment, "shop"))
+}
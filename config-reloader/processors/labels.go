@@ -18,6 +18,7 @@ import (
 
 const (
 	macroLabels    = "$labels"
+	macroContainer = "$container"
 	containerLabel = "_container"
 )
 
@@ -113,7 +114,38 @@ func parseTagToLabels(tag string) (map[string]string, error) {
 	return result, nil
 }
 
+// parseTagToContainer reads $container(name), a shorthand for $labels(_container=name)
+func parseTagToContainer(tag string) (map[string]string, error) {
+	if !strings.HasPrefix(tag, macroContainer+"(") || !strings.HasSuffix(tag, ")") {
+		return nil, fmt.Errorf("bad $container macro use: %s", tag)
+	}
+
+	name := util.Trim(tag[len(macroContainer)+1 : len(tag)-1])
+	if name == "" || !reValidLabelValue.MatchString(name) {
+		return nil, fmt.Errorf("bad container name: %s", name)
+	}
+
+	return map[string]string{containerLabel: name}, nil
+}
+
+// isLabelsMacro tells if a tag uses $labels or $container
+func isLabelsMacro(tag string) bool {
+	return strings.HasPrefix(tag, macroLabels) || strings.HasPrefix(tag, macroContainer)
+}
+
+func parseLabelsMacro(tag string) (map[string]string, error) {
+	if strings.HasPrefix(tag, macroContainer) {
+		return parseTagToContainer(tag)
+	}
+	return parseTagToLabels(tag)
+}
+
 func makeTagFromFilter(ns string, sortedLabelNames []string, labelNames map[string]string) string {
+	if len(sortedLabelNames) == 0 {
+		// only containers are selected, their name is in the tag already and nothing is retagged
+		return fmt.Sprintf("kube.%s.*.%s", ns, labelNames[containerLabel])
+	}
+
 	buf := &bytes.Buffer{}
 
 	if cont, ok := labelNames[containerLabel]; ok {
@@ -157,11 +189,11 @@ func (p *expandLabelsMacroState) Process(input fluentd.Fragment) (fluentd.Fragme
 			return nil
 		}
 
-		if !strings.HasPrefix(d.Tag, macroLabels) {
+		if !isLabelsMacro(d.Tag) {
 			return nil
 		}
 
-		labelNames, err := parseTagToLabels(d.Tag)
+		labelNames, err := parseLabelsMacro(d.Tag)
 		if err != nil {
 			return err
 		}
@@ -188,11 +220,11 @@ func (p *expandLabelsMacroState) Process(input fluentd.Fragment) (fluentd.Fragme
 			return nil
 		}
 
-		if !strings.HasPrefix(d.Tag, macroLabels) {
+		if !isLabelsMacro(d.Tag) {
 			return nil
 		}
 
-		labelNames, err := parseTagToLabels(d.Tag)
+		labelNames, err := parseLabelsMacro(d.Tag)
 		if err != nil {
 			// should never happen as the error should be caught beforehand
 			return nil
@@ -204,6 +236,10 @@ func (p *expandLabelsMacroState) Process(input fluentd.Fragment) (fluentd.Fragme
 	}
 	applyRecursivelyInPlace(input, p.Context, replaceLabels)
 
+	if len(sortedLabelNames) == 0 {
+		return input, nil
+	}
+
 	// prepare extra directives
 	model := struct {
 		Pattern string
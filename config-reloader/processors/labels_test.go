@@ -277,3 +277,111 @@ func TestLabelWithLabelsAndContainer(t *testing.T) {
 		assert.Equal(t, "kube.monitoring.*.*._labels.prom.helm_12.*", dir.Tag)
 	}
 }
+
+func TestLabelsOverlappingMatchesKeepOrder(t *testing.T) {
+	s := `
+<match $labels(tier=web)>
+  @type null
+</match>
+
+<match $labels(app=frontend)>
+  @type logzio
+</match>
+	`
+
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "shop",
+		GenerationContext: &GenerationContext{
+			ReferencedBridges: map[string]bool{},
+		},
+	}
+
+	fragment, err = Process(fragment, ctx, &expandLabelsMacroState{})
+	assert.Nil(t, err)
+
+	// a pod labelled app=frontend,tier=web is tagged with both label values and matches
+	// both blocks, the first one in the config gets its logs
+	assert.Equal(t, 5, len(fragment))
+	assert.Equal(t, "kube.shop.*.*._labels.*.web", fragment[3].Tag)
+	assert.Equal(t, "null", fragment[3].Type())
+	assert.Equal(t, "kube.shop.*.*._labels.frontend.*", fragment[4].Tag)
+	assert.Equal(t, "logzio", fragment[4].Type())
+}
+
+func TestContainerMacro(t *testing.T) {
+	s := `
+<filter $container(app)>
+  @type parse
+</filter>
+
+<match $labels(_container=istio-proxy)>
+  @type null
+</match>
+
+<match $container(istio-init)>
+  @type null
+</match>
+	`
+
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "shop",
+		GenerationContext: &GenerationContext{
+			ReferencedBridges: map[string]bool{},
+		},
+	}
+
+	fragment, err = Process(fragment, ctx, &expandLabelsMacroState{})
+	assert.Nil(t, err)
+
+	// the container name is in the tag already, nothing is retagged
+	assert.Equal(t, 3, len(fragment))
+	assert.Equal(t, "kube.shop.*.app", fragment[0].Tag)
+	assert.Equal(t, "kube.shop.*.istio-proxy", fragment[1].Tag)
+	assert.Equal(t, "kube.shop.*.istio-init", fragment[2].Tag)
+}
+
+func TestContainerMacroWithLabels(t *testing.T) {
+	s := `
+<match $container(istio-proxy)>
+  @type null
+</match>
+
+<match $labels(app=frontend)>
+  @type logzio
+</match>
+	`
+
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "shop",
+		GenerationContext: &GenerationContext{
+			ReferencedBridges: map[string]bool{},
+		},
+	}
+
+	fragment, err = Process(fragment, ctx, &expandLabelsMacroState{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 5, len(fragment))
+	assert.Equal(t, "kube.shop.*.istio-proxy._labels.*", fragment[3].Tag)
+	assert.Equal(t, "kube.shop.*.*._labels.frontend", fragment[4].Tag)
+}
+
+func TestContainerMacroParseNotOk(t *testing.T) {
+	for _, tag := range []string{"$container()", "$container(-a)", "$container(a=b)", "$container"} {
+		res, err := parseTagToContainer(tag)
+		assert.NotNil(t, err, "Got this instead for %s: %+v", tag, res)
+	}
+
+	res, err := parseTagToContainer("$container( main )")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"_container": "main"}, res)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// routingTypes re-emit records inside fluentd or drop them, they never reach a destination
+var routingTypes = map[string]bool{
+	"relabel":            true,
+	"rewrite_tag_filter": true,
+	"detect_exceptions":  true,
+	"null":               true,
+}
+
+// maxOutputsState fails a namespace whose generated config has more than MaxOutputs outputs
+type maxOutputsState struct {
+	BaseProcessorState
+}
+
+// CountOutputs counts the <match> and <store> directives sending records out of fluentd.
+// A copy output is not an output itself, each of its stores is
+func CountOutputs(fragment fluentd.Fragment) int {
+	n := 0
+	for _, d := range fragment {
+		switch d.Name {
+		case "label":
+			n += CountOutputs(d.Nested)
+		case "match", "store":
+			if d.Type() == "copy" {
+				n += CountOutputs(d.Nested)
+			} else if d.Type() != "" && !routingTypes[d.Type()] {
+				n++
+			}
+		}
+	}
+
+	return n
+}
+
+func (state *maxOutputsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	limit := state.Context.MaxOutputs
+	if limit <= 0 {
+		return input, nil
+	}
+
+	if n := CountOutputs(input); n > limit {
+		return nil, datasource.PolicyErrorf("the config has %d outputs, at most %d are allowed per namespace", n, limit)
+	}
+
+	return input, nil
+}
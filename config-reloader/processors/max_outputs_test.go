@@ -0,0 +1,102 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const configWithCopies = `
+<match kube.shop.web.**>
+  @type copy
+  <store>
+    @type elasticsearch
+  </store>
+  <store>
+    @type s3
+  </store>
+  <store>
+    @type relabel
+    @label @archive
+  </store>
+</match>
+
+<match kube.shop.db.**>
+  @type logzio_buffered
+</match>
+
+<label @archive>
+  <match **>
+    @type copy
+    <store>
+      @type gcs
+    </store>
+    <store>
+      @type null
+    </store>
+  </match>
+</label>
+`
+
+func TestCountOutputs(t *testing.T) {
+	fragment, err := fluentd.ParseString(configWithCopies)
+	assert.Nil(t, err)
+
+	// elasticsearch, s3, logzio_buffered and gcs: copy, relabel and null are not outputs
+	assert.Equal(t, 4, CountOutputs(fragment))
+}
+
+func TestMaxOutputs(t *testing.T) {
+	fragment, err := fluentd.ParseString(configWithCopies)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:  "shop",
+		MaxOutputs: 4,
+	}
+	_, err = Process(fragment, ctx, &maxOutputsState{})
+	assert.Nil(t, err)
+
+	ctx.MaxOutputs = 3
+	_, err = Process(fragment, ctx, &maxOutputsState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "the config has 4 outputs, at most 3 are allowed per namespace", err.Error())
+	assert.Equal(t, datasource.ErrorPhasePolicy, datasource.ErrorPhase(err))
+
+	// no limit
+	ctx.MaxOutputs = 0
+	_, err = Process(fragment, ctx, &maxOutputsState{})
+	assert.Nil(t, err)
+}
+
+func TestMaxOutputsCountsFanOut(t *testing.T) {
+	s := `
+<plugin archive>
+  @type s3
+</plugin>
+`
+	admin, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+	genCtx := &GenerationContext{ReferencedBridges: map[string]bool{}}
+	ExtractPlugins(genCtx, admin)
+
+	fragment, err := fluentd.ParseString("<match **>\n  @type elasticsearch\n</match>\n")
+	assert.Nil(t, err)
+
+	// the extra store added for also-send-to is counted too
+	ctx := &ProcessorContext{
+		Namespace:         "shop",
+		MaxOutputs:        1,
+		FanOutPlugins:     []string{"archive"},
+		GenerationContext: genCtx,
+	}
+	_, err = Process(fragment, ctx, DefaultProcessors()...)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "has 2 outputs")
+}
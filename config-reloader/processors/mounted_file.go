@@ -161,28 +161,67 @@ func (state *mountedFileState) makeAttachK8sMetadataDirective(tag string, mc *da
 
 	buf := &bytes.Buffer{}
 	fmt.Fprintf(buf, "record['stream']='%s'; ", cf.Path)
-	fmt.Fprintf(buf, "record['kubernetes']=%s; ", util.ToRubyMapLiteral(map[string]string{
+	kubernetes := map[string]string{
 		"container_name":  mc.Name,
 		"container_image": mc.Image,
 		"namespace_name":  state.Context.Namespace,
 		"pod_name":        mc.PodName,
 		"pod_id":          mc.PodID,
 		"host":            mc.NodeName,
-	}))
+	}
+	if mc.OwnerKind != "" {
+		kubernetes["owner_kind"] = mc.OwnerKind
+		kubernetes["owner_name"] = mc.OwnerName
+	}
+	if len(state.Context.MetadataFields) > 0 {
+		// the fields only added on request, then the others not requested are dropped
+		kubernetes["pod_ip"] = mc.PodIP
+		kubernetes["container_image_id"] = mc.ImageID
+		for field := range kubernetes {
+			if !state.keepsMetadata(field) {
+				delete(kubernetes, field)
+			}
+		}
+	}
+	fmt.Fprintf(buf, "record['kubernetes']=%s; ", util.ToRubyMapLiteral(kubernetes))
 
 	fmt.Fprintf(buf, "record['docker']=%s; ", util.ToRubyMapLiteral(map[string]string{
 		"container_id": mc.ContainerID,
 	}))
 
-	fmt.Fprintf(buf, "record['container_info']='%s'; ", util.Hash(mc.PodID, cf.Path))
-	fmt.Fprintf(buf, "record['kubernetes']['labels']=%s; ", util.ToRubyMapLiteral(mergeMaps(mc.Labels, cf.AddedLabels)))
-	fmt.Fprintf(buf, "record['kubernetes']['namespace_labels']=%s", util.ToRubyMapLiteral(state.Context.NamespaceLabels))
+	fmt.Fprintf(buf, "record['container_info']='%s'", util.Hash(mc.PodID, cf.Path))
+	if state.keepsMetadata("labels") {
+		fmt.Fprintf(buf, "; record['kubernetes']['labels']=%s", util.ToRubyMapLiteral(mergeMaps(mc.Labels, cf.AddedLabels)))
+	}
+	if state.keepsMetadata("namespace_labels") {
+		fmt.Fprintf(buf, "; record['kubernetes']['namespace_labels']=%s", util.ToRubyMapLiteral(state.Context.NamespaceLabels))
+	}
+	if len(state.Context.MetadataFields) > 0 && state.keepsMetadata("annotations") {
+		fmt.Fprintf(buf, "; record['kubernetes']['annotations']=%s", util.ToRubyMapLiteral(mc.Annotations))
+	}
+	if len(state.Context.MetadataFields) > 0 && state.keepsMetadata("namespace_annotations") {
+		fmt.Fprintf(buf, "; record['kubernetes']['namespace_annotations']=%s", util.ToRubyMapLiteral(state.Context.NamespaceAnnotations))
+	}
 
 	res.Nested[0].SetParam("dummy_", fmt.Sprintf("${%s}", buf.String()))
 
 	return res
 }
 
+// keepsMetadata tells if a field of the Kubernetes metadata is kept on the records, without
+// --metadata-field all the default ones are
+func (state *mountedFileState) keepsMetadata(field string) bool {
+	if len(state.Context.MetadataFields) == 0 {
+		return true
+	}
+	for _, f := range state.Context.MetadataFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
 func mergeMaps(base, more map[string]string) map[string]string {
 	res := map[string]string{}
 
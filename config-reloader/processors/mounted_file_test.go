@@ -167,10 +167,12 @@ func TestConvertToFragment(t *testing.T) {
 		Labels: map[string]string{"app": "nginx"},
 	}
 	c2 := &datasource.MiniContainer{
-		PodID:   "abc-id",
-		PodName: "abc",
-		Name:    "nginx",
-		Labels:  map[string]string{"app": "nginx"},
+		PodID:     "abc-id",
+		PodName:   "abc",
+		Name:      "nginx",
+		Labels:    map[string]string{"app": "nginx"},
+		OwnerKind: "DaemonSet",
+		OwnerName: "nginx",
 		HostMounts: []*datasource.Mount{
 			{
 				Path:       "/var/log",
@@ -236,6 +238,7 @@ func TestConvertToFragment(t *testing.T) {
 	assert.True(t, strings.Contains(mod.String(), "'good'=>'morning'"))
 	assert.True(t, strings.Contains(mod.String(), "'key'=>'value'"))
 	assert.True(t, !strings.Contains(mod.String(), "'key'=>'new_value'"))
+	assert.False(t, strings.Contains(mod.String(), "'owner_kind'"))
 
 	result = state.convertToFragement(specC2)
 	assert.Equal(t, 2, len(result))
@@ -250,6 +253,7 @@ func TestConvertToFragment(t *testing.T) {
 	mod = result[1]
 	assert.Equal(t, "filter", mod.Name)
 	assert.Equal(t, "record_modifier", mod.Type())
+	assert.True(t, strings.Contains(mod.String(), "'owner_kind'=>'DaemonSet','owner_name'=>'nginx'"))
 
 	result = state.convertToFragement(specC3)
 	assert.Equal(t, 2, len(result))
@@ -379,3 +383,51 @@ func TestProcessMountedFile(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(main))
 }
+
+func TestMountedFileMetadataFields(t *testing.T) {
+	ctx := &ProcessorContext{
+		Namespace:            "monitoring",
+		NamespaceLabels:      map[string]string{"team": "sre"},
+		NamespaceAnnotations: map[string]string{"owner": "sre@example.com"},
+		KubeletRoot:          "/kubelet-root",
+		MetadataFields:       []string{"pod_name", "pod_ip", "annotations"},
+		MiniContainers: []*datasource.MiniContainer{{
+			PodID:       "123-id",
+			PodName:     "123",
+			PodIP:       "10.0.0.7",
+			Image:       "image-c1",
+			ContainerID: "contid-c1",
+			Name:        "redis-main",
+			NodeName:    "node-1",
+			Labels:      map[string]string{"app": "redis"},
+			Annotations: map[string]string{"build": "42"},
+			HostMounts:  []*datasource.Mount{{Path: "/var/log", VolumeName: "logs"}},
+		}},
+	}
+	state := &mountedFileState{BaseProcessorState: BaseProcessorState{Context: ctx}}
+
+	input, err := fluentd.ParseString("<source>\n  @type mounted-file\n  path /var/log/redis.log\n  labels app=redis\n</source>\n")
+	assert.Nil(t, err)
+	prep, err := Prepare(input, ctx, state)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(prep))
+
+	payload := prep[1].Nested[0].Param("dummy_")
+	assert.Contains(t, payload, "record['kubernetes']={'pod_ip'=>'10.0.0.7','pod_name'=>'123'}")
+	assert.Contains(t, payload, "record['kubernetes']['annotations']={'build'=>'42'}")
+	assert.NotContains(t, payload, "image-c1")
+	assert.NotContains(t, payload, "node-1")
+	assert.NotContains(t, payload, "['labels']")
+	assert.NotContains(t, payload, "namespace_labels")
+	assert.NotContains(t, payload, "namespace_annotations")
+
+	// the fields added on request are not there by default
+	ctx.MetadataFields = nil
+	prep, err = Prepare(input, ctx, state)
+	assert.Nil(t, err)
+	payload = prep[1].Nested[0].Param("dummy_")
+	assert.Contains(t, payload, "'host'=>'node-1'")
+	assert.Contains(t, payload, "record['kubernetes']['namespace_labels']={'team'=>'sre'}")
+	assert.NotContains(t, payload, "pod_ip")
+	assert.NotContains(t, payload, "annotations")
+}
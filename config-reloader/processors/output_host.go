@@ -0,0 +1,123 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// overrideOutputHostState points the known network outputs to OutputHostOverride.
+// Only the host part is replaced, ports, schemes and all other params are kept.
+type overrideOutputHostState struct {
+	BaseProcessorState
+}
+
+// outputs that don't send anything over the network
+var localOutputTypes = map[string]bool{
+	"copy":    true,
+	"null":    true,
+	"relabel": true,
+	"file":    true,
+	"stdout":  true,
+}
+
+// replaceHostPort replaces the host of a host[:port] string
+func replaceHostPort(hostPort string, host string) string {
+	if _, port, err := net.SplitHostPort(hostPort); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+
+	return host
+}
+
+// replaceURLHost replaces the host of a URL or a host[:port] string
+func replaceURLHost(endpoint string, host string) string {
+	if !strings.Contains(endpoint, "://") {
+		return replaceHostPort(endpoint, host)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else {
+		u.Host = host
+	}
+
+	return u.String()
+}
+
+// replaceList applies fn to every element of a comma-separated list
+func replaceList(list string, fn func(string) string) string {
+	parts := strings.Split(list, ",")
+	for i, p := range parts {
+		parts[i] = fn(strings.TrimSpace(p))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (state *overrideOutputHostState) overrideHost(d *fluentd.Directive) {
+	host := state.Context.OutputHostOverride
+
+	switch d.Type() {
+	case "elasticsearch":
+		if hosts := d.Param("hosts"); hosts != "" {
+			d.SetParam("hosts", replaceList(hosts, func(s string) string { return replaceURLHost(s, host) }))
+		} else {
+			d.SetParam("host", host)
+		}
+	case "forward":
+		for _, server := range d.Nested {
+			if server.Name == "server" {
+				server.SetParam("host", host)
+			}
+		}
+	case "kafka", "kafka2", "kafka_buffered":
+		for _, param := range []string{"brokers", "seed_brokers"} {
+			if brokers := d.Param(param); brokers != "" {
+				d.SetParam(param, replaceList(brokers, func(s string) string { return replaceHostPort(s, host) }))
+			}
+		}
+	case "s3":
+		if endpoint := d.Param("s3_endpoint"); endpoint != "" {
+			d.SetParam("s3_endpoint", replaceURLHost(endpoint, host))
+		} else {
+			d.SetParam("s3_endpoint", "https://"+host)
+		}
+	default:
+		if !localOutputTypes[d.Type()] {
+			logrus.Warnf("Cannot override the host of '@type %s' in namespace %s, leaving it untouched", d.Type(), state.Context.Namespace)
+		}
+	}
+}
+
+func (state *overrideOutputHostState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if state.Context.OutputHostOverride == "" {
+		return input, nil
+	}
+
+	f := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if d.Name == "match" || d.Name == "store" {
+			state.overrideHost(d)
+		}
+
+		return nil
+	}
+
+	err := applyRecursivelyInPlace(input, state.Context, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
@@ -0,0 +1,103 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputHostOverride(t *testing.T) {
+	s := `
+<match a.**>
+  @type elasticsearch
+  host es.prod
+  port 9200
+  index_name logs
+</match>
+
+<match b.**>
+  @type elasticsearch
+  hosts https://es1.prod:9200,es2.prod:9200
+</match>
+
+<match c.**>
+  @type copy
+  <store>
+    @type forward
+    <server>
+      host fwd.prod
+      port 24224
+    </server>
+  </store>
+  <store>
+    @type kafka2
+    brokers k1.prod:9092,k2.prod:9093
+  </store>
+</match>
+
+<match d.**>
+  @type s3
+  s3_bucket logs
+  s3_endpoint http://minio.prod:9000
+</match>
+
+<match e.**>
+  @type logzio
+  endpoint_url https://listener.logz.io
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:          "monitoring",
+		OutputHostOverride: "sink.staging",
+	}
+
+	fragment, err = Process(fragment, ctx, &overrideOutputHostState{})
+	assert.Nil(t, err)
+	fmt.Printf("Processed: %s", fragment)
+
+	es := fragment[0]
+	assert.Equal(t, "sink.staging", es.Param("host"))
+	assert.Equal(t, "9200", es.Param("port"))
+	assert.Equal(t, "logs", es.Param("index_name"))
+
+	assert.Equal(t, "https://sink.staging:9200,sink.staging:9200", fragment[1].Param("hosts"))
+
+	forward := fragment[2].Nested[0]
+	assert.Equal(t, "sink.staging", forward.Nested[0].Param("host"))
+	assert.Equal(t, "24224", forward.Nested[0].Param("port"))
+	assert.Equal(t, "sink.staging:9092,sink.staging:9093", fragment[2].Nested[1].Param("brokers"))
+
+	assert.Equal(t, "http://sink.staging:9000", fragment[3].Param("s3_endpoint"))
+	assert.Equal(t, "logs", fragment[3].Param("s3_bucket"))
+
+	// unknown plugins are left untouched
+	assert.Equal(t, "https://listener.logz.io", fragment[4].Param("endpoint_url"))
+}
+
+func TestOutputHostOverrideDisabled(t *testing.T) {
+	s := `
+<match **>
+  @type elasticsearch
+  host es.prod
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "monitoring",
+	}
+
+	fragment, err = Process(fragment, ctx, &overrideOutputHostState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "es.prod", fragment[0].Param("host"))
+}
@@ -0,0 +1,50 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+const paramID = "@id"
+
+// outputIDsState gives every output of a namespace a stable @id so that the runtime state fluentd
+// reports per plugin id can be traced back to the namespace. Ids set by the tenant are kept
+type outputIDsState struct {
+	BaseProcessorState
+}
+
+func (state *outputIDsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if !state.Context.AssignOutputIDs {
+		return input, nil
+	}
+
+	n := 0
+	cb := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if (d.Name != "match" && d.Name != "store") || d.Type() == "" || d.Param(paramID) != "" {
+			return nil
+		}
+
+		n++
+		d.SetParam(paramID, fmt.Sprintf("kfo-%s-%d", ctx.Namespace, n))
+		return nil
+	}
+
+	applyRecursivelyInPlace(input, state.Context, cb)
+	return input, nil
+}
+
+// OutputIDs lists the @id of the outputs of a processed config
+func OutputIDs(fragment fluentd.Fragment) []string {
+	res := []string{}
+	applyRecursivelyInPlace(fragment, nil, func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if (d.Name == "match" || d.Name == "store") && d.Param(paramID) != "" {
+			res = append(res, d.Param(paramID))
+		}
+		return nil
+	})
+	return res
+}
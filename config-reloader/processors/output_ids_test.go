@@ -0,0 +1,57 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputIDs(t *testing.T) {
+	s := `
+<match a.**>
+  @type copy
+  <store>
+    @type elasticsearch
+  </store>
+  <store>
+    @type s3
+    @id archive
+  </store>
+</match>
+
+<match b.**>
+  @type null
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:       "shop",
+		AssignOutputIDs: true,
+	}
+
+	fragment, err = Process(fragment, ctx, &outputIDsState{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "kfo-shop-1", fragment[0].Param("@id"))
+	assert.Equal(t, "kfo-shop-2", fragment[1].Param("@id"))
+	assert.Equal(t, "kfo-shop-3", fragment[0].Nested[0].Param("@id"))
+	assert.Equal(t, "archive", fragment[0].Nested[1].Param("@id"))
+
+	assert.ElementsMatch(t, []string{"kfo-shop-1", "kfo-shop-2", "kfo-shop-3", "archive"}, OutputIDs(fragment))
+}
+
+func TestOutputIDsDisabled(t *testing.T) {
+	fragment, err := fluentd.ParseString("<match **>\n  @type null\n</match>")
+	assert.Nil(t, err)
+
+	fragment, err = Process(fragment, &ProcessorContext{Namespace: "shop"}, &outputIDsState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", fragment[0].Param("@id"))
+}
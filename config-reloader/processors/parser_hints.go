@@ -0,0 +1,80 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// Supported values of a container parser hint
+const (
+	parserHintJSON      = "json"
+	parserHintLogfmt    = "logfmt"
+	parserHintMultiline = "multiline"
+)
+
+// parserHintsState parses the logs of containers that carry a parser hint. The filters go to the
+// main file so they run before any routing done by the namespace
+type parserHintsState struct {
+	BaseProcessorState
+}
+
+func (state *parserHintsState) Prepare(input fluentd.Fragment) (fluentd.Fragment, error) {
+	res := fluentd.Fragment{}
+
+	for _, mc := range state.Context.MiniContainers {
+		if mc.ParserHint == "" {
+			continue
+		}
+
+		filter := state.makeParserFilter(mc)
+		if filter == nil {
+			logrus.Warnf("Ignoring unknown parser hint '%s' of container %s/%s in namespace %s", mc.ParserHint, mc.PodName, mc.Name, state.Context.Namespace)
+			continue
+		}
+		res = append(res, filter)
+	}
+
+	return res, nil
+}
+
+func (state *parserHintsState) makeParserFilter(mc *datasource.MiniContainer) *fluentd.Directive {
+	filter := &fluentd.Directive{
+		Name:   "filter",
+		Tag:    fmt.Sprintf("kube.%s.%s.%s", state.Context.Namespace, mc.PodName, mc.Name),
+		Params: fluentd.Params{},
+	}
+
+	switch mc.ParserHint {
+	case parserHintJSON, parserHintLogfmt:
+		filter.SetParam("@type", "parser")
+		filter.SetParam("key_name", "log")
+		filter.SetParam("reserve_data", "true")
+		filter.SetParam("emit_invalid_record_to_error", "false")
+		filter.Nested = fluentd.Fragment{
+			{
+				Name:   "parse",
+				Params: fluentd.ParamsFromKV("@type", mc.ParserHint),
+			},
+		}
+	case parserHintMultiline:
+		// lines not starting with a blank start a new event, the others are joined to it
+		filter.SetParam("@type", "concat")
+		filter.SetParam("key", "log")
+		filter.SetParam("multiline_start_regexp", `/^\S/`)
+		filter.SetParam("flush_interval", "5")
+	default:
+		return nil
+	}
+
+	return filter
+}
+
+func (state *parserHintsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	return input, nil
+}
@@ -0,0 +1,45 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParserHints(t *testing.T) {
+	ctx := &ProcessorContext{
+		Namespace: "shop",
+		MiniContainers: []*datasource.MiniContainer{
+			{PodName: "api-1", Name: "app", ParserHint: "json"},
+			{PodName: "api-1", Name: "proxy", ParserHint: "logfmt"},
+			{PodName: "worker-1", Name: "app", ParserHint: "multiline"},
+			{PodName: "worker-1", Name: "sidecar"},
+			{PodName: "worker-2", Name: "app", ParserHint: "xml"},
+		},
+	}
+
+	prep, err := Prepare(fluentd.Fragment{}, ctx, &parserHintsState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(prep))
+
+	json := prep[0]
+	assert.Equal(t, "filter", json.Name)
+	assert.Equal(t, "kube.shop.api-1.app", json.Tag)
+	assert.Equal(t, "parser", json.Type())
+	assert.Equal(t, "log", json.Param("key_name"))
+	assert.Equal(t, "true", json.Param("reserve_data"))
+	assert.Equal(t, "json", json.Nested[0].Type())
+
+	assert.Equal(t, "kube.shop.api-1.proxy", prep[1].Tag)
+	assert.Equal(t, "logfmt", prep[1].Nested[0].Type())
+
+	assert.Equal(t, "kube.shop.worker-1.app", prep[2].Tag)
+	assert.Equal(t, "concat", prep[2].Type())
+	assert.Equal(t, "log", prep[2].Param("key"))
+}
@@ -37,15 +37,42 @@ func (g *GenerationContext) augmentTag(d *fluentd.Directive) {
 // ProcessorContext is how a processor gets an environment to operate in.
 // It is both the model and the workspace of a processor.
 type ProcessorContext struct {
-	Namespace         string
-	NamespaceLabels   map[string]string
-	AllowFile         bool
-	DeploymentID      string
-	MiniContainers    []*datasource.MiniContainer
-	KubeletRoot       string
-	BufferMountFolder string
-	GenerationContext *GenerationContext
-	AllowTagExpansion bool
+	Namespace            string
+	NamespaceLabels      map[string]string
+	NamespaceAnnotations map[string]string
+	// Kubernetes metadata fields kept on the records, empty keeps the default ones
+	MetadataFields      []string
+	AllowFile           bool
+	DeploymentID        string
+	MiniContainers      []*datasource.MiniContainer
+	KubeletRoot         string
+	BufferMountFolder   string
+	GenerationContext   *GenerationContext
+	AllowTagExpansion   bool
+	AllowedTailPaths    []string
+	AllowedPlugins      []string
+	DeniedPlugins       []string
+	ReservedTagPrefixes []string
+	OutputHostOverride  string
+	DeadLetterEnabled   bool
+	MaxFlushThreads     int
+	MaxOutputs          int
+	RetryPolicy         *RetryPolicy
+	FanOutPlugins       []string
+	DefaultTimeFormat   string
+	DefaultTimezone     string
+	AssignOutputIDs     bool
+	IsolateNamespaces   bool
+	// aggregator the outputs of the namespace are routed to, empty keeps the outputs
+	Aggregator  string
+	Aggregators map[string]string
+	// log sources selected by the namespace, nil keeps the container logs only
+	Sources         []string
+	SourceTemplates map[string]string
+	// template of the <match> every record of the namespace is also sent to, empty if there is none
+	DefaultOutput string
+	// buffer profile selected by the namespace, empty keeps its buffer settings
+	BufferProfile string
 }
 
 type BaseProcessorState struct {
@@ -194,14 +221,30 @@ func augmentTag(orig string) string {
 func DefaultProcessors() []FragmentProcessor {
 	return []FragmentProcessor{
 		&expandPluginsState{},
+		&allowedPluginsState{},
+		&overrideOutputHostState{},
 		&expandTagsState{},
 		&expandThisnsMacroState{},
 		&fixDestinations{},
+		&fanOutState{},
 		&expandLabelsMacroState{},
 		&uniqueRewriteTagState{},
+		&reservedTagsState{},
 		&rewriteLabelsState{},
 		&mountedFileState{},
+		&hostFileState{},
 		&shareLogsState{},
 		&detectExceptionsState{},
+		&bufferProfileState{},
+		&limitFlushThreadsState{},
+		&retryPolicyState{},
+		&parserHintsState{},
+		&excludedPodsState{},
+		&timeFormatState{},
+		&outputIDsState{},
+		&maxOutputsState{},
+		&namespaceSourcesState{},
+		&aggregatorState{},
+		&isolationState{},
 	}
 }
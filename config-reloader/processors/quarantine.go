@@ -0,0 +1,42 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// QuarantineRecordKey is added to the records of a quarantined namespace, its value is the namespace
+const QuarantineRecordKey = "kfo_quarantined_namespace"
+
+// MakeQuarantineConfig builds the config used instead of an invalid namespace config: all logs of
+// the namespace are marked and sent as is to the given plugin definition from the admin namespace
+func MakeQuarantineConfig(namespace string, plugin *fluentd.Directive) fluentd.Fragment {
+	tag := fmt.Sprintf("kube.%s.**", namespace)
+
+	mark := &fluentd.Directive{
+		Name:   "filter",
+		Tag:    tag,
+		Params: fluentd.Params{},
+		Nested: fluentd.Fragment{
+			&fluentd.Directive{
+				Name:   "record",
+				Params: fluentd.Params{},
+			},
+		},
+	}
+	mark.SetParam("@type", "record_transformer")
+	mark.Nested[0].SetParam(QuarantineRecordKey, namespace)
+
+	match := &fluentd.Directive{
+		Name:   "match",
+		Tag:    tag,
+		Params: plugin.Params.Clone(),
+		Nested: plugin.Nested.Clone(),
+	}
+
+	return fluentd.Fragment{mark, match}
+}
@@ -0,0 +1,85 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+const (
+	paramTag             = "tag"
+	paramAddTagPrefix    = "add_tag_prefix"
+	paramRemoveTagPrefix = "remove_tag_prefix"
+)
+
+// reservedTagsState keeps the tags a namespace emits records to inside kube.<namespace>.
+// so that a namespace cannot hijack the routing of the admin or of other namespaces.
+// Tags with a reserved prefix are rejected, any other tag is moved under kube.<namespace>.
+type reservedTagsState struct {
+	BaseProcessorState
+}
+
+func (state *reservedTagsState) reservedPrefix(tag string) string {
+	for _, p := range state.Context.ReservedTagPrefixes {
+		if tag == p || strings.HasPrefix(tag, p+".") {
+			return p
+		}
+	}
+
+	return ""
+}
+
+// sanitizeTag returns the tag moved under the namespace prefix, or an error if it is reserved
+func (state *reservedTagsState) sanitizeTag(d *fluentd.Directive, tag string) (string, error) {
+	ownPrefix := fmt.Sprintf("kube.%s.", state.Context.Namespace)
+	if strings.HasPrefix(tag, ownPrefix) || strings.HasPrefix(tag, "${tag}") {
+		// already inside the namespace, ${tag} is the tag of a record routed to the namespace
+		return tag, nil
+	}
+
+	if p := state.reservedPrefix(tag); p != "" {
+		return "", datasource.PolicyErrorf("cannot emit records to tag %s in <%s>, tags starting with %s are reserved", tag, d.Name, p)
+	}
+
+	return ownPrefix + tag, nil
+}
+
+func (state *reservedTagsState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	f := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if d.Name != "match" && d.Name != "filter" && d.Name != "store" && d.Name != "rule" {
+			return nil
+		}
+
+		if d.Param(paramRemoveTagPrefix) != "" {
+			return datasource.PolicyErrorf("cannot use %s in <%s>, it would move records out of the namespace", paramRemoveTagPrefix, d.Name)
+		}
+
+		for _, param := range []string{paramTag, paramAddTagPrefix} {
+			tag := d.Param(param)
+			if tag == "" {
+				continue
+			}
+
+			sanitized, err := state.sanitizeTag(d, tag)
+			if err != nil {
+				return err
+			}
+
+			d.SetParam(param, sanitized)
+		}
+
+		return nil
+	}
+
+	err := applyRecursivelyInPlace(input, state.Context, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
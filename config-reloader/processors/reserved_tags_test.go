@@ -0,0 +1,131 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservedTagsRewritesTenantTags(t *testing.T) {
+	s := `
+<match kube.demo.app.**>
+  @type record_reformer
+  tag alerts
+</match>
+
+<match kube.demo.web.**>
+  @type copy
+  <store>
+    @type record_reformer
+    tag kube.other.hijack
+  </store>
+  <store>
+    @type record_reformer
+    tag kube.demo.kept
+  </store>
+  <store>
+    @type record_reformer
+    tag ${tag}.copy
+  </store>
+</match>
+
+<match kube.demo.db.**>
+  @type route
+  add_tag_prefix slow
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:           "demo",
+		ReservedTagPrefixes: []string{"fluent"},
+	}
+
+	fragment, err = Process(fragment, ctx, &reservedTagsState{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "kube.demo.alerts", fragment[0].Param("tag"))
+	// without kube reserved, another namespace's tag ends up inside the namespace too
+	assert.Equal(t, "kube.demo.kube.other.hijack", fragment[1].Nested[0].Param("tag"))
+	assert.Equal(t, "kube.demo.kept", fragment[1].Nested[1].Param("tag"))
+	assert.Equal(t, "${tag}.copy", fragment[1].Nested[2].Param("tag"))
+	assert.Equal(t, "kube.demo.slow", fragment[2].Param("add_tag_prefix"))
+}
+
+func TestReservedTagsRejectsCollisions(t *testing.T) {
+	attempts := []string{
+		// the internal tags of fluentd
+		`<match **>
+  @type record_reformer
+  tag fluent.warn
+</match>`,
+		`<match **>
+  @type copy
+  <store>
+    @type record_reformer
+    tag systemd
+  </store>
+</match>`,
+		`<match **>
+  @type route
+  add_tag_prefix kubernetes.var.log
+</match>`,
+		`<match **>
+  @type retag
+  <rule>
+    key msg
+    pattern /x/
+    tag kubernetes.other
+  </rule>
+</match>`,
+		// the tags of another namespace
+		`<match **>
+  @type record_reformer
+  tag kube.other.hijack
+</match>`,
+		// dropping the namespace prefix
+		`<match **>
+  @type route
+  remove_tag_prefix kube.demo
+</match>`,
+	}
+
+	for _, s := range attempts {
+		fragment, err := fluentd.ParseString(s)
+		assert.Nil(t, err)
+
+		ctx := &ProcessorContext{
+			Namespace:           "demo",
+			ReservedTagPrefixes: []string{"fluent", "kubernetes", "kube", "systemd"},
+		}
+
+		_, err = Process(fragment, ctx, &reservedTagsState{})
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestReservedTagsPrefixMatchesWholeTagParts(t *testing.T) {
+	s := `
+<match **>
+  @type record_reformer
+  tag fluentbit.logs
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:           "demo",
+		ReservedTagPrefixes: []string{"fluent"},
+	}
+
+	fragment, err = Process(fragment, ctx, &reservedTagsState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "kube.demo.fluentbit.logs", fragment[0].Param("tag"))
+}
@@ -0,0 +1,149 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+const (
+	paramRetryMaxTimes = "retry_max_times"
+	paramRetryWait     = "retry_wait"
+	paramRetryTimeout  = "retry_timeout"
+	paramRetryForever  = "retry_forever"
+)
+
+// RetryPolicy holds the admin defaults and bounds of the buffer retry params. Zero values are unset,
+// times use the fluentd format
+type RetryPolicy struct {
+	DefaultMaxTimes int
+	MaxMaxTimes     int
+	DefaultWait     string
+	MinWait         string
+	DefaultTimeout  string
+	MaxTimeout      string
+}
+
+// IsEmpty tells if the policy neither sets defaults nor bounds
+func (p *RetryPolicy) IsEmpty() bool {
+	return p == nil || *p == RetryPolicy{}
+}
+
+// retryPolicyState fills in the missing retry params of every <buffer> with the admin defaults and
+// clamps the ones outside of the admin bounds
+type retryPolicyState struct {
+	BaseProcessorState
+}
+
+func (state *retryPolicyState) applyMaxTimes(d *fluentd.Directive, policy *RetryPolicy) error {
+	value := d.Param(paramRetryMaxTimes)
+	if value == "" {
+		if policy.DefaultMaxTimes > 0 {
+			d.SetParam(paramRetryMaxTimes, strconv.Itoa(policy.DefaultMaxTimes))
+		}
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%s must be a number, got '%s'", paramRetryMaxTimes, value)
+	}
+
+	if policy.MaxMaxTimes > 0 && n > policy.MaxMaxTimes {
+		logrus.Warnf("Lowering %s from %d to %d in namespace %s", paramRetryMaxTimes, n, policy.MaxMaxTimes, state.Context.Namespace)
+		d.SetParam(paramRetryMaxTimes, strconv.Itoa(policy.MaxMaxTimes))
+	}
+
+	return nil
+}
+
+// applyTime sets a time param to its default when missing, or to the bound when out of bounds
+// (below it when lower is true, above it otherwise)
+func (state *retryPolicyState) applyTime(d *fluentd.Directive, param string, def string, bound string, lower bool) error {
+	value := d.Param(param)
+	if value == "" {
+		if def != "" {
+			d.SetParam(param, def)
+		}
+		return nil
+	}
+
+	current, err := fluentd.ParseTime(value)
+	if err != nil {
+		return fmt.Errorf("bad %s: %v", param, err)
+	}
+
+	if bound == "" {
+		return nil
+	}
+
+	limit, err := fluentd.ParseTime(bound)
+	if err != nil {
+		return err
+	}
+
+	if (lower && current < limit) || (!lower && current > limit) {
+		logrus.Warnf("Changing %s from %s to %s in namespace %s", param, value, bound, state.Context.Namespace)
+		d.SetParam(param, bound)
+	}
+
+	return nil
+}
+
+func (state *retryPolicyState) applyPolicy(d *fluentd.Directive, policy *RetryPolicy) error {
+	if err := state.applyMaxTimes(d, policy); err != nil {
+		return err
+	}
+
+	if err := state.applyTime(d, paramRetryWait, policy.DefaultWait, policy.MinWait, true); err != nil {
+		return err
+	}
+
+	if err := state.applyTime(d, paramRetryTimeout, policy.DefaultTimeout, policy.MaxTimeout, false); err != nil {
+		return err
+	}
+
+	// retrying forever would defeat the bounds
+	if d.Param(paramRetryForever) == "true" && (policy.MaxMaxTimes > 0 || policy.MaxTimeout != "") {
+		logrus.Warnf("Disabling %s in namespace %s, retries are bounded by the cluster policy", paramRetryForever, state.Context.Namespace)
+		d.SetParam(paramRetryForever, "false")
+	}
+
+	wait, timeout := d.Param(paramRetryWait), d.Param(paramRetryTimeout)
+	if wait != "" && timeout != "" {
+		w, _ := fluentd.ParseTime(wait)
+		t, _ := fluentd.ParseTime(timeout)
+		if w > t {
+			return fmt.Errorf("%s %s is longer than %s %s", paramRetryWait, wait, paramRetryTimeout, timeout)
+		}
+	}
+
+	return nil
+}
+
+func (state *retryPolicyState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	policy := state.Context.RetryPolicy
+	if policy.IsEmpty() {
+		return input, nil
+	}
+
+	f := func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if d.Name != "buffer" {
+			return nil
+		}
+
+		return state.applyPolicy(d, policy)
+	}
+
+	err := applyRecursivelyInPlace(input, state.Context, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
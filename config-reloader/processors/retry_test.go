@@ -0,0 +1,130 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	s := `
+<match a.**>
+  @type elasticsearch
+  <buffer>
+    flush_interval 5s
+  </buffer>
+</match>
+
+<match b.**>
+  @type copy
+  <store>
+    @type s3
+    <buffer>
+      retry_max_times 100
+      retry_wait 0.1
+      retry_timeout 3d
+      retry_forever true
+    </buffer>
+  </store>
+</match>
+
+<match c.**>
+  @type null
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "flaky",
+		RetryPolicy: &RetryPolicy{
+			DefaultMaxTimes: 10,
+			MaxMaxTimes:     20,
+			DefaultWait:     "2s",
+			MinWait:         "1s",
+			DefaultTimeout:  "1h",
+			MaxTimeout:      "24h",
+		},
+	}
+
+	fragment, err = Process(fragment, ctx, &retryPolicyState{})
+	assert.Nil(t, err)
+
+	// missing params get the defaults
+	buf := fragment[0].Nested[0]
+	assert.Equal(t, "10", buf.Param("retry_max_times"))
+	assert.Equal(t, "2s", buf.Param("retry_wait"))
+	assert.Equal(t, "1h", buf.Param("retry_timeout"))
+	assert.Equal(t, "5s", buf.Param("flush_interval"))
+
+	// tenant values are clamped to the bounds
+	buf = fragment[1].Nested[0].Nested[0]
+	assert.Equal(t, "20", buf.Param("retry_max_times"))
+	assert.Equal(t, "1s", buf.Param("retry_wait"))
+	assert.Equal(t, "24h", buf.Param("retry_timeout"))
+	assert.Equal(t, "false", buf.Param("retry_forever"))
+
+	// outputs without a buffer are left alone
+	assert.Equal(t, 0, len(fragment[2].Nested))
+	assert.Equal(t, "", fragment[2].Param("retry_max_times"))
+}
+
+func TestRetryPolicyKeepsValuesWithinBounds(t *testing.T) {
+	s := `
+<match **>
+  @type elasticsearch
+  <buffer>
+    retry_max_times 5
+    retry_wait 10s
+    retry_timeout 30m
+  </buffer>
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace: "polite",
+		RetryPolicy: &RetryPolicy{
+			DefaultMaxTimes: 10,
+			MaxMaxTimes:     20,
+			MinWait:         "1s",
+			MaxTimeout:      "24h",
+		},
+	}
+
+	fragment, err = Process(fragment, ctx, &retryPolicyState{})
+	assert.Nil(t, err)
+
+	buf := fragment[0].Nested[0]
+	assert.Equal(t, "5", buf.Param("retry_max_times"))
+	assert.Equal(t, "10s", buf.Param("retry_wait"))
+	assert.Equal(t, "30m", buf.Param("retry_timeout"))
+}
+
+func TestRetryPolicyBadValues(t *testing.T) {
+	policy := &RetryPolicy{MaxMaxTimes: 20, MaxTimeout: "1h"}
+	for _, buffer := range []string{
+		"retry_max_times lots",
+		"retry_timeout forever",
+		"retry_wait 2h\n    retry_timeout 30m",
+	} {
+		fragment, err := fluentd.ParseString("<match **>\n  @type forward\n  <buffer>\n    " + buffer + "\n  </buffer>\n</match>\n")
+		assert.Nil(t, err)
+
+		ctx := &ProcessorContext{Namespace: "bad", RetryPolicy: policy}
+		_, err = Process(fragment, ctx, &retryPolicyState{})
+		assert.NotNil(t, err, buffer)
+	}
+
+	// without a policy nothing is checked
+	fragment, err := fluentd.ParseString("<match **>\n  @type forward\n  <buffer>\n    retry_max_times lots\n  </buffer>\n</match>\n")
+	assert.Nil(t, err)
+	_, err = Process(fragment, &ProcessorContext{Namespace: "bad"}, &retryPolicyState{})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,109 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+// containerSource is the stdout/stderr of the containers of a namespace, collected unless
+// the namespace selects its sources without it
+const containerSource = "container"
+
+// namespaceSourcesState emits the log sources a namespace selected from the ones defined by
+// the admin. They go to the main file like the other sources
+type namespaceSourcesState struct {
+	BaseProcessorState
+}
+
+// sourceTemplateModel is what an admin-defined source template is evaluated against
+type sourceTemplateModel struct {
+	Namespace string
+}
+
+func (state *namespaceSourcesState) Prepare(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if state.Context.Sources == nil {
+		return nil, nil
+	}
+
+	res := fluentd.Fragment{}
+	withContainers := false
+	for _, name := range state.Context.Sources {
+		if name == containerSource {
+			withContainers = true
+			continue
+		}
+
+		text, ok := state.Context.SourceTemplates[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown log source '%s', the available sources are: %s", name, strings.Join(state.availableSources(), ", "))
+		}
+
+		sources, err := state.renderSource(name, text)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sources...)
+	}
+
+	if !withContainers {
+		res = append(res, state.makeDropContainerLogsDirective())
+	}
+
+	return res, nil
+}
+
+func (state *namespaceSourcesState) availableSources() []string {
+	res := []string{containerSource}
+	for name := range state.Context.SourceTemplates {
+		res = append(res, name)
+	}
+	sort.Strings(res[1:])
+	return res
+}
+
+func (state *namespaceSourcesState) renderSource(name string, text string) (fluentd.Fragment, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("bad template of log source %s: %v", name, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, &sourceTemplateModel{Namespace: state.Context.Namespace}); err != nil {
+		return nil, fmt.Errorf("bad template of log source %s: %v", name, err)
+	}
+
+	fragment, err := fluentd.ParseString(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad config of log source %s: %v", name, err)
+	}
+
+	return fragment, nil
+}
+
+// makeDropContainerLogsDirective drops the container stdout/stderr of the namespace. Records of the
+// file sources carry the file path as stream and are kept
+func (state *namespaceSourcesState) makeDropContainerLogsDirective() *fluentd.Directive {
+	return &fluentd.Directive{
+		Name:   "filter",
+		Tag:    fmt.Sprintf("kube.%s.**", state.Context.Namespace),
+		Params: fluentd.ParamsFromKV("@type", "grep"),
+		Nested: fluentd.Fragment{
+			{
+				Name:   "exclude",
+				Params: fluentd.ParamsFromKV("key", "stream", "pattern", "/^(stdout|stderr)$/"),
+			},
+		},
+	}
+}
+
+func (state *namespaceSourcesState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	return input, nil
+}
@@ -0,0 +1,63 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const systemdSourceTemplate = `
+<source>
+  @type systemd
+  path /var/log/journal
+  matchers [{"_SYSTEMD_UNIT": "docker.service"}]
+  tag kube.{{ .Namespace }}.systemd.docker
+</source>
+`
+
+func TestNamespaceSources(t *testing.T) {
+	ctx := &ProcessorContext{
+		Namespace:       "infra",
+		Sources:         []string{"container", "systemd"},
+		SourceTemplates: map[string]string{"systemd": systemdSourceTemplate},
+	}
+
+	prep, err := Prepare(fluentd.Fragment{}, ctx, &namespaceSourcesState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(prep))
+	assert.Equal(t, "source", prep[0].Name)
+	assert.Equal(t, "kube.infra.systemd.docker", prep[0].Param("tag"))
+
+	// without container the stdout of the containers is dropped
+	ctx.Sources = []string{"systemd"}
+	prep, err = Prepare(fluentd.Fragment{}, ctx, &namespaceSourcesState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(prep))
+	assert.Equal(t, "filter", prep[1].Name)
+	assert.Equal(t, "kube.infra.**", prep[1].Tag)
+	assert.Equal(t, "grep", prep[1].Type())
+	assert.Equal(t, "stream", prep[1].Nested[0].Param("key"))
+
+	// nothing selected, nothing changes
+	ctx.Sources = nil
+	prep, err = Prepare(fluentd.Fragment{}, ctx, &namespaceSourcesState{})
+	assert.Nil(t, err)
+	assert.Empty(t, prep)
+}
+
+func TestNamespaceSourcesUnknown(t *testing.T) {
+	ctx := &ProcessorContext{
+		Namespace:       "infra",
+		Sources:         []string{"container", "kernel"},
+		SourceTemplates: map[string]string{"systemd": systemdSourceTemplate},
+	}
+
+	_, err := Prepare(fluentd.Fragment{}, ctx, &namespaceSourcesState{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "unknown log source 'kernel', the available sources are: container, systemd", err.Error())
+}
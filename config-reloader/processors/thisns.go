@@ -42,7 +42,7 @@ func (p *expandThisnsMacroState) Process(input fluentd.Fragment) (fluentd.Fragme
 			return nil
 		}
 
-		if strings.HasPrefix(d.Tag, macroLabels) || strings.HasPrefix(d.Tag, macroUniqueTag) {
+		if isLabelsMacro(d.Tag) || strings.HasPrefix(d.Tag, macroUniqueTag) {
 			// Let other processors handle this
 			return nil
 		}
@@ -0,0 +1,71 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+)
+
+const timeRecordKey = "time"
+
+// timeFormatState rewrites the time field of all container logs of a namespace in the format set by
+// the admin. The filter goes to the main file so it runs before any processing done by the namespace
+type timeFormatState struct {
+	BaseProcessorState
+}
+
+// setsTimeField tells if the namespace already writes the time field itself in a <record> section
+func setsTimeField(input fluentd.Fragment) bool {
+	found := false
+	applyRecursivelyInPlace(input, nil, func(d *fluentd.Directive, ctx *ProcessorContext) error {
+		if d.Name == "record" && d.Param(timeRecordKey) != "" {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func (state *timeFormatState) Prepare(input fluentd.Fragment) (fluentd.Fragment, error) {
+	if state.Context.DefaultTimeFormat == "" {
+		return nil, nil
+	}
+
+	if setsTimeField(input) {
+		logrus.Debugf("Namespace %s sets the %s field itself, not normalizing it", state.Context.Namespace, timeRecordKey)
+		return nil, nil
+	}
+
+	localTime := "time"
+	switch tz := state.Context.DefaultTimezone; tz {
+	case "":
+	case "UTC":
+		localTime = "time.getutc"
+	default:
+		localTime = fmt.Sprintf("time.getlocal('%s')", tz)
+	}
+
+	filter := &fluentd.Directive{
+		Name:   "filter",
+		Tag:    fmt.Sprintf("kube.%s.**", state.Context.Namespace),
+		Params: fluentd.ParamsFromKV("@type", "record_transformer"),
+		Nested: fluentd.Fragment{
+			{
+				Name:   "record",
+				Params: fluentd.Params{},
+			},
+		},
+	}
+	filter.SetParam("enable_ruby", "true")
+	filter.Nested[0].SetParam(timeRecordKey, fmt.Sprintf("${%s.strftime('%s')}", localTime, state.Context.DefaultTimeFormat))
+
+	return fluentd.Fragment{filter}, nil
+}
+
+func (state *timeFormatState) Process(input fluentd.Fragment) (fluentd.Fragment, error) {
+	return input, nil
+}
@@ -0,0 +1,76 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/fluentd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeFormat(t *testing.T) {
+	s := `
+<match **>
+  @type null
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:         "shop",
+		DefaultTimeFormat: "%Y-%m-%dT%H:%M:%S.%L%z",
+		DefaultTimezone:   "+02:00",
+	}
+
+	prep, err := Prepare(fragment, ctx, &timeFormatState{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(prep))
+
+	filter := prep[0]
+	assert.Equal(t, "kube.shop.**", filter.Tag)
+	assert.Equal(t, "record_transformer", filter.Type())
+	assert.Equal(t, "true", filter.Param("enable_ruby"))
+	assert.Equal(t, "${time.getlocal('+02:00').strftime('%Y-%m-%dT%H:%M:%S.%L%z')}", filter.Nested[0].Param("time"))
+
+	ctx.DefaultTimezone = "UTC"
+	prep, err = Prepare(fragment, ctx, &timeFormatState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "${time.getutc.strftime('%Y-%m-%dT%H:%M:%S.%L%z')}", prep[0].Nested[0].Param("time"))
+
+	// no format, nothing to do
+	ctx.DefaultTimeFormat = ""
+	prep, err = Prepare(fragment, ctx, &timeFormatState{})
+	assert.Nil(t, err)
+	assert.Empty(t, prep)
+}
+
+func TestTimeFormatSkipsNamespacesSettingTheTime(t *testing.T) {
+	s := `
+<filter **>
+  @type record_transformer
+  enable_ruby true
+  <record>
+    time ${time.to_i}
+  </record>
+</filter>
+
+<match **>
+  @type null
+</match>
+`
+	fragment, err := fluentd.ParseString(s)
+	assert.Nil(t, err)
+
+	ctx := &ProcessorContext{
+		Namespace:         "shop",
+		DefaultTimeFormat: "%FT%T%z",
+	}
+
+	prep, err := Prepare(fragment, ctx, &timeFormatState{})
+	assert.Nil(t, err)
+	assert.Empty(t, prep)
+}
@@ -0,0 +1,139 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package stateapi
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// StateReader returns the statuses of the namespaces processed by the last run, keyed by namespace.
+// It is called from the gRPC goroutines
+type StateReader interface {
+	NamespaceStates() map[string]*datasource.NamespaceStatus
+}
+
+// Server serves the NamespaceStates gRPC service
+type Server struct {
+	UnimplementedNamespaceStatesServer
+	states StateReader
+	source string
+}
+
+// New creates a server reading the statuses from states. source tells where the namespace
+// configs are read from
+func New(states StateReader, source string) *Server {
+	return &Server{
+		states: states,
+		source: source,
+	}
+}
+
+func (s *Server) toState(namespace string, st *datasource.NamespaceStatus) *NamespaceState {
+	return &NamespaceState{
+		Namespace:   namespace,
+		Status:      st.Status,
+		Phase:       st.Phase,
+		Message:     st.Message,
+		Hash:        st.Hash,
+		LastApplied: st.LastApplied,
+		Source:      s.source,
+	}
+}
+
+// GetNamespaceState implements NamespaceStatesServer
+func (s *Server) GetNamespaceState(ctx context.Context, req *GetNamespaceStateRequest) (*NamespaceState, error) {
+	if req.GetNamespace() == "" {
+		return nil, status.Error(codes.InvalidArgument, "namespace is required")
+	}
+
+	st, ok := s.states.NamespaceStates()[req.GetNamespace()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "namespace %s is not processed", req.GetNamespace())
+	}
+
+	return s.toState(req.GetNamespace(), st), nil
+}
+
+// ListNamespaceStates implements NamespaceStatesServer
+func (s *Server) ListNamespaceStates(ctx context.Context, req *ListNamespaceStatesRequest) (*ListNamespaceStatesResponse, error) {
+	states := s.states.NamespaceStates()
+
+	res := &ListNamespaceStatesResponse{States: make([]*NamespaceState, 0, len(states))}
+	for ns, st := range states {
+		res.States = append(res.States, s.toState(ns, st))
+	}
+	sort.Slice(res.States, func(i, j int) bool { return res.States[i].Namespace < res.States[j].Namespace })
+
+	return res, nil
+}
+
+// ServerOptions returns the options securing the server like the HTTP endpoints: TLS with the
+// certificate of the gate and its bearer token in the authorization metadata of every call
+func ServerOptions(gate *httpauth.Gate) ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+	if gate == nil {
+		return opts, nil
+	}
+
+	if gate.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(gate.CertFile, gate.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	opts = append(opts, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var authorization string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				authorization = values[0]
+			}
+		}
+		if err := gate.Authorize(ctx, authorization); err != nil {
+			logrus.Debugf("Rejecting %s: %v", info.FullMethod, err)
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(ctx, req)
+	}))
+
+	return opts, nil
+}
+
+// Start serves the gRPC API on addr in the background, secured by the gate
+func (s *Server) Start(addr string, gate *httpauth.Gate) error {
+	opts, err := ServerOptions(gate)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(opts...)
+	RegisterNamespaceStatesServer(srv, s)
+
+	go func() {
+		logrus.Infof("Serving the namespace states gRPC API on %s", addr)
+		if err := srv.Serve(lis); err != nil {
+			logrus.Errorf("gRPC server stopped: %+v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package stateapi
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/httpauth"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type staticStates map[string]*datasource.NamespaceStatus
+
+func (s staticStates) NamespaceStates() map[string]*datasource.NamespaceStatus {
+	return s
+}
+
+func dial(t *testing.T, states StateReader, opts ...grpc.ServerOption) NamespaceStatesClient {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(opts...)
+	RegisterNamespaceStatesServer(srv, New(states, "configmap"))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewNamespaceStatesClient(conn)
+}
+
+func TestNamespaceStates(t *testing.T) {
+	client := dial(t, staticStates{
+		"web": {Status: datasource.StatusOK, Hash: "abc", LastApplied: "2021-11-30T10:00:00Z"},
+		"api": {Status: datasource.StatusError, Phase: datasource.ErrorPhaseValidation, Message: "bad config", Hash: "def"},
+	})
+	ctx := context.Background()
+
+	st, err := client.GetNamespaceState(ctx, &GetNamespaceStateRequest{Namespace: "web"})
+	assert.Nil(t, err)
+	assert.Equal(t, "web", st.Namespace)
+	assert.Equal(t, "ok", st.Status)
+	assert.Equal(t, "abc", st.Hash)
+	assert.Equal(t, "2021-11-30T10:00:00Z", st.LastApplied)
+	assert.Equal(t, "configmap", st.Source)
+
+	_, err = client.GetNamespaceState(ctx, &GetNamespaceStateRequest{Namespace: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetNamespaceState(ctx, &GetNamespaceStateRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := client.ListNamespaceStates(ctx, &ListNamespaceStatesRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list.States))
+	assert.Equal(t, "api", list.States[0].Namespace)
+	assert.Equal(t, "ValidationError", list.States[0].Phase)
+	assert.Equal(t, "bad config", list.States[0].Message)
+	assert.Equal(t, "web", list.States[1].Namespace)
+}
+
+func TestNamespaceStatesNeedToken(t *testing.T) {
+	opts, err := ServerOptions(&httpauth.Gate{Token: "s3cret"})
+	assert.Nil(t, err)
+	client := dial(t, staticStates{"web": {Status: datasource.StatusOK}}, opts...)
+	ctx := context.Background()
+
+	_, err = client.ListNamespaceStates(ctx, &ListNamespaceStatesRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.GetNamespaceState(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"), &GetNamespaceStateRequest{Namespace: "web"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	st, err := client.GetNamespaceState(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer s3cret"), &GetNamespaceStateRequest{Namespace: "web"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", st.Status)
+}
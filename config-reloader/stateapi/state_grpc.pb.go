@@ -0,0 +1,141 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package stateapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// NamespaceStatesClient is the client API for NamespaceStates service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type NamespaceStatesClient interface {
+	// GetNamespaceState returns the state of one namespace, NOT_FOUND if it is not processed
+	GetNamespaceState(ctx context.Context, in *GetNamespaceStateRequest, opts ...grpc.CallOption) (*NamespaceState, error)
+	// ListNamespaceStates returns the states of all processed namespaces sorted by name
+	ListNamespaceStates(ctx context.Context, in *ListNamespaceStatesRequest, opts ...grpc.CallOption) (*ListNamespaceStatesResponse, error)
+}
+
+type namespaceStatesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNamespaceStatesClient(cc grpc.ClientConnInterface) NamespaceStatesClient {
+	return &namespaceStatesClient{cc}
+}
+
+func (c *namespaceStatesClient) GetNamespaceState(ctx context.Context, in *GetNamespaceStateRequest, opts ...grpc.CallOption) (*NamespaceState, error) {
+	out := new(NamespaceState)
+	err := c.cc.Invoke(ctx, "/kfo.state.v1.NamespaceStates/GetNamespaceState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *namespaceStatesClient) ListNamespaceStates(ctx context.Context, in *ListNamespaceStatesRequest, opts ...grpc.CallOption) (*ListNamespaceStatesResponse, error) {
+	out := new(ListNamespaceStatesResponse)
+	err := c.cc.Invoke(ctx, "/kfo.state.v1.NamespaceStates/ListNamespaceStates", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NamespaceStatesServer is the server API for NamespaceStates service.
+// All implementations must embed UnimplementedNamespaceStatesServer
+// for forward compatibility
+type NamespaceStatesServer interface {
+	// GetNamespaceState returns the state of one namespace, NOT_FOUND if it is not processed
+	GetNamespaceState(context.Context, *GetNamespaceStateRequest) (*NamespaceState, error)
+	// ListNamespaceStates returns the states of all processed namespaces sorted by name
+	ListNamespaceStates(context.Context, *ListNamespaceStatesRequest) (*ListNamespaceStatesResponse, error)
+	mustEmbedUnimplementedNamespaceStatesServer()
+}
+
+// UnimplementedNamespaceStatesServer must be embedded to have forward compatible implementations.
+type UnimplementedNamespaceStatesServer struct {
+}
+
+func (UnimplementedNamespaceStatesServer) GetNamespaceState(context.Context, *GetNamespaceStateRequest) (*NamespaceState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNamespaceState not implemented")
+}
+func (UnimplementedNamespaceStatesServer) ListNamespaceStates(context.Context, *ListNamespaceStatesRequest) (*ListNamespaceStatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNamespaceStates not implemented")
+}
+func (UnimplementedNamespaceStatesServer) mustEmbedUnimplementedNamespaceStatesServer() {}
+
+// UnsafeNamespaceStatesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NamespaceStatesServer will
+// result in compilation errors.
+type UnsafeNamespaceStatesServer interface {
+	mustEmbedUnimplementedNamespaceStatesServer()
+}
+
+func RegisterNamespaceStatesServer(s grpc.ServiceRegistrar, srv NamespaceStatesServer) {
+	s.RegisterService(&NamespaceStates_ServiceDesc, srv)
+}
+
+func _NamespaceStates_GetNamespaceState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNamespaceStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NamespaceStatesServer).GetNamespaceState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kfo.state.v1.NamespaceStates/GetNamespaceState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NamespaceStatesServer).GetNamespaceState(ctx, req.(*GetNamespaceStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NamespaceStates_ListNamespaceStates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNamespaceStatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NamespaceStatesServer).ListNamespaceStates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kfo.state.v1.NamespaceStates/ListNamespaceStates",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NamespaceStatesServer).ListNamespaceStates(ctx, req.(*ListNamespaceStatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// NamespaceStates_ServiceDesc is the grpc.ServiceDesc for NamespaceStates service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NamespaceStates_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kfo.state.v1.NamespaceStates",
+	HandlerType: (*NamespaceStatesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetNamespaceState",
+			Handler:    _NamespaceStates_GetNamespaceState_Handler,
+		},
+		{
+			MethodName: "ListNamespaceStates",
+			Handler:    _NamespaceStates_ListNamespaceStates_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "state.proto",
+}
@@ -9,7 +9,9 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -109,8 +111,46 @@ func ExecAndGetOutput(cmd string, timeout time.Duration, args ...string) (string
 	return string(out), err
 }
 
+// WriteStringToFile replaces the file atomically: the data is written to a temp file in the
+// same directory which is then renamed, so readers see either the old or the new content
 func WriteStringToFile(filename string, data string) error {
-	return ioutil.WriteFile(filename, []byte(data), maskFile)
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	// no-op once the rename succeeded
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), maskFile); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// WriteStringToFileIfChanged writes the file only if its content differs, leaving the
+// modification time of unchanged files alone. It reports whether the file was written
+func WriteStringToFileIfChanged(filename string, data string) (bool, error) {
+	if existing, err := ioutil.ReadFile(filename); err == nil && string(existing) == data {
+		return false, nil
+	}
+
+	return true, WriteStringToFile(filename, data)
 }
 
 func TrimTrailingComment(line string) string {
@@ -123,3 +163,34 @@ func TrimTrailingComment(line string) string {
 
 	return line
 }
+
+// Labels put on the objects the operator creates
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "kube-fluentd-operator"
+	// tells which operator deployment (--id) created the object
+	InstanceLabel = "app.kubernetes.io/instance"
+)
+
+// ManagedLabels returns the labels marking an object created by the operator deployment with the given id
+func ManagedLabels(id string) map[string]string {
+	return map[string]string{
+		ManagedByLabel: ManagedByValue,
+		InstanceLabel:  id,
+	}
+}
+
+// IsManaged tells if an object with these labels was created by the operator
+func IsManaged(labels map[string]string) bool {
+	return labels[ManagedByLabel] == ManagedByValue
+}
+
+// NotifyUpdate asks the controller for a run without blocking. There is already one pending
+// notification when the send fails, useless to send another one since all new changes will be
+// reloaded by the pending one
+func NotifyUpdate(updateChan chan time.Time) {
+	select {
+	case updateChan <- time.Now():
+	default:
+	}
+}
@@ -4,6 +4,10 @@
 package util
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,3 +45,74 @@ func TestTrimTrailingComment(t *testing.T) {
 	assert.Equal(t, "a", TrimTrailingComment("a"))
 	assert.Equal(t, "a", TrimTrailingComment("a#########"))
 }
+
+func TestWriteStringToFileIsAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "fluent.conf")
+	contents := []string{
+		strings.Repeat("a", 1024*1024),
+		strings.Repeat("b", 2*1024*1024),
+	}
+	assert.Nil(t, WriteStringToFile(filename, contents[0]))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := WriteStringToFile(filename, contents[i%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+
+		data, err := ioutil.ReadFile(filename)
+		assert.Nil(t, err)
+		if string(data) != contents[0] && string(data) != contents[1] {
+			t.Fatalf("observed a partial file of %d bytes", len(data))
+		}
+	}
+
+	// no temp files are left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(maskFile), info.Mode().Perm())
+}
+
+func TestWriteStringToFileIfChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ifchanged")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "ns-a.conf")
+
+	written, err := WriteStringToFileIfChanged(filename, "a")
+	assert.Nil(t, err)
+	assert.True(t, written)
+
+	written, err = WriteStringToFileIfChanged(filename, "a")
+	assert.Nil(t, err)
+	assert.False(t, written)
+
+	written, err = WriteStringToFileIfChanged(filename, "b")
+	assert.Nil(t, err)
+	assert.True(t, written)
+
+	data, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(data))
+}
@@ -0,0 +1,161 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	kfo "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/apis/logs.vdp.vmware.com/v1beta1"
+
+	"github.com/sirupsen/logrus"
+	admission "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	validatePath = "/validate"
+
+	// the configmap entry read by the configmap datasources
+	configMapEntryName = "fluent.conf"
+)
+
+// NamespaceValidator validates the fluentd config of a single namespace
+type NamespaceValidator interface {
+	ValidateNamespace(ns *datasource.NamespaceConfig) error
+}
+
+// Server is a validating admission webhook rejecting fluentd configs that
+// would fail processing or fluentd validation
+type Server struct {
+	cfg       *config.Config
+	validator NamespaceValidator
+	// nil if the labels and annotations of the namespaces cannot be read
+	namespaces datasource.NamespaceMetadataReader
+}
+
+// New creates a webhook server backed by the given validator
+func New(ctx context.Context, cfg *config.Config, validator NamespaceValidator) *Server {
+	return &Server{
+		cfg:       cfg,
+		validator: validator,
+	}
+}
+
+// SetNamespaceMetadataReader makes the configs validated with the labels and annotations of their
+// namespace, like in a run. nil reader is fine
+func (s *Server) SetNamespaceMetadataReader(r datasource.NamespaceMetadataReader) {
+	s.namespaces = r
+}
+
+// Start serves the webhook over TLS in the background
+func (s *Server) Start() {
+	mux := http.NewServeMux()
+	mux.HandleFunc(validatePath, s.handleValidate)
+	srv := &http.Server{
+		Addr:    s.cfg.WebhookAddr,
+		Handler: mux,
+	}
+
+	go func() {
+		logrus.Infof("Serving admission webhook on %s%s", s.cfg.WebhookAddr, validatePath)
+		if err := srv.ListenAndServeTLS(s.cfg.WebhookCertFile, s.cfg.WebhookKeyFile); err != nil {
+			logrus.Errorf("Admission webhook stopped: %+v", err)
+		}
+	}()
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &admission.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("cannot decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review.Response = s.review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	resp, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *Server) review(req *admission.AdmissionRequest) *admission.AdmissionResponse {
+	if req.Operation == admission.Delete || req.Namespace == s.cfg.AdminNamespace {
+		// the admin namespace is never validated
+		return &admission.AdmissionResponse{Allowed: true}
+	}
+
+	fluentdConfig, err := extractFluentdConfig(req)
+	if err != nil {
+		return deny(err)
+	}
+
+	nsConf := &datasource.NamespaceConfig{
+		Name:          req.Namespace,
+		FluentdConfig: fluentdConfig,
+	}
+	if s.namespaces != nil {
+		// a namespace created by the same apply is not known yet, its config is validated without them
+		if labels, annotations, err := s.namespaces.NamespaceMetadata(req.Namespace); err == nil {
+			nsConf.Labels, nsConf.Annotations = labels, annotations
+		}
+	}
+
+	err = s.validator.ValidateNamespace(nsConf)
+	if err != nil {
+		logrus.Infof("Rejecting %s %s/%s: %+v", req.Kind.Kind, req.Namespace, req.Name, err)
+		return deny(err)
+	}
+
+	return &admission.AdmissionResponse{Allowed: true}
+}
+
+func extractFluentdConfig(req *admission.AdmissionRequest) (string, error) {
+	switch req.Kind.Kind {
+	case "FluentdConfig":
+		fc := &kfo.FluentdConfig{}
+		if err := json.Unmarshal(req.Object.Raw, fc); err != nil {
+			return "", fmt.Errorf("cannot decode FluentdConfig: %v", err)
+		}
+		return fc.Spec.FluentConf, nil
+	case "ConfigMap":
+		cm := &core.ConfigMap{}
+		if err := json.Unmarshal(req.Object.Raw, cm); err != nil {
+			return "", fmt.Errorf("cannot decode ConfigMap: %v", err)
+		}
+		return cm.Data[configMapEntryName], nil
+	}
+
+	return "", fmt.Errorf("unsupported kind %s", req.Kind.Kind)
+}
+
+func deny(err error) *admission.AdmissionResponse {
+	return &admission.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonInvalid,
+		},
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/vmware/kube-fluentd-operator/config-reloader/config"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/datasource"
+	kfo "github.com/vmware/kube-fluentd-operator/config-reloader/datasource/kubedatasource/fluentdconfig/apis/logs.vdp.vmware.com/v1beta1"
+	"github.com/vmware/kube-fluentd-operator/config-reloader/generator"
+
+	"github.com/stretchr/testify/assert"
+	admission "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type staticNamespaces map[string]map[string]string
+
+func (s staticNamespaces) NamespaceMetadata(namespace string) (map[string]string, map[string]string, error) {
+	labels, ok := s[namespace]
+	if !ok {
+		return nil, nil, errors.New("not found")
+	}
+	return labels, nil, nil
+}
+
+func fluentdConfigRequest(t *testing.T, namespace string, fluentConf string) *admission.AdmissionRequest {
+	raw, err := json.Marshal(&kfo.FluentdConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "fd-config", Namespace: namespace},
+		Spec:       kfo.FluentdConfigSpec{FluentConf: fluentConf},
+	})
+	assert.Nil(t, err)
+
+	return &admission.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Group: "logs.vdp.vmware.com", Version: "v1beta1", Kind: "FluentdConfig"},
+		Namespace: namespace,
+		Name:      "fd-config",
+		Operation: admission.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestReviewFluentdConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:     "../templates",
+		AdminNamespace:   "kube-system",
+		StrictTemplating: true,
+	}
+	s := New(ctx, cfg, generator.New(ctx, cfg))
+
+	resp := s.review(fluentdConfigRequest(t, "demo", "<match **>\n  @type null\n</match>\n"))
+	assert.True(t, resp.Allowed)
+
+	resp = s.review(fluentdConfigRequest(t, "demo", "<match hello-world>\n  @type null\n</match>\n"))
+	assert.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Message, "hello-world")
+
+	// the admin namespace is never validated
+	resp = s.review(fluentdConfigRequest(t, "kube-system", "<match hello-world>\n  @type null\n</match>\n"))
+	assert.True(t, resp.Allowed)
+}
+
+func TestReviewUsesNamespaceLabels(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TemplatesDir:     "../templates",
+		AdminNamespace:   "kube-system",
+		StrictTemplating: true,
+	}
+	s := New(ctx, cfg, generator.New(ctx, cfg))
+	conf := "<match **>\n  @type null\n  @id ${namespace_labels['team']}\n</match>\n"
+
+	// the label is missing without the namespace
+	resp := s.review(fluentdConfigRequest(t, "demo", conf))
+	assert.False(t, resp.Allowed)
+
+	s.SetNamespaceMetadataReader(staticNamespaces{"demo": {"team": "payments"}})
+	resp = s.review(fluentdConfigRequest(t, "demo", conf))
+	assert.True(t, resp.Allowed, "%+v", resp.Result)
+}
+
+var _ datasource.NamespaceMetadataReader = staticNamespaces{}